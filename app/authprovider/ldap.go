@@ -0,0 +1,206 @@
+package authprovider
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Aryma-f4/uas-backend/app/entity"
+	"github.com/go-ldap/ldap/v3"
+)
+
+// LDAPProviderName is the auth_provider value of directory users.
+const LDAPProviderName = "ldap"
+
+// GroupRole maps members of a directory group to a role.
+type GroupRole struct {
+	Group string
+	Role  string
+}
+
+// LDAPConfig of a directory. UserFilter is a fmt format with the escaped
+// login identifier as its only argument. With GroupRoles set, only members
+// of a mapped group may log in; the first listed group of the user wins.
+type LDAPConfig struct {
+	URL               string
+	StartTLS          bool
+	BindDN            string
+	BindPassword      string
+	BaseDN            string
+	UserFilter        string
+	UsernameAttribute string
+	GroupAttribute    string
+	GroupRoles        []GroupRole
+	Timeout           time.Duration
+	TLSConfig         *tls.Config
+}
+
+// LDAPProvider authenticates by searching the user's entry, with the
+// service account if one is configured, and binding as that entry.
+type LDAPProvider struct {
+	config LDAPConfig
+}
+
+func NewLDAPProvider(cfg LDAPConfig) *LDAPProvider {
+	if cfg.UserFilter == "" {
+		cfg.UserFilter = "(|(uid=%[1]s)(mail=%[1]s))"
+	}
+	if cfg.UsernameAttribute == "" {
+		cfg.UsernameAttribute = "uid"
+	}
+	if cfg.GroupAttribute == "" {
+		cfg.GroupAttribute = "memberOf"
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	return &LDAPProvider{config: cfg}
+}
+
+func (p *LDAPProvider) Name() string {
+	return LDAPProviderName
+}
+
+func (p *LDAPProvider) Authenticate(ctx context.Context, user *entity.User, identifier, password string) (*Identity, error) {
+	// An empty password would be an unauthenticated bind, which succeeds
+	if password == "" {
+		return nil, ErrInvalidCredentials
+	}
+	if user != nil {
+		identifier = user.Username
+	}
+
+	conn, err := p.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if p.config.BindDN != "" {
+		if err := conn.Bind(p.config.BindDN, p.config.BindPassword); err != nil {
+			return nil, fmt.Errorf("ldap service bind: %w", err)
+		}
+	}
+
+	request := ldap.NewSearchRequest(
+		p.config.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, int(p.config.Timeout.Seconds()), false,
+		fmt.Sprintf(p.config.UserFilter, ldap.EscapeFilter(identifier)),
+		[]string{p.config.UsernameAttribute, "mail", "displayName", "cn", p.config.GroupAttribute},
+		nil,
+	)
+	result, err := conn.Search(request)
+	if err != nil && !ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+		return nil, fmt.Errorf("ldap search: %w", err)
+	}
+	// Unknown and ambiguous identifiers are both rejected
+	if result == nil || len(result.Entries) != 1 {
+		return nil, ErrInvalidCredentials
+	}
+	entry := result.Entries[0]
+
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, fmt.Errorf("ldap bind: %w", err)
+	}
+
+	identity := &Identity{
+		Username: entry.GetEqualFoldAttributeValue(p.config.UsernameAttribute),
+		Email:    entry.GetEqualFoldAttributeValue("mail"),
+		FullName: entry.GetEqualFoldAttributeValue("displayName"),
+		Groups:   entry.GetEqualFoldAttributeValues(p.config.GroupAttribute),
+	}
+	if identity.FullName == "" {
+		identity.FullName = entry.GetEqualFoldAttributeValue("cn")
+	}
+	if identity.Username == "" {
+		identity.Username = identifier
+	}
+
+	if len(p.config.GroupRoles) > 0 {
+		identity.Role = p.roleOf(identity.Groups)
+		if identity.Role == "" {
+			return nil, ErrNoRole
+		}
+	}
+	return identity, nil
+}
+
+func (p *LDAPProvider) dial(ctx context.Context) (*ldap.Conn, error) {
+	timeout := p.config.Timeout
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < timeout {
+		timeout = time.Until(deadline)
+	}
+
+	options := []ldap.DialOpt{}
+	if p.config.TLSConfig != nil {
+		options = append(options, ldap.DialWithTLSConfig(p.config.TLSConfig))
+	}
+	conn, err := ldap.DialURL(p.config.URL, options...)
+	if err != nil {
+		return nil, fmt.Errorf("ldap dial: %w", err)
+	}
+	conn.SetTimeout(timeout)
+
+	if p.config.StartTLS {
+		tlsConfig := p.config.TLSConfig
+		if tlsConfig == nil {
+			tlsConfig = &tls.Config{}
+		}
+		if tlsConfig.ServerName == "" {
+			if u, err := url.Parse(p.config.URL); err == nil {
+				tlsConfig = tlsConfig.Clone()
+				tlsConfig.ServerName = u.Hostname()
+			}
+		}
+		if err := conn.StartTLS(tlsConfig); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("ldap starttls: %w", err)
+		}
+	}
+	return conn, nil
+}
+
+// roleOf returns the role of the first mapped group the user is in.
+func (p *LDAPProvider) roleOf(groups []string) string {
+	for _, mapping := range p.config.GroupRoles {
+		want, err := ldap.ParseDN(mapping.Group)
+		for _, group := range groups {
+			if err != nil {
+				if strings.EqualFold(mapping.Group, group) {
+					return mapping.Role
+				}
+				continue
+			}
+			if got, err := ldap.ParseDN(group); err == nil && want.EqualFold(got) {
+				return mapping.Role
+			}
+		}
+	}
+	return ""
+}
+
+// ParseGroupRoles parses a group to role mapping written as
+// "Role:group dn;Role:group dn", e.g.
+// "Admin:cn=admins,ou=groups,dc=example,dc=ac,dc=id".
+func ParseGroupRoles(s string) ([]GroupRole, error) {
+	var mappings []GroupRole
+	for _, item := range strings.Split(s, ";") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		role, group, ok := strings.Cut(item, ":")
+		role, group = strings.TrimSpace(role), strings.TrimSpace(group)
+		if !ok || role == "" || group == "" {
+			return nil, errors.New("group role mapping must be written as Role:group dn")
+		}
+		mappings = append(mappings, GroupRole{Group: group, Role: role})
+	}
+	return mappings, nil
+}
@@ -0,0 +1,294 @@
+package authprovider
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+)
+
+const (
+	testBaseDN          = "dc=example,dc=ac,dc=id"
+	testServiceDN       = "cn=svc,ou=services,dc=example,dc=ac,dc=id"
+	testServicePassword = "svc-secret"
+	testAdminsGroup     = "cn=admins,ou=groups,dc=example,dc=ac,dc=id"
+	testLecturersGroup  = "cn=lecturers,ou=groups,dc=example,dc=ac,dc=id"
+)
+
+type testEntry struct {
+	dn       string
+	password string
+	attrs    map[string][]string
+}
+
+// testDirectory is an in-process LDAP server speaking just enough of the
+// protocol for the provider: simple binds, subtree searches matched on uid
+// and mail, and unbind.
+type testDirectory struct {
+	listener net.Listener
+	entries  []testEntry
+
+	mu       sync.Mutex
+	searches []string
+}
+
+func newTestDirectory(t *testing.T) *testDirectory {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := &testDirectory{
+		listener: listener,
+		entries: []testEntry{
+			{
+				dn:       "uid=budi,ou=people,dc=example,dc=ac,dc=id",
+				password: "budi-pass",
+				attrs: map[string][]string{
+					"uid":         {"budi"},
+					"mail":        {"budi@ft.example.ac.id"},
+					"displayName": {"Budi Santoso"},
+					"memberOf":    {"CN=Lecturers,OU=Groups,DC=example,DC=ac,DC=id"},
+				},
+			},
+			{
+				dn:       "uid=sari,ou=people,dc=example,dc=ac,dc=id",
+				password: "sari-pass",
+				attrs: map[string][]string{
+					"uid":      {"sari"},
+					"mail":     {"sari@ft.example.ac.id"},
+					"cn":       {"Sari"},
+					"memberOf": {testAdminsGroup, testLecturersGroup},
+				},
+			},
+			{
+				dn:       "uid=tamu,ou=people,dc=example,dc=ac,dc=id",
+				password: "tamu-pass",
+				attrs: map[string][]string{
+					"uid":  {"tamu"},
+					"mail": {"tamu@ft.example.ac.id"},
+				},
+			},
+		},
+	}
+	go d.accept()
+	t.Cleanup(func() { listener.Close() })
+	return d
+}
+
+func (d *testDirectory) url() string {
+	return "ldap://" + d.listener.Addr().String()
+}
+
+func (d *testDirectory) accept() {
+	for {
+		conn, err := d.listener.Accept()
+		if err != nil {
+			return
+		}
+		go d.serve(conn)
+	}
+}
+
+func (d *testDirectory) serve(conn net.Conn) {
+	defer conn.Close()
+	bound := false
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil || len(packet.Children) < 2 {
+			return
+		}
+		messageID, _ := packet.Children[0].Value.(int64)
+		op := packet.Children[1]
+
+		switch op.Tag {
+		case ldap.ApplicationBindRequest:
+			name, _ := op.Children[1].Value.(string)
+			password := op.Children[2].Data.String()
+			code := ldap.LDAPResultInvalidCredentials
+			if d.checkBind(name, password) {
+				code, bound = ldap.LDAPResultSuccess, true
+			}
+			conn.Write(result(messageID, ldap.ApplicationBindResponse, code).Bytes())
+
+		case ldap.ApplicationSearchRequest:
+			if !bound {
+				conn.Write(result(messageID, ldap.ApplicationSearchResultDone, ldap.LDAPResultInsufficientAccessRights).Bytes())
+				continue
+			}
+			filter, _ := ldap.DecompileFilter(op.Children[6])
+			d.mu.Lock()
+			d.searches = append(d.searches, filter)
+			d.mu.Unlock()
+			for _, entry := range d.entries {
+				if matches(entry, filter) {
+					conn.Write(searchEntry(messageID, entry).Bytes())
+				}
+			}
+			conn.Write(result(messageID, ldap.ApplicationSearchResultDone, ldap.LDAPResultSuccess).Bytes())
+
+		case ldap.ApplicationUnbindRequest:
+			return
+		}
+	}
+}
+
+func (d *testDirectory) checkBind(name, password string) bool {
+	if name == testServiceDN {
+		return password == testServicePassword
+	}
+	for _, entry := range d.entries {
+		if entry.dn == name {
+			return password == entry.password
+		}
+	}
+	return false
+}
+
+func matches(entry testEntry, filter string) bool {
+	for _, attr := range []string{"uid", "mail"} {
+		for _, value := range entry.attrs[attr] {
+			if strings.Contains(filter, "("+attr+"="+value+")") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func result(messageID int64, tag ber.Tag, code int) *ber.Packet {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "")
+	op.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, int64(code), ""))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", ""))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", ""))
+	return envelope(messageID, op)
+}
+
+func searchEntry(messageID int64, entry testEntry) *ber.Packet {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "")
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, entry.dn, ""))
+	attrs := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "")
+	for name, values := range entry.attrs {
+		attr := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "")
+		attr.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, ""))
+		set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "")
+		for _, value := range values {
+			set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, value, ""))
+		}
+		attr.AppendChild(set)
+		attrs.AppendChild(attr)
+	}
+	op.AppendChild(attrs)
+	return envelope(messageID, op)
+}
+
+func envelope(messageID int64, op *ber.Packet) *ber.Packet {
+	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "")
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, messageID, ""))
+	packet.AppendChild(op)
+	return packet
+}
+
+func newTestLDAPProvider(d *testDirectory) *LDAPProvider {
+	return NewLDAPProvider(LDAPConfig{
+		URL:          d.url(),
+		BindDN:       testServiceDN,
+		BindPassword: testServicePassword,
+		BaseDN:       testBaseDN,
+		GroupRoles: []GroupRole{
+			{Group: testAdminsGroup, Role: "Admin"},
+			{Group: testLecturersGroup, Role: "Dosen Wali"},
+		},
+	})
+}
+
+func TestLDAPAuthenticate(t *testing.T) {
+	d := newTestDirectory(t)
+	provider := newTestLDAPProvider(d)
+	ctx := context.Background()
+
+	identity, err := provider.Authenticate(ctx, nil, "budi@ft.example.ac.id", "budi-pass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identity.Username != "budi" || identity.Email != "budi@ft.example.ac.id" || identity.FullName != "Budi Santoso" {
+		t.Errorf("unexpected identity %+v", identity)
+	}
+	// Group DNs compare case-insensitively
+	if identity.Role != "Dosen Wali" {
+		t.Errorf("role = %q, want Dosen Wali", identity.Role)
+	}
+
+	// The first mapped group wins and cn stands in for a missing displayName
+	identity, err = provider.Authenticate(ctx, nil, "sari", "sari-pass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identity.Role != "Admin" || identity.FullName != "Sari" {
+		t.Errorf("unexpected identity %+v", identity)
+	}
+}
+
+func TestLDAPAuthenticateRejects(t *testing.T) {
+	d := newTestDirectory(t)
+	provider := newTestLDAPProvider(d)
+	ctx := context.Background()
+
+	tests := []struct {
+		name       string
+		identifier string
+		password   string
+		want       error
+	}{
+		{"wrong password", "budi", "wrong", ErrInvalidCredentials},
+		{"unknown user", "nobody", "budi-pass", ErrInvalidCredentials},
+		{"empty password", "budi", "", ErrInvalidCredentials},
+		{"wildcard identifier", "*", "budi-pass", ErrInvalidCredentials},
+		{"no mapped group", "tamu", "tamu-pass", ErrNoRole},
+	}
+	for _, tt := range tests {
+		if _, err := provider.Authenticate(ctx, nil, tt.identifier, tt.password); !errors.Is(err, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.want)
+		}
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, filter := range d.searches {
+		if strings.Contains(filter, "(uid=*)") {
+			t.Errorf("identifier was not escaped in filter %s", filter)
+		}
+	}
+}
+
+func TestLDAPServiceBindFailure(t *testing.T) {
+	d := newTestDirectory(t)
+	provider := NewLDAPProvider(LDAPConfig{
+		URL:          d.url(),
+		BindDN:       testServiceDN,
+		BindPassword: "wrong",
+		BaseDN:       testBaseDN,
+	})
+
+	// A broken service account is a configuration error, not a failed login
+	_, err := provider.Authenticate(context.Background(), nil, "budi", "budi-pass")
+	if err == nil || errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("got %v, want a service bind error", err)
+	}
+}
+
+func TestLDAPDirectoryDown(t *testing.T) {
+	d := newTestDirectory(t)
+	provider := newTestLDAPProvider(d)
+	d.listener.Close()
+
+	_, err := provider.Authenticate(context.Background(), nil, "budi", "budi-pass")
+	if err == nil || errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("got %v, want a connection error", err)
+	}
+}
@@ -0,0 +1,35 @@
+package authprovider
+
+import (
+	"context"
+
+	"github.com/Aryma-f4/uas-backend/app/entity"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// dummyPasswordHash is compared against when the username does not exist,
+// so that unknown and known usernames take equally long to reject.
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("dummy-password"), bcrypt.DefaultCost)
+
+// LocalProvider checks passwords against the bcrypt hashes of users.
+type LocalProvider struct{}
+
+func NewLocalProvider() *LocalProvider {
+	return &LocalProvider{}
+}
+
+func (p *LocalProvider) Name() string {
+	return Local
+}
+
+func (p *LocalProvider) Authenticate(ctx context.Context, user *entity.User, identifier, password string) (*Identity, error) {
+	passwordHash := dummyPasswordHash
+	if user != nil {
+		passwordHash = []byte(user.PasswordHash)
+	}
+	if err := bcrypt.CompareHashAndPassword(passwordHash, []byte(password)); err != nil || user == nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	return &Identity{Username: user.Username, Email: user.Email, FullName: user.FullName}, nil
+}
@@ -0,0 +1,92 @@
+// Package authprovider checks login credentials against the local password
+// hashes or an external directory. Login picks the provider of a user from
+// the user's auth_provider, else from the domain of the login identifier.
+package authprovider
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/Aryma-f4/uas-backend/app/entity"
+)
+
+// Local is the name of the bcrypt provider, used when nothing else applies.
+const Local = "local"
+
+var (
+	// ErrInvalidCredentials is returned for a wrong username or password.
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	// ErrNoRole is returned when a directory account is in none of the
+	// groups that map to a role.
+	ErrNoRole = errors.New("account is not in any group with access")
+)
+
+// Identity describes an authenticated account. Directory providers fill it
+// from the directory entry; Role is the role its groups map to, if any.
+type Identity struct {
+	Username string
+	Email    string
+	FullName string
+	Groups   []string
+	Role     string
+}
+
+// Provider checks a password. user is the local account of the login, or
+// nil if there is none yet, in which case a directory provider may still
+// authenticate the account and return its identity for provisioning. Other
+// errors than ErrInvalidCredentials and ErrNoRole mean the provider could
+// not decide, e.g. because the directory is down.
+type Provider interface {
+	Name() string
+	Authenticate(ctx context.Context, user *entity.User, identifier, password string) (*Identity, error)
+}
+
+// Registry holds the configured providers and the login domains routed to
+// them.
+type Registry struct {
+	local     Provider
+	providers map[string]Provider
+	domains   map[string]string
+}
+
+func NewRegistry(local Provider) *Registry {
+	return &Registry{
+		local:     local,
+		providers: map[string]Provider{local.Name(): local},
+		domains:   make(map[string]string),
+	}
+}
+
+// Register adds a provider, used for users naming it and for logins with an
+// identifier at one of the given domains.
+func (r *Registry) Register(p Provider, domains ...string) {
+	r.providers[p.Name()] = p
+	for _, domain := range domains {
+		if domain = strings.ToLower(strings.TrimSpace(domain)); domain != "" {
+			r.domains[domain] = p.Name()
+		}
+	}
+}
+
+// Get returns the provider with the given name.
+func (r *Registry) Get(name string) (Provider, bool) {
+	p, ok := r.providers[name]
+	return p, ok
+}
+
+// For returns the provider of a login: the user's own provider if set,
+// else the one of the identifier's domain, else the local one. It returns
+// nil if the user names a provider that is not configured.
+func (r *Registry) For(user *entity.User, identifier string) Provider {
+	if user != nil && user.AuthProvider != "" {
+		return r.providers[user.AuthProvider]
+	}
+
+	if at := strings.LastIndex(identifier, "@"); at >= 0 {
+		if name, ok := r.domains[strings.ToLower(identifier[at+1:])]; ok {
+			return r.providers[name]
+		}
+	}
+	return r.local
+}
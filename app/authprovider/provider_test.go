@@ -0,0 +1,72 @@
+package authprovider
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Aryma-f4/uas-backend/app/entity"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestRegistryFor(t *testing.T) {
+	registry := NewRegistry(NewLocalProvider())
+	registry.Register(NewLDAPProvider(LDAPConfig{}), "FT.example.ac.id", "")
+
+	tests := []struct {
+		name       string
+		user       *entity.User
+		identifier string
+		want       string
+	}{
+		{"user provider", &entity.User{AuthProvider: LDAPProviderName}, "budi", LDAPProviderName},
+		{"user forced local", &entity.User{AuthProvider: Local}, "budi@ft.example.ac.id", Local},
+		{"domain", nil, "budi@ft.example.ac.id", LDAPProviderName},
+		{"domain of existing user", &entity.User{}, "budi@FT.example.ac.id", LDAPProviderName},
+		{"other domain", nil, "budi@example.ac.id", Local},
+		{"username", nil, "budi", Local},
+		{"empty domain", nil, "budi@", Local},
+	}
+	for _, tt := range tests {
+		provider := registry.For(tt.user, tt.identifier)
+		if provider == nil || provider.Name() != tt.want {
+			t.Errorf("%s: got %v, want %s", tt.name, provider, tt.want)
+		}
+	}
+
+	if provider := registry.For(&entity.User{AuthProvider: "kerberos"}, "budi"); provider != nil {
+		t.Errorf("unknown provider resolved to %s", provider.Name())
+	}
+}
+
+func TestLocalProvider(t *testing.T) {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	user := &entity.User{Username: "budi", PasswordHash: string(hash)}
+	provider := NewLocalProvider()
+	ctx := context.Background()
+
+	if identity, err := provider.Authenticate(ctx, user, "budi", "secret"); err != nil || identity.Username != "budi" {
+		t.Errorf("correct password: %v", err)
+	}
+	if _, err := provider.Authenticate(ctx, user, "budi", "wrong"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("wrong password: %v", err)
+	}
+	if _, err := provider.Authenticate(ctx, nil, "nobody", "dummy-password"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("unknown user: %v", err)
+	}
+}
+
+func TestParseGroupRoles(t *testing.T) {
+	mappings, err := ParseGroupRoles(" Admin:cn=admins,dc=example ; Dosen Wali:cn=lecturers,dc=example;")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mappings) != 2 || mappings[0] != (GroupRole{Group: "cn=admins,dc=example", Role: "Admin"}) ||
+		mappings[1] != (GroupRole{Group: "cn=lecturers,dc=example", Role: "Dosen Wali"}) {
+		t.Errorf("unexpected mappings %+v", mappings)
+	}
+
+	if _, err := ParseGroupRoles("cn=admins,dc=example"); err == nil {
+		t.Error("mapping without role accepted")
+	}
+}
@@ -0,0 +1,116 @@
+package entity
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Levels of the faculty → department → study program hierarchy
+const (
+	UnitLevelFaculty      = "faculty"
+	UnitLevelDepartment   = "department"
+	UnitLevelStudyProgram = "study_program"
+)
+
+type Faculty struct {
+	ID        uuid.UUID `json:"id"`
+	Code      string    `json:"code"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type Department struct {
+	ID          uuid.UUID `json:"id"`
+	FacultyID   uuid.UUID `json:"faculty_id"`
+	FacultyName string    `json:"faculty_name,omitempty"`
+	Code        string    `json:"code"`
+	Name        string    `json:"name"`
+	Aliases     []string  `json:"aliases"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type StudyProgram struct {
+	ID             uuid.UUID `json:"id"`
+	DepartmentID   uuid.UUID `json:"department_id"`
+	DepartmentName string    `json:"department_name,omitempty"`
+	FacultyID      uuid.UUID `json:"faculty_id"`
+	Code           string    `json:"code"`
+	Name           string    `json:"name"`
+	Degree         string    `json:"degree,omitempty"`
+	Aliases        []string  `json:"aliases"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+type FacultyRequest struct {
+	Code string `json:"code" validate:"required"`
+	Name string `json:"name" validate:"required"`
+}
+
+type DepartmentRequest struct {
+	FacultyID uuid.UUID `json:"faculty_id" validate:"required"`
+	Code      string    `json:"code" validate:"required"`
+	Name      string    `json:"name" validate:"required"`
+	Aliases   []string  `json:"aliases,omitempty"`
+}
+
+type StudyProgramRequest struct {
+	DepartmentID uuid.UUID `json:"department_id" validate:"required"`
+	Code         string    `json:"code" validate:"required"`
+	Name         string    `json:"name" validate:"required"`
+	Degree       string    `json:"degree,omitempty"`
+	Aliases      []string  `json:"aliases,omitempty"`
+}
+
+type UpdateStudyProgramRequest struct {
+	StudyProgramID uuid.UUID `json:"study_program_id" validate:"required"`
+}
+
+type UpdateDepartmentRequest struct {
+	DepartmentID uuid.UUID `json:"department_id" validate:"required"`
+}
+
+// AcademicUnitFilter narrows a query to one branch of the hierarchy. Nil
+// fields are not filtered on.
+type AcademicUnitFilter struct {
+	FacultyID      *uuid.UUID `json:"faculty_id,omitempty"`
+	DepartmentID   *uuid.UUID `json:"department_id,omitempty"`
+	StudyProgramID *uuid.UUID `json:"study_program_id,omitempty"`
+}
+
+type UnitStatistics struct {
+	UnitID            uuid.UUID `json:"unit_id"`
+	UnitCode          string    `json:"unit_code"`
+	UnitName          string    `json:"unit_name"`
+	Students          int       `json:"students"`
+	TotalAchievements int       `json:"total_achievements"`
+	TotalDraft        int       `json:"total_draft"`
+	TotalPending      int       `json:"total_pending"`
+	TotalVerified     int       `json:"total_verified"`
+	TotalRejected     int       `json:"total_rejected"`
+	VerifiedPoints    int       `json:"verified_points"`
+}
+
+type UnitStatisticsResponse struct {
+	Level  string             `json:"level"`
+	Filter AcademicUnitFilter `json:"filter"`
+	Units  []*UnitStatistics  `json:"units"`
+	// UnlinkedStudents have a program_study text that matches no study program
+	UnlinkedStudents int        `json:"unlinked_students"`
+	GeneratedAt      *time.Time `json:"generated_at"`
+}
+
+type AcademicUnitLinkResult struct {
+	StudentsLinked    int64 `json:"students_linked"`
+	LecturersLinked   int64 `json:"lecturers_linked"`
+	UnlinkedStudents  int   `json:"unlinked_students"`
+	UnlinkedLecturers int   `json:"unlinked_lecturers"`
+}
+
+// UnlinkedUnitName is a free-text program or department that matches no
+// unit yet, usually fixed by adding it as an alias.
+type UnlinkedUnitName struct {
+	Kind  string `json:"kind"`
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
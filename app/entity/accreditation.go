@@ -0,0 +1,70 @@
+package entity
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Achievement levels of the accreditation tables. Competition levels that
+// match none of them are reported as AccreditationLevelUnspecified.
+const (
+	AccreditationLevelLocal         = "local"
+	AccreditationLevelRegional      = "regional"
+	AccreditationLevelNational      = "national"
+	AccreditationLevelInternational = "international"
+	AccreditationLevelUnspecified   = "unspecified"
+)
+
+// Accreditation categories. details.category may set either explicitly;
+// otherwise academic, competition, publication and certification
+// achievements are academic and the other types non-academic.
+const (
+	AccreditationAcademic    = "academic"
+	AccreditationNonAcademic = "non_academic"
+)
+
+// Default and maximum number of years covered by an accreditation report.
+const (
+	AccreditationDefaultYears = 3
+	AccreditationMaxYears     = 10
+)
+
+type AccreditationReport struct {
+	StudyProgram *StudyProgram               `json:"study_program"`
+	Years        []int                       `json:"years"`
+	Summary      []*AccreditationYearSummary `json:"summary"`
+	Achievements []*AccreditationAchievement `json:"achievements"`
+	GeneratedAt  time.Time                   `json:"generated_at"`
+}
+
+// AccreditationYearSummary counts verified achievements of one category in
+// one year per level.
+type AccreditationYearSummary struct {
+	Year          int    `json:"year"`
+	Category      string `json:"category"`
+	Local         int    `json:"local"`
+	Regional      int    `json:"regional"`
+	National      int    `json:"national"`
+	International int    `json:"international"`
+	Unspecified   int    `json:"unspecified"`
+	Total         int    `json:"total"`
+}
+
+// AccreditationAchievement is one row of the achievement list. Year is the
+// year of details.eventDate, falling back to the verification date.
+type AccreditationAchievement struct {
+	ID              string          `json:"id"`
+	Year            int             `json:"year"`
+	Category        string          `json:"category"`
+	Level           string          `json:"level"`
+	AchievementType AchievementType `json:"achievement_type"`
+	Title           string          `json:"title"`
+	// Result is the medal or rank reached, e.g. "gold" or "Rank 1"
+	Result      string     `json:"result"`
+	Organizer   string     `json:"organizer"`
+	StudentID   uuid.UUID  `json:"student_id"`
+	NIM         string     `json:"nim"`
+	StudentName string     `json:"student_name"`
+	VerifiedAt  *time.Time `json:"verified_at"`
+}
@@ -27,6 +27,21 @@ const (
 	TypeOther         AchievementType = "other"
 )
 
+func (t AchievementType) IsValid() bool {
+	switch t {
+	case TypeAcademic, TypeCompetition, TypeOrganization, TypePublication, TypeCertification, TypeOther:
+		return true
+	}
+	return false
+}
+
+// ExportDetailKeys are the Details keys that get their own column in
+// spreadsheet exports; any other keys are exported together as JSON.
+var ExportDetailKeys = []string{
+	"competitionName", "competitionLevel", "rank", "medalType", "organizer",
+	"location", "eventDate", "publisher", "issuer", "certificationNumber", "position",
+}
+
 // MongoDB Achievement Document
 type Achievement struct {
 	ID              primitive.ObjectID     `json:"id" bson:"_id,omitempty"`
@@ -38,6 +53,7 @@ type Achievement struct {
 	Attachments     []Attachment           `json:"attachments" bson:"attachments"`
 	Tags            []string               `json:"tags" bson:"tags"`
 	Points          int                    `json:"points" bson:"points"`
+	ImportBatchID   string                 `json:"import_batch_id,omitempty" bson:"importBatchId,omitempty"`
 	CreatedAt       time.Time              `json:"created_at" bson:"createdAt"`
 	UpdatedAt       time.Time              `json:"updated_at" bson:"updatedAt"`
 }
@@ -59,6 +75,7 @@ type AchievementReference struct {
 	VerifiedAt         *time.Time        `json:"verified_at,omitempty"`
 	VerifiedBy         *uuid.UUID        `json:"verified_by,omitempty"`
 	RejectionNote      string            `json:"rejection_note,omitempty"`
+	ImportBatchID      *uuid.UUID        `json:"import_batch_id,omitempty"`
 	CreatedAt          time.Time         `json:"created_at"`
 	UpdatedAt          time.Time         `json:"updated_at"`
 }
@@ -69,8 +86,10 @@ type AchievementStatusHistory struct {
 	OldStatus        AchievementStatus `json:"old_status"`
 	NewStatus        AchievementStatus `json:"new_status"`
 	ChangedBy        uuid.UUID         `json:"changed_by"`
-	Note             string            `json:"note"`
-	CreatedAt        time.Time         `json:"created_at"`
+	// ImpersonatedBy is the admin who made the change acting as ChangedBy
+	ImpersonatedBy *uuid.UUID `json:"impersonated_by,omitempty"`
+	Note           string     `json:"note"`
+	CreatedAt      time.Time  `json:"created_at"`
 }
 
 // Combined Achievement Response
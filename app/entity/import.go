@@ -0,0 +1,65 @@
+package entity
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type ImportRowError struct {
+	Row     int    `json:"row"`
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+type AchievementImportBatch struct {
+	ID            uuid.UUID         `json:"id"`
+	FileName      string            `json:"file_name"`
+	InitialStatus AchievementStatus `json:"initial_status"`
+	TotalRows     int               `json:"total_rows"`
+	ImportedRows  int               `json:"imported_rows"`
+	CreatedBy     uuid.UUID         `json:"created_by"`
+	RolledBackAt  *time.Time        `json:"rolled_back_at,omitempty"`
+	CreatedAt     time.Time         `json:"created_at"`
+}
+
+type AchievementImportResult struct {
+	BatchID      *uuid.UUID       `json:"batch_id,omitempty"`
+	DryRun       bool             `json:"dry_run"`
+	TotalRows    int              `json:"total_rows"`
+	ValidRows    int              `json:"valid_rows"`
+	ImportedRows int              `json:"imported_rows"`
+	Errors       []ImportRowError `json:"errors"`
+}
+
+// AchievementImportRow is a single parsed spreadsheet row: the NIM of the
+// student plus the same fields accepted by CreateAchievementRequest.
+type AchievementImportRow struct {
+	Row       int
+	NIM       string
+	StudentID uuid.UUID
+	Request   CreateAchievementRequest
+}
+
+const (
+	RosterCredentialPassword   = "password"
+	RosterCredentialInvitation = "invitation"
+)
+
+type RosterImportRowResult struct {
+	Row             int    `json:"row"`
+	Role            string `json:"role"`
+	Username        string `json:"username"`
+	Email           string `json:"email"`
+	Status          string `json:"status"`
+	Message         string `json:"message,omitempty"`
+	InitialPassword string `json:"initial_password,omitempty"`
+	InvitationToken string `json:"invitation_token,omitempty"`
+}
+
+type RosterImportResult struct {
+	TotalRows int                      `json:"total_rows"`
+	Created   int                      `json:"created"`
+	Failed    int                      `json:"failed"`
+	Rows      []*RosterImportRowResult `json:"rows"`
+}
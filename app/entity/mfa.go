@@ -0,0 +1,79 @@
+package entity
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MFA limits. A challenge issued by the first login step must be answered
+// within MFAChallengeTTL and allows MFAChallengeMaxAttempts codes.
+const (
+	MFAChallengeTTL         = 5 * time.Minute
+	MFAChallengeMaxAttempts = 5
+	MFARecoveryCodeCount    = 10
+)
+
+// UserMFA is the TOTP enrollment of a user. EnabledAt is nil while the
+// secret waits for its first code. LastUsedStep rejects replayed codes.
+type UserMFA struct {
+	UserID       uuid.UUID
+	Secret       string
+	EnabledAt    *time.Time
+	LastUsedStep int64
+	CreatedAt    time.Time
+}
+
+// MFAChallenge is the second login step of a user whose password was
+// correct. SetupRequired is set when the role requires MFA and the user has
+// not enrolled yet.
+type MFAChallenge struct {
+	ID            uuid.UUID
+	UserID        uuid.UUID
+	TokenHash     string
+	UserAgent     string
+	IPAddress     string
+	SetupRequired bool
+	Attempts      int
+	ExpiresAt     time.Time
+	UsedAt        *time.Time
+}
+
+type MFAEnrollment struct {
+	Secret string `json:"secret"`
+	// ProvisioningURI is the otpauth:// URI to show as a QR code
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+type MFAStatus struct {
+	Enabled                bool `json:"enabled"`
+	Required               bool `json:"required"`
+	RecoveryCodesRemaining int  `json:"recovery_codes_remaining"`
+}
+
+type MFACodeRequest struct {
+	Code string `json:"code" validate:"required"`
+}
+
+// MFAVerifyRequest answers a login challenge with a TOTP or recovery code.
+type MFAVerifyRequest struct {
+	MFAToken string `json:"mfa_token" validate:"required"`
+	Code     string `json:"code" validate:"required"`
+}
+
+type MFASetupRequest struct {
+	MFAToken string `json:"mfa_token" validate:"required"`
+}
+
+type DisableMFARequest struct {
+	Password string `json:"password" validate:"required"`
+	Code     string `json:"code" validate:"required"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+type UpdateRoleMFARequest struct {
+	Required bool `json:"required"`
+}
@@ -0,0 +1,31 @@
+package entity
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// OIDCStateTTL is how long a started single sign-on login may take.
+const OIDCStateTTL = 10 * time.Minute
+
+// OIDCState is a started single sign-on login, keyed by the hash of the
+// state parameter and consumed by the callback.
+type OIDCState struct {
+	ID           uuid.UUID
+	StateHash    string
+	Nonce        string
+	CodeVerifier string
+	ExpiresAt    time.Time
+}
+
+// UserIdentity links an account at the identity provider to a user.
+type UserIdentity struct {
+	ID          uuid.UUID  `json:"id"`
+	UserID      uuid.UUID  `json:"user_id"`
+	Issuer      string     `json:"issuer"`
+	Subject     string     `json:"subject"`
+	Email       string     `json:"email"`
+	LastLoginAt *time.Time `json:"last_login_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
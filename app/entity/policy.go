@@ -0,0 +1,39 @@
+package entity
+
+import "github.com/google/uuid"
+
+// PermissionDepartmentRead lets a lecturer access the students of their
+// department and their achievements, e.g. through a head of department role.
+const PermissionDepartmentRead = "department:read"
+
+// PermissionStudentManage lets a user manage, and so access, every student.
+const PermissionStudentManage = "student:manage"
+
+// Subject is the caller an access decision is made for. UserID is nil for
+// service accounts; ImpersonatorID is the admin acting as UserID, nil
+// otherwise.
+type Subject struct {
+	UserID         uuid.UUID
+	RoleName       string
+	Permissions    []string
+	ImpersonatorID uuid.UUID
+}
+
+// Impersonator returns the admin acting as the subject, for recording with
+// the changes it makes, or nil.
+func (s *Subject) Impersonator() *uuid.UUID {
+	if s.ImpersonatorID == uuid.Nil {
+		return nil
+	}
+	id := s.ImpersonatorID
+	return &id
+}
+
+func (s *Subject) HasPermission(permission string) bool {
+	for _, granted := range s.Permissions {
+		if granted == permission {
+			return true
+		}
+	}
+	return false
+}
@@ -1,5 +1,20 @@
 package entity
 
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Bucketing of StatisticsResponse.MonthlyTrend
+const (
+	TrendByEvent    = "event"
+	TrendByVerified = "verified"
+)
+
+// TopStudentsLimit is the number of students listed in TopStudents.
+const TopStudentsLimit = 10
+
 type StatisticsResponse struct {
 	TotalAchievements    int                    `json:"total_achievements"`
 	TotalVerified        int                    `json:"total_verified"`
@@ -10,6 +25,10 @@ type StatisticsResponse struct {
 	ByCompetitionLevel   map[string]int         `json:"by_competition_level,omitempty"`
 	TopStudents          []TopStudentStats      `json:"top_students,omitempty"`
 	MonthlyTrend         []MonthlyStats         `json:"monthly_trend,omitempty"`
+	TrendBy              string                 `json:"trend_by,omitempty"`
+	Advisees             []*AdviseeStatistics   `json:"advisees,omitempty"`
+	// GeneratedAt is the oldest snapshot the figures were computed from
+	GeneratedAt          *time.Time             `json:"generated_at"`
 }
 
 type TopStudentStats struct {
@@ -19,11 +38,79 @@ type TopStudentStats struct {
 	Achievements int    `json:"achievements"`
 }
 
+// AdviseeStatistics is one row of an advisor's per-advisee breakdown.
+type AdviseeStatistics struct {
+	StudentID         uuid.UUID `json:"student_id"`
+	NIM               string    `json:"nim"`
+	FullName          string    `json:"full_name"`
+	ProgramStudy      string    `json:"program_study"`
+	TotalAchievements int       `json:"total_achievements"`
+	TotalDraft        int       `json:"total_draft"`
+	TotalPending      int       `json:"total_pending"`
+	TotalVerified     int       `json:"total_verified"`
+	TotalRejected     int       `json:"total_rejected"`
+	VerifiedPoints    int       `json:"verified_points"`
+}
+
 type MonthlyStats struct {
 	Month string `json:"month"`
 	Count int    `json:"count"`
 }
 
+// StudentStatistics is the pre-aggregated row of one student, recomputed on
+// every status change and by the periodic full refresh.
+type StudentStatistics struct {
+	StudentID          uuid.UUID
+	TotalAchievements  int
+	TotalDraft         int
+	TotalPending       int
+	TotalVerified      int
+	TotalRejected      int
+	VerifiedPoints     int
+	ByType             map[string]int
+	ByCompetitionLevel map[string]int
+	// Periods buckets verified achievements per month, once by event date
+	// and once by verification date (Basis is TrendByEvent or TrendByVerified)
+	Periods []*PeriodStatistics
+}
+
+type PeriodStatistics struct {
+	Basis          string
+	Period         string
+	TotalVerified  int
+	VerifiedPoints int
+}
+
+type LeaderboardFilter struct {
+	FacultyID       string `query:"faculty_id"`
+	DepartmentID    string `query:"department_id"`
+	StudyProgramID  string `query:"study_program_id"`
+	AcademicYear    string `query:"academic_year"`
+	AchievementType string `query:"type"`
+	StartDate       string `query:"start_date"`
+	EndDate         string `query:"end_date"`
+	IncludeHidden   bool   `query:"include_hidden"`
+	Page            int    `query:"page"`
+	Limit           int    `query:"limit"`
+}
+
+// LeaderboardEntry is one ranked student. Students with the same points and
+// number of verified achievements share a rank.
+type LeaderboardEntry struct {
+	Rank         int       `json:"rank"`
+	StudentID    uuid.UUID `json:"student_id"`
+	NIM          string    `json:"nim"`
+	FullName     string    `json:"full_name"`
+	ProgramStudy string    `json:"program_study"`
+	AcademicYear string    `json:"academic_year"`
+	TotalPoints  int       `json:"total_points"`
+	Achievements int       `json:"achievements"`
+}
+
+type LeaderboardVisibilityRequest struct {
+	Hidden bool `json:"hidden"`
+}
+
 type StudentReportResponse struct {
 	StudentInfo     StudentReportInfo    `json:"student_info"`
 	Statistics      StatisticsResponse   `json:"statistics"`
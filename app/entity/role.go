@@ -0,0 +1,19 @@
+package entity
+
+type CreateRoleRequest struct {
+	Name        string   `json:"name" validate:"required"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+}
+
+// EditRoleRequest changes the given fields; Permissions replaces all
+// permissions of the role when set.
+type EditRoleRequest struct {
+	Name        *string  `json:"name"`
+	Description *string  `json:"description"`
+	Permissions []string `json:"permissions"`
+}
+
+type RolePermissionsRequest struct {
+	Permissions []string `json:"permissions" validate:"required"`
+}
@@ -0,0 +1,44 @@
+package entity
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Security event types recorded in security_events.
+const (
+	SecurityEventAccountLocked    = "account_locked"
+	SecurityEventIPLocked         = "ip_locked"
+	SecurityEventAccountUnlocked  = "account_unlocked"
+	SecurityEventMFAEnabled       = "mfa_enabled"
+	SecurityEventMFADisabled      = "mfa_disabled"
+	SecurityEventRecoveryCodes    = "mfa_recovery_codes_regenerated"
+	SecurityEventRecoveryCodeUse  = "mfa_recovery_code_used"
+	SecurityEventIdentityLinked   = "identity_linked"
+	SecurityEventUserProvisioned  = "user_provisioned"
+	SecurityEventAPIKeyCreated    = "api_key_created"
+	SecurityEventAPIKeyRotated    = "api_key_rotated"
+	SecurityEventAPIKeyRevoked    = "api_key_revoked"
+	SecurityEventImpersonation    = "impersonation_started"
+	SecurityEventImpersonationEnd = "impersonation_ended"
+)
+
+// LoginThrottle counts recent failed logins of one account or IP address.
+// Key is "account:<user id>" for known accounts, "account:<identifier>" for
+// unknown usernames and emails, and "ip:<address>".
+type LoginThrottle struct {
+	Key           string
+	Failures      int
+	LastFailureAt time.Time
+	LockedUntil   *time.Time
+}
+
+type SecurityEvent struct {
+	ID        uuid.UUID  `json:"id"`
+	UserID    *uuid.UUID `json:"user_id,omitempty"`
+	EventType string     `json:"event_type"`
+	IPAddress string     `json:"ip_address"`
+	Detail    string     `json:"detail"`
+	CreatedAt time.Time  `json:"created_at"`
+}
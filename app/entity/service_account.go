@@ -0,0 +1,78 @@
+package entity
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// RoleServiceAccount is the role name of requests authenticated with an API
+// key. Handlers scoping data by role treat it like Admin; what a service
+// account may call is limited by its permissions.
+const RoleServiceAccount = "Service Account"
+
+// APIKeyPrefix starts every API key, so leaked keys are easy to recognise.
+const APIKeyPrefix = "uask_"
+
+// ServiceAccount is a non-human client such as SIAKAD. AllowedIPs holds
+// addresses or CIDR ranges; an empty list allows any address.
+type ServiceAccount struct {
+	ID          uuid.UUID  `json:"id"`
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+	Permissions []string   `json:"permissions"`
+	AllowedIPs  []string   `json:"allowed_ips"`
+	IsActive    bool       `json:"is_active"`
+	CreatedBy   *uuid.UUID `json:"created_by,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	Keys        []*APIKey  `json:"keys,omitempty"`
+}
+
+// APIKey of a service account. Only the SHA-256 of the key is stored;
+// Prefix is its first characters, for telling keys apart.
+type APIKey struct {
+	ID               uuid.UUID  `json:"id"`
+	ServiceAccountID uuid.UUID  `json:"service_account_id"`
+	Prefix           string     `json:"prefix"`
+	KeyHash          string     `json:"-"`
+	ExpiresAt        *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt       *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt        *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt        time.Time  `json:"created_at"`
+}
+
+type CreateServiceAccountRequest struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+	AllowedIPs  []string `json:"allowed_ips"`
+	// ExpiresAt of the first key; nil keys never expire
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// UpdateServiceAccountRequest changes the fields that are set.
+type UpdateServiceAccountRequest struct {
+	Description *string  `json:"description,omitempty"`
+	Permissions []string `json:"permissions,omitempty"`
+	AllowedIPs  []string `json:"allowed_ips,omitempty"`
+	IsActive    *bool    `json:"is_active,omitempty"`
+}
+
+type CreateAPIKeyRequest struct {
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// RotateAPIKeyRequest replaces a key. The old key keeps working for
+// GraceMinutes so clients can switch over; 0 revokes it at once.
+type RotateAPIKeyRequest struct {
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`
+	GraceMinutes int        `json:"grace_minutes"`
+}
+
+// APIKeyResponse carries a new key, which is shown only this once.
+type APIKeyResponse struct {
+	Key            string          `json:"key"`
+	APIKey         *APIKey         `json:"api_key"`
+	ServiceAccount *ServiceAccount `json:"service_account,omitempty"`
+}
@@ -16,6 +16,7 @@ type Student struct {
 	AcademicYear string    `json:"academic_year"`
 	AdvisorID    *uuid.UUID `json:"advisor_id,omitempty"`
 	AdvisorName  string    `json:"advisor_name,omitempty"`
+	StudyProgramID *uuid.UUID `json:"study_program_id,omitempty"`
 	CreatedAt    time.Time `json:"created_at"`
 }
 
@@ -26,9 +27,72 @@ type Lecturer struct {
 	FullName   string    `json:"full_name,omitempty"`
 	Email      string    `json:"email,omitempty"`
 	Department string    `json:"department"`
+	DepartmentID *uuid.UUID `json:"department_id,omitempty"`
 	CreatedAt  time.Time `json:"created_at"`
 }
 
 type UpdateAdvisorRequest struct {
 	AdvisorID uuid.UUID `json:"advisor_id" validate:"required"`
+	Note      string    `json:"note,omitempty"`
+}
+
+type AdvisorHistoryEntry struct {
+	ID             uuid.UUID  `json:"id"`
+	StudentID      uuid.UUID  `json:"student_id"`
+	LecturerID     uuid.UUID  `json:"lecturer_id"`
+	LecturerNIP    string     `json:"lecturer_nip"`
+	LecturerName   string     `json:"lecturer_name"`
+	AssignedBy     *uuid.UUID `json:"assigned_by,omitempty"`
+	AssignedByName string     `json:"assigned_by_name,omitempty"`
+	Note           string     `json:"note,omitempty"`
+	StartedAt      time.Time  `json:"started_at"`
+	EndedAt        *time.Time `json:"ended_at,omitempty"`
+}
+
+type AdvisorChangeResult struct {
+	Changed              bool  `json:"changed"`
+	TransferredSubmitted int64 `json:"transferred_submitted"`
+}
+
+type LecturerWorkload struct {
+	LecturerID   uuid.UUID  `json:"lecturer_id"`
+	NIP          string     `json:"nip"`
+	FullName     string     `json:"full_name"`
+	Department   string     `json:"department"`
+	DepartmentID *uuid.UUID `json:"department_id,omitempty"`
+	AdviseeCount int        `json:"advisee_count"`
+}
+
+type AdvisorAssignment struct {
+	StudentID    uuid.UUID `json:"student_id"`
+	NIM          string    `json:"nim"`
+	StudentName  string    `json:"student_name"`
+	ProgramStudy string    `json:"program_study"`
+	LecturerID   uuid.UUID `json:"lecturer_id"`
+	LecturerNIP  string    `json:"lecturer_nip"`
+	LecturerName string    `json:"lecturer_name"`
+}
+
+type UnassignedStudent struct {
+	StudentID    uuid.UUID `json:"student_id"`
+	NIM          string    `json:"nim"`
+	StudentName  string    `json:"student_name"`
+	ProgramStudy string    `json:"program_study"`
+	Reason       string    `json:"reason"`
+}
+
+// ApplyAdvisorAssignmentRequest carries the assignments of a previewed plan
+// back for saving.
+type ApplyAdvisorAssignmentRequest struct {
+	MaxLoad     int                 `json:"max_load"`
+	Assignments []AdvisorAssignment `json:"assignments"`
+}
+
+type AdvisorAssignmentPlan struct {
+	MaxLoad     int                 `json:"max_load"`
+	Applied     bool                `json:"applied"`
+	Assignments []AdvisorAssignment `json:"assignments"`
+	Unassigned  []UnassignedStudent `json:"unassigned"`
+	// Workloads are the advisee counts once the assignments are applied
+	Workloads []*LecturerWorkload `json:"workloads"`
 }
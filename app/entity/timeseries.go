@@ -0,0 +1,68 @@
+package entity
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Time series metrics. submitted, verified and rejected count status
+// changes; points sums the points of achievements verified in a bucket.
+const (
+	MetricSubmitted = "submitted"
+	MetricVerified  = "verified"
+	MetricRejected  = "rejected"
+	MetricPoints    = "points"
+)
+
+// Time series bucket sizes. Weeks start on Monday.
+const (
+	GranularityDay   = "day"
+	GranularityWeek  = "week"
+	GranularityMonth = "month"
+)
+
+// Time series grouping; without one the response has a single series.
+const (
+	GroupByType    = "type"
+	GroupByProgram = "program"
+)
+
+// TimeSeriesMaxBuckets caps the number of buckets of one request.
+const TimeSeriesMaxBuckets = 400
+
+type TimeSeriesFilter struct {
+	Metric      string `query:"metric"`
+	Granularity string `query:"granularity"`
+	From        string `query:"from"`
+	To          string `query:"to"`
+	GroupBy     string `query:"group_by"`
+}
+
+type TimeSeriesResponse struct {
+	Metric      string `json:"metric"`
+	Granularity string `json:"granularity"`
+	GroupBy     string `json:"group_by,omitempty"`
+	From        string `json:"from"`
+	To          string `json:"to"`
+	// Buckets holds the start date of every bucket, including empty ones
+	Buckets []string      `json:"buckets"`
+	Series  []*TimeSeries `json:"series"`
+}
+
+// TimeSeries has one value per bucket of the response.
+type TimeSeries struct {
+	Key    string `json:"key"`
+	Label  string `json:"label"`
+	Values []int  `json:"values"`
+	Total  int    `json:"total"`
+}
+
+// StatusChange is one achievement_status_history entry with what the time
+// series needs to bucket and group it.
+type StatusChange struct {
+	ChangedAt          time.Time
+	MongoAchievementID string
+	StudyProgramID     *uuid.UUID
+	StudyProgramName   string
+}
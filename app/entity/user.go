@@ -15,14 +15,23 @@ type User struct {
 	RoleID       uuid.UUID `json:"role_id"`
 	RoleName     string    `json:"role_name,omitempty"`
 	IsActive     bool      `json:"is_active"`
+	// AuthProvider checks the password, e.g. "local" or "ldap"; empty picks
+	// it by the domain of the login identifier
+	AuthProvider string    `json:"auth_provider,omitempty"`
 	CreatedAt    time.Time `json:"created_at"`
 	UpdatedAt    time.Time `json:"updated_at"`
 }
 
+// Role is a set of permissions given to users. Built-in roles are referred
+// to by name in code and cannot be renamed or deleted. Permissions is only
+// filled by the role administration endpoints.
 type Role struct {
 	ID          uuid.UUID `json:"id"`
 	Name        string    `json:"name"`
 	Description string    `json:"description"`
+	MFARequired bool      `json:"mfa_required"`
+	IsBuiltin   bool      `json:"is_builtin"`
+	Permissions []string  `json:"permissions,omitempty"`
 	CreatedAt   time.Time `json:"created_at"`
 }
 
@@ -34,16 +43,33 @@ type Permission struct {
 	Description string    `json:"description"`
 }
 
+// RoleAccess is a role with the names of its permissions, as of permission
+// version Version.
+type RoleAccess struct {
+	RoleID      uuid.UUID
+	RoleName    string
+	Permissions []string
+	Version     int64
+}
+
 // Request/Response DTOs
 type LoginRequest struct {
 	Username string `json:"username" validate:"required"`
 	Password string `json:"password" validate:"required"`
 }
 
+// LoginResponse carries either the tokens of a new session or, when MFA is
+// enabled or required, only an MFA challenge to answer at /auth/mfa/verify.
 type LoginResponse struct {
-	Token        string   `json:"token"`
-	RefreshToken string   `json:"refresh_token"`
-	User         UserInfo `json:"user"`
+	Token        string    `json:"token,omitempty"`
+	RefreshToken string    `json:"refresh_token,omitempty"`
+	User         *UserInfo `json:"user,omitempty"`
+
+	MFARequired      bool   `json:"mfa_required,omitempty"`
+	MFASetupRequired bool   `json:"mfa_setup_required,omitempty"`
+	MFAToken         string `json:"mfa_token,omitempty"`
+	// RecoveryCodes is only set when the login completed MFA enrollment
+	RecoveryCodes []string `json:"recovery_codes,omitempty"`
 }
 
 type UserInfo struct {
@@ -53,6 +79,8 @@ type UserInfo struct {
 	Email       string    `json:"email"`
 	Role        string    `json:"role"`
 	Permissions []string  `json:"permissions"`
+	// ImpersonatedBy is set on the profile of an impersonation token
+	ImpersonatedBy *uuid.UUID `json:"impersonated_by,omitempty"`
 }
 
 type CreateUserRequest struct {
@@ -73,6 +101,11 @@ type UpdateUserRequest struct {
 	Email    string `json:"email,omitempty"`
 	FullName string `json:"full_name,omitempty"`
 	IsActive *bool  `json:"is_active,omitempty"`
+	// Password sets a new password and signs the user out everywhere
+	Password string `json:"password,omitempty"`
+	// AuthProvider moves the user to another authentication provider; ""
+	// picks it by login domain again
+	AuthProvider *string `json:"auth_provider,omitempty"`
 }
 
 type UpdateRoleRequest struct {
@@ -82,3 +115,101 @@ type UpdateRoleRequest struct {
 type RefreshTokenRequest struct {
 	RefreshToken string `json:"refresh_token" validate:"required"`
 }
+
+type UserInvitation struct {
+	ID         uuid.UUID  `json:"id"`
+	UserID     uuid.UUID  `json:"user_id"`
+	TokenHash  string     `json:"-"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	AcceptedAt *time.Time `json:"accepted_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// RefreshToken is a stored refresh token. Each refresh uses the token up and
+// issues a successor in the same family; presenting a used token again
+// revokes the whole family.
+type RefreshToken struct {
+	ID        uuid.UUID
+	UserID    uuid.UUID
+	FamilyID  uuid.UUID
+	TokenHash string
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	RevokedAt *time.Time
+	CreatedAt time.Time
+}
+
+// Session is a login on one device. Its ID is the family ID of the refresh
+// tokens issued for it and the sid claim of its access tokens.
+type Session struct {
+	ID         uuid.UUID  `json:"id"`
+	UserID     uuid.UUID  `json:"user_id"`
+	UserAgent  string     `json:"user_agent"`
+	IPAddress  string     `json:"ip_address"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastSeenAt time.Time  `json:"last_seen_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	// ImpersonatedBy is the admin acting as the user in this session
+	ImpersonatedBy *uuid.UUID `json:"impersonated_by,omitempty"`
+	Current        bool       `json:"current"`
+}
+
+// TokenClaims are the claims of a validated access token. SessionID is nil
+// for tokens issued before sessions were tracked. ImpersonatorID is the admin
+// acting as UserID in an impersonation session, nil otherwise. Permissions is
+// nil unless the token embeds the role name and permissions of permission
+// version PermissionVersion.
+type TokenClaims struct {
+	UserID            uuid.UUID
+	RoleID            uuid.UUID
+	SessionID         uuid.UUID
+	ImpersonatorID    uuid.UUID
+	RoleName          string
+	Permissions       []string
+	PermissionVersion int64
+}
+
+// ImpersonateRequest gives the reason an admin acts as another user; it is
+// recorded with the impersonation.
+type ImpersonateRequest struct {
+	Reason string `json:"reason"`
+}
+
+// ImpersonationResponse is a short-lived access token acting as User on
+// behalf of the admin ImpersonatorID. It cannot be refreshed.
+type ImpersonationResponse struct {
+	Token          string    `json:"token"`
+	ExpiresAt      time.Time `json:"expires_at"`
+	User           *UserInfo `json:"user"`
+	ImpersonatorID uuid.UUID `json:"impersonator_id"`
+}
+
+// PasswordReset is a single-use token mailed to reset a forgotten password.
+type PasswordReset struct {
+	ID        uuid.UUID
+	UserID    uuid.UUID
+	TokenHash string
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" validate:"required"`
+	NewPassword     string `json:"new_password" validate:"required"`
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"required"`
+}
+
+type AcceptInvitationRequest struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"required,min=6"`
+}
@@ -0,0 +1,33 @@
+// Package mailer sends transactional email such as password reset links.
+package mailer
+
+import (
+	"context"
+	"log"
+	"strings"
+)
+
+// Message is a plain text email.
+type Message struct {
+	To      []string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers messages. Implementations must be safe for concurrent use.
+type Mailer interface {
+	Send(ctx context.Context, msg *Message) error
+}
+
+// LogMailer is used when no SMTP server is configured. It only logs that a
+// message was dropped, without its body, since bodies may contain tokens.
+type LogMailer struct{}
+
+func NewLogMailer() *LogMailer {
+	return &LogMailer{}
+}
+
+func (m *LogMailer) Send(ctx context.Context, msg *Message) error {
+	log.Printf("[WARN] SMTP not configured, mail %q to %s not sent", msg.Subject, strings.Join(msg.To, ", "))
+	return nil
+}
@@ -0,0 +1,123 @@
+package mailer
+
+import (
+	"context"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+)
+
+// smtpStandIn is a minimal in-process SMTP server that accepts one message.
+type smtpStandIn struct {
+	listener net.Listener
+	from     string
+	to       []string
+	data     string
+	done     chan struct{}
+}
+
+func newSMTPStandIn(t *testing.T) *smtpStandIn {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	s := &smtpStandIn{listener: listener, done: make(chan struct{})}
+	go s.serve()
+	t.Cleanup(func() { listener.Close() })
+	return s
+}
+
+func (s *smtpStandIn) port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+func (s *smtpStandIn) serve() {
+	defer close(s.done)
+	conn, err := s.listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	tp := textproto.NewConn(conn)
+	tp.PrintfLine("220 localhost ESMTP stand-in")
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		switch cmd {
+		case "EHLO", "HELO":
+			tp.PrintfLine("250-localhost")
+			tp.PrintfLine("250 8BITMIME")
+		case "MAIL":
+			// Drop parameters such as BODY=8BITMIME
+			s.from = strings.Fields(strings.TrimPrefix(line, "MAIL FROM:"))[0]
+			tp.PrintfLine("250 OK")
+		case "RCPT":
+			s.to = append(s.to, strings.TrimPrefix(line, "RCPT TO:"))
+			tp.PrintfLine("250 OK")
+		case "DATA":
+			tp.PrintfLine("354 End data with <CR><LF>.<CR><LF>")
+			lines, err := tp.ReadDotLines()
+			if err != nil {
+				return
+			}
+			s.data = strings.Join(lines, "\n")
+			tp.PrintfLine("250 OK")
+		case "QUIT":
+			tp.PrintfLine("221 Bye")
+			return
+		default:
+			tp.PrintfLine("502 Command not implemented")
+		}
+	}
+}
+
+func TestSMTPMailerSend(t *testing.T) {
+	server := newSMTPStandIn(t)
+	m := NewSMTPMailer(SMTPConfig{Host: "127.0.0.1", Port: server.port(), From: "no-reply@example.com"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err := m.Send(ctx, &Message{
+		To:      []string{"student@example.com"},
+		Subject: "Reset your password",
+		Body:    "Open the link below.\n.\nhttps://example.com/reset?token=abc",
+	})
+	if err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	<-server.done
+
+	if server.from != "<no-reply@example.com>" {
+		t.Errorf("from = %q", server.from)
+	}
+	if len(server.to) != 1 || server.to[0] != "<student@example.com>" {
+		t.Errorf("to = %v", server.to)
+	}
+
+	headers, body, _ := strings.Cut(server.data, "\n\n")
+	if !strings.Contains(headers, "Subject: Reset your password") {
+		t.Errorf("missing subject in headers:\n%s", headers)
+	}
+	if !strings.Contains(headers, "To: student@example.com") {
+		t.Errorf("missing recipient in headers:\n%s", headers)
+	}
+	// The lone dot must survive dot-stuffing
+	if want := "Open the link below.\n.\nhttps://example.com/reset?token=abc"; body != want {
+		t.Errorf("body = %q, want %q", body, want)
+	}
+}
+
+func TestSMTPMailerRequiresRecipient(t *testing.T) {
+	m := NewSMTPMailer(SMTPConfig{Host: "127.0.0.1", Port: 1, From: "no-reply@example.com"})
+	if err := m.Send(context.Background(), &Message{Subject: "x"}); err == nil {
+		t.Fatal("expected an error without recipients")
+	}
+}
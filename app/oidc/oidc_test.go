@@ -0,0 +1,224 @@
+package oidc
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// mockIdP is an identity provider serving discovery, JWKS and a token
+// endpoint that hands out one ID token for one code and PKCE challenge.
+type mockIdP struct {
+	server    *httptest.Server
+	kid       string
+	key       ed25519.PrivateKey
+	code      string
+	challenge string
+	claims    jwt.MapClaims
+}
+
+func newMockIdP(t *testing.T) *mockIdP {
+	t.Helper()
+	idp := &mockIdP{}
+	idp.rotate(t, "k1")
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 idp.server.URL,
+			"authorization_endpoint": idp.server.URL + "/authorize",
+			"token_endpoint":         idp.server.URL + "/token",
+			"jwks_uri":               idp.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "OKP",
+				"crv": "Ed25519",
+				"kid": idp.kid,
+				"use": "sig",
+				"alg": "EdDSA",
+				"x":   base64.RawURLEncoding.EncodeToString(idp.key.Public().(ed25519.PublicKey)),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if user, pass, _ := r.BasicAuth(); user != "client" || pass != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_client"})
+			return
+		}
+		if r.Form.Get("code") != idp.code || S256Challenge(r.Form.Get("code_verifier")) != idp.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id_token": idp.sign(t, idp.claims)})
+	})
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+	return idp
+}
+
+func (idp *mockIdP) rotate(t *testing.T, kid string) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp.kid, idp.key = kid, key
+}
+
+func (idp *mockIdP) sign(t *testing.T, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+	token.Header["kid"] = idp.kid
+	signed, err := token.SignedString(idp.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func (idp *mockIdP) idClaims(nonce string) jwt.MapClaims {
+	return jwt.MapClaims{
+		"iss":            idp.server.URL,
+		"sub":            "user-1",
+		"aud":            "client",
+		"exp":            time.Now().Add(time.Hour).Unix(),
+		"iat":            time.Now().Unix(),
+		"nonce":          nonce,
+		"email":          "student@example.ac.id",
+		"email_verified": true,
+		"nim":            "434221001",
+	}
+}
+
+func newTestProvider(idp *mockIdP) *Provider {
+	return NewProvider(Config{
+		IssuerURL:    idp.server.URL,
+		ClientID:     "client",
+		ClientSecret: "secret",
+		RedirectURL:  "http://localhost:8080/api/v1/auth/oidc/callback",
+	})
+}
+
+func TestAuthorizationCodeFlow(t *testing.T) {
+	idp := newMockIdP(t)
+	provider := newTestProvider(idp)
+	ctx := context.Background()
+
+	verifier, challenge, err := GeneratePKCE()
+	if err != nil {
+		t.Fatal(err)
+	}
+	authURL, err := provider.AuthCodeURL(ctx, "state-1", "nonce-1", challenge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, _ := url.Parse(authURL)
+	query := parsed.Query()
+	if !strings.HasPrefix(authURL, idp.server.URL+"/authorize?") ||
+		query.Get("state") != "state-1" || query.Get("nonce") != "nonce-1" ||
+		query.Get("code_challenge") != challenge || query.Get("code_challenge_method") != "S256" ||
+		query.Get("client_id") != "client" || query.Get("scope") != "openid email profile" {
+		t.Fatalf("unexpected authorization URL %s", authURL)
+	}
+
+	idp.code, idp.challenge, idp.claims = "code-1", challenge, idp.idClaims("nonce-1")
+	claims, err := provider.Exchange(ctx, "code-1", verifier, "nonce-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Subject != "user-1" || claims.Email != "student@example.ac.id" ||
+		claims.EmailVerified == nil || !*claims.EmailVerified || claims.Raw["nim"] != "434221001" {
+		t.Fatalf("unexpected claims %+v", claims)
+	}
+
+	if _, err := provider.Exchange(ctx, "code-1", "wrong-verifier", "nonce-1"); err == nil {
+		t.Fatal("exchange with a wrong code verifier succeeded")
+	}
+	if _, err := provider.Exchange(ctx, "code-1", verifier, "nonce-2"); err == nil {
+		t.Fatal("ID token with another nonce was accepted")
+	}
+}
+
+func TestVerifyIDTokenRejects(t *testing.T) {
+	idp := newMockIdP(t)
+	provider := newTestProvider(idp)
+	ctx := context.Background()
+
+	tests := map[string]func(jwt.MapClaims){
+		"wrong issuer":   func(c jwt.MapClaims) { c["iss"] = "https://other.example" },
+		"wrong audience": func(c jwt.MapClaims) { c["aud"] = "other" },
+		"expired":        func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() },
+		"no expiry":      func(c jwt.MapClaims) { delete(c, "exp") },
+		"foreign azp": func(c jwt.MapClaims) {
+			c["aud"] = []string{"client", "other"}
+			c["azp"] = "other"
+		},
+	}
+	for name, mutate := range tests {
+		claims := idp.idClaims("n")
+		mutate(claims)
+		if _, err := provider.VerifyIDToken(ctx, idp.sign(t, claims), "n"); err == nil {
+			t.Errorf("%s: token accepted", name)
+		}
+	}
+
+	hmac := jwt.NewWithClaims(jwt.SigningMethodHS256, idp.idClaims("n"))
+	signed, _ := hmac.SignedString([]byte("secret"))
+	if _, err := provider.VerifyIDToken(ctx, signed, "n"); err == nil {
+		t.Error("HS256 token signed with the client secret was accepted")
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	idp := newMockIdP(t)
+	provider := newTestProvider(idp)
+	ctx := context.Background()
+
+	if _, err := provider.VerifyIDToken(ctx, idp.sign(t, idp.idClaims("n")), "n"); err != nil {
+		t.Fatal(err)
+	}
+
+	// A new kid is fetched once the refetch interval has passed
+	idp.rotate(t, "k2")
+	provider.keys.fetchedAt = time.Now().Add(-minRefetchInterval)
+	if _, err := provider.VerifyIDToken(ctx, idp.sign(t, idp.idClaims("n")), "n"); err != nil {
+		t.Fatalf("token of rotated key rejected: %v", err)
+	}
+
+	// but not again right away
+	idp.rotate(t, "k3")
+	if _, err := provider.VerifyIDToken(ctx, idp.sign(t, idp.idClaims("n")), "n"); err == nil {
+		t.Fatal("unknown kid accepted without a JWKS refetch")
+	}
+}
+
+func TestDiscoveryIssuerMismatch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 "https://idp.example",
+			"authorization_endpoint": "https://idp.example/authorize",
+			"token_endpoint":         "https://idp.example/token",
+			"jwks_uri":               "https://idp.example/jwks",
+		})
+	}))
+	defer server.Close()
+
+	provider := NewProvider(Config{IssuerURL: server.URL, ClientID: "client"})
+	if _, err := provider.Metadata(context.Background()); err == nil || !strings.Contains(err.Error(), "does not match") {
+		t.Fatalf("expected issuer mismatch, got %v", err)
+	}
+}
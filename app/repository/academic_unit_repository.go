@@ -0,0 +1,314 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/Aryma-f4/uas-backend/app/entity"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+type AcademicUnitRepository struct {
+	db *sql.DB
+}
+
+func NewAcademicUnitRepository(db *sql.DB) *AcademicUnitRepository {
+	return &AcademicUnitRepository{db: db}
+}
+
+// normalizedName lowercases a free-text column and collapses whitespace, the
+// same normalization applied to stored aliases.
+func normalizedName(column string) string {
+	return fmt.Sprintf(`lower(regexp_replace(trim(%s), '\s+', ' ', 'g'))`, column)
+}
+
+// Faculties
+
+func (r *AcademicUnitRepository) CreateFaculty(ctx context.Context, faculty *entity.Faculty) error {
+	query := `INSERT INTO faculties (id, code, name) VALUES ($1, $2, $3) RETURNING created_at`
+	return r.db.QueryRowContext(ctx, query, faculty.ID, faculty.Code, faculty.Name).Scan(&faculty.CreatedAt)
+}
+
+func (r *AcademicUnitRepository) UpdateFaculty(ctx context.Context, faculty *entity.Faculty) error {
+	query := `UPDATE faculties SET code = $2, name = $3 WHERE id = $1`
+	return execOne(r.db.ExecContext(ctx, query, faculty.ID, faculty.Code, faculty.Name))
+}
+
+func (r *AcademicUnitRepository) DeleteFaculty(ctx context.Context, id uuid.UUID) error {
+	return execOne(r.db.ExecContext(ctx, `DELETE FROM faculties WHERE id = $1`, id))
+}
+
+func (r *AcademicUnitRepository) GetFaculty(ctx context.Context, id uuid.UUID) (*entity.Faculty, error) {
+	query := `SELECT id, code, name, created_at FROM faculties WHERE id = $1`
+	faculty := &entity.Faculty{}
+	err := r.db.QueryRowContext(ctx, query, id).Scan(&faculty.ID, &faculty.Code, &faculty.Name, &faculty.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return faculty, nil
+}
+
+func (r *AcademicUnitRepository) ListFaculties(ctx context.Context) ([]*entity.Faculty, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT id, code, name, created_at FROM faculties ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	faculties := []*entity.Faculty{}
+	for rows.Next() {
+		faculty := &entity.Faculty{}
+		if err := rows.Scan(&faculty.ID, &faculty.Code, &faculty.Name, &faculty.CreatedAt); err != nil {
+			return nil, err
+		}
+		faculties = append(faculties, faculty)
+	}
+	return faculties, nil
+}
+
+// Departments
+
+func (r *AcademicUnitRepository) CreateDepartment(ctx context.Context, department *entity.Department) error {
+	query := `
+		INSERT INTO departments (id, faculty_id, code, name, aliases)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING created_at
+	`
+	return r.db.QueryRowContext(ctx, query,
+		department.ID, department.FacultyID, department.Code, department.Name, pq.Array(department.Aliases),
+	).Scan(&department.CreatedAt)
+}
+
+func (r *AcademicUnitRepository) UpdateDepartment(ctx context.Context, department *entity.Department) error {
+	query := `UPDATE departments SET faculty_id = $2, code = $3, name = $4, aliases = $5 WHERE id = $1`
+	return execOne(r.db.ExecContext(ctx, query,
+		department.ID, department.FacultyID, department.Code, department.Name, pq.Array(department.Aliases),
+	))
+}
+
+func (r *AcademicUnitRepository) DeleteDepartment(ctx context.Context, id uuid.UUID) error {
+	return execOne(r.db.ExecContext(ctx, `DELETE FROM departments WHERE id = $1`, id))
+}
+
+func (r *AcademicUnitRepository) GetDepartment(ctx context.Context, id uuid.UUID) (*entity.Department, error) {
+	departments, err := r.listDepartments(ctx, `WHERE d.id = $1`, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(departments) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return departments[0], nil
+}
+
+func (r *AcademicUnitRepository) ListDepartments(ctx context.Context, facultyID *uuid.UUID) ([]*entity.Department, error) {
+	return r.listDepartments(ctx, `WHERE ($1::uuid IS NULL OR d.faculty_id = $1)`, facultyID)
+}
+
+func (r *AcademicUnitRepository) listDepartments(ctx context.Context, where string, args ...interface{}) ([]*entity.Department, error) {
+	query := `
+		SELECT d.id, d.faculty_id, f.name, d.code, d.name, d.aliases, d.created_at
+		FROM departments d
+		JOIN faculties f ON d.faculty_id = f.id
+		` + where + `
+		ORDER BY d.name
+	`
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	departments := []*entity.Department{}
+	for rows.Next() {
+		d := &entity.Department{}
+		if err := rows.Scan(&d.ID, &d.FacultyID, &d.FacultyName, &d.Code, &d.Name, pq.Array(&d.Aliases), &d.CreatedAt); err != nil {
+			return nil, err
+		}
+		departments = append(departments, d)
+	}
+	return departments, nil
+}
+
+// Study programs
+
+func (r *AcademicUnitRepository) CreateStudyProgram(ctx context.Context, program *entity.StudyProgram) error {
+	query := `
+		INSERT INTO study_programs (id, department_id, code, name, degree, aliases)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING created_at
+	`
+	return r.db.QueryRowContext(ctx, query,
+		program.ID, program.DepartmentID, program.Code, program.Name, program.Degree, pq.Array(program.Aliases),
+	).Scan(&program.CreatedAt)
+}
+
+func (r *AcademicUnitRepository) UpdateStudyProgram(ctx context.Context, program *entity.StudyProgram) error {
+	query := `UPDATE study_programs SET department_id = $2, code = $3, name = $4, degree = $5, aliases = $6 WHERE id = $1`
+	return execOne(r.db.ExecContext(ctx, query,
+		program.ID, program.DepartmentID, program.Code, program.Name, program.Degree, pq.Array(program.Aliases),
+	))
+}
+
+func (r *AcademicUnitRepository) DeleteStudyProgram(ctx context.Context, id uuid.UUID) error {
+	return execOne(r.db.ExecContext(ctx, `DELETE FROM study_programs WHERE id = $1`, id))
+}
+
+func (r *AcademicUnitRepository) GetStudyProgram(ctx context.Context, id uuid.UUID) (*entity.StudyProgram, error) {
+	programs, err := r.listStudyPrograms(ctx, `WHERE p.id = $1`, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(programs) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return programs[0], nil
+}
+
+func (r *AcademicUnitRepository) ListStudyPrograms(ctx context.Context, filter *entity.AcademicUnitFilter) ([]*entity.StudyProgram, error) {
+	return r.listStudyPrograms(ctx,
+		`WHERE ($1::uuid IS NULL OR d.faculty_id = $1) AND ($2::uuid IS NULL OR p.department_id = $2)`,
+		filter.FacultyID, filter.DepartmentID,
+	)
+}
+
+func (r *AcademicUnitRepository) listStudyPrograms(ctx context.Context, where string, args ...interface{}) ([]*entity.StudyProgram, error) {
+	query := `
+		SELECT p.id, p.department_id, d.name, d.faculty_id, p.code, p.name, COALESCE(p.degree, ''), p.aliases, p.created_at
+		FROM study_programs p
+		JOIN departments d ON p.department_id = d.id
+		` + where + `
+		ORDER BY p.name
+	`
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	programs := []*entity.StudyProgram{}
+	for rows.Next() {
+		p := &entity.StudyProgram{}
+		if err := rows.Scan(
+			&p.ID, &p.DepartmentID, &p.DepartmentName, &p.FacultyID, &p.Code, &p.Name, &p.Degree,
+			pq.Array(&p.Aliases), &p.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		programs = append(programs, p)
+	}
+	return programs, nil
+}
+
+// LinkUnmatched sets students.study_program_id and lecturers.department_id
+// for rows that have none yet, by matching their free-text program or
+// department against unit names, codes and aliases. A lecturer whose
+// department text names a study program is linked to that program's
+// department. Rows that are already linked are never touched, so this is
+// safe to run on every startup.
+func (r *AcademicUnitRepository) LinkUnmatched(ctx context.Context) (*entity.AcademicUnitLinkResult, error) {
+	studentName := normalizedName("s.program_study")
+	studentQuery := `
+		WITH matches AS (
+			SELECT DISTINCT ON (s.id) s.id AS student_id, p.id AS program_id
+			FROM students s
+			JOIN study_programs p ON ` + studentName + ` IN (lower(p.name), lower(p.code))
+			                      OR ` + studentName + ` = ANY(p.aliases)
+			WHERE s.study_program_id IS NULL
+			ORDER BY s.id, (` + studentName + ` = lower(p.name)) DESC, p.code
+		)
+		UPDATE students s SET study_program_id = m.program_id
+		FROM matches m
+		WHERE s.id = m.student_id
+	`
+
+	lecturerName := normalizedName("l.department")
+	lecturerQuery := `
+		WITH matches AS (
+			SELECT DISTINCT ON (l.id) l.id AS lecturer_id, d.id AS department_id
+			FROM lecturers l
+			JOIN departments d ON ` + lecturerName + ` IN (lower(d.name), lower(d.code))
+			                   OR ` + lecturerName + ` = ANY(d.aliases)
+			                   OR EXISTS (
+			                       SELECT 1 FROM study_programs p
+			                       WHERE p.department_id = d.id
+			                         AND (` + lecturerName + ` IN (lower(p.name), lower(p.code)) OR ` + lecturerName + ` = ANY(p.aliases))
+			                   )
+			WHERE l.department_id IS NULL
+			ORDER BY l.id, (` + lecturerName + ` = lower(d.name)) DESC, d.code
+		)
+		UPDATE lecturers l SET department_id = m.department_id
+		FROM matches m
+		WHERE l.id = m.lecturer_id
+	`
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	result := &entity.AcademicUnitLinkResult{}
+
+	res, err := tx.ExecContext(ctx, studentQuery)
+	if err != nil {
+		return nil, err
+	}
+	result.StudentsLinked, _ = res.RowsAffected()
+
+	res, err = tx.ExecContext(ctx, lecturerQuery)
+	if err != nil {
+		return nil, err
+	}
+	result.LecturersLinked, _ = res.RowsAffected()
+
+	if err := tx.QueryRowContext(ctx, `
+		SELECT
+			(SELECT COUNT(*) FROM students WHERE study_program_id IS NULL AND COALESCE(trim(program_study), '') <> ''),
+			(SELECT COUNT(*) FROM lecturers WHERE department_id IS NULL AND COALESCE(trim(department), '') <> '')
+	`).Scan(&result.UnlinkedStudents, &result.UnlinkedLecturers); err != nil {
+		return nil, err
+	}
+
+	return result, tx.Commit()
+}
+
+// ListUnlinkedNames returns the distinct free-text programs and departments
+// that LinkUnmatched could not resolve, most frequent first.
+func (r *AcademicUnitRepository) ListUnlinkedNames(ctx context.Context) ([]*entity.UnlinkedUnitName, error) {
+	query := `
+		SELECT 'study_program', trim(program_study), COUNT(*)
+		FROM students
+		WHERE study_program_id IS NULL AND COALESCE(trim(program_study), '') <> ''
+		GROUP BY trim(program_study)
+		UNION ALL
+		SELECT 'department', trim(department), COUNT(*)
+		FROM lecturers
+		WHERE department_id IS NULL AND COALESCE(trim(department), '') <> ''
+		GROUP BY trim(department)
+		ORDER BY 3 DESC, 2
+	`
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	names := []*entity.UnlinkedUnitName{}
+	for rows.Next() {
+		n := &entity.UnlinkedUnitName{}
+		if err := rows.Scan(&n.Kind, &n.Name, &n.Count); err != nil {
+			return nil, err
+		}
+		names = append(names, n)
+	}
+	return names, nil
+}
+
+func (r *AcademicUnitRepository) CountUnlinkedStudents(ctx context.Context) (int, error) {
+	var count int
+	err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM students WHERE study_program_id IS NULL`).Scan(&count)
+	return count, err
+}
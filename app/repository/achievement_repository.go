@@ -75,24 +75,54 @@ func (r *AchievementRepository) ListMongo(ctx context.Context, filter bson.M, li
 	return achievements, nil
 }
 
+// ListMongoByIDs fetches the given documents, optionally restricted to one achievement type.
+func (r *AchievementRepository) ListMongoByIDs(ctx context.Context, ids []primitive.ObjectID, achievementType string) ([]*entity.Achievement, error) {
+	filter := bson.M{"_id": bson.M{"$in": ids}}
+	if achievementType != "" {
+		filter["achievementType"] = achievementType
+	}
+
+	cursor, err := r.collection.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var achievements []*entity.Achievement
+	if err := cursor.All(ctx, &achievements); err != nil {
+		return nil, err
+	}
+	return achievements, nil
+}
+
+func (r *AchievementRepository) DeleteMongoByImportBatch(ctx context.Context, batchID uuid.UUID) (int64, error) {
+	result, err := r.collection.DeleteMany(ctx, bson.M{"importBatchId": batchID.String()})
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
+
 func (r *AchievementRepository) CountMongo(ctx context.Context, filter bson.M) (int64, error) {
 	return r.collection.CountDocuments(ctx, filter)
 }
 
+// GetStatsMongo counts achievements per type for the given students. A nil
+// slice counts every student.
 func (r *AchievementRepository) GetStatsMongo(ctx context.Context, studentIDs []uuid.UUID) (map[string]int, error) {
-	// Convert UUIDs to interface slice for $in query
-	ids := make([]interface{}, len(studentIDs))
-	for i, id := range studentIDs {
-		ids[i] = id
-	}
-
-	pipeline := mongo.Pipeline{
-		{{Key: "$match", Value: bson.M{"studentId": bson.M{"$in": ids}}}},
-		{{Key: "$group", Value: bson.M{
-			"_id":   "$achievementType",
-			"count": bson.M{"$sum": 1},
-		}}},
+	pipeline := mongo.Pipeline{}
+	if studentIDs != nil {
+		// Convert UUIDs to interface slice for $in query
+		ids := make([]interface{}, len(studentIDs))
+		for i, id := range studentIDs {
+			ids[i] = id
+		}
+		pipeline = append(pipeline, bson.D{{Key: "$match", Value: bson.M{"studentId": bson.M{"$in": ids}}}})
 	}
+	pipeline = append(pipeline, bson.D{{Key: "$group", Value: bson.M{
+		"_id":   "$achievementType",
+		"count": bson.M{"$sum": 1},
+	}}})
 
 	cursor, err := r.collection.Aggregate(ctx, pipeline)
 	if err != nil {
@@ -114,13 +144,88 @@ func (r *AchievementRepository) GetStatsMongo(ctx context.Context, studentIDs []
 	return stats, nil
 }
 
+// LeaderboardMongo ranks students by the points of the given documents,
+// optionally restricted to one achievement type, and returns one page plus
+// the number of ranked students. Ranks are shared on equal points and
+// achievement count; rows with a shared rank are ordered by student ID.
+func (r *AchievementRepository) LeaderboardMongo(ctx context.Context, ids []primitive.ObjectID, achievementType string, limit, offset int) ([]*entity.LeaderboardEntry, int, error) {
+	entries := []*entity.LeaderboardEntry{}
+	if len(ids) == 0 {
+		return entries, 0, nil
+	}
+
+	match := bson.M{"_id": bson.M{"$in": ids}}
+	if achievementType != "" {
+		match["achievementType"] = achievementType
+	}
+
+	ranking := bson.D{{Key: "points", Value: -1}, {Key: "achievements", Value: -1}}
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$group", Value: bson.M{
+			"_id":          "$studentId",
+			"points":       bson.M{"$sum": "$points"},
+			"achievements": bson.M{"$sum": 1},
+		}}},
+		{{Key: "$setWindowFields", Value: bson.M{
+			"sortBy": ranking,
+			"output": bson.M{"rank": bson.M{"$rank": bson.M{}}},
+		}}},
+		{{Key: "$facet", Value: bson.M{
+			"rows": bson.A{
+				bson.M{"$sort": append(ranking, bson.E{Key: "_id", Value: 1})},
+				bson.M{"$skip": offset},
+				bson.M{"$limit": limit},
+			},
+			"total": bson.A{bson.M{"$count": "count"}},
+		}}},
+	}
+
+	cursor, err := r.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var result struct {
+		Rows []struct {
+			StudentID    uuid.UUID `bson:"_id"`
+			Points       int       `bson:"points"`
+			Achievements int       `bson:"achievements"`
+			Rank         int       `bson:"rank"`
+		} `bson:"rows"`
+		Total []struct {
+			Count int `bson:"count"`
+		} `bson:"total"`
+	}
+	if cursor.Next(ctx) {
+		if err := cursor.Decode(&result); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	for _, row := range result.Rows {
+		entries = append(entries, &entity.LeaderboardEntry{
+			Rank:         row.Rank,
+			StudentID:    row.StudentID,
+			TotalPoints:  row.Points,
+			Achievements: row.Achievements,
+		})
+	}
+	total := 0
+	if len(result.Total) > 0 {
+		total = result.Total[0].Count
+	}
+	return entries, total, cursor.Err()
+}
+
 // PostgreSQL Operations (Achievement References)
 func (r *AchievementRepository) CreateReference(ctx context.Context, ref *entity.AchievementReference) error {
 	query := `
-		INSERT INTO achievement_references (id, student_id, mongo_achievement_id, status)
-		VALUES ($1, $2, $3, $4)
+		INSERT INTO achievement_references (id, student_id, mongo_achievement_id, status, import_batch_id)
+		VALUES ($1, $2, $3, $4, $5)
 	`
-	_, err := r.db.ExecContext(ctx, query, ref.ID, ref.StudentID, ref.MongoAchievementID, ref.Status)
+	_, err := r.db.ExecContext(ctx, query, ref.ID, ref.StudentID, ref.MongoAchievementID, ref.Status, ref.ImportBatchID)
 	return err
 }
 
@@ -277,6 +382,62 @@ func (r *AchievementRepository) ListReferences(ctx context.Context, studentID *u
 	return refs, total, nil
 }
 
+// StreamReferences calls fn for every reference matching the filters without
+// loading them all into memory. A nil studentIDs slice means every student.
+func (r *AchievementRepository) StreamReferences(ctx context.Context, studentIDs []uuid.UUID, status string, fn func(*entity.AchievementReference) error) error {
+	query := `
+		SELECT id, student_id, mongo_achievement_id, status, submitted_at, verified_at, verified_by, rejection_note, created_at, updated_at
+		FROM achievement_references
+		WHERE ($1::uuid[] IS NULL OR student_id = ANY($1::uuid[]))
+		  AND ($2 = '' OR status = $2)
+		ORDER BY created_at DESC
+	`
+	var ids interface{}
+	if studentIDs != nil {
+		ids = uuidArray(studentIDs)
+	}
+
+	rows, err := r.db.QueryContext(ctx, query, ids, status)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		ref := &entity.AchievementReference{}
+		var submittedAt, verifiedAt sql.NullTime
+		var verifiedBy, rejectionNote sql.NullString
+
+		if err := rows.Scan(
+			&ref.ID, &ref.StudentID, &ref.MongoAchievementID, &ref.Status,
+			&submittedAt, &verifiedAt, &verifiedBy, &rejectionNote,
+			&ref.CreatedAt, &ref.UpdatedAt,
+		); err != nil {
+			return err
+		}
+
+		if submittedAt.Valid {
+			ref.SubmittedAt = &submittedAt.Time
+		}
+		if verifiedAt.Valid {
+			ref.VerifiedAt = &verifiedAt.Time
+		}
+		if verifiedBy.Valid {
+			id, _ := uuid.Parse(verifiedBy.String)
+			ref.VerifiedBy = &id
+		}
+		if rejectionNote.Valid {
+			ref.RejectionNote = rejectionNote.String
+		}
+
+		if err := fn(ref); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
 func (r *AchievementRepository) ListReferencesByStudentIDs(ctx context.Context, studentIDs []uuid.UUID, status string, limit, offset int) ([]*entity.AchievementReference, int, error) {
 	if len(studentIDs) == 0 {
 		return []*entity.AchievementReference{}, 0, nil
@@ -366,18 +527,18 @@ func (r *AchievementRepository) ListReferencesByStudentIDs(ctx context.Context,
 
 func (r *AchievementRepository) AddStatusHistory(ctx context.Context, history *entity.AchievementStatusHistory) error {
 	query := `
-		INSERT INTO achievement_status_history (id, achievement_ref_id, old_status, new_status, changed_by, note)
-		VALUES ($1, $2, $3, $4, $5, $6)
+		INSERT INTO achievement_status_history (id, achievement_ref_id, old_status, new_status, changed_by, impersonated_by, note)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
 	`
 	_, err := r.db.ExecContext(ctx, query,
-		history.ID, history.AchievementRefID, history.OldStatus, history.NewStatus, history.ChangedBy, history.Note,
+		history.ID, history.AchievementRefID, history.OldStatus, history.NewStatus, history.ChangedBy, history.ImpersonatedBy, history.Note,
 	)
 	return err
 }
 
 func (r *AchievementRepository) GetStatusHistory(ctx context.Context, achievementRefID uuid.UUID) ([]*entity.AchievementStatusHistory, error) {
 	query := `
-		SELECT id, achievement_ref_id, old_status, new_status, changed_by, note, created_at
+		SELECT id, achievement_ref_id, old_status, new_status, changed_by, impersonated_by, note, created_at
 		FROM achievement_status_history
 		WHERE achievement_ref_id = $1
 		ORDER BY created_at ASC
@@ -392,7 +553,7 @@ func (r *AchievementRepository) GetStatusHistory(ctx context.Context, achievemen
 	for rows.Next() {
 		h := &entity.AchievementStatusHistory{}
 		var oldStatus sql.NullString
-		if err := rows.Scan(&h.ID, &h.AchievementRefID, &oldStatus, &h.NewStatus, &h.ChangedBy, &h.Note, &h.CreatedAt); err != nil {
+		if err := rows.Scan(&h.ID, &h.AchievementRefID, &oldStatus, &h.NewStatus, &h.ChangedBy, &h.ImpersonatedBy, &h.Note, &h.CreatedAt); err != nil {
 			return nil, err
 		}
 		if oldStatus.Valid {
@@ -403,7 +564,55 @@ func (r *AchievementRepository) GetStatusHistory(ctx context.Context, achievemen
 	return history, nil
 }
 
-func (r *AchievementRepository) GetStatistics(ctx context.Context, studentID *uuid.UUID) (*entity.StatisticsResponse, error) {
+// StreamStatusChanges calls fn for every change to status in [from, to),
+// oldest first. Entries that keep the status, such as verification
+// transfers after an advisor change, are skipped. A nil studentIDs slice
+// means every student.
+func (r *AchievementRepository) StreamStatusChanges(ctx context.Context, studentIDs []uuid.UUID, status string, from, to time.Time, fn func(*entity.StatusChange) error) error {
+	query := `
+		SELECT h.created_at, ar.mongo_achievement_id, s.study_program_id, COALESCE(p.name, '')
+		FROM achievement_status_history h
+		JOIN achievement_references ar ON h.achievement_ref_id = ar.id
+		JOIN students s ON ar.student_id = s.id
+		LEFT JOIN study_programs p ON s.study_program_id = p.id
+		WHERE h.new_status = $1
+		  AND h.old_status IS DISTINCT FROM h.new_status
+		  AND h.created_at >= $2 AND h.created_at < $3
+		  AND ($4::uuid[] IS NULL OR ar.student_id = ANY($4::uuid[]))
+		ORDER BY h.created_at
+	`
+	var ids interface{}
+	if studentIDs != nil {
+		ids = uuidArray(studentIDs)
+	}
+
+	rows, err := r.db.QueryContext(ctx, query, status, from, to, ids)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		change := &entity.StatusChange{}
+		var programID sql.NullString
+		if err := rows.Scan(&change.ChangedAt, &change.MongoAchievementID, &programID, &change.StudyProgramName); err != nil {
+			return err
+		}
+		if programID.Valid {
+			id, _ := uuid.Parse(programID.String)
+			change.StudyProgramID = &id
+		}
+		if err := fn(change); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// GetStatistics counts references per status for the given students. A nil
+// slice counts every student.
+func (r *AchievementRepository) GetStatistics(ctx context.Context, studentIDs []uuid.UUID) (*entity.StatisticsResponse, error) {
 	stats := &entity.StatisticsResponse{
 		ByType:   make(map[string]int),
 		ByStatus: make(map[string]int),
@@ -412,14 +621,14 @@ func (r *AchievementRepository) GetStatistics(ctx context.Context, studentID *uu
 	var statusQuery string
 	var args []interface{}
 
-	if studentID != nil {
+	if studentIDs != nil {
 		statusQuery = `
 			SELECT status, COUNT(*) as count
 			FROM achievement_references
-			WHERE student_id = $1
+			WHERE student_id = ANY($1::uuid[])
 			GROUP BY status
 		`
-		args = []interface{}{studentID}
+		args = []interface{}{uuidArray(studentIDs)}
 	} else {
 		statusQuery = `
 			SELECT status, COUNT(*) as count
@@ -456,3 +665,192 @@ func (r *AchievementRepository) GetStatistics(ctx context.Context, studentID *uu
 
 	return stats, nil
 }
+
+// ListVerifiedByStudyProgram returns the verified references of students
+// linked to the study program.
+func (r *AchievementRepository) ListVerifiedByStudyProgram(ctx context.Context, programID uuid.UUID) ([]*entity.AchievementReference, error) {
+	query := `
+		SELECT ar.id, ar.student_id, ar.mongo_achievement_id, ar.verified_at
+		FROM achievement_references ar
+		JOIN students s ON ar.student_id = s.id
+		WHERE s.study_program_id = $1 AND ar.status = 'verified'
+		ORDER BY ar.verified_at
+	`
+	rows, err := r.db.QueryContext(ctx, query, programID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var refs []*entity.AchievementReference
+	for rows.Next() {
+		ref := &entity.AchievementReference{Status: entity.StatusVerified}
+		var verifiedAt sql.NullTime
+		if err := rows.Scan(&ref.ID, &ref.StudentID, &ref.MongoAchievementID, &verifiedAt); err != nil {
+			return nil, err
+		}
+		if verifiedAt.Valid {
+			ref.VerifiedAt = &verifiedAt.Time
+		}
+		refs = append(refs, ref)
+	}
+	return refs, rows.Err()
+}
+
+// ListLeaderboardMongoIDs returns the Mongo IDs of verified achievements of
+// students in the given unit and academic year, verified within [from, to).
+// Students who opted out are skipped unless includeHidden is set.
+func (r *AchievementRepository) ListLeaderboardMongoIDs(ctx context.Context, units *entity.AcademicUnitFilter, academicYear string, from, to *time.Time, includeHidden bool) ([]primitive.ObjectID, error) {
+	query := `
+		SELECT ar.mongo_achievement_id
+		FROM achievement_references ar
+		JOIN students s ON ar.student_id = s.id
+		LEFT JOIN study_programs p ON s.study_program_id = p.id
+		LEFT JOIN departments d ON p.department_id = d.id
+		WHERE ar.status = 'verified'
+		  AND ($1::uuid IS NULL OR d.faculty_id = $1)
+		  AND ($2::uuid IS NULL OR p.department_id = $2)
+		  AND ($3::uuid IS NULL OR s.study_program_id = $3)
+		  AND ($4 = '' OR s.academic_year = $4)
+		  AND ($5::timestamp IS NULL OR ar.verified_at >= $5)
+		  AND ($6::timestamp IS NULL OR ar.verified_at < $6)
+		  AND ($7 OR NOT s.hide_from_leaderboard)
+	`
+	rows, err := r.db.QueryContext(ctx, query,
+		units.FacultyID, units.DepartmentID, units.StudyProgramID, academicYear, from, to, includeHidden,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []primitive.ObjectID
+	for rows.Next() {
+		var hex string
+		if err := rows.Scan(&hex); err != nil {
+			return nil, err
+		}
+		if id, err := primitive.ObjectIDFromHex(hex); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+func (r *AchievementRepository) CreateImportBatch(ctx context.Context, batch *entity.AchievementImportBatch) error {
+	query := `
+		INSERT INTO achievement_import_batches (id, file_name, initial_status, total_rows, imported_rows, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`
+	_, err := r.db.ExecContext(ctx, query,
+		batch.ID, batch.FileName, batch.InitialStatus, batch.TotalRows, batch.ImportedRows, batch.CreatedBy,
+	)
+	return err
+}
+
+func (r *AchievementRepository) UpdateImportBatchCount(ctx context.Context, batchID uuid.UUID, importedRows int) error {
+	query := `UPDATE achievement_import_batches SET imported_rows = $2 WHERE id = $1`
+	_, err := r.db.ExecContext(ctx, query, batchID, importedRows)
+	return err
+}
+
+// RollbackImportBatch deletes the references created by a batch and marks
+// it rolled back in one transaction, returning the students they belonged
+// to. It returns sql.ErrNoRows if the batch was already rolled back. The
+// Mongo documents are left to the caller.
+func (r *AchievementRepository) RollbackImportBatch(ctx context.Context, batchID uuid.UUID) ([]uuid.UUID, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err := execOne(tx.ExecContext(ctx,
+		`UPDATE achievement_import_batches SET rolled_back_at = NOW() WHERE id = $1 AND rolled_back_at IS NULL`,
+		batchID,
+	)); err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.QueryContext(ctx, `DELETE FROM achievement_references WHERE import_batch_id = $1 RETURNING student_id`, batchID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	seen := make(map[uuid.UUID]bool)
+	var studentIDs []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		if !seen[id] {
+			seen[id] = true
+			studentIDs = append(studentIDs, id)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return studentIDs, tx.Commit()
+}
+
+func (r *AchievementRepository) GetImportBatch(ctx context.Context, batchID uuid.UUID) (*entity.AchievementImportBatch, error) {
+	query := `
+		SELECT id, COALESCE(file_name, ''), initial_status, total_rows, imported_rows, created_by, rolled_back_at, created_at
+		FROM achievement_import_batches
+		WHERE id = $1
+	`
+	batch := &entity.AchievementImportBatch{}
+	var rolledBackAt sql.NullTime
+	err := r.db.QueryRowContext(ctx, query, batchID).Scan(
+		&batch.ID, &batch.FileName, &batch.InitialStatus, &batch.TotalRows, &batch.ImportedRows,
+		&batch.CreatedBy, &rolledBackAt, &batch.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if rolledBackAt.Valid {
+		batch.RolledBackAt = &rolledBackAt.Time
+	}
+	return batch, nil
+}
+
+func (r *AchievementRepository) ListImportBatches(ctx context.Context, limit, offset int) ([]*entity.AchievementImportBatch, int, error) {
+	var total int
+	if err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM achievement_import_batches`).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	query := `
+		SELECT id, COALESCE(file_name, ''), initial_status, total_rows, imported_rows, created_by, rolled_back_at, created_at
+		FROM achievement_import_batches
+		ORDER BY created_at DESC
+		LIMIT $1 OFFSET $2
+	`
+	rows, err := r.db.QueryContext(ctx, query, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var batches []*entity.AchievementImportBatch
+	for rows.Next() {
+		batch := &entity.AchievementImportBatch{}
+		var rolledBackAt sql.NullTime
+		if err := rows.Scan(
+			&batch.ID, &batch.FileName, &batch.InitialStatus, &batch.TotalRows, &batch.ImportedRows,
+			&batch.CreatedBy, &rolledBackAt, &batch.CreatedAt,
+		); err != nil {
+			return nil, 0, err
+		}
+		if rolledBackAt.Valid {
+			batch.RolledBackAt = &rolledBackAt.Time
+		}
+		batches = append(batches, batch)
+	}
+
+	return batches, total, nil
+}
@@ -18,37 +18,70 @@ func NewLecturerRepository(db *sql.DB) *LecturerRepository {
 
 func (r *LecturerRepository) GetByID(ctx context.Context, id uuid.UUID) (*entity.Lecturer, error) {
 	query := `
-		SELECT l.id, l.user_id, l.lecturer_id, u.full_name, u.email, l.department, l.created_at
+		SELECT l.id, l.user_id, l.lecturer_id, u.full_name, u.email, l.department, l.department_id, l.created_at
 		FROM lecturers l
 		JOIN users u ON l.user_id = u.id
 		WHERE l.id = $1
 	`
 	lecturer := &entity.Lecturer{}
+	var departmentID sql.NullString
 	err := r.db.QueryRowContext(ctx, query, id).Scan(
 		&lecturer.ID, &lecturer.UserID, &lecturer.LecturerID, &lecturer.FullName, &lecturer.Email,
-		&lecturer.Department, &lecturer.CreatedAt,
+		&lecturer.Department, &departmentID, &lecturer.CreatedAt,
 	)
 	if err != nil {
 		return nil, err
 	}
+	if departmentID.Valid {
+		did, _ := uuid.Parse(departmentID.String)
+		lecturer.DepartmentID = &did
+	}
 	return lecturer, nil
 }
 
 func (r *LecturerRepository) GetByUserID(ctx context.Context, userID uuid.UUID) (*entity.Lecturer, error) {
 	query := `
-		SELECT l.id, l.user_id, l.lecturer_id, u.full_name, u.email, l.department, l.created_at
+		SELECT l.id, l.user_id, l.lecturer_id, u.full_name, u.email, l.department, l.department_id, l.created_at
 		FROM lecturers l
 		JOIN users u ON l.user_id = u.id
 		WHERE l.user_id = $1
 	`
 	lecturer := &entity.Lecturer{}
+	var departmentID sql.NullString
 	err := r.db.QueryRowContext(ctx, query, userID).Scan(
 		&lecturer.ID, &lecturer.UserID, &lecturer.LecturerID, &lecturer.FullName, &lecturer.Email,
-		&lecturer.Department, &lecturer.CreatedAt,
+		&lecturer.Department, &departmentID, &lecturer.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if departmentID.Valid {
+		did, _ := uuid.Parse(departmentID.String)
+		lecturer.DepartmentID = &did
+	}
+	return lecturer, nil
+}
+
+func (r *LecturerRepository) GetByLecturerID(ctx context.Context, nip string) (*entity.Lecturer, error) {
+	query := `
+		SELECT l.id, l.user_id, l.lecturer_id, u.full_name, u.email, l.department, l.department_id, l.created_at
+		FROM lecturers l
+		JOIN users u ON l.user_id = u.id
+		WHERE l.lecturer_id = $1
+	`
+	lecturer := &entity.Lecturer{}
+	var departmentID sql.NullString
+	err := r.db.QueryRowContext(ctx, query, nip).Scan(
+		&lecturer.ID, &lecturer.UserID, &lecturer.LecturerID, &lecturer.FullName, &lecturer.Email,
+		&lecturer.Department, &departmentID, &lecturer.CreatedAt,
 	)
 	if err != nil {
 		return nil, err
 	}
+	if departmentID.Valid {
+		did, _ := uuid.Parse(departmentID.String)
+		lecturer.DepartmentID = &did
+	}
 	return lecturer, nil
 }
 
@@ -61,6 +94,17 @@ func (r *LecturerRepository) Create(ctx context.Context, lecturer *entity.Lectur
 	return err
 }
 
+// UpdateDepartment links the lecturer to a department and keeps the
+// free-text department column in sync with the department name.
+func (r *LecturerRepository) UpdateDepartment(ctx context.Context, lecturerID, departmentID uuid.UUID) error {
+	query := `
+		UPDATE lecturers l SET department_id = d.id, department = d.name
+		FROM departments d
+		WHERE l.id = $1 AND d.id = $2
+	`
+	return execOne(r.db.ExecContext(ctx, query, lecturerID, departmentID))
+}
+
 func (r *LecturerRepository) List(ctx context.Context, limit, offset int) ([]*entity.Lecturer, int, error) {
 	var total int
 	countQuery := `SELECT COUNT(*) FROM lecturers`
@@ -69,7 +113,7 @@ func (r *LecturerRepository) List(ctx context.Context, limit, offset int) ([]*en
 	}
 
 	query := `
-		SELECT l.id, l.user_id, l.lecturer_id, u.full_name, u.email, l.department, l.created_at
+		SELECT l.id, l.user_id, l.lecturer_id, u.full_name, u.email, l.department, l.department_id, l.created_at
 		FROM lecturers l
 		JOIN users u ON l.user_id = u.id
 		ORDER BY l.created_at DESC
@@ -84,14 +128,50 @@ func (r *LecturerRepository) List(ctx context.Context, limit, offset int) ([]*en
 	var lecturers []*entity.Lecturer
 	for rows.Next() {
 		lecturer := &entity.Lecturer{}
+		var departmentID sql.NullString
 		if err := rows.Scan(
 			&lecturer.ID, &lecturer.UserID, &lecturer.LecturerID, &lecturer.FullName, &lecturer.Email,
-			&lecturer.Department, &lecturer.CreatedAt,
+			&lecturer.Department, &departmentID, &lecturer.CreatedAt,
 		); err != nil {
 			return nil, 0, err
 		}
+		if departmentID.Valid {
+			did, _ := uuid.Parse(departmentID.String)
+			lecturer.DepartmentID = &did
+		}
 		lecturers = append(lecturers, lecturer)
 	}
 
 	return lecturers, total, nil
 }
+
+func (r *LecturerRepository) ListWorkloads(ctx context.Context) ([]*entity.LecturerWorkload, error) {
+	query := `
+		SELECT l.id, l.lecturer_id, u.full_name, COALESCE(l.department, ''), l.department_id, COUNT(s.id) as advisee_count
+		FROM lecturers l
+		JOIN users u ON l.user_id = u.id
+		LEFT JOIN students s ON s.advisor_id = l.id
+		GROUP BY l.id, l.lecturer_id, u.full_name, l.department, l.department_id
+		ORDER BY advisee_count DESC, u.full_name
+	`
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var workloads []*entity.LecturerWorkload
+	for rows.Next() {
+		w := &entity.LecturerWorkload{}
+		var departmentID sql.NullString
+		if err := rows.Scan(&w.LecturerID, &w.NIP, &w.FullName, &w.Department, &departmentID, &w.AdviseeCount); err != nil {
+			return nil, err
+		}
+		if departmentID.Valid {
+			did, _ := uuid.Parse(departmentID.String)
+			w.DepartmentID = &did
+		}
+		workloads = append(workloads, w)
+	}
+	return workloads, nil
+}
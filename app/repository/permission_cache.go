@@ -0,0 +1,159 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+
+	"github.com/Aryma-f4/uas-backend/app/entity"
+	"github.com/google/uuid"
+)
+
+const defaultPermissionCheckInterval = 5 * time.Second
+
+// PermissionCache keeps every role with its permissions in memory. Database
+// triggers bump the permission version on any change to roles, permissions
+// or role_permissions; the cache compares it at most once per check interval
+// and reloads when it moved, so other instances see changes within that
+// interval. Invalidate makes the next lookup reload right away.
+type PermissionCache struct {
+	db            *sql.DB
+	checkInterval time.Duration
+
+	mu        sync.RWMutex
+	loaded    bool
+	version   int64
+	roles     map[uuid.UUID]*entity.RoleAccess
+	checkedAt time.Time
+}
+
+func NewPermissionCache(db *sql.DB) *PermissionCache {
+	return &PermissionCache{db: db, checkInterval: defaultPermissionCheckInterval}
+}
+
+// SetCheckInterval sets how long the loaded permissions are used without
+// comparing the version; 0 compares it on every lookup.
+func (p *PermissionCache) SetCheckInterval(interval time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.checkInterval = interval
+}
+
+// Load reads the permission version and all roles with their permissions
+// from one snapshot.
+func (p *PermissionCache) Load(ctx context.Context) error {
+	tx, err := p.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var version int64
+	if err := tx.QueryRowContext(ctx, `SELECT version FROM permission_version`).Scan(&version); err != nil {
+		return err
+	}
+
+	query := `
+		SELECT r.id, r.name, p.name
+		FROM roles r
+		LEFT JOIN role_permissions rp ON rp.role_id = r.id
+		LEFT JOIN permissions p ON p.id = rp.permission_id
+		ORDER BY r.name, p.name
+	`
+	rows, err := tx.QueryContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	roles := make(map[uuid.UUID]*entity.RoleAccess)
+	for rows.Next() {
+		var roleID uuid.UUID
+		var roleName string
+		var permission sql.NullString
+		if err := rows.Scan(&roleID, &roleName, &permission); err != nil {
+			return err
+		}
+		role, ok := roles[roleID]
+		if !ok {
+			role = &entity.RoleAccess{RoleID: roleID, RoleName: roleName, Permissions: []string{}, Version: version}
+			roles[roleID] = role
+		}
+		if permission.Valid {
+			role.Permissions = append(role.Permissions, permission.String)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.loaded = true
+	p.version = version
+	p.roles = roles
+	p.checkedAt = time.Now()
+	return nil
+}
+
+// Invalidate drops the loaded permissions; the next lookup reloads them.
+func (p *PermissionCache) Invalidate() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.loaded = false
+}
+
+// Role returns a role with its permissions, or sql.ErrNoRows for an unknown
+// role. The result is shared and must not be modified.
+func (p *PermissionCache) Role(ctx context.Context, roleID uuid.UUID) (*entity.RoleAccess, error) {
+	roles, _, err := p.current(ctx)
+	if err != nil {
+		return nil, err
+	}
+	role, ok := roles[roleID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return role, nil
+}
+
+// Version returns the permission version of the loaded permissions.
+func (p *PermissionCache) Version(ctx context.Context) (int64, error) {
+	_, version, err := p.current(ctx)
+	return version, err
+}
+
+// current returns the loaded permissions, first reloading them when they
+// were invalidated or the version in the database moved.
+func (p *PermissionCache) current(ctx context.Context) (map[uuid.UUID]*entity.RoleAccess, int64, error) {
+	p.mu.RLock()
+	loaded, roles, version := p.loaded, p.roles, p.version
+	fresh := time.Since(p.checkedAt) < p.checkInterval
+	p.mu.RUnlock()
+
+	if loaded && fresh {
+		return roles, version, nil
+	}
+
+	if loaded {
+		var latest int64
+		if err := p.db.QueryRowContext(ctx, `SELECT version FROM permission_version`).Scan(&latest); err != nil {
+			return nil, 0, err
+		}
+		if latest == version {
+			p.mu.Lock()
+			p.checkedAt = time.Now()
+			p.mu.Unlock()
+			return roles, version, nil
+		}
+	}
+
+	if err := p.Load(ctx); err != nil {
+		return nil, 0, err
+	}
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.roles, p.version, nil
+}
@@ -0,0 +1,29 @@
+package repository
+
+import (
+	"database/sql"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// uuidArray converts IDs into a Postgres array parameter, for use with
+// "= ANY($n::uuid[])" instead of building IN placeholders by hand.
+func uuidArray(ids []uuid.UUID) interface{} {
+	values := make([]string, len(ids))
+	for i, id := range ids {
+		values[i] = id.String()
+	}
+	return pq.Array(values)
+}
+
+// execOne turns an update or delete that matched no row into sql.ErrNoRows.
+func execOne(result sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
@@ -0,0 +1,258 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/Aryma-f4/uas-backend/app/entity"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// RoleRepository manages roles and their permissions. Every write
+// invalidates the permission cache so this instance applies it at once.
+type RoleRepository struct {
+	db          *sql.DB
+	permissions *PermissionCache
+}
+
+func NewRoleRepository(db *sql.DB, permissions *PermissionCache) *RoleRepository {
+	return &RoleRepository{db: db, permissions: permissions}
+}
+
+const roleColumns = `
+	r.id, r.name, COALESCE(r.description, ''), r.mfa_required, r.is_builtin, r.created_at,
+	ARRAY(
+		SELECT p.name FROM role_permissions rp
+		JOIN permissions p ON p.id = rp.permission_id
+		WHERE rp.role_id = r.id
+		ORDER BY p.name
+	)
+`
+
+func (r *RoleRepository) List(ctx context.Context) ([]*entity.Role, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT `+roleColumns+` FROM roles r ORDER BY r.name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := []*entity.Role{}
+	for rows.Next() {
+		role, err := scanRole(rows)
+		if err != nil {
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+	return roles, rows.Err()
+}
+
+func (r *RoleRepository) GetByID(ctx context.Context, id uuid.UUID) (*entity.Role, error) {
+	return scanRole(r.db.QueryRowContext(ctx, `SELECT `+roleColumns+` FROM roles r WHERE r.id = $1`, id))
+}
+
+// Create inserts a role with its Permissions.
+func (r *RoleRepository) Create(ctx context.Context, role *entity.Role) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO roles (id, name, description, is_builtin) VALUES ($1, $2, $3, false)`,
+		role.ID, role.Name, role.Description,
+	); err != nil {
+		return err
+	}
+	if err := grantPermissionsTx(ctx, tx, role.ID, role.Permissions); err != nil {
+		return err
+	}
+
+	return r.commit(tx)
+}
+
+// Update saves the name and description of a role and, unless permissions
+// is nil, replaces its permissions.
+func (r *RoleRepository) Update(ctx context.Context, role *entity.Role, permissions []string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := execOne(tx.ExecContext(ctx,
+		`UPDATE roles SET name = $2, description = $3 WHERE id = $1`,
+		role.ID, role.Name, role.Description,
+	)); err != nil {
+		return err
+	}
+	if permissions != nil {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM role_permissions WHERE role_id = $1`, role.ID); err != nil {
+			return err
+		}
+		if err := grantPermissionsTx(ctx, tx, role.ID, permissions); err != nil {
+			return err
+		}
+	}
+
+	return r.commit(tx)
+}
+
+// Delete removes a role that is not built in; built-in and unknown roles
+// give sql.ErrNoRows.
+func (r *RoleRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	err := execOne(r.db.ExecContext(ctx, `DELETE FROM roles WHERE id = $1 AND NOT is_builtin`, id))
+	if err == nil {
+		r.permissions.Invalidate()
+	}
+	return err
+}
+
+// GrantPermissions adds permissions to a role; ones it already has are kept.
+func (r *RoleRepository) GrantPermissions(ctx context.Context, roleID uuid.UUID, names []string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := grantPermissionsTx(ctx, tx, roleID, names); err != nil {
+		return err
+	}
+
+	return r.commit(tx)
+}
+
+// RevokePermission removes a permission from a role, or returns
+// sql.ErrNoRows when the role does not have it.
+func (r *RoleRepository) RevokePermission(ctx context.Context, roleID uuid.UUID, name string) error {
+	err := execOne(r.db.ExecContext(ctx, `
+		DELETE FROM role_permissions rp
+		USING permissions p
+		WHERE rp.permission_id = p.id AND rp.role_id = $1 AND p.name = $2
+	`, roleID, name))
+	if err == nil {
+		r.permissions.Invalidate()
+	}
+	return err
+}
+
+func (r *RoleRepository) ListPermissions(ctx context.Context) ([]*entity.Permission, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, name, resource, action, COALESCE(description, '')
+		FROM permissions
+		ORDER BY name
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	permissions := []*entity.Permission{}
+	for rows.Next() {
+		permission := &entity.Permission{}
+		if err := rows.Scan(&permission.ID, &permission.Name, &permission.Resource, &permission.Action, &permission.Description); err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, permission)
+	}
+	return permissions, rows.Err()
+}
+
+// UnknownPermissions returns the names that are not in the permissions table.
+func (r *RoleRepository) UnknownPermissions(ctx context.Context, names []string) ([]string, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT unnest($1::text[]) EXCEPT SELECT name FROM permissions`, pq.Array(names))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var unknown []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		unknown = append(unknown, name)
+	}
+	return unknown, rows.Err()
+}
+
+// SyncPermissions inserts the permissions the database does not have yet
+// and grants them to the built-in Admin role, which holds every permission.
+// It returns the names it added.
+func (r *RoleRepository) SyncPermissions(ctx context.Context, permissions []entity.Permission) ([]string, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var added []string
+	for _, permission := range permissions {
+		var id uuid.UUID
+		err := tx.QueryRowContext(ctx, `
+			INSERT INTO permissions (id, name, resource, action, description)
+			VALUES ($1, $2, $3, $4, $5)
+			ON CONFLICT (name) DO NOTHING
+			RETURNING id
+		`, uuid.New(), permission.Name, permission.Resource, permission.Action, permission.Description).Scan(&id)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO role_permissions (role_id, permission_id)
+			SELECT id, $1 FROM roles WHERE name = 'Admin' AND is_builtin
+			ON CONFLICT DO NOTHING
+		`, id); err != nil {
+			return nil, err
+		}
+		added = append(added, permission.Name)
+	}
+
+	if len(added) == 0 {
+		return nil, nil
+	}
+	return added, r.commit(tx)
+}
+
+func (r *RoleRepository) commit(tx *sql.Tx) error {
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	r.permissions.Invalidate()
+	return nil
+}
+
+// grantPermissionsTx adds the named permissions to a role; unknown names
+// are skipped, so callers check them first.
+func grantPermissionsTx(ctx context.Context, tx *sql.Tx, roleID uuid.UUID, names []string) error {
+	if len(names) == 0 {
+		return nil
+	}
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO role_permissions (role_id, permission_id)
+		SELECT $1, id FROM permissions WHERE name = ANY($2)
+		ON CONFLICT DO NOTHING
+	`, roleID, pq.Array(names))
+	return err
+}
+
+func scanRole(row interface{ Scan(...interface{}) error }) (*entity.Role, error) {
+	role := &entity.Role{}
+	err := row.Scan(
+		&role.ID, &role.Name, &role.Description, &role.MFARequired, &role.IsBuiltin, &role.CreatedAt,
+		pq.Array(&role.Permissions),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return role, nil
+}
@@ -0,0 +1,355 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/Aryma-f4/uas-backend/app/entity"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// SecurityRepository stores failed login counters and security events.
+type SecurityRepository struct {
+	db *sql.DB
+}
+
+func NewSecurityRepository(db *sql.DB) *SecurityRepository {
+	return &SecurityRepository{db: db}
+}
+
+// RecordLoginFailure counts a failed login for the key and returns the
+// number of failures so far. The count starts over when the previous
+// failure is older than window.
+func (r *SecurityRepository) RecordLoginFailure(ctx context.Context, key string, window time.Duration) (int, error) {
+	query := `
+		INSERT INTO login_throttles (key, failures, last_failure_at)
+		VALUES ($1, 1, NOW())
+		ON CONFLICT (key) DO UPDATE SET
+			failures = CASE
+				WHEN login_throttles.last_failure_at < NOW() - $2 * INTERVAL '1 second' THEN 1
+				ELSE login_throttles.failures + 1
+			END,
+			last_failure_at = NOW()
+		RETURNING failures
+	`
+	var failures int
+	err := r.db.QueryRowContext(ctx, query, key, int(window.Seconds())).Scan(&failures)
+	return failures, err
+}
+
+func (r *SecurityRepository) LockLogin(ctx context.Context, key string, until time.Time) error {
+	query := `UPDATE login_throttles SET locked_until = $2 WHERE key = $1`
+	_, err := r.db.ExecContext(ctx, query, key, until)
+	return err
+}
+
+// GetLockedUntil returns the latest lock of the given keys that has not
+// expired yet, or nil if none of them is locked.
+func (r *SecurityRepository) GetLockedUntil(ctx context.Context, keys ...string) (*time.Time, error) {
+	query := `
+		SELECT MAX(locked_until) FROM login_throttles
+		WHERE key = ANY($1::text[]) AND locked_until > NOW()
+	`
+	var lockedUntil sql.NullTime
+	if err := r.db.QueryRowContext(ctx, query, pq.Array(keys)).Scan(&lockedUntil); err != nil {
+		return nil, err
+	}
+	if !lockedUntil.Valid {
+		return nil, nil
+	}
+	return &lockedUntil.Time, nil
+}
+
+// ResetLoginThrottle clears the failures and lock of a key. It returns
+// sql.ErrNoRows if the key had none.
+func (r *SecurityRepository) ResetLoginThrottle(ctx context.Context, key string) error {
+	return execOne(r.db.ExecContext(ctx, `DELETE FROM login_throttles WHERE key = $1`, key))
+}
+
+func (r *SecurityRepository) CreateEvent(ctx context.Context, event *entity.SecurityEvent) error {
+	query := `
+		INSERT INTO security_events (id, user_id, event_type, ip_address, detail)
+		VALUES ($1, $2, $3, $4, $5)
+	`
+	_, err := r.db.ExecContext(ctx, query, event.ID, event.UserID, event.EventType, event.IPAddress, event.Detail)
+	return err
+}
+
+// ListEventsByUser returns the security events of a user, newest first.
+func (r *SecurityRepository) ListEventsByUser(ctx context.Context, userID uuid.UUID, limit, offset int) ([]*entity.SecurityEvent, int, error) {
+	var total int
+	if err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM security_events WHERE user_id = $1`, userID).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	query := `
+		SELECT id, user_id, event_type, ip_address, detail, created_at
+		FROM security_events
+		WHERE user_id = $1
+		ORDER BY created_at DESC
+		LIMIT $2 OFFSET $3
+	`
+	rows, err := r.db.QueryContext(ctx, query, userID, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	events := []*entity.SecurityEvent{}
+	for rows.Next() {
+		event := &entity.SecurityEvent{}
+		var eventUserID sql.NullString
+		if err := rows.Scan(&event.ID, &eventUserID, &event.EventType, &event.IPAddress, &event.Detail, &event.CreatedAt); err != nil {
+			return nil, 0, err
+		}
+		if eventUserID.Valid {
+			uid, _ := uuid.Parse(eventUserID.String)
+			event.UserID = &uid
+		}
+		events = append(events, event)
+	}
+	return events, total, rows.Err()
+}
+
+// GetMFA returns the TOTP enrollment of a user, or sql.ErrNoRows.
+func (r *SecurityRepository) GetMFA(ctx context.Context, userID uuid.UUID) (*entity.UserMFA, error) {
+	query := `
+		SELECT user_id, secret, enabled_at, last_used_step, created_at
+		FROM user_mfa
+		WHERE user_id = $1
+	`
+	mfa := &entity.UserMFA{}
+	var enabledAt sql.NullTime
+	err := r.db.QueryRowContext(ctx, query, userID).Scan(&mfa.UserID, &mfa.Secret, &enabledAt, &mfa.LastUsedStep, &mfa.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if enabledAt.Valid {
+		mfa.EnabledAt = &enabledAt.Time
+	}
+	return mfa, nil
+}
+
+// SaveMFASecret stores a pending secret, replacing an earlier pending one.
+// It returns sql.ErrNoRows if MFA is already enabled.
+func (r *SecurityRepository) SaveMFASecret(ctx context.Context, userID uuid.UUID, secret string) error {
+	query := `
+		INSERT INTO user_mfa (user_id, secret)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE SET secret = EXCLUDED.secret, last_used_step = 0, created_at = NOW()
+		WHERE user_mfa.enabled_at IS NULL
+	`
+	return execOne(r.db.ExecContext(ctx, query, userID, secret))
+}
+
+// EnableMFA enables the pending secret, whose first code was used at step,
+// and replaces the recovery codes. It returns sql.ErrNoRows if there is no
+// pending secret.
+func (r *SecurityRepository) EnableMFA(ctx context.Context, userID uuid.UUID, step int64, codeHashes []string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = execOne(tx.ExecContext(ctx, `
+		UPDATE user_mfa SET enabled_at = NOW(), last_used_step = $2
+		WHERE user_id = $1 AND enabled_at IS NULL
+	`, userID, step))
+	if err != nil {
+		return err
+	}
+
+	if err := replaceRecoveryCodesTx(ctx, tx, userID, codeHashes); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// DisableMFA removes the enrollment and recovery codes of a user.
+func (r *SecurityRepository) DisableMFA(ctx context.Context, userID uuid.UUID) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	if err := execOne(tx.ExecContext(ctx, `DELETE FROM user_mfa WHERE user_id = $1`, userID)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// UseTOTPStep records that the code of step was used. It returns
+// sql.ErrNoRows if that step or a later one was used before.
+func (r *SecurityRepository) UseTOTPStep(ctx context.Context, userID uuid.UUID, step int64) error {
+	query := `UPDATE user_mfa SET last_used_step = $2 WHERE user_id = $1 AND last_used_step < $2`
+	return execOne(r.db.ExecContext(ctx, query, userID, step))
+}
+
+func (r *SecurityRepository) ReplaceRecoveryCodes(ctx context.Context, userID uuid.UUID, codeHashes []string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := replaceRecoveryCodesTx(ctx, tx, userID, codeHashes); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// UseRecoveryCode uses up a recovery code. It returns sql.ErrNoRows if the
+// user has no such unused code.
+func (r *SecurityRepository) UseRecoveryCode(ctx context.Context, userID uuid.UUID, codeHash string) error {
+	query := `
+		UPDATE mfa_recovery_codes SET used_at = NOW()
+		WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL
+	`
+	return execOne(r.db.ExecContext(ctx, query, userID, codeHash))
+}
+
+func (r *SecurityRepository) CountRecoveryCodes(ctx context.Context, userID uuid.UUID) (int, error) {
+	var count int
+	query := `SELECT COUNT(*) FROM mfa_recovery_codes WHERE user_id = $1 AND used_at IS NULL`
+	err := r.db.QueryRowContext(ctx, query, userID).Scan(&count)
+	return count, err
+}
+
+func replaceRecoveryCodesTx(ctx context.Context, tx *sql.Tx, userID uuid.UUID, codeHashes []string) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	for _, hash := range codeHashes {
+		_, err := tx.ExecContext(ctx, `INSERT INTO mfa_recovery_codes (user_id, code_hash) VALUES ($1, $2)`, userID, hash)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *SecurityRepository) CreateMFAChallenge(ctx context.Context, challenge *entity.MFAChallenge) error {
+	query := `
+		INSERT INTO mfa_challenges (id, user_id, token_hash, user_agent, ip_address, setup_required, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`
+	_, err := r.db.ExecContext(ctx, query,
+		challenge.ID, challenge.UserID, challenge.TokenHash, challenge.UserAgent, challenge.IPAddress,
+		challenge.SetupRequired, challenge.ExpiresAt,
+	)
+	return err
+}
+
+func (r *SecurityRepository) GetMFAChallengeByHash(ctx context.Context, tokenHash string) (*entity.MFAChallenge, error) {
+	query := `
+		SELECT id, user_id, token_hash, user_agent, ip_address, setup_required, attempts, expires_at, used_at
+		FROM mfa_challenges
+		WHERE token_hash = $1
+	`
+	challenge := &entity.MFAChallenge{}
+	var usedAt sql.NullTime
+	err := r.db.QueryRowContext(ctx, query, tokenHash).Scan(
+		&challenge.ID, &challenge.UserID, &challenge.TokenHash, &challenge.UserAgent, &challenge.IPAddress,
+		&challenge.SetupRequired, &challenge.Attempts, &challenge.ExpiresAt, &usedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if usedAt.Valid {
+		challenge.UsedAt = &usedAt.Time
+	}
+	return challenge, nil
+}
+
+// RecordMFAChallengeAttempt counts a code submitted to a challenge and
+// returns the attempts so far, including this one.
+func (r *SecurityRepository) RecordMFAChallengeAttempt(ctx context.Context, id uuid.UUID) (int, error) {
+	var attempts int
+	query := `UPDATE mfa_challenges SET attempts = attempts + 1 WHERE id = $1 RETURNING attempts`
+	err := r.db.QueryRowContext(ctx, query, id).Scan(&attempts)
+	return attempts, err
+}
+
+// CompleteMFAChallenge uses up a challenge. It returns sql.ErrNoRows if it
+// was used concurrently.
+func (r *SecurityRepository) CompleteMFAChallenge(ctx context.Context, id uuid.UUID) error {
+	query := `UPDATE mfa_challenges SET used_at = NOW() WHERE id = $1 AND used_at IS NULL`
+	return execOne(r.db.ExecContext(ctx, query, id))
+}
+
+// CreateOIDCState stores a started single sign-on login and clears the
+// expired ones of abandoned logins.
+func (r *SecurityRepository) CreateOIDCState(ctx context.Context, state *entity.OIDCState) error {
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM oidc_states WHERE expires_at < NOW()`); err != nil {
+		return err
+	}
+	query := `
+		INSERT INTO oidc_states (id, state_hash, nonce, code_verifier, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`
+	_, err := r.db.ExecContext(ctx, query, state.ID, state.StateHash, state.Nonce, state.CodeVerifier, state.ExpiresAt)
+	return err
+}
+
+// ConsumeOIDCState deletes and returns an unexpired login state, so a state
+// can be redeemed only once. It returns sql.ErrNoRows for unknown, used or
+// expired states.
+func (r *SecurityRepository) ConsumeOIDCState(ctx context.Context, stateHash string) (*entity.OIDCState, error) {
+	query := `
+		DELETE FROM oidc_states
+		WHERE state_hash = $1 AND expires_at > NOW()
+		RETURNING id, state_hash, nonce, code_verifier, expires_at
+	`
+	state := &entity.OIDCState{}
+	err := r.db.QueryRowContext(ctx, query, stateHash).Scan(
+		&state.ID, &state.StateHash, &state.Nonce, &state.CodeVerifier, &state.ExpiresAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+func (r *SecurityRepository) GetIdentity(ctx context.Context, issuer, subject string) (*entity.UserIdentity, error) {
+	query := `
+		SELECT id, user_id, issuer, subject, email, last_login_at, created_at
+		FROM user_identities
+		WHERE issuer = $1 AND subject = $2
+	`
+	identity := &entity.UserIdentity{}
+	var lastLoginAt sql.NullTime
+	err := r.db.QueryRowContext(ctx, query, issuer, subject).Scan(
+		&identity.ID, &identity.UserID, &identity.Issuer, &identity.Subject, &identity.Email,
+		&lastLoginAt, &identity.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if lastLoginAt.Valid {
+		identity.LastLoginAt = &lastLoginAt.Time
+	}
+	return identity, nil
+}
+
+// SaveIdentityLogin links an identity to its user, or records another login
+// of an already linked one. It returns sql.ErrNoRows if the identity is
+// linked to a different user.
+func (r *SecurityRepository) SaveIdentityLogin(ctx context.Context, identity *entity.UserIdentity) error {
+	query := `
+		INSERT INTO user_identities (id, user_id, issuer, subject, email, last_login_at)
+		VALUES ($1, $2, $3, $4, $5, NOW())
+		ON CONFLICT (issuer, subject) DO UPDATE
+		SET email = EXCLUDED.email, last_login_at = NOW()
+		WHERE user_identities.user_id = EXCLUDED.user_id
+	`
+	return execOne(r.db.ExecContext(ctx, query,
+		identity.ID, identity.UserID, identity.Issuer, identity.Subject, identity.Email,
+	))
+}
@@ -0,0 +1,290 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/Aryma-f4/uas-backend/app/entity"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+type ServiceAccountRepository struct {
+	db *sql.DB
+}
+
+func NewServiceAccountRepository(db *sql.DB) *ServiceAccountRepository {
+	return &ServiceAccountRepository{db: db}
+}
+
+const serviceAccountColumns = `
+	sa.id, sa.name, sa.description, sa.allowed_ips, sa.is_active, sa.created_by, sa.created_at, sa.updated_at,
+	ARRAY(
+		SELECT p.name FROM service_account_permissions sap
+		JOIN permissions p ON p.id = sap.permission_id
+		WHERE sap.service_account_id = sa.id
+		ORDER BY p.name
+	)
+`
+
+const insertAPIKeyQuery = `
+	INSERT INTO api_keys (id, service_account_id, prefix, key_hash, expires_at)
+	VALUES ($1, $2, $3, $4, $5)
+`
+
+// Create stores a service account with its permissions and first key.
+func (r *ServiceAccountRepository) Create(ctx context.Context, account *entity.ServiceAccount, key *entity.APIKey) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO service_accounts (id, name, description, allowed_ips, is_active, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`, account.ID, account.Name, account.Description, pq.Array(account.AllowedIPs), account.IsActive, account.CreatedBy); err != nil {
+		return err
+	}
+	if err := setPermissionsTx(ctx, tx, account.ID, account.Permissions); err != nil {
+		return err
+	}
+	if err := createAPIKeyTx(ctx, tx, key); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *ServiceAccountRepository) GetByID(ctx context.Context, id uuid.UUID) (*entity.ServiceAccount, error) {
+	query := `SELECT ` + serviceAccountColumns + ` FROM service_accounts sa WHERE sa.id = $1`
+	account, err := scanServiceAccount(r.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		return nil, err
+	}
+
+	keys, err := r.ListAPIKeys(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	account.Keys = keys
+	return account, nil
+}
+
+func (r *ServiceAccountRepository) List(ctx context.Context) ([]*entity.ServiceAccount, error) {
+	query := `SELECT ` + serviceAccountColumns + ` FROM service_accounts sa ORDER BY sa.name`
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	accounts := []*entity.ServiceAccount{}
+	for rows.Next() {
+		account, err := scanServiceAccount(rows)
+		if err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, account)
+	}
+	return accounts, rows.Err()
+}
+
+// Update saves the description, allowed IPs, active flag and permissions.
+func (r *ServiceAccountRepository) Update(ctx context.Context, account *entity.ServiceAccount) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := execOne(tx.ExecContext(ctx, `
+		UPDATE service_accounts
+		SET description = $2, allowed_ips = $3, is_active = $4, updated_at = NOW()
+		WHERE id = $1
+	`, account.ID, account.Description, pq.Array(account.AllowedIPs), account.IsActive)); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM service_account_permissions WHERE service_account_id = $1`, account.ID); err != nil {
+		return err
+	}
+	if err := setPermissionsTx(ctx, tx, account.ID, account.Permissions); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Delete removes a service account together with its keys.
+func (r *ServiceAccountRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	return execOne(r.db.ExecContext(ctx, `DELETE FROM service_accounts WHERE id = $1`, id))
+}
+
+// UnknownPermissions returns the names that are not in the permissions table.
+func (r *ServiceAccountRepository) UnknownPermissions(ctx context.Context, names []string) ([]string, error) {
+	query := `SELECT unnest($1::text[]) EXCEPT SELECT name FROM permissions`
+	rows, err := r.db.QueryContext(ctx, query, pq.Array(names))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var unknown []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		unknown = append(unknown, name)
+	}
+	return unknown, rows.Err()
+}
+
+func (r *ServiceAccountRepository) CreateAPIKey(ctx context.Context, key *entity.APIKey) error {
+	_, err := r.db.ExecContext(ctx, insertAPIKeyQuery, key.ID, key.ServiceAccountID, key.Prefix, key.KeyHash, key.ExpiresAt)
+	return err
+}
+
+// RotateAPIKey adds the next key of an account and retires the old one: it
+// is revoked when graceUntil is nil and expires then otherwise. It returns
+// sql.ErrNoRows if the old key is not an active key of the account.
+func (r *ServiceAccountRepository) RotateAPIKey(ctx context.Context, accountID, oldID uuid.UUID, graceUntil *time.Time, next *entity.APIKey) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE api_keys SET revoked_at = NOW()
+		WHERE id = $1 AND service_account_id = $2 AND revoked_at IS NULL
+	`
+	args := []interface{}{oldID, accountID}
+	if graceUntil != nil {
+		query = `
+			UPDATE api_keys SET expires_at = LEAST(COALESCE(expires_at, $3), $3)
+			WHERE id = $1 AND service_account_id = $2 AND revoked_at IS NULL
+		`
+		args = append(args, *graceUntil)
+	}
+	if err := execOne(tx.ExecContext(ctx, query, args...)); err != nil {
+		return err
+	}
+	if err := createAPIKeyTx(ctx, tx, next); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// RevokeAPIKey returns sql.ErrNoRows if the key is not an active key of
+// the account.
+func (r *ServiceAccountRepository) RevokeAPIKey(ctx context.Context, accountID, keyID uuid.UUID) error {
+	query := `
+		UPDATE api_keys SET revoked_at = NOW()
+		WHERE id = $1 AND service_account_id = $2 AND revoked_at IS NULL
+	`
+	return execOne(r.db.ExecContext(ctx, query, keyID, accountID))
+}
+
+func (r *ServiceAccountRepository) ListAPIKeys(ctx context.Context, accountID uuid.UUID) ([]*entity.APIKey, error) {
+	query := `
+		SELECT id, service_account_id, prefix, key_hash, expires_at, last_used_at, revoked_at, created_at
+		FROM api_keys
+		WHERE service_account_id = $1
+		ORDER BY created_at DESC
+	`
+	rows, err := r.db.QueryContext(ctx, query, accountID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []*entity.APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+func (r *ServiceAccountRepository) GetAPIKeyByHash(ctx context.Context, keyHash string) (*entity.APIKey, error) {
+	query := `
+		SELECT id, service_account_id, prefix, key_hash, expires_at, last_used_at, revoked_at, created_at
+		FROM api_keys
+		WHERE key_hash = $1
+	`
+	return scanAPIKey(r.db.QueryRowContext(ctx, query, keyHash))
+}
+
+// TouchAPIKey records the use of a key, at most once a minute.
+func (r *ServiceAccountRepository) TouchAPIKey(ctx context.Context, id uuid.UUID) error {
+	query := `
+		UPDATE api_keys SET last_used_at = NOW()
+		WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute')
+	`
+	_, err := r.db.ExecContext(ctx, query, id)
+	return err
+}
+
+func setPermissionsTx(ctx context.Context, tx *sql.Tx, accountID uuid.UUID, permissions []string) error {
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO service_account_permissions (service_account_id, permission_id)
+		SELECT $1, id FROM permissions WHERE name = ANY($2)
+	`, accountID, pq.Array(permissions))
+	return err
+}
+
+func createAPIKeyTx(ctx context.Context, tx *sql.Tx, key *entity.APIKey) error {
+	_, err := tx.ExecContext(ctx, insertAPIKeyQuery, key.ID, key.ServiceAccountID, key.Prefix, key.KeyHash, key.ExpiresAt)
+	return err
+}
+
+func scanServiceAccount(row interface{ Scan(...interface{}) error }) (*entity.ServiceAccount, error) {
+	account := &entity.ServiceAccount{}
+	var createdBy sql.NullString
+	err := row.Scan(
+		&account.ID, &account.Name, &account.Description, pq.Array(&account.AllowedIPs), &account.IsActive,
+		&createdBy, &account.CreatedAt, &account.UpdatedAt, pq.Array(&account.Permissions),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if createdBy.Valid {
+		if id, err := uuid.Parse(createdBy.String); err == nil {
+			account.CreatedBy = &id
+		}
+	}
+	if account.AllowedIPs == nil {
+		account.AllowedIPs = []string{}
+	}
+	if account.Permissions == nil {
+		account.Permissions = []string{}
+	}
+	return account, nil
+}
+
+func scanAPIKey(row interface{ Scan(...interface{}) error }) (*entity.APIKey, error) {
+	key := &entity.APIKey{}
+	var expiresAt, lastUsedAt, revokedAt sql.NullTime
+	err := row.Scan(
+		&key.ID, &key.ServiceAccountID, &key.Prefix, &key.KeyHash, &expiresAt, &lastUsedAt, &revokedAt, &key.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if expiresAt.Valid {
+		key.ExpiresAt = &expiresAt.Time
+	}
+	if lastUsedAt.Valid {
+		key.LastUsedAt = &lastUsedAt.Time
+	}
+	if revokedAt.Valid {
+		key.RevokedAt = &revokedAt.Time
+	}
+	return key, nil
+}
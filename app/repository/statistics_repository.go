@@ -0,0 +1,467 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Aryma-f4/uas-backend/app/entity"
+	"github.com/google/uuid"
+)
+
+// StatisticsRepository stores the pre-aggregated statistics tables:
+// student_statistics, student_period_statistics and program_statistics.
+type StatisticsRepository struct {
+	db *sql.DB
+}
+
+func NewStatisticsRepository(db *sql.DB) *StatisticsRepository {
+	return &StatisticsRepository{db: db}
+}
+
+// SaveStudentStatistics stores rows computed from a snapshot taken at
+// refreshedAt and recomputes the programs the students belonged to before
+// and after the write. A row is skipped when the stored one comes from a
+// newer snapshot, so a slow full refresh never overwrites a per-student
+// update made while it ran.
+func (r *StatisticsRepository) SaveStudentStatistics(ctx context.Context, rows []*entity.StudentStatistics, refreshedAt time.Time) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	ids := make([]uuid.UUID, len(rows))
+	for i, row := range rows {
+		ids[i] = row.StudentID
+	}
+
+	before, err := listStatisticsPrograms(ctx, tx, ids)
+	if err != nil {
+		return err
+	}
+
+	for _, row := range rows {
+		if err := saveStudentStatistics(ctx, tx, row, refreshedAt); err != nil {
+			return err
+		}
+	}
+
+	after, err := listStatisticsPrograms(ctx, tx, ids)
+	if err != nil {
+		return err
+	}
+
+	if err := refreshProgramStatistics(ctx, tx, uuidArray(append(before, after...))); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ReplaceAllStatistics stores the rows of a full refresh. Students without
+// achievements get zero rows, and every program is recomputed.
+func (r *StatisticsRepository) ReplaceAllStatistics(ctx context.Context, rows []*entity.StudentStatistics, refreshedAt time.Time) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, row := range rows {
+		if err := saveStudentStatistics(ctx, tx, row, refreshedAt); err != nil {
+			return err
+		}
+	}
+
+	// Rows not written above belong to students without achievements in
+	// the snapshot; rows from a newer snapshot are left alone
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO student_statistics (student_id, study_program_id, refreshed_at)
+		SELECT id, study_program_id, $1 FROM students
+		ON CONFLICT (student_id) DO UPDATE SET
+			study_program_id = EXCLUDED.study_program_id,
+			total_achievements = 0, total_draft = 0, total_pending = 0,
+			total_verified = 0, total_rejected = 0, verified_points = 0,
+			by_type = '{}', by_competition_level = '{}',
+			refreshed_at = EXCLUDED.refreshed_at
+		WHERE student_statistics.refreshed_at < EXCLUDED.refreshed_at
+	`, refreshedAt)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		DELETE FROM student_period_statistics p
+		USING student_statistics st
+		WHERE p.student_id = st.student_id
+		  AND st.refreshed_at = $1 AND st.total_achievements = 0
+	`, refreshedAt)
+	if err != nil {
+		return err
+	}
+
+	if err := refreshProgramStatistics(ctx, tx, nil); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func saveStudentStatistics(ctx context.Context, tx *sql.Tx, row *entity.StudentStatistics, refreshedAt time.Time) error {
+	byType, err := jsonCounts(row.ByType)
+	if err != nil {
+		return err
+	}
+	byLevel, err := jsonCounts(row.ByCompetitionLevel)
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.ExecContext(ctx, `
+		INSERT INTO student_statistics (
+			student_id, study_program_id, total_achievements, total_draft, total_pending,
+			total_verified, total_rejected, verified_points, by_type, by_competition_level, refreshed_at
+		)
+		SELECT s.id, s.study_program_id, $2, $3, $4, $5, $6, $7, $8::jsonb, $9::jsonb, $10
+		FROM students s WHERE s.id = $1
+		ON CONFLICT (student_id) DO UPDATE SET
+			study_program_id = EXCLUDED.study_program_id,
+			total_achievements = EXCLUDED.total_achievements,
+			total_draft = EXCLUDED.total_draft,
+			total_pending = EXCLUDED.total_pending,
+			total_verified = EXCLUDED.total_verified,
+			total_rejected = EXCLUDED.total_rejected,
+			verified_points = EXCLUDED.verified_points,
+			by_type = EXCLUDED.by_type,
+			by_competition_level = EXCLUDED.by_competition_level,
+			refreshed_at = EXCLUDED.refreshed_at
+		WHERE student_statistics.refreshed_at <= EXCLUDED.refreshed_at
+	`, row.StudentID, row.TotalAchievements, row.TotalDraft, row.TotalPending,
+		row.TotalVerified, row.TotalRejected, row.VerifiedPoints, byType, byLevel, refreshedAt)
+	if err := execOne(result, err); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			// Student deleted, or a newer snapshot is already stored
+			return nil
+		}
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM student_period_statistics WHERE student_id = $1`, row.StudentID); err != nil {
+		return err
+	}
+	for _, p := range row.Periods {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO student_period_statistics (student_id, basis, period, total_verified, verified_points)
+			VALUES ($1, $2, $3, $4, $5)
+		`, row.StudentID, p.Basis, p.Period, p.TotalVerified, p.VerifiedPoints)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// listStatisticsPrograms returns the study programs the given students are
+// currently counted in.
+func listStatisticsPrograms(ctx context.Context, tx *sql.Tx, studentIDs []uuid.UUID) ([]uuid.UUID, error) {
+	rows, err := tx.QueryContext(ctx, `
+		SELECT DISTINCT study_program_id FROM student_statistics
+		WHERE student_id = ANY($1::uuid[]) AND study_program_id IS NOT NULL
+	`, uuidArray(studentIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// refreshProgramStatistics sums student_statistics into program_statistics
+// for the given programs, or for every program when programIDs is nil.
+func refreshProgramStatistics(ctx context.Context, tx *sql.Tx, programIDs interface{}) error {
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO program_statistics (
+			study_program_id, students, total_achievements, total_draft, total_pending,
+			total_verified, total_rejected, verified_points, refreshed_at
+		)
+		SELECT study_program_id, COUNT(*), SUM(total_achievements), SUM(total_draft), SUM(total_pending),
+		       SUM(total_verified), SUM(total_rejected), SUM(verified_points), MIN(refreshed_at)
+		FROM student_statistics
+		WHERE study_program_id IS NOT NULL
+		  AND ($1::uuid[] IS NULL OR study_program_id = ANY($1::uuid[]))
+		GROUP BY study_program_id
+		ON CONFLICT (study_program_id) DO UPDATE SET
+			students = EXCLUDED.students,
+			total_achievements = EXCLUDED.total_achievements,
+			total_draft = EXCLUDED.total_draft,
+			total_pending = EXCLUDED.total_pending,
+			total_verified = EXCLUDED.total_verified,
+			total_rejected = EXCLUDED.total_rejected,
+			verified_points = EXCLUDED.verified_points,
+			refreshed_at = EXCLUDED.refreshed_at
+	`, programIDs)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		DELETE FROM program_statistics ps
+		WHERE ($1::uuid[] IS NULL OR ps.study_program_id = ANY($1::uuid[]))
+		  AND NOT EXISTS (SELECT 1 FROM student_statistics st WHERE st.study_program_id = ps.study_program_id)
+	`, programIDs)
+	return err
+}
+
+// GetSummary adds up the statistics of the given students. A nil slice
+// covers every student.
+func (r *StatisticsRepository) GetSummary(ctx context.Context, studentIDs []uuid.UUID) (*entity.StatisticsResponse, error) {
+	scope := statisticsScope(studentIDs)
+
+	stats := &entity.StatisticsResponse{ByStatus: make(map[string]int)}
+	var draft int
+	var generatedAt sql.NullTime
+	err := r.db.QueryRowContext(ctx, `
+		SELECT COALESCE(SUM(total_achievements), 0), COALESCE(SUM(total_draft), 0),
+		       COALESCE(SUM(total_pending), 0), COALESCE(SUM(total_verified), 0),
+		       COALESCE(SUM(total_rejected), 0), MIN(refreshed_at)
+		FROM student_statistics
+		WHERE ($1::uuid[] IS NULL OR student_id = ANY($1::uuid[]))
+	`, scope).Scan(&stats.TotalAchievements, &draft, &stats.TotalPending, &stats.TotalVerified, &stats.TotalRejected, &generatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if generatedAt.Valid {
+		stats.GeneratedAt = &generatedAt.Time
+	}
+
+	for status, count := range map[entity.AchievementStatus]int{
+		entity.StatusDraft:     draft,
+		entity.StatusSubmitted: stats.TotalPending,
+		entity.StatusVerified:  stats.TotalVerified,
+		entity.StatusRejected:  stats.TotalRejected,
+	} {
+		if count > 0 {
+			stats.ByStatus[string(status)] = count
+		}
+	}
+
+	if stats.ByType, err = r.sumCounts(ctx, "by_type", scope); err != nil {
+		return nil, err
+	}
+	if stats.ByCompetitionLevel, err = r.sumCounts(ctx, "by_competition_level", scope); err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+// sumCounts adds up one of the JSONB count columns of student_statistics.
+func (r *StatisticsRepository) sumCounts(ctx context.Context, column string, scope interface{}) (map[string]int, error) {
+	query := fmt.Sprintf(`
+		SELECT c.key, SUM(c.value::int)
+		FROM student_statistics st, jsonb_each_text(st.%s) c
+		WHERE ($1::uuid[] IS NULL OR st.student_id = ANY($1::uuid[]))
+		GROUP BY c.key
+	`, column)
+	rows, err := r.db.QueryContext(ctx, query, scope)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var key string
+		var count int
+		if err := rows.Scan(&key, &count); err != nil {
+			return nil, err
+		}
+		counts[key] = count
+	}
+	return counts, rows.Err()
+}
+
+// GetTopStudents ranks the given students by verified points. Ties are
+// broken by verified count and then student ID.
+func (r *StatisticsRepository) GetTopStudents(ctx context.Context, studentIDs []uuid.UUID, limit int) ([]entity.TopStudentStats, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT st.student_id, u.full_name, st.verified_points, st.total_verified
+		FROM student_statistics st
+		JOIN students s ON s.id = st.student_id
+		JOIN users u ON u.id = s.user_id
+		WHERE ($1::uuid[] IS NULL OR st.student_id = ANY($1::uuid[]))
+		  AND st.total_verified > 0
+		ORDER BY st.verified_points DESC, st.total_verified DESC, st.student_id
+		LIMIT $2
+	`, statisticsScope(studentIDs), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	top := []entity.TopStudentStats{}
+	for rows.Next() {
+		var t entity.TopStudentStats
+		if err := rows.Scan(&t.StudentID, &t.StudentName, &t.TotalPoints, &t.Achievements); err != nil {
+			return nil, err
+		}
+		top = append(top, t)
+	}
+	return top, rows.Err()
+}
+
+// GetMonthlyTrend counts verified achievements of the given students per
+// month, by event date or verification date (basis).
+func (r *StatisticsRepository) GetMonthlyTrend(ctx context.Context, studentIDs []uuid.UUID, basis string) ([]entity.MonthlyStats, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT period, SUM(total_verified)
+		FROM student_period_statistics
+		WHERE basis = $1
+		  AND ($2::uuid[] IS NULL OR student_id = ANY($2::uuid[]))
+		GROUP BY period
+		ORDER BY period
+	`, basis, statisticsScope(studentIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	trend := []entity.MonthlyStats{}
+	for rows.Next() {
+		var m entity.MonthlyStats
+		if err := rows.Scan(&m.Month, &m.Count); err != nil {
+			return nil, err
+		}
+		trend = append(trend, m)
+	}
+	return trend, rows.Err()
+}
+
+// ListStudentStatistics returns one row per given student, sorted by NIM.
+// Students not refreshed yet get zero counts.
+func (r *StatisticsRepository) ListStudentStatistics(ctx context.Context, studentIDs []uuid.UUID) ([]*entity.AdviseeStatistics, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT s.id, s.student_id, u.full_name, COALESCE(s.program_study, ''),
+		       COALESCE(st.total_achievements, 0), COALESCE(st.total_draft, 0),
+		       COALESCE(st.total_pending, 0), COALESCE(st.total_verified, 0),
+		       COALESCE(st.total_rejected, 0), COALESCE(st.verified_points, 0)
+		FROM students s
+		JOIN users u ON u.id = s.user_id
+		LEFT JOIN student_statistics st ON st.student_id = s.id
+		WHERE s.id = ANY($1::uuid[])
+		ORDER BY s.student_id
+	`, uuidArray(studentIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []*entity.AdviseeStatistics{}
+	for rows.Next() {
+		a := &entity.AdviseeStatistics{}
+		if err := rows.Scan(
+			&a.StudentID, &a.NIM, &a.FullName, &a.ProgramStudy,
+			&a.TotalAchievements, &a.TotalDraft, &a.TotalPending,
+			&a.TotalVerified, &a.TotalRejected, &a.VerifiedPoints,
+		); err != nil {
+			return nil, err
+		}
+		list = append(list, a)
+	}
+	return list, rows.Err()
+}
+
+// GetUnitStatistics sums program_statistics per unit at the given level of
+// the hierarchy, restricted to the filtered branch. It also returns the
+// oldest snapshot the figures come from.
+func (r *StatisticsRepository) GetUnitStatistics(ctx context.Context, level string, filter *entity.AcademicUnitFilter) ([]*entity.UnitStatistics, *time.Time, error) {
+	var unit string
+	switch level {
+	case entity.UnitLevelFaculty:
+		unit = "f"
+	case entity.UnitLevelDepartment:
+		unit = "d"
+	case entity.UnitLevelStudyProgram:
+		unit = "p"
+	default:
+		return nil, nil, errors.New("invalid unit level")
+	}
+
+	query := fmt.Sprintf(`
+		SELECT %[1]s.id, %[1]s.code, %[1]s.name,
+		       COALESCE(SUM(ps.students), 0),
+		       COALESCE(SUM(ps.total_achievements), 0),
+		       COALESCE(SUM(ps.total_draft), 0),
+		       COALESCE(SUM(ps.total_pending), 0),
+		       COALESCE(SUM(ps.total_verified), 0),
+		       COALESCE(SUM(ps.total_rejected), 0),
+		       COALESCE(SUM(ps.verified_points), 0),
+		       MIN(ps.refreshed_at)
+		FROM study_programs p
+		JOIN departments d ON p.department_id = d.id
+		JOIN faculties f ON d.faculty_id = f.id
+		LEFT JOIN program_statistics ps ON ps.study_program_id = p.id
+		WHERE ($1::uuid IS NULL OR f.id = $1)
+		  AND ($2::uuid IS NULL OR d.id = $2)
+		  AND ($3::uuid IS NULL OR p.id = $3)
+		GROUP BY %[1]s.id, %[1]s.code, %[1]s.name
+		ORDER BY %[1]s.name
+	`, unit)
+
+	rows, err := r.db.QueryContext(ctx, query, filter.FacultyID, filter.DepartmentID, filter.StudyProgramID)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	units := []*entity.UnitStatistics{}
+	var generatedAt *time.Time
+	for rows.Next() {
+		u := &entity.UnitStatistics{}
+		var refreshedAt sql.NullTime
+		if err := rows.Scan(
+			&u.UnitID, &u.UnitCode, &u.UnitName, &u.Students, &u.TotalAchievements,
+			&u.TotalDraft, &u.TotalPending, &u.TotalVerified, &u.TotalRejected,
+			&u.VerifiedPoints, &refreshedAt,
+		); err != nil {
+			return nil, nil, err
+		}
+		if refreshedAt.Valid && (generatedAt == nil || refreshedAt.Time.Before(*generatedAt)) {
+			t := refreshedAt.Time
+			generatedAt = &t
+		}
+		units = append(units, u)
+	}
+	return units, generatedAt, rows.Err()
+}
+
+// statisticsScope turns a student scope into a query parameter for
+// "$n::uuid[] IS NULL OR student_id = ANY($n::uuid[])"; nil means every
+// student.
+func statisticsScope(studentIDs []uuid.UUID) interface{} {
+	if studentIDs == nil {
+		return nil
+	}
+	return uuidArray(studentIDs)
+}
+
+// jsonCounts encodes a count map for a JSONB column, storing nil as {}.
+func jsonCounts(counts map[string]int) (string, error) {
+	if counts == nil {
+		return "{}", nil
+	}
+	data, err := json.Marshal(counts)
+	return string(data), err
+}
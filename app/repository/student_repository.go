@@ -19,7 +19,7 @@ func NewStudentRepository(db *sql.DB) *StudentRepository {
 func (r *StudentRepository) GetByID(ctx context.Context, id uuid.UUID) (*entity.Student, error) {
 	query := `
 		SELECT s.id, s.user_id, s.student_id, u.full_name, u.email, s.program_study, 
-		       s.academic_year, s.advisor_id, s.created_at,
+		       s.academic_year, s.advisor_id, s.study_program_id, s.created_at,
 		       COALESCE(lu.full_name, '') as advisor_name
 		FROM students s
 		JOIN users u ON s.user_id = u.id
@@ -28,10 +28,10 @@ func (r *StudentRepository) GetByID(ctx context.Context, id uuid.UUID) (*entity.
 		WHERE s.id = $1
 	`
 	student := &entity.Student{}
-	var advisorID sql.NullString
+	var advisorID, programID sql.NullString
 	err := r.db.QueryRowContext(ctx, query, id).Scan(
 		&student.ID, &student.UserID, &student.StudentID, &student.FullName, &student.Email,
-		&student.ProgramStudy, &student.AcademicYear, &advisorID, &student.CreatedAt, &student.AdvisorName,
+		&student.ProgramStudy, &student.AcademicYear, &advisorID, &programID, &student.CreatedAt, &student.AdvisorName,
 	)
 	if err != nil {
 		return nil, err
@@ -40,13 +40,17 @@ func (r *StudentRepository) GetByID(ctx context.Context, id uuid.UUID) (*entity.
 		uid, _ := uuid.Parse(advisorID.String)
 		student.AdvisorID = &uid
 	}
+	if programID.Valid {
+		pid, _ := uuid.Parse(programID.String)
+		student.StudyProgramID = &pid
+	}
 	return student, nil
 }
 
 func (r *StudentRepository) GetByUserID(ctx context.Context, userID uuid.UUID) (*entity.Student, error) {
 	query := `
 		SELECT s.id, s.user_id, s.student_id, u.full_name, u.email, s.program_study, 
-		       s.academic_year, s.advisor_id, s.created_at,
+		       s.academic_year, s.advisor_id, s.study_program_id, s.created_at,
 		       COALESCE(lu.full_name, '') as advisor_name
 		FROM students s
 		JOIN users u ON s.user_id = u.id
@@ -55,10 +59,41 @@ func (r *StudentRepository) GetByUserID(ctx context.Context, userID uuid.UUID) (
 		WHERE s.user_id = $1
 	`
 	student := &entity.Student{}
-	var advisorID sql.NullString
+	var advisorID, programID sql.NullString
 	err := r.db.QueryRowContext(ctx, query, userID).Scan(
 		&student.ID, &student.UserID, &student.StudentID, &student.FullName, &student.Email,
-		&student.ProgramStudy, &student.AcademicYear, &advisorID, &student.CreatedAt, &student.AdvisorName,
+		&student.ProgramStudy, &student.AcademicYear, &advisorID, &programID, &student.CreatedAt, &student.AdvisorName,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if advisorID.Valid {
+		uid, _ := uuid.Parse(advisorID.String)
+		student.AdvisorID = &uid
+	}
+	if programID.Valid {
+		pid, _ := uuid.Parse(programID.String)
+		student.StudyProgramID = &pid
+	}
+	return student, nil
+}
+
+func (r *StudentRepository) GetByStudentID(ctx context.Context, nim string) (*entity.Student, error) {
+	query := `
+		SELECT s.id, s.user_id, s.student_id, u.full_name, u.email, s.program_study, 
+		       s.academic_year, s.advisor_id, s.study_program_id, s.created_at,
+		       COALESCE(lu.full_name, '') as advisor_name
+		FROM students s
+		JOIN users u ON s.user_id = u.id
+		LEFT JOIN lecturers l ON s.advisor_id = l.id
+		LEFT JOIN users lu ON l.user_id = lu.id
+		WHERE s.student_id = $1
+	`
+	student := &entity.Student{}
+	var advisorID, programID sql.NullString
+	err := r.db.QueryRowContext(ctx, query, nim).Scan(
+		&student.ID, &student.UserID, &student.StudentID, &student.FullName, &student.Email,
+		&student.ProgramStudy, &student.AcademicYear, &advisorID, &programID, &student.CreatedAt, &student.AdvisorName,
 	)
 	if err != nil {
 		return nil, err
@@ -67,9 +102,53 @@ func (r *StudentRepository) GetByUserID(ctx context.Context, userID uuid.UUID) (
 		uid, _ := uuid.Parse(advisorID.String)
 		student.AdvisorID = &uid
 	}
+	if programID.Valid {
+		pid, _ := uuid.Parse(programID.String)
+		student.StudyProgramID = &pid
+	}
 	return student, nil
 }
 
+func (r *StudentRepository) GetByIDs(ctx context.Context, ids []uuid.UUID) ([]*entity.Student, error) {
+	query := `
+		SELECT s.id, s.user_id, s.student_id, u.full_name, u.email, s.program_study, 
+		       s.academic_year, s.advisor_id, s.study_program_id, s.created_at,
+		       COALESCE(lu.full_name, '') as advisor_name
+		FROM students s
+		JOIN users u ON s.user_id = u.id
+		LEFT JOIN lecturers l ON s.advisor_id = l.id
+		LEFT JOIN users lu ON l.user_id = lu.id
+		WHERE s.id = ANY($1::uuid[])
+	`
+	rows, err := r.db.QueryContext(ctx, query, uuidArray(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var students []*entity.Student
+	for rows.Next() {
+		student := &entity.Student{}
+		var advisorID, programID sql.NullString
+		if err := rows.Scan(
+			&student.ID, &student.UserID, &student.StudentID, &student.FullName, &student.Email,
+			&student.ProgramStudy, &student.AcademicYear, &advisorID, &programID, &student.CreatedAt, &student.AdvisorName,
+		); err != nil {
+			return nil, err
+		}
+		if advisorID.Valid {
+			uid, _ := uuid.Parse(advisorID.String)
+			student.AdvisorID = &uid
+		}
+		if programID.Valid {
+			pid, _ := uuid.Parse(programID.String)
+			student.StudyProgramID = &pid
+		}
+		students = append(students, student)
+	}
+	return students, nil
+}
+
 func (r *StudentRepository) Create(ctx context.Context, student *entity.Student) error {
 	query := `
 		INSERT INTO students (id, user_id, student_id, program_study, academic_year, advisor_id)
@@ -81,31 +160,168 @@ func (r *StudentRepository) Create(ctx context.Context, student *entity.Student)
 	return err
 }
 
-func (r *StudentRepository) UpdateAdvisor(ctx context.Context, studentID, advisorID uuid.UUID) error {
-	query := `UPDATE students SET advisor_id = $2 WHERE id = $1`
-	_, err := r.db.ExecContext(ctx, query, studentID, advisorID)
-	return err
+// UpdateAdvisor closes the student's current advisor assignment, opens a new
+// one and hands every submitted (not yet verified) achievement over to the new
+// advisor with a history note, all in one transaction. It returns the number
+// of submissions transferred, or -1 when the advisor did not change.
+func (r *StudentRepository) UpdateAdvisor(ctx context.Context, studentID, advisorID uuid.UUID, assignedBy *uuid.UUID, note string) (int64, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	transferred, err := r.updateAdvisor(ctx, tx, studentID, advisorID, assignedBy, note)
+	if err != nil || transferred < 0 {
+		return transferred, err
+	}
+	return transferred, tx.Commit()
+}
+
+// AssignAdvisors sets the advisor of every student in assignments in one
+// transaction. It fails with sql.ErrNoRows, leaving every student unchanged,
+// when one of them got an advisor in the meantime.
+func (r *StudentRepository) AssignAdvisors(ctx context.Context, assignments []entity.AdvisorAssignment, assignedBy uuid.UUID, note string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, a := range assignments {
+		var id uuid.UUID
+		if err := tx.QueryRowContext(ctx, `SELECT id FROM students WHERE id = $1 AND advisor_id IS NULL FOR UPDATE`, a.StudentID).Scan(&id); err != nil {
+			return err
+		}
+		if _, err := r.updateAdvisor(ctx, tx, a.StudentID, a.LecturerID, &assignedBy, note); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
 }
 
-func (r *StudentRepository) List(ctx context.Context, limit, offset int) ([]*entity.Student, int, error) {
+func (r *StudentRepository) updateAdvisor(ctx context.Context, tx *sql.Tx, studentID, advisorID uuid.UUID, assignedBy *uuid.UUID, note string) (int64, error) {
+	var currentAdvisor sql.NullString
+	if err := tx.QueryRowContext(ctx, `SELECT advisor_id FROM students WHERE id = $1 FOR UPDATE`, studentID).Scan(&currentAdvisor); err != nil {
+		return 0, err
+	}
+	if currentAdvisor.Valid && currentAdvisor.String == advisorID.String() {
+		return -1, nil
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE advisor_assignments SET ended_at = NOW() WHERE student_id = $1 AND ended_at IS NULL`, studentID); err != nil {
+		return 0, err
+	}
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO advisor_assignments (student_id, lecturer_id, assigned_by, note)
+		VALUES ($1, $2, $3, $4)
+	`, studentID, advisorID, assignedBy, note); err != nil {
+		return 0, err
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE students SET advisor_id = $2 WHERE id = $1`, studentID, advisorID); err != nil {
+		return 0, err
+	}
+
+	var newName, oldName string
+	if err := tx.QueryRowContext(ctx, `SELECT u.full_name FROM lecturers l JOIN users u ON l.user_id = u.id WHERE l.id = $1`, advisorID).Scan(&newName); err != nil {
+		return 0, err
+	}
+	transferNote := "Verification assigned to " + newName + " after advisor change"
+	if currentAdvisor.Valid {
+		if err := tx.QueryRowContext(ctx, `SELECT u.full_name FROM lecturers l JOIN users u ON l.user_id = u.id WHERE l.id = $1`, currentAdvisor.String).Scan(&oldName); err == nil {
+			transferNote = "Verification transferred from " + oldName + " to " + newName + " after advisor change"
+		}
+	}
+
+	result, err := tx.ExecContext(ctx, `
+		INSERT INTO achievement_status_history (achievement_ref_id, old_status, new_status, changed_by, note)
+		SELECT id, status, status, $2, $3 FROM achievement_references
+		WHERE student_id = $1 AND status = 'submitted'
+	`, studentID, assignedBy, transferNote)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// UpdateStudyProgram links the student to a study program and keeps the
+// free-text program_study column in sync with the program name.
+func (r *StudentRepository) UpdateStudyProgram(ctx context.Context, studentID, programID uuid.UUID) error {
+	query := `
+		UPDATE students s SET study_program_id = p.id, program_study = p.name
+		FROM study_programs p
+		WHERE s.id = $1 AND p.id = $2
+	`
+	return execOne(r.db.ExecContext(ctx, query, studentID, programID))
+}
+
+func (r *StudentRepository) GetAdvisorHistory(ctx context.Context, studentID uuid.UUID) ([]*entity.AdvisorHistoryEntry, error) {
+	query := `
+		SELECT a.id, a.student_id, a.lecturer_id, l.lecturer_id, lu.full_name,
+		       a.assigned_by, COALESCE(au.full_name, ''), COALESCE(a.note, ''), a.started_at, a.ended_at
+		FROM advisor_assignments a
+		JOIN lecturers l ON a.lecturer_id = l.id
+		JOIN users lu ON l.user_id = lu.id
+		LEFT JOIN users au ON a.assigned_by = au.id
+		WHERE a.student_id = $1
+		ORDER BY a.started_at DESC
+	`
+	rows, err := r.db.QueryContext(ctx, query, studentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	history := []*entity.AdvisorHistoryEntry{}
+	for rows.Next() {
+		h := &entity.AdvisorHistoryEntry{}
+		var assignedBy sql.NullString
+		var endedAt sql.NullTime
+		if err := rows.Scan(
+			&h.ID, &h.StudentID, &h.LecturerID, &h.LecturerNIP, &h.LecturerName,
+			&assignedBy, &h.AssignedByName, &h.Note, &h.StartedAt, &endedAt,
+		); err != nil {
+			return nil, err
+		}
+		if assignedBy.Valid {
+			id, _ := uuid.Parse(assignedBy.String)
+			h.AssignedBy = &id
+		}
+		if endedAt.Valid {
+			h.EndedAt = &endedAt.Time
+		}
+		history = append(history, h)
+	}
+	return history, nil
+}
+
+// List pages through the given students; a nil studentIDs slice means
+// every student.
+func (r *StudentRepository) List(ctx context.Context, studentIDs []uuid.UUID, limit, offset int) ([]*entity.Student, int, error) {
+	var ids interface{}
+	if studentIDs != nil {
+		ids = uuidArray(studentIDs)
+	}
+
 	var total int
-	countQuery := `SELECT COUNT(*) FROM students`
-	if err := r.db.QueryRowContext(ctx, countQuery).Scan(&total); err != nil {
+	countQuery := `SELECT COUNT(*) FROM students WHERE ($1::uuid[] IS NULL OR id = ANY($1::uuid[]))`
+	if err := r.db.QueryRowContext(ctx, countQuery, ids).Scan(&total); err != nil {
 		return nil, 0, err
 	}
 
 	query := `
 		SELECT s.id, s.user_id, s.student_id, u.full_name, u.email, s.program_study, 
-		       s.academic_year, s.advisor_id, s.created_at,
+		       s.academic_year, s.advisor_id, s.study_program_id, s.created_at,
 		       COALESCE(lu.full_name, '') as advisor_name
 		FROM students s
 		JOIN users u ON s.user_id = u.id
 		LEFT JOIN lecturers l ON s.advisor_id = l.id
 		LEFT JOIN users lu ON l.user_id = lu.id
+		WHERE ($1::uuid[] IS NULL OR s.id = ANY($1::uuid[]))
 		ORDER BY s.created_at DESC
-		LIMIT $1 OFFSET $2
+		LIMIT $2 OFFSET $3
 	`
-	rows, err := r.db.QueryContext(ctx, query, limit, offset)
+	rows, err := r.db.QueryContext(ctx, query, ids, limit, offset)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -114,10 +330,10 @@ func (r *StudentRepository) List(ctx context.Context, limit, offset int) ([]*ent
 	var students []*entity.Student
 	for rows.Next() {
 		student := &entity.Student{}
-		var advisorID sql.NullString
+		var advisorID, programID sql.NullString
 		if err := rows.Scan(
 			&student.ID, &student.UserID, &student.StudentID, &student.FullName, &student.Email,
-			&student.ProgramStudy, &student.AcademicYear, &advisorID, &student.CreatedAt, &student.AdvisorName,
+			&student.ProgramStudy, &student.AcademicYear, &advisorID, &programID, &student.CreatedAt, &student.AdvisorName,
 		); err != nil {
 			return nil, 0, err
 		}
@@ -125,12 +341,73 @@ func (r *StudentRepository) List(ctx context.Context, limit, offset int) ([]*ent
 			uid, _ := uuid.Parse(advisorID.String)
 			student.AdvisorID = &uid
 		}
+		if programID.Valid {
+			pid, _ := uuid.Parse(programID.String)
+			student.StudyProgramID = &pid
+		}
 		students = append(students, student)
 	}
 
 	return students, total, nil
 }
 
+func (r *StudentRepository) ListWithoutAdvisor(ctx context.Context) ([]*entity.Student, error) {
+	query := `
+		SELECT s.id, s.user_id, s.student_id, u.full_name, u.email, COALESCE(s.program_study, ''),
+		       COALESCE(s.academic_year, ''), s.study_program_id, s.created_at
+		FROM students s
+		JOIN users u ON s.user_id = u.id
+		WHERE s.advisor_id IS NULL
+		ORDER BY s.program_study, s.student_id
+	`
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var students []*entity.Student
+	for rows.Next() {
+		student := &entity.Student{}
+		var programID sql.NullString
+		if err := rows.Scan(
+			&student.ID, &student.UserID, &student.StudentID, &student.FullName, &student.Email,
+			&student.ProgramStudy, &student.AcademicYear, &programID, &student.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		if programID.Valid {
+			pid, _ := uuid.Parse(programID.String)
+			student.StudyProgramID = &pid
+		}
+		students = append(students, student)
+	}
+	return students, nil
+}
+
+func (r *StudentRepository) SetLeaderboardHidden(ctx context.Context, studentID uuid.UUID, hidden bool) error {
+	return execOne(r.db.ExecContext(ctx, `UPDATE students SET hide_from_leaderboard = $2 WHERE id = $1`, studentID, hidden))
+}
+
+// ListIDsByAdvisorID returns the IDs of every advisee of the lecturer.
+func (r *StudentRepository) ListIDsByAdvisorID(ctx context.Context, advisorID uuid.UUID) ([]uuid.UUID, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT id FROM students WHERE advisor_id = $1 ORDER BY student_id`, advisorID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []uuid.UUID{}
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
 func (r *StudentRepository) GetByAdvisorID(ctx context.Context, advisorID uuid.UUID, limit, offset int) ([]*entity.Student, int, error) {
 	var total int
 	countQuery := `SELECT COUNT(*) FROM students WHERE advisor_id = $1`
@@ -140,7 +417,7 @@ func (r *StudentRepository) GetByAdvisorID(ctx context.Context, advisorID uuid.U
 
 	query := `
 		SELECT s.id, s.user_id, s.student_id, u.full_name, u.email, s.program_study, 
-		       s.academic_year, s.advisor_id, s.created_at,
+		       s.academic_year, s.advisor_id, s.study_program_id, s.created_at,
 		       COALESCE(lu.full_name, '') as advisor_name
 		FROM students s
 		JOIN users u ON s.user_id = u.id
@@ -159,10 +436,10 @@ func (r *StudentRepository) GetByAdvisorID(ctx context.Context, advisorID uuid.U
 	var students []*entity.Student
 	for rows.Next() {
 		student := &entity.Student{}
-		var advID sql.NullString
+		var advID, programID sql.NullString
 		if err := rows.Scan(
 			&student.ID, &student.UserID, &student.StudentID, &student.FullName, &student.Email,
-			&student.ProgramStudy, &student.AcademicYear, &advID, &student.CreatedAt, &student.AdvisorName,
+			&student.ProgramStudy, &student.AcademicYear, &advID, &programID, &student.CreatedAt, &student.AdvisorName,
 		); err != nil {
 			return nil, 0, err
 		}
@@ -170,8 +447,38 @@ func (r *StudentRepository) GetByAdvisorID(ctx context.Context, advisorID uuid.U
 			uid, _ := uuid.Parse(advID.String)
 			student.AdvisorID = &uid
 		}
+		if programID.Valid {
+			pid, _ := uuid.Parse(programID.String)
+			student.StudyProgramID = &pid
+		}
 		students = append(students, student)
 	}
 
 	return students, total, nil
 }
+
+// ListIDsByDepartmentID returns the IDs of the students whose study program
+// belongs to the department.
+func (r *StudentRepository) ListIDsByDepartmentID(ctx context.Context, departmentID uuid.UUID) ([]uuid.UUID, error) {
+	query := `
+		SELECT s.id FROM students s
+		JOIN study_programs sp ON sp.id = s.study_program_id
+		WHERE sp.department_id = $1
+		ORDER BY s.student_id
+	`
+	rows, err := r.db.QueryContext(ctx, query, departmentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []uuid.UUID{}
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
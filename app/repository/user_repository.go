@@ -3,6 +3,7 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 
 	"github.com/Aryma-f4/uas-backend/app/entity"
@@ -10,17 +11,25 @@ import (
 )
 
 type UserRepository struct {
-	db *sql.DB
+	db          *sql.DB
+	permissions *PermissionCache
 }
 
 func NewUserRepository(db *sql.DB) *UserRepository {
-	return &UserRepository{db: db}
+	return &UserRepository{db: db, permissions: NewPermissionCache(db)}
+}
+
+// PermissionCache returns the cache that serves GetRoleAccess,
+// GetPermissions and CheckPermission.
+func (r *UserRepository) PermissionCache() *PermissionCache {
+	return r.permissions
 }
 
 func (r *UserRepository) GetByID(ctx context.Context, id uuid.UUID) (*entity.User, error) {
 	query := `
 		SELECT u.id, u.username, u.email, u.password_hash, u.full_name, 
-		       u.role_id, r.name as role_name, u.is_active, u.created_at, u.updated_at
+		       u.role_id, r.name as role_name, u.is_active, COALESCE(u.auth_provider, ''),
+		       u.created_at, u.updated_at
 		FROM users u
 		LEFT JOIN roles r ON u.role_id = r.id
 		WHERE u.id = $1
@@ -28,7 +37,7 @@ func (r *UserRepository) GetByID(ctx context.Context, id uuid.UUID) (*entity.Use
 	user := &entity.User{}
 	err := r.db.QueryRowContext(ctx, query, id).Scan(
 		&user.ID, &user.Username, &user.Email, &user.PasswordHash, &user.FullName,
-		&user.RoleID, &user.RoleName, &user.IsActive, &user.CreatedAt, &user.UpdatedAt,
+		&user.RoleID, &user.RoleName, &user.IsActive, &user.AuthProvider, &user.CreatedAt, &user.UpdatedAt,
 	)
 	if err != nil {
 		return nil, err
@@ -39,7 +48,8 @@ func (r *UserRepository) GetByID(ctx context.Context, id uuid.UUID) (*entity.Use
 func (r *UserRepository) GetByUsername(ctx context.Context, username string) (*entity.User, error) {
 	query := `
 		SELECT u.id, u.username, u.email, u.password_hash, u.full_name, 
-		       u.role_id, r.name as role_name, u.is_active, u.created_at, u.updated_at
+		       u.role_id, r.name as role_name, u.is_active, COALESCE(u.auth_provider, ''),
+		       u.created_at, u.updated_at
 		FROM users u
 		LEFT JOIN roles r ON u.role_id = r.id
 		WHERE u.username = $1
@@ -47,7 +57,7 @@ func (r *UserRepository) GetByUsername(ctx context.Context, username string) (*e
 	user := &entity.User{}
 	err := r.db.QueryRowContext(ctx, query, username).Scan(
 		&user.ID, &user.Username, &user.Email, &user.PasswordHash, &user.FullName,
-		&user.RoleID, &user.RoleName, &user.IsActive, &user.CreatedAt, &user.UpdatedAt,
+		&user.RoleID, &user.RoleName, &user.IsActive, &user.AuthProvider, &user.CreatedAt, &user.UpdatedAt,
 	)
 	if err != nil {
 		return nil, err
@@ -58,7 +68,8 @@ func (r *UserRepository) GetByUsername(ctx context.Context, username string) (*e
 func (r *UserRepository) GetByEmail(ctx context.Context, email string) (*entity.User, error) {
 	query := `
 		SELECT u.id, u.username, u.email, u.password_hash, u.full_name, 
-		       u.role_id, r.name as role_name, u.is_active, u.created_at, u.updated_at
+		       u.role_id, r.name as role_name, u.is_active, COALESCE(u.auth_provider, ''),
+		       u.created_at, u.updated_at
 		FROM users u
 		LEFT JOIN roles r ON u.role_id = r.id
 		WHERE u.email = $1
@@ -66,7 +77,7 @@ func (r *UserRepository) GetByEmail(ctx context.Context, email string) (*entity.
 	user := &entity.User{}
 	err := r.db.QueryRowContext(ctx, query, email).Scan(
 		&user.ID, &user.Username, &user.Email, &user.PasswordHash, &user.FullName,
-		&user.RoleID, &user.RoleName, &user.IsActive, &user.CreatedAt, &user.UpdatedAt,
+		&user.RoleID, &user.RoleName, &user.IsActive, &user.AuthProvider, &user.CreatedAt, &user.UpdatedAt,
 	)
 	if err != nil {
 		return nil, err
@@ -76,21 +87,450 @@ func (r *UserRepository) GetByEmail(ctx context.Context, email string) (*entity.
 
 func (r *UserRepository) Create(ctx context.Context, user *entity.User) error {
 	query := `
-		INSERT INTO users (id, username, email, password_hash, full_name, role_id, is_active)
-		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		INSERT INTO users (id, username, email, password_hash, full_name, role_id, is_active, auth_provider)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, NULLIF($8, ''))
 	`
 	_, err := r.db.ExecContext(ctx, query,
-		user.ID, user.Username, user.Email, user.PasswordHash, user.FullName, user.RoleID, user.IsActive,
+		user.ID, user.Username, user.Email, user.PasswordHash, user.FullName, user.RoleID, user.IsActive, user.AuthProvider,
+	)
+	return err
+}
+
+// CreateWithProfile creates the user together with its student or lecturer
+// profile and optional invitation in a single transaction.
+func (r *UserRepository) CreateWithProfile(ctx context.Context, user *entity.User, student *entity.Student, lecturer *entity.Lecturer, invitation *entity.UserInvitation) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO users (id, username, email, password_hash, full_name, role_id, is_active, auth_provider)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, NULLIF($8, ''))
+	`, user.ID, user.Username, user.Email, user.PasswordHash, user.FullName, user.RoleID, user.IsActive, user.AuthProvider); err != nil {
+		return err
+	}
+
+	if lecturer != nil {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO lecturers (id, user_id, lecturer_id, department)
+			VALUES ($1, $2, $3, $4)
+		`, lecturer.ID, lecturer.UserID, lecturer.LecturerID, lecturer.Department); err != nil {
+			return err
+		}
+	}
+
+	if student != nil {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO students (id, user_id, student_id, program_study, academic_year, advisor_id)
+			VALUES ($1, $2, $3, $4, $5, $6)
+		`, student.ID, student.UserID, student.StudentID, student.ProgramStudy, student.AcademicYear, student.AdvisorID); err != nil {
+			return err
+		}
+		if student.AdvisorID != nil {
+			if _, err := tx.ExecContext(ctx, `
+				INSERT INTO advisor_assignments (student_id, lecturer_id, note)
+				VALUES ($1, $2, $3)
+			`, student.ID, student.AdvisorID, "Assigned during roster import"); err != nil {
+				return err
+			}
+		}
+	}
+
+	if invitation != nil {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO user_invitations (id, user_id, token_hash, expires_at)
+			VALUES ($1, $2, $3, $4)
+		`, invitation.ID, invitation.UserID, invitation.TokenHash, invitation.ExpiresAt); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (r *UserRepository) GetInvitationByTokenHash(ctx context.Context, tokenHash string) (*entity.UserInvitation, error) {
+	query := `
+		SELECT id, user_id, token_hash, expires_at, accepted_at, created_at
+		FROM user_invitations
+		WHERE token_hash = $1
+	`
+	invitation := &entity.UserInvitation{}
+	var acceptedAt sql.NullTime
+	err := r.db.QueryRowContext(ctx, query, tokenHash).Scan(
+		&invitation.ID, &invitation.UserID, &invitation.TokenHash, &invitation.ExpiresAt, &acceptedAt, &invitation.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if acceptedAt.Valid {
+		invitation.AcceptedAt = &acceptedAt.Time
+	}
+	return invitation, nil
+}
+
+// AcceptInvitation marks the invitation as used and sets the user's password.
+// It fails if the invitation was already accepted concurrently.
+func (r *UserRepository) AcceptInvitation(ctx context.Context, invitationID, userID uuid.UUID, passwordHash string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `UPDATE user_invitations SET accepted_at = NOW() WHERE id = $1 AND accepted_at IS NULL`, invitationID)
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return sql.ErrNoRows
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE users SET password_hash = $2, updated_at = NOW() WHERE id = $1`, userID, passwordHash); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// CreateSession stores a new session together with its first refresh token.
+func (r *UserRepository) CreateSession(ctx context.Context, session *entity.Session, token *entity.RefreshToken) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO sessions (id, user_id, user_agent, ip_address, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`, session.ID, session.UserID, session.UserAgent, session.IPAddress, session.ExpiresAt)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO refresh_tokens (id, user_id, family_id, token_hash, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`, token.ID, token.UserID, token.FamilyID, token.TokenHash, token.ExpiresAt)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *UserRepository) GetRefreshTokenByHash(ctx context.Context, tokenHash string) (*entity.RefreshToken, error) {
+	query := `
+		SELECT id, user_id, family_id, token_hash, expires_at, used_at, revoked_at, created_at
+		FROM refresh_tokens
+		WHERE token_hash = $1
+	`
+	token := &entity.RefreshToken{}
+	var usedAt, revokedAt sql.NullTime
+	err := r.db.QueryRowContext(ctx, query, tokenHash).Scan(
+		&token.ID, &token.UserID, &token.FamilyID, &token.TokenHash, &token.ExpiresAt, &usedAt, &revokedAt, &token.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if usedAt.Valid {
+		token.UsedAt = &usedAt.Time
+	}
+	if revokedAt.Valid {
+		token.RevokedAt = &revokedAt.Time
+	}
+	return token, nil
+}
+
+// RotateRefreshToken marks the token as used and stores its successor. It
+// returns sql.ErrNoRows if the token was used or revoked concurrently.
+func (r *UserRepository) RotateRefreshToken(ctx context.Context, usedID uuid.UUID, next *entity.RefreshToken) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = execOne(tx.ExecContext(ctx, `
+		UPDATE refresh_tokens SET used_at = NOW()
+		WHERE id = $1 AND used_at IS NULL AND revoked_at IS NULL
+	`, usedID))
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO refresh_tokens (id, user_id, family_id, token_hash, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`, next.ID, next.UserID, next.FamilyID, next.TokenHash, next.ExpiresAt)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE sessions SET last_seen_at = NOW(), expires_at = $2 WHERE id = $1
+	`, next.FamilyID, next.ExpiresAt)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// CreateImpersonationSession stores a session in which session.ImpersonatedBy
+// acts as the user. It has no refresh token.
+func (r *UserRepository) CreateImpersonationSession(ctx context.Context, session *entity.Session) error {
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO sessions (id, user_id, user_agent, ip_address, expires_at, impersonated_by)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`, session.ID, session.UserID, session.UserAgent, session.IPAddress, session.ExpiresAt, session.ImpersonatedBy)
+	return err
+}
+
+func (r *UserRepository) GetSession(ctx context.Context, id uuid.UUID) (*entity.Session, error) {
+	query := `
+		SELECT id, user_id, user_agent, ip_address, created_at, last_seen_at, expires_at, revoked_at, impersonated_by
+		FROM sessions
+		WHERE id = $1
+	`
+	return scanSession(r.db.QueryRowContext(ctx, query, id))
+}
+
+// ListActiveSessions returns the sessions of a user that are neither revoked
+// nor expired, most recently used first.
+func (r *UserRepository) ListActiveSessions(ctx context.Context, userID uuid.UUID) ([]*entity.Session, error) {
+	query := `
+		SELECT id, user_id, user_agent, ip_address, created_at, last_seen_at, expires_at, revoked_at, impersonated_by
+		FROM sessions
+		WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > NOW()
+		ORDER BY last_seen_at DESC
+	`
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []*entity.Session{}
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+// TouchSession records activity on a session, at most once a minute.
+func (r *UserRepository) TouchSession(ctx context.Context, id uuid.UUID) error {
+	query := `
+		UPDATE sessions SET last_seen_at = NOW()
+		WHERE id = $1 AND last_seen_at < NOW() - INTERVAL '1 minute'
+	`
+	_, err := r.db.ExecContext(ctx, query, id)
+	return err
+}
+
+// RevokeSession revokes a session of the user and its refresh tokens. It
+// returns sql.ErrNoRows if the user has no such active session. Refresh
+// token families without a session row are revoked as well.
+func (r *UserRepository) RevokeSession(ctx context.Context, userID, sessionID uuid.UUID) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `
+		UPDATE sessions SET revoked_at = NOW()
+		WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL
+	`, sessionID, userID)
+	if err != nil {
+		return err
+	}
+	sessions, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	result, err = tx.ExecContext(ctx, `
+		UPDATE refresh_tokens SET revoked_at = NOW()
+		WHERE family_id = $1 AND user_id = $2 AND revoked_at IS NULL
+	`, sessionID, userID)
+	if err != nil {
+		return err
+	}
+	tokens, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if sessions == 0 && tokens == 0 {
+		return sql.ErrNoRows
+	}
+	return tx.Commit()
+}
+
+// RevokeAllSessions revokes every session and refresh token of a user and
+// returns the number of sessions revoked.
+func (r *UserRepository) RevokeAllSessions(ctx context.Context, userID uuid.UUID) (int, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `
+		UPDATE sessions SET revoked_at = NOW()
+		WHERE user_id = $1 AND revoked_at IS NULL
+	`, userID)
+	if err != nil {
+		return 0, err
+	}
+	revoked, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE refresh_tokens SET revoked_at = NOW()
+		WHERE user_id = $1 AND revoked_at IS NULL
+	`, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	return int(revoked), tx.Commit()
+}
+
+func scanSession(row interface{ Scan(...interface{}) error }) (*entity.Session, error) {
+	session := &entity.Session{}
+	var revokedAt sql.NullTime
+	err := row.Scan(
+		&session.ID, &session.UserID, &session.UserAgent, &session.IPAddress,
+		&session.CreatedAt, &session.LastSeenAt, &session.ExpiresAt, &revokedAt, &session.ImpersonatedBy,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if revokedAt.Valid {
+		session.RevokedAt = &revokedAt.Time
+	}
+	return session, nil
+}
+
+// CreatePasswordReset stores a reset token and invalidates the earlier
+// unused tokens of the user.
+func (r *UserRepository) CreatePasswordReset(ctx context.Context, reset *entity.PasswordReset) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `UPDATE password_resets SET used_at = NOW() WHERE user_id = $1 AND used_at IS NULL`, reset.UserID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO password_resets (id, user_id, token_hash, expires_at)
+		VALUES ($1, $2, $3, $4)
+	`, reset.ID, reset.UserID, reset.TokenHash, reset.ExpiresAt)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *UserRepository) GetPasswordResetByTokenHash(ctx context.Context, tokenHash string) (*entity.PasswordReset, error) {
+	query := `
+		SELECT id, user_id, token_hash, expires_at, used_at, created_at
+		FROM password_resets
+		WHERE token_hash = $1
+	`
+	reset := &entity.PasswordReset{}
+	var usedAt sql.NullTime
+	err := r.db.QueryRowContext(ctx, query, tokenHash).Scan(
+		&reset.ID, &reset.UserID, &reset.TokenHash, &reset.ExpiresAt, &usedAt, &reset.CreatedAt,
 	)
+	if err != nil {
+		return nil, err
+	}
+	if usedAt.Valid {
+		reset.UsedAt = &usedAt.Time
+	}
+	return reset, nil
+}
+
+// UpdatePassword sets a new password hash and revokes every session of the
+// user except keepSessionID, which may be uuid.Nil.
+func (r *UserRepository) UpdatePassword(ctx context.Context, userID uuid.UUID, passwordHash string, keepSessionID uuid.UUID) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := updatePasswordTx(ctx, tx, userID, passwordHash, keepSessionID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ResetPassword uses up a reset token, sets the new password hash and
+// revokes every session of the user. It returns sql.ErrNoRows if the token
+// was used concurrently.
+func (r *UserRepository) ResetPassword(ctx context.Context, resetID, userID uuid.UUID, passwordHash string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = execOne(tx.ExecContext(ctx, `UPDATE password_resets SET used_at = NOW() WHERE id = $1 AND used_at IS NULL`, resetID))
+	if err != nil {
+		return err
+	}
+
+	if err := updatePasswordTx(ctx, tx, userID, passwordHash, uuid.Nil); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func updatePasswordTx(ctx context.Context, tx *sql.Tx, userID uuid.UUID, passwordHash string, keepSessionID uuid.UUID) error {
+	err := execOne(tx.ExecContext(ctx, `UPDATE users SET password_hash = $2, updated_at = NOW() WHERE id = $1`, userID, passwordHash))
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE sessions SET revoked_at = NOW()
+		WHERE user_id = $1 AND id <> $2 AND revoked_at IS NULL
+	`, userID, keepSessionID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE refresh_tokens SET revoked_at = NOW()
+		WHERE user_id = $1 AND family_id <> $2 AND revoked_at IS NULL
+	`, userID, keepSessionID)
 	return err
 }
 
 func (r *UserRepository) Update(ctx context.Context, user *entity.User) error {
 	query := `
-		UPDATE users SET username = $2, email = $3, full_name = $4, is_active = $5, updated_at = NOW()
+		UPDATE users SET username = $2, email = $3, full_name = $4, is_active = $5,
+		       auth_provider = NULLIF($6, ''), updated_at = NOW()
 		WHERE id = $1
 	`
-	_, err := r.db.ExecContext(ctx, query, user.ID, user.Username, user.Email, user.FullName, user.IsActive)
+	_, err := r.db.ExecContext(ctx, query, user.ID, user.Username, user.Email, user.FullName, user.IsActive, user.AuthProvider)
 	return err
 }
 
@@ -116,7 +556,8 @@ func (r *UserRepository) List(ctx context.Context, limit, offset int) ([]*entity
 
 	query := `
 		SELECT u.id, u.username, u.email, u.password_hash, u.full_name, 
-		       u.role_id, r.name as role_name, u.is_active, u.created_at, u.updated_at
+		       u.role_id, r.name as role_name, u.is_active, COALESCE(u.auth_provider, ''),
+		       u.created_at, u.updated_at
 		FROM users u
 		LEFT JOIN roles r ON u.role_id = r.id
 		ORDER BY u.created_at DESC
@@ -133,7 +574,7 @@ func (r *UserRepository) List(ctx context.Context, limit, offset int) ([]*entity
 		user := &entity.User{}
 		if err := rows.Scan(
 			&user.ID, &user.Username, &user.Email, &user.PasswordHash, &user.FullName,
-			&user.RoleID, &user.RoleName, &user.IsActive, &user.CreatedAt, &user.UpdatedAt,
+			&user.RoleID, &user.RoleName, &user.IsActive, &user.AuthProvider, &user.CreatedAt, &user.UpdatedAt,
 		); err != nil {
 			return nil, 0, err
 		}
@@ -144,33 +585,31 @@ func (r *UserRepository) List(ctx context.Context, limit, offset int) ([]*entity
 }
 
 func (r *UserRepository) GetPermissions(ctx context.Context, roleID uuid.UUID) ([]string, error) {
-	query := `
-		SELECT p.name FROM permissions p
-		JOIN role_permissions rp ON p.id = rp.permission_id
-		WHERE rp.role_id = $1
-	`
-	rows, err := r.db.QueryContext(ctx, query, roleID)
+	role, err := r.permissions.Role(ctx, roleID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return []string{}, nil
+	}
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
+	return append([]string{}, role.Permissions...), nil
+}
 
-	var permissions []string
-	for rows.Next() {
-		var perm string
-		if err := rows.Scan(&perm); err != nil {
-			return nil, err
-		}
-		permissions = append(permissions, perm)
-	}
+// GetRoleAccess returns the name and permissions of a role from the
+// permission cache, or sql.ErrNoRows for an unknown role.
+func (r *UserRepository) GetRoleAccess(ctx context.Context, roleID uuid.UUID) (*entity.RoleAccess, error) {
+	return r.permissions.Role(ctx, roleID)
+}
 
-	return permissions, nil
+// PermissionVersion returns the permission version of the cached permissions.
+func (r *UserRepository) PermissionVersion(ctx context.Context) (int64, error) {
+	return r.permissions.Version(ctx)
 }
 
 func (r *UserRepository) GetRoleByName(ctx context.Context, name string) (*entity.Role, error) {
-	query := `SELECT id, name, description, created_at FROM roles WHERE name = $1`
+	query := `SELECT id, name, description, mfa_required, is_builtin, created_at FROM roles WHERE name = $1`
 	role := &entity.Role{}
-	err := r.db.QueryRowContext(ctx, query, name).Scan(&role.ID, &role.Name, &role.Description, &role.CreatedAt)
+	err := r.db.QueryRowContext(ctx, query, name).Scan(&role.ID, &role.Name, &role.Description, &role.MFARequired, &role.IsBuiltin, &role.CreatedAt)
 	if err != nil {
 		return nil, err
 	}
@@ -178,7 +617,7 @@ func (r *UserRepository) GetRoleByName(ctx context.Context, name string) (*entit
 }
 
 func (r *UserRepository) GetRoles(ctx context.Context) ([]*entity.Role, error) {
-	query := `SELECT id, name, description, created_at FROM roles ORDER BY name`
+	query := `SELECT id, name, description, mfa_required, is_builtin, created_at FROM roles ORDER BY name`
 	rows, err := r.db.QueryContext(ctx, query)
 	if err != nil {
 		return nil, err
@@ -188,7 +627,7 @@ func (r *UserRepository) GetRoles(ctx context.Context) ([]*entity.Role, error) {
 	var roles []*entity.Role
 	for rows.Next() {
 		role := &entity.Role{}
-		if err := rows.Scan(&role.ID, &role.Name, &role.Description, &role.CreatedAt); err != nil {
+		if err := rows.Scan(&role.ID, &role.Name, &role.Description, &role.MFARequired, &role.IsBuiltin, &role.CreatedAt); err != nil {
 			return nil, err
 		}
 		roles = append(roles, role)
@@ -196,18 +635,30 @@ func (r *UserRepository) GetRoles(ctx context.Context) ([]*entity.Role, error) {
 	return roles, nil
 }
 
+func (r *UserRepository) IsMFARequired(ctx context.Context, roleID uuid.UUID) (bool, error) {
+	var required bool
+	err := r.db.QueryRowContext(ctx, `SELECT mfa_required FROM roles WHERE id = $1`, roleID).Scan(&required)
+	return required, err
+}
+
+func (r *UserRepository) SetRoleMFARequired(ctx context.Context, roleID uuid.UUID, required bool) error {
+	return execOne(r.db.ExecContext(ctx, `UPDATE roles SET mfa_required = $2 WHERE id = $1`, roleID, required))
+}
+
 func (r *UserRepository) CheckPermission(ctx context.Context, roleID uuid.UUID, permission string) (bool, error) {
-	query := `
-		SELECT COUNT(*) FROM role_permissions rp
-		JOIN permissions p ON rp.permission_id = p.id
-		WHERE rp.role_id = $1 AND p.name = $2
-	`
-	var count int
-	err := r.db.QueryRowContext(ctx, query, roleID, permission).Scan(&count)
+	role, err := r.permissions.Role(ctx, roleID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
 	if err != nil {
 		return false, err
 	}
-	return count > 0, nil
+	for _, granted := range role.Permissions {
+		if granted == permission {
+			return true, nil
+		}
+	}
+	return false, nil
 }
 
 func (r *UserRepository) GetStudentByUserID(ctx context.Context, userID uuid.UUID) (*entity.Student, error) {
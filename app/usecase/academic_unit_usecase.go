@@ -0,0 +1,225 @@
+package usecase
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/Aryma-f4/uas-backend/app/entity"
+	"github.com/Aryma-f4/uas-backend/app/repository"
+	"github.com/google/uuid"
+)
+
+type AcademicUnitUsecase struct {
+	unitRepo *repository.AcademicUnitRepository
+}
+
+func NewAcademicUnitUsecase(unitRepo *repository.AcademicUnitRepository) *AcademicUnitUsecase {
+	return &AcademicUnitUsecase{unitRepo: unitRepo}
+}
+
+// Faculties
+
+func (u *AcademicUnitUsecase) CreateFaculty(ctx context.Context, req *entity.FacultyRequest) (*entity.Faculty, error) {
+	faculty := &entity.Faculty{ID: uuid.New()}
+	if err := applyFacultyRequest(faculty, req); err != nil {
+		return nil, err
+	}
+	if err := u.unitRepo.CreateFaculty(ctx, faculty); err != nil {
+		return nil, unitWriteError(err)
+	}
+	return faculty, nil
+}
+
+func (u *AcademicUnitUsecase) UpdateFaculty(ctx context.Context, id uuid.UUID, req *entity.FacultyRequest) (*entity.Faculty, error) {
+	faculty, err := u.unitRepo.GetFaculty(ctx, id)
+	if err != nil {
+		return nil, errors.New("faculty not found")
+	}
+	if err := applyFacultyRequest(faculty, req); err != nil {
+		return nil, err
+	}
+	if err := u.unitRepo.UpdateFaculty(ctx, faculty); err != nil {
+		return nil, unitWriteError(err)
+	}
+	return faculty, nil
+}
+
+func (u *AcademicUnitUsecase) DeleteFaculty(ctx context.Context, id uuid.UUID) error {
+	return unitWriteError(u.unitRepo.DeleteFaculty(ctx, id))
+}
+
+func (u *AcademicUnitUsecase) GetFaculty(ctx context.Context, id uuid.UUID) (*entity.Faculty, error) {
+	return u.unitRepo.GetFaculty(ctx, id)
+}
+
+func (u *AcademicUnitUsecase) ListFaculties(ctx context.Context) ([]*entity.Faculty, error) {
+	return u.unitRepo.ListFaculties(ctx)
+}
+
+// Departments
+
+func (u *AcademicUnitUsecase) CreateDepartment(ctx context.Context, req *entity.DepartmentRequest) (*entity.Department, error) {
+	department := &entity.Department{ID: uuid.New()}
+	if err := u.applyDepartmentRequest(ctx, department, req); err != nil {
+		return nil, err
+	}
+	if err := u.unitRepo.CreateDepartment(ctx, department); err != nil {
+		return nil, unitWriteError(err)
+	}
+	return department, nil
+}
+
+func (u *AcademicUnitUsecase) UpdateDepartment(ctx context.Context, id uuid.UUID, req *entity.DepartmentRequest) (*entity.Department, error) {
+	department, err := u.unitRepo.GetDepartment(ctx, id)
+	if err != nil {
+		return nil, errors.New("department not found")
+	}
+	if err := u.applyDepartmentRequest(ctx, department, req); err != nil {
+		return nil, err
+	}
+	if err := u.unitRepo.UpdateDepartment(ctx, department); err != nil {
+		return nil, unitWriteError(err)
+	}
+	return department, nil
+}
+
+func (u *AcademicUnitUsecase) DeleteDepartment(ctx context.Context, id uuid.UUID) error {
+	return unitWriteError(u.unitRepo.DeleteDepartment(ctx, id))
+}
+
+func (u *AcademicUnitUsecase) GetDepartment(ctx context.Context, id uuid.UUID) (*entity.Department, error) {
+	return u.unitRepo.GetDepartment(ctx, id)
+}
+
+func (u *AcademicUnitUsecase) ListDepartments(ctx context.Context, facultyID *uuid.UUID) ([]*entity.Department, error) {
+	return u.unitRepo.ListDepartments(ctx, facultyID)
+}
+
+// Study programs
+
+func (u *AcademicUnitUsecase) CreateStudyProgram(ctx context.Context, req *entity.StudyProgramRequest) (*entity.StudyProgram, error) {
+	program := &entity.StudyProgram{ID: uuid.New()}
+	if err := u.applyStudyProgramRequest(ctx, program, req); err != nil {
+		return nil, err
+	}
+	if err := u.unitRepo.CreateStudyProgram(ctx, program); err != nil {
+		return nil, unitWriteError(err)
+	}
+	return program, nil
+}
+
+func (u *AcademicUnitUsecase) UpdateStudyProgram(ctx context.Context, id uuid.UUID, req *entity.StudyProgramRequest) (*entity.StudyProgram, error) {
+	program, err := u.unitRepo.GetStudyProgram(ctx, id)
+	if err != nil {
+		return nil, errors.New("study program not found")
+	}
+	if err := u.applyStudyProgramRequest(ctx, program, req); err != nil {
+		return nil, err
+	}
+	if err := u.unitRepo.UpdateStudyProgram(ctx, program); err != nil {
+		return nil, unitWriteError(err)
+	}
+	return program, nil
+}
+
+func (u *AcademicUnitUsecase) DeleteStudyProgram(ctx context.Context, id uuid.UUID) error {
+	return unitWriteError(u.unitRepo.DeleteStudyProgram(ctx, id))
+}
+
+func (u *AcademicUnitUsecase) GetStudyProgram(ctx context.Context, id uuid.UUID) (*entity.StudyProgram, error) {
+	return u.unitRepo.GetStudyProgram(ctx, id)
+}
+
+func (u *AcademicUnitUsecase) ListStudyPrograms(ctx context.Context, filter *entity.AcademicUnitFilter) ([]*entity.StudyProgram, error) {
+	return u.unitRepo.ListStudyPrograms(ctx, filter)
+}
+
+// LinkUnmatched resolves free-text programs and departments that are not yet
+// linked to a unit, e.g. after adding aliases.
+func (u *AcademicUnitUsecase) LinkUnmatched(ctx context.Context) (*entity.AcademicUnitLinkResult, error) {
+	return u.unitRepo.LinkUnmatched(ctx)
+}
+
+func (u *AcademicUnitUsecase) ListUnlinkedNames(ctx context.Context) ([]*entity.UnlinkedUnitName, error) {
+	return u.unitRepo.ListUnlinkedNames(ctx)
+}
+
+func applyFacultyRequest(faculty *entity.Faculty, req *entity.FacultyRequest) error {
+	faculty.Code = strings.TrimSpace(req.Code)
+	faculty.Name = cleanUnitName(req.Name)
+	if faculty.Code == "" || faculty.Name == "" {
+		return errors.New("code and name are required")
+	}
+	return nil
+}
+
+func (u *AcademicUnitUsecase) applyDepartmentRequest(ctx context.Context, department *entity.Department, req *entity.DepartmentRequest) error {
+	department.Code = strings.TrimSpace(req.Code)
+	department.Name = cleanUnitName(req.Name)
+	if department.Code == "" || department.Name == "" {
+		return errors.New("code and name are required")
+	}
+	faculty, err := u.unitRepo.GetFaculty(ctx, req.FacultyID)
+	if err != nil {
+		return errors.New("faculty not found")
+	}
+	department.FacultyID = faculty.ID
+	department.FacultyName = faculty.Name
+	department.Aliases = normalizeAliases(req.Aliases)
+	return nil
+}
+
+func (u *AcademicUnitUsecase) applyStudyProgramRequest(ctx context.Context, program *entity.StudyProgram, req *entity.StudyProgramRequest) error {
+	program.Code = strings.TrimSpace(req.Code)
+	program.Name = cleanUnitName(req.Name)
+	if program.Code == "" || program.Name == "" {
+		return errors.New("code and name are required")
+	}
+	department, err := u.unitRepo.GetDepartment(ctx, req.DepartmentID)
+	if err != nil {
+		return errors.New("department not found")
+	}
+	program.DepartmentID = department.ID
+	program.DepartmentName = department.Name
+	program.FacultyID = department.FacultyID
+	program.Degree = strings.TrimSpace(req.Degree)
+	program.Aliases = normalizeAliases(req.Aliases)
+	return nil
+}
+
+// cleanUnitName trims a unit name and collapses inner whitespace.
+func cleanUnitName(name string) string {
+	return strings.Join(strings.Fields(name), " ")
+}
+
+// normalizeAliases stores aliases in the normalized form LinkUnmatched
+// compares against, without duplicates.
+func normalizeAliases(aliases []string) []string {
+	normalized := []string{}
+	seen := make(map[string]bool)
+	for _, alias := range aliases {
+		alias = normalizeUnitName(alias)
+		if alias == "" || seen[alias] {
+			continue
+		}
+		seen[alias] = true
+		normalized = append(normalized, alias)
+	}
+	return normalized
+}
+
+func unitWriteError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, sql.ErrNoRows):
+		return errors.New("academic unit not found")
+	case strings.Contains(err.Error(), "duplicate key"):
+		return errors.New("code already exists")
+	case strings.Contains(err.Error(), "foreign key"):
+		return errors.New("academic unit is still referenced by other units, students or lecturers")
+	}
+	return err
+}
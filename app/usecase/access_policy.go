@@ -0,0 +1,191 @@
+package usecase
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/Aryma-f4/uas-backend/app/entity"
+	"github.com/Aryma-f4/uas-backend/app/repository"
+	"github.com/google/uuid"
+)
+
+// Resources a caller may not access are reported as missing, so their
+// existence is not revealed.
+var (
+	ErrStudentNotFound     = errors.New("student not found")
+	ErrAchievementNotFound = errors.New("achievement not found")
+	ErrLecturerNotFound    = errors.New("lecturer not found")
+)
+
+// AccessPolicy decides access to students and everything that belongs to
+// them (achievements, reports) by the caller's relationship to the student:
+// the student themselves, their current advisor, a lecturer of their
+// department holding department:read, or a user holding student:manage or a
+// service account, who may access every student.
+type AccessPolicy struct {
+	studentRepo  *repository.StudentRepository
+	lecturerRepo *repository.LecturerRepository
+	unitRepo     *repository.AcademicUnitRepository
+}
+
+func NewAccessPolicy(
+	studentRepo *repository.StudentRepository,
+	lecturerRepo *repository.LecturerRepository,
+	unitRepo *repository.AcademicUnitRepository,
+) *AccessPolicy {
+	return &AccessPolicy{
+		studentRepo:  studentRepo,
+		lecturerRepo: lecturerRepo,
+		unitRepo:     unitRepo,
+	}
+}
+
+// Scope returns the IDs of the students the subject may access. A nil slice
+// means every student; an empty slice means none.
+func (p *AccessPolicy) Scope(ctx context.Context, subject *entity.Subject) ([]uuid.UUID, error) {
+	if seesAllStudents(subject) {
+		return nil, nil
+	}
+
+	ids := []uuid.UUID{}
+	seen := make(map[uuid.UUID]bool)
+	add := func(studentIDs ...uuid.UUID) {
+		for _, id := range studentIDs {
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+
+	student, err := p.studentRepo.GetByUserID(ctx, subject.UserID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	if student != nil {
+		add(student.ID)
+	}
+
+	lecturer, err := p.lecturerRepo.GetByUserID(ctx, subject.UserID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ids, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	advisees, err := p.studentRepo.ListIDsByAdvisorID(ctx, lecturer.ID)
+	if err != nil {
+		return nil, err
+	}
+	add(advisees...)
+
+	if lecturer.DepartmentID != nil && subject.HasPermission(entity.PermissionDepartmentRead) {
+		department, err := p.studentRepo.ListIDsByDepartmentID(ctx, *lecturer.DepartmentID)
+		if err != nil {
+			return nil, err
+		}
+		add(department...)
+	}
+
+	return ids, nil
+}
+
+// CanAccessStudent reports whether the subject may access the student. It
+// is false for unknown students.
+func (p *AccessPolicy) CanAccessStudent(ctx context.Context, subject *entity.Subject, studentID uuid.UUID) (bool, error) {
+	if seesAllStudents(subject) {
+		return true, nil
+	}
+
+	student, err := p.studentRepo.GetByID(ctx, studentID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if student.UserID == subject.UserID {
+		return true, nil
+	}
+
+	lecturer, err := p.lecturerRepo.GetByUserID(ctx, subject.UserID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if student.AdvisorID != nil && *student.AdvisorID == lecturer.ID {
+		return true, nil
+	}
+
+	if lecturer.DepartmentID == nil || student.StudyProgramID == nil || !subject.HasPermission(entity.PermissionDepartmentRead) {
+		return false, nil
+	}
+	program, err := p.unitRepo.GetStudyProgram(ctx, *student.StudyProgramID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return program.DepartmentID == *lecturer.DepartmentID, nil
+}
+
+// AuthorizeStudent returns ErrStudentNotFound unless the subject may access
+// the student.
+func (p *AccessPolicy) AuthorizeStudent(ctx context.Context, subject *entity.Subject, studentID uuid.UUID) error {
+	allowed, err := p.CanAccessStudent(ctx, subject, studentID)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return ErrStudentNotFound
+	}
+	return nil
+}
+
+// AuthorizeAdvisees returns ErrLecturerNotFound unless the subject may see
+// the advisees of the lecturer as a group: their own, those of a lecturer of
+// their department with department:read, or any with access to every
+// student.
+func (p *AccessPolicy) AuthorizeAdvisees(ctx context.Context, subject *entity.Subject, lecturerID uuid.UUID) error {
+	if seesAllStudents(subject) {
+		return nil
+	}
+
+	own, err := p.lecturerRepo.GetByUserID(ctx, subject.UserID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrLecturerNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if own.ID == lecturerID {
+		return nil
+	}
+	if own.DepartmentID == nil || !subject.HasPermission(entity.PermissionDepartmentRead) {
+		return ErrLecturerNotFound
+	}
+
+	lecturer, err := p.lecturerRepo.GetByID(ctx, lecturerID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrLecturerNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if lecturer.DepartmentID == nil || *lecturer.DepartmentID != *own.DepartmentID {
+		return ErrLecturerNotFound
+	}
+	return nil
+}
+
+// seesAllStudents reports whether the subject may access every student.
+// Service accounts have no relationship to students and read everything
+// their permissions allow.
+func seesAllStudents(subject *entity.Subject) bool {
+	return subject.RoleName == entity.RoleServiceAccount || subject.HasPermission(entity.PermissionStudentManage)
+}
@@ -0,0 +1,274 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Aryma-f4/uas-backend/app/entity"
+	"github.com/Aryma-f4/uas-backend/app/repository"
+	"github.com/Aryma-f4/uas-backend/utils"
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// accreditationLevels maps normalized details.competitionLevel values to
+// accreditation levels.
+var accreditationLevels = map[string]string{
+	"local":         entity.AccreditationLevelLocal,
+	"lokal":         entity.AccreditationLevelLocal,
+	"campus":        entity.AccreditationLevelLocal,
+	"regional":      entity.AccreditationLevelRegional,
+	"wilayah":       entity.AccreditationLevelRegional,
+	"provincial":    entity.AccreditationLevelRegional,
+	"provinsi":      entity.AccreditationLevelRegional,
+	"national":      entity.AccreditationLevelNational,
+	"nasional":      entity.AccreditationLevelNational,
+	"international": entity.AccreditationLevelInternational,
+	"internasional": entity.AccreditationLevelInternational,
+}
+
+type AccreditationUsecase struct {
+	achievementRepo *repository.AchievementRepository
+	studentRepo     *repository.StudentRepository
+	unitRepo        *repository.AcademicUnitRepository
+}
+
+func NewAccreditationUsecase(
+	achievementRepo *repository.AchievementRepository,
+	studentRepo *repository.StudentRepository,
+	unitRepo *repository.AcademicUnitRepository,
+) *AccreditationUsecase {
+	return &AccreditationUsecase{
+		achievementRepo: achievementRepo,
+		studentRepo:     studentRepo,
+		unitRepo:        unitRepo,
+	}
+}
+
+// GetReport builds the accreditation table of a study program: verified
+// achievements of the given number of years ending with endYear, counted
+// per year, category and level, plus the full list.
+func (u *AccreditationUsecase) GetReport(ctx context.Context, programID uuid.UUID, endYear, years int) (*entity.AccreditationReport, error) {
+	if years < 1 || years > entity.AccreditationMaxYears {
+		return nil, fmt.Errorf("years must be between 1 and %d", entity.AccreditationMaxYears)
+	}
+
+	program, err := u.unitRepo.GetStudyProgram(ctx, programID)
+	if err != nil {
+		return nil, errors.New("study program not found")
+	}
+
+	report := &entity.AccreditationReport{
+		StudyProgram: program,
+		Years:        make([]int, 0, years),
+		Summary:      []*entity.AccreditationYearSummary{},
+		Achievements: []*entity.AccreditationAchievement{},
+		GeneratedAt:  time.Now(),
+	}
+
+	summaries := make(map[string]*entity.AccreditationYearSummary)
+	for year := endYear - years + 1; year <= endYear; year++ {
+		report.Years = append(report.Years, year)
+		for _, category := range []string{entity.AccreditationAcademic, entity.AccreditationNonAcademic} {
+			summary := &entity.AccreditationYearSummary{Year: year, Category: category}
+			summaries[fmt.Sprintf("%d/%s", year, category)] = summary
+			report.Summary = append(report.Summary, summary)
+		}
+	}
+
+	refs, err := u.achievementRepo.ListVerifiedByStudyProgram(ctx, programID)
+	if err != nil {
+		return nil, err
+	}
+	if len(refs) == 0 {
+		return report, nil
+	}
+
+	students := make(map[uuid.UUID]*entity.Student)
+	var studentIDs []uuid.UUID
+	for _, ref := range refs {
+		if _, ok := students[ref.StudentID]; !ok {
+			students[ref.StudentID] = nil
+			studentIDs = append(studentIDs, ref.StudentID)
+		}
+	}
+	found, err := u.studentRepo.GetByIDs(ctx, studentIDs)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range found {
+		students[s.ID] = s
+	}
+
+	const batchSize = 500
+	for start := 0; start < len(refs); start += batchSize {
+		batch := refs[start:min(start+batchSize, len(refs))]
+
+		mongoIDs := make([]primitive.ObjectID, 0, len(batch))
+		for _, ref := range batch {
+			if id, err := primitive.ObjectIDFromHex(ref.MongoAchievementID); err == nil {
+				mongoIDs = append(mongoIDs, id)
+			}
+		}
+		docs, err := u.achievementRepo.ListMongoByIDs(ctx, mongoIDs, "")
+		if err != nil {
+			return nil, err
+		}
+		byID := make(map[string]*entity.Achievement, len(docs))
+		for _, doc := range docs {
+			byID[doc.ID.Hex()] = doc
+		}
+
+		for _, ref := range batch {
+			doc, ok := byID[ref.MongoAchievementID]
+			if !ok {
+				continue
+			}
+
+			item := accreditationItem(ref, doc, students[ref.StudentID])
+			summary, ok := summaries[fmt.Sprintf("%d/%s", item.Year, item.Category)]
+			if !ok {
+				continue
+			}
+			countAccreditationLevel(summary, item.Level)
+			report.Achievements = append(report.Achievements, item)
+		}
+	}
+
+	sort.SliceStable(report.Achievements, func(i, j int) bool {
+		a, b := report.Achievements[i], report.Achievements[j]
+		if a.Year != b.Year {
+			return a.Year < b.Year
+		}
+		if a.Category != b.Category {
+			return a.Category == entity.AccreditationAcademic
+		}
+		return a.Title < b.Title
+	})
+
+	return report, nil
+}
+
+// WriteReport writes the report as spreadsheet rows: a heading, the summary
+// table and the achievement list, separated by blank rows.
+func (u *AccreditationUsecase) WriteReport(report *entity.AccreditationReport, write func([]string) error) error {
+	first, last := report.Years[0], report.Years[len(report.Years)-1]
+	rows := [][]string{
+		{"Study Program", report.StudyProgram.Code, report.StudyProgram.Name},
+		{"Years", fmt.Sprintf("%d-%d", first, last)},
+		{"Generated At", report.GeneratedAt.Format(time.RFC3339)},
+		{},
+		{"Year", "Category", "Local", "Regional", "National", "International", "Unspecified", "Total"},
+	}
+	for _, s := range report.Summary {
+		rows = append(rows, []string{
+			strconv.Itoa(s.Year), s.Category,
+			strconv.Itoa(s.Local), strconv.Itoa(s.Regional), strconv.Itoa(s.National),
+			strconv.Itoa(s.International), strconv.Itoa(s.Unspecified), strconv.Itoa(s.Total),
+		})
+	}
+	rows = append(rows, []string{},
+		[]string{"No", "Year", "Category", "Level", "Type", "Title", "Result", "Organizer", "NIM", "Student Name", "Verified At"})
+	for i, a := range report.Achievements {
+		rows = append(rows, []string{
+			strconv.Itoa(i + 1), strconv.Itoa(a.Year), a.Category, a.Level, string(a.AchievementType),
+			a.Title, a.Result, a.Organizer, a.NIM, a.StudentName, formatExportTime(a.VerifiedAt),
+		})
+	}
+
+	for _, row := range rows {
+		if err := write(utils.EscapeSpreadsheetRow(row)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func accreditationItem(ref *entity.AchievementReference, doc *entity.Achievement, student *entity.Student) *entity.AccreditationAchievement {
+	fallback := doc.CreatedAt
+	if ref.VerifiedAt != nil {
+		fallback = *ref.VerifiedAt
+	}
+	year, _ := strconv.Atoi(eventMonth(doc, fallback)[:4])
+
+	item := &entity.AccreditationAchievement{
+		ID:              ref.MongoAchievementID,
+		Year:            year,
+		Category:        accreditationCategory(doc),
+		Level:           entity.AccreditationLevelUnspecified,
+		AchievementType: doc.AchievementType,
+		Title:           doc.Title,
+		Result:          accreditationResult(doc.Details),
+		Organizer:       detailString(doc.Details, "organizer"),
+		StudentID:       ref.StudentID,
+		VerifiedAt:      ref.VerifiedAt,
+	}
+	if level, ok := accreditationLevels[normalizeUnitName(detailString(doc.Details, "competitionLevel"))]; ok {
+		item.Level = level
+	}
+	if student != nil {
+		item.NIM = student.StudentID
+		item.StudentName = student.FullName
+	}
+	return item
+}
+
+func accreditationCategory(doc *entity.Achievement) string {
+	switch strings.ReplaceAll(normalizeUnitName(detailString(doc.Details, "category")), "-", "_") {
+	case entity.AccreditationAcademic:
+		return entity.AccreditationAcademic
+	case entity.AccreditationNonAcademic, "non academic":
+		return entity.AccreditationNonAcademic
+	}
+
+	switch doc.AchievementType {
+	case entity.TypeAcademic, entity.TypeCompetition, entity.TypePublication, entity.TypeCertification:
+		return entity.AccreditationAcademic
+	}
+	return entity.AccreditationNonAcademic
+}
+
+// accreditationResult prefers the medal over the rank.
+func accreditationResult(details map[string]interface{}) string {
+	if medal := detailString(details, "medalType"); medal != "" {
+		return medal
+	}
+	if rank := detailString(details, "rank"); rank != "" {
+		return "Rank " + rank
+	}
+	return ""
+}
+
+func countAccreditationLevel(summary *entity.AccreditationYearSummary, level string) {
+	switch level {
+	case entity.AccreditationLevelLocal:
+		summary.Local++
+	case entity.AccreditationLevelRegional:
+		summary.Regional++
+	case entity.AccreditationLevelNational:
+		summary.National++
+	case entity.AccreditationLevelInternational:
+		summary.International++
+	default:
+		summary.Unspecified++
+	}
+	summary.Total++
+}
+
+// detailString formats a details value that may be stored as a string or a
+// number.
+func detailString(details map[string]interface{}, key string) string {
+	switch v := details[key].(type) {
+	case nil:
+		return ""
+	case string:
+		return strings.TrimSpace(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,322 @@
+package usecase
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/Aryma-f4/uas-backend/app/entity"
+	"github.com/Aryma-f4/uas-backend/app/repository"
+	"github.com/Aryma-f4/uas-backend/utils"
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Columns prefixed with "details." are copied into Achievement.Details,
+// e.g. "details.competitionLevel" or "details.rank".
+const importDetailsPrefix = "details."
+
+type AchievementImportUsecase struct {
+	achievementRepo   *repository.AchievementRepository
+	studentRepo       *repository.StudentRepository
+	statisticsUsecase *StatisticsUsecase
+}
+
+func NewAchievementImportUsecase(achievementRepo *repository.AchievementRepository, studentRepo *repository.StudentRepository, statisticsUsecase *StatisticsUsecase) *AchievementImportUsecase {
+	return &AchievementImportUsecase{
+		achievementRepo:   achievementRepo,
+		studentRepo:       studentRepo,
+		statisticsUsecase: statisticsUsecase,
+	}
+}
+
+// Import validates every row of the spreadsheet and, unless dryRun is set,
+// creates the achievements in the given initial status under a new batch.
+// Nothing is written when any row fails validation.
+func (u *AchievementImportUsecase) Import(ctx context.Context, adminID uuid.UUID, fileName string, records [][]string, initialStatus entity.AchievementStatus, dryRun bool) (*entity.AchievementImportResult, error) {
+	switch initialStatus {
+	case entity.StatusDraft, entity.StatusSubmitted, entity.StatusVerified:
+	default:
+		return nil, errors.New("initial status must be draft, submitted or verified")
+	}
+
+	if len(records) < 2 {
+		return nil, errors.New("file has no data rows")
+	}
+
+	rows, rowErrors, err := u.parseRows(ctx, records)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &entity.AchievementImportResult{
+		DryRun:    dryRun,
+		TotalRows: len(records) - 1,
+		ValidRows: len(rows),
+		Errors:    rowErrors,
+	}
+
+	if dryRun || len(rowErrors) > 0 {
+		return result, nil
+	}
+
+	batch := &entity.AchievementImportBatch{
+		ID:            uuid.New(),
+		FileName:      fileName,
+		InitialStatus: initialStatus,
+		TotalRows:     result.TotalRows,
+		CreatedBy:     adminID,
+	}
+	if err := u.achievementRepo.CreateImportBatch(ctx, batch); err != nil {
+		return nil, err
+	}
+	result.BatchID = &batch.ID
+
+	imported := make(map[uuid.UUID]bool)
+	for _, row := range rows {
+		if err := u.createRow(ctx, adminID, batch, row); err != nil {
+			result.Errors = append(result.Errors, entity.ImportRowError{Row: row.Row, Message: err.Error()})
+			continue
+		}
+		result.ImportedRows++
+		imported[row.StudentID] = true
+	}
+
+	studentIDs := make([]uuid.UUID, 0, len(imported))
+	for id := range imported {
+		studentIDs = append(studentIDs, id)
+	}
+	u.statisticsUsecase.OnStatusChange(ctx, studentIDs...)
+
+	if err := u.achievementRepo.UpdateImportBatchCount(ctx, batch.ID, result.ImportedRows); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// Rollback removes every achievement created by the batch, whatever status
+// it has reached since the import. The references go first, together with
+// marking the batch, so a failure never leaves references to deleted
+// documents; rolling back again removes documents an interrupted rollback
+// left behind.
+func (u *AchievementImportUsecase) Rollback(ctx context.Context, batchID uuid.UUID) error {
+	batch, err := u.achievementRepo.GetImportBatch(ctx, batchID)
+	if err != nil {
+		return errors.New("import batch not found")
+	}
+
+	if batch.RolledBackAt != nil {
+		deleted, err := u.achievementRepo.DeleteMongoByImportBatch(ctx, batchID)
+		if err != nil {
+			return err
+		}
+		if deleted == 0 {
+			return errors.New("import batch already rolled back")
+		}
+		return nil
+	}
+
+	studentIDs, err := u.achievementRepo.RollbackImportBatch(ctx, batchID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return errors.New("import batch already rolled back")
+	}
+	if err != nil {
+		return err
+	}
+	u.statisticsUsecase.OnStatusChange(ctx, studentIDs...)
+
+	if _, err := u.achievementRepo.DeleteMongoByImportBatch(ctx, batchID); err != nil {
+		return fmt.Errorf("import batch rolled back, but removing its documents failed, roll back again to retry: %w", err)
+	}
+	return nil
+}
+
+func (u *AchievementImportUsecase) GetBatch(ctx context.Context, batchID uuid.UUID) (*entity.AchievementImportBatch, error) {
+	return u.achievementRepo.GetImportBatch(ctx, batchID)
+}
+
+func (u *AchievementImportUsecase) ListBatches(ctx context.Context, limit, offset int) ([]*entity.AchievementImportBatch, int, error) {
+	return u.achievementRepo.ListImportBatches(ctx, limit, offset)
+}
+
+func (u *AchievementImportUsecase) parseRows(ctx context.Context, records [][]string) ([]*entity.AchievementImportRow, []entity.ImportRowError, error) {
+	header := records[0]
+	index := utils.HeaderIndex(header)
+
+	if _, ok := index["nim"]; !ok {
+		return nil, nil, errors.New("missing required column: nim")
+	}
+	for _, column := range []string{"achievement_type", "title"} {
+		if _, ok := index[column]; !ok {
+			return nil, nil, fmt.Errorf("missing required column: %s", column)
+		}
+	}
+
+	students := make(map[string]uuid.UUID)
+	rows := []*entity.AchievementImportRow{}
+	rowErrors := []entity.ImportRowError{}
+
+	for i, record := range records[1:] {
+		// Row numbers match the spreadsheet, where the header is row 1
+		rowNumber := i + 2
+		if isBlankRecord(record) {
+			continue
+		}
+
+		row := &entity.AchievementImportRow{
+			Row: rowNumber,
+			NIM: utils.CellValue(record, index, "nim"),
+			Request: entity.CreateAchievementRequest{
+				AchievementType: entity.AchievementType(strings.ToLower(utils.CellValue(record, index, "achievement_type"))),
+				Title:           utils.CellValue(record, index, "title"),
+				Description:     utils.CellValue(record, index, "description"),
+				Details:         make(map[string]interface{}),
+				Tags:            splitTags(utils.CellValue(record, index, "tags")),
+			},
+		}
+
+		for j, name := range header {
+			key := strings.TrimSpace(name)
+			if !strings.HasPrefix(strings.ToLower(key), importDetailsPrefix) || j >= len(record) {
+				continue
+			}
+			if value := strings.TrimSpace(record[j]); value != "" {
+				row.Request.Details[key[len(importDetailsPrefix):]] = parseDetailValue(value)
+			}
+		}
+
+		valid := true
+		if row.NIM == "" {
+			rowErrors = append(rowErrors, entity.ImportRowError{Row: rowNumber, Field: "nim", Message: "NIM is required"})
+			valid = false
+		} else if studentID, ok := students[row.NIM]; ok {
+			row.StudentID = studentID
+		} else {
+			student, err := u.studentRepo.GetByStudentID(ctx, row.NIM)
+			if err != nil {
+				rowErrors = append(rowErrors, entity.ImportRowError{Row: rowNumber, Field: "nim", Message: "student with NIM " + row.NIM + " not found"})
+				valid = false
+			} else {
+				students[row.NIM] = student.ID
+				row.StudentID = student.ID
+			}
+		}
+		if !row.Request.AchievementType.IsValid() {
+			rowErrors = append(rowErrors, entity.ImportRowError{Row: rowNumber, Field: "achievement_type", Message: "invalid achievement type"})
+			valid = false
+		}
+		if row.Request.Title == "" {
+			rowErrors = append(rowErrors, entity.ImportRowError{Row: rowNumber, Field: "title", Message: "Title is required"})
+			valid = false
+		}
+
+		if valid {
+			rows = append(rows, row)
+		}
+	}
+
+	return rows, rowErrors, nil
+}
+
+// discardRow undoes a partly created row: its reference, if any, and then
+// its document. Failures are logged, the row is reported failed regardless.
+func (u *AchievementImportUsecase) discardRow(ctx context.Context, ref *entity.AchievementReference, mongoID primitive.ObjectID) {
+	if ref != nil {
+		if err := u.achievementRepo.DeleteReference(ctx, ref.MongoAchievementID); err != nil {
+			log.Printf("Failed to discard imported achievement reference %s: %v", ref.ID, err)
+			return
+		}
+	}
+	if err := u.achievementRepo.DeleteMongo(ctx, mongoID); err != nil {
+		log.Printf("Failed to discard imported achievement %s: %v", mongoID.Hex(), err)
+	}
+}
+
+func (u *AchievementImportUsecase) createRow(ctx context.Context, adminID uuid.UUID, batch *entity.AchievementImportBatch, row *entity.AchievementImportRow) error {
+	achievement := &entity.Achievement{
+		StudentID:       row.StudentID,
+		AchievementType: row.Request.AchievementType,
+		Title:           row.Request.Title,
+		Description:     row.Request.Description,
+		Details:         row.Request.Details,
+		Tags:            row.Request.Tags,
+		Points:          calculatePoints(row.Request.AchievementType, row.Request.Details),
+		Attachments:     []entity.Attachment{},
+		ImportBatchID:   batch.ID.String(),
+	}
+
+	mongoID, err := u.achievementRepo.CreateMongo(ctx, achievement)
+	if err != nil {
+		return err
+	}
+
+	ref := &entity.AchievementReference{
+		ID:                 uuid.New(),
+		StudentID:          row.StudentID,
+		MongoAchievementID: mongoID.Hex(),
+		Status:             entity.StatusDraft,
+		ImportBatchID:      &batch.ID,
+	}
+	if err := u.achievementRepo.CreateReference(ctx, ref); err != nil {
+		u.discardRow(ctx, nil, mongoID)
+		return err
+	}
+
+	if batch.InitialStatus != entity.StatusDraft {
+		var verifiedBy *uuid.UUID
+		if batch.InitialStatus == entity.StatusVerified {
+			verifiedBy = &adminID
+		}
+		if err := u.achievementRepo.UpdateReferenceStatus(ctx, ref.MongoAchievementID, batch.InitialStatus, verifiedBy, ""); err != nil {
+			u.discardRow(ctx, ref, mongoID)
+			return err
+		}
+	}
+
+	history := &entity.AchievementStatusHistory{
+		ID:               uuid.New(),
+		AchievementRefID: ref.ID,
+		NewStatus:        batch.InitialStatus,
+		ChangedBy:        adminID,
+		Note:             "Imported in batch " + batch.ID.String(),
+	}
+	if err := u.achievementRepo.AddStatusHistory(ctx, history); err != nil {
+		u.discardRow(ctx, ref, mongoID)
+		return err
+	}
+
+	return nil
+}
+
+func isBlankRecord(record []string) bool {
+	for _, value := range record {
+		if strings.TrimSpace(value) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+func splitTags(value string) []string {
+	tags := []string{}
+	for _, tag := range strings.FieldsFunc(value, func(r rune) bool { return r == ';' || r == ',' }) {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// parseDetailValue keeps numbers numeric so that calculatePoints sees
+// details such as rank the same way it does for JSON requests.
+func parseDetailValue(value string) interface{} {
+	if n, err := strconv.ParseFloat(value, 64); err == nil {
+		return n
+	}
+	return value
+}
@@ -2,34 +2,48 @@ package usecase
 
 import (
 	"context"
+	"database/sql"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/Aryma-f4/uas-backend/app/entity"
 	"github.com/Aryma-f4/uas-backend/app/repository"
+	"github.com/Aryma-f4/uas-backend/utils"
 	"github.com/google/uuid"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type AchievementUsecase struct {
-	achievementRepo *repository.AchievementRepository
-	studentRepo     *repository.StudentRepository
-	userRepo        *repository.UserRepository
+	achievementRepo   *repository.AchievementRepository
+	studentRepo       *repository.StudentRepository
+	userRepo          *repository.UserRepository
+	statisticsUsecase *StatisticsUsecase
+	policy            *AccessPolicy
 }
 
 func NewAchievementUsecase(
 	achievementRepo *repository.AchievementRepository,
 	studentRepo *repository.StudentRepository,
 	userRepo *repository.UserRepository,
+	statisticsUsecase *StatisticsUsecase,
+	policy *AccessPolicy,
 ) *AchievementUsecase {
 	return &AchievementUsecase{
-		achievementRepo: achievementRepo,
-		studentRepo:     studentRepo,
-		userRepo:        userRepo,
+		achievementRepo:   achievementRepo,
+		studentRepo:       studentRepo,
+		userRepo:          userRepo,
+		statisticsUsecase: statisticsUsecase,
+		policy:            policy,
 	}
 }
 
-func (u *AchievementUsecase) Create(ctx context.Context, userID uuid.UUID, req *entity.CreateAchievementRequest) (*entity.AchievementResponse, error) {
-	
+func (u *AchievementUsecase) Create(ctx context.Context, subject *entity.Subject, req *entity.CreateAchievementRequest) (*entity.AchievementResponse, error) {
+	userID := subject.UserID
+
 	student, err := u.studentRepo.GetByUserID(ctx, userID)
 	if err != nil {
 		return nil, errors.New("student profile not found")
@@ -75,9 +89,11 @@ func (u *AchievementUsecase) Create(ctx context.Context, userID uuid.UUID, req *
 		AchievementRefID: ref.ID,
 		NewStatus:        entity.StatusDraft,
 		ChangedBy:        userID,
+		ImpersonatedBy:   subject.Impersonator(),
 		Note:             "Achievement created",
 	}
 	u.achievementRepo.AddStatusHistory(ctx, history)
+	u.statisticsUsecase.OnStatusChange(ctx, student.ID)
 
 	return &entity.AchievementResponse{
 		ID:              mongoID.Hex(),
@@ -95,7 +111,37 @@ func (u *AchievementUsecase) Create(ctx context.Context, userID uuid.UUID, req *
 	}, nil
 }
 
-func (u *AchievementUsecase) GetByID(ctx context.Context, id string) (*entity.AchievementResponse, error) {
+// GetByID returns an achievement the subject may access, or
+// ErrAchievementNotFound.
+func (u *AchievementUsecase) GetByID(ctx context.Context, subject *entity.Subject, id string) (*entity.AchievementResponse, error) {
+	if _, err := u.visibleReference(ctx, subject, id); err != nil {
+		return nil, err
+	}
+	return u.getByID(ctx, id)
+}
+
+// visibleReference returns the reference of an achievement the subject may
+// access, or ErrAchievementNotFound.
+func (u *AchievementUsecase) visibleReference(ctx context.Context, subject *entity.Subject, id string) (*entity.AchievementReference, error) {
+	ref, err := u.achievementRepo.GetReferenceByMongoID(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrAchievementNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	allowed, err := u.policy.CanAccessStudent(ctx, subject, ref.StudentID)
+	if err != nil {
+		return nil, err
+	}
+	if !allowed {
+		return nil, ErrAchievementNotFound
+	}
+	return ref, nil
+}
+
+func (u *AchievementUsecase) getByID(ctx context.Context, id string) (*entity.AchievementResponse, error) {
 	mongoID, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
 		return nil, errors.New("invalid achievement ID")
@@ -139,23 +185,19 @@ func (u *AchievementUsecase) GetByID(ctx context.Context, id string) (*entity.Ac
 	}, nil
 }
 
-func (u *AchievementUsecase) Update(ctx context.Context, id string, userID uuid.UUID, req *entity.UpdateAchievementRequest) (*entity.AchievementResponse, error) {
+func (u *AchievementUsecase) Update(ctx context.Context, id string, subject *entity.Subject, req *entity.UpdateAchievementRequest) (*entity.AchievementResponse, error) {
 	mongoID, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
 		return nil, errors.New("invalid achievement ID")
 	}
 
 	
-	ref, err := u.achievementRepo.GetReferenceByMongoID(ctx, id)
+	ref, err := u.visibleReference(ctx, subject, id)
 	if err != nil {
 		return nil, err
 	}
 
-	if ref.Status != entity.StatusDraft && ref.Status != entity.StatusRejected {
-		return nil, errors.New("can only update draft or rejected achievements")
-	}
-
-	student, err := u.studentRepo.GetByUserID(ctx, userID)
+	student, err := u.studentRepo.GetByUserID(ctx, subject.UserID)
 	if err != nil {
 		return nil, errors.New("student profile not found")
 	}
@@ -164,6 +206,10 @@ func (u *AchievementUsecase) Update(ctx context.Context, id string, userID uuid.
 		return nil, errors.New("not authorized to update this achievement")
 	}
 
+	if ref.Status != entity.StatusDraft && ref.Status != entity.StatusRejected {
+		return nil, errors.New("can only update draft or rejected achievements")
+	}
+
 	
 	achievement, err := u.achievementRepo.GetMongoByID(ctx, mongoID)
 	if err != nil {
@@ -195,26 +241,23 @@ func (u *AchievementUsecase) Update(ctx context.Context, id string, userID uuid.
 	if ref.Status == entity.StatusRejected {
 		u.achievementRepo.UpdateReferenceStatus(ctx, id, entity.StatusDraft, nil, "")
 	}
+	u.statisticsUsecase.OnStatusChange(ctx, ref.StudentID)
 
-	return u.GetByID(ctx, id)
+	return u.getByID(ctx, id)
 }
 
-func (u *AchievementUsecase) Delete(ctx context.Context, id string, userID uuid.UUID) error {
+func (u *AchievementUsecase) Delete(ctx context.Context, id string, subject *entity.Subject) error {
 	mongoID, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
 		return errors.New("invalid achievement ID")
 	}
 
-	ref, err := u.achievementRepo.GetReferenceByMongoID(ctx, id)
+	ref, err := u.visibleReference(ctx, subject, id)
 	if err != nil {
 		return err
 	}
 
-	if ref.Status != entity.StatusDraft {
-		return errors.New("can only delete draft achievements")
-	}
-
-	student, err := u.studentRepo.GetByUserID(ctx, userID)
+	student, err := u.studentRepo.GetByUserID(ctx, subject.UserID)
 	if err != nil {
 		return errors.New("student profile not found")
 	}
@@ -223,25 +266,31 @@ func (u *AchievementUsecase) Delete(ctx context.Context, id string, userID uuid.
 		return errors.New("not authorized to delete this achievement")
 	}
 
+	if ref.Status != entity.StatusDraft {
+		return errors.New("can only delete draft achievements")
+	}
+
 	
 	if err := u.achievementRepo.DeleteMongo(ctx, mongoID); err != nil {
 		return err
 	}
 
 	
-	return u.achievementRepo.DeleteReference(ctx, id)
+	if err := u.achievementRepo.DeleteReference(ctx, id); err != nil {
+		return err
+	}
+	u.statisticsUsecase.OnStatusChange(ctx, ref.StudentID)
+
+	return nil
 }
 
-func (u *AchievementUsecase) Submit(ctx context.Context, id string, userID uuid.UUID) error {
-	ref, err := u.achievementRepo.GetReferenceByMongoID(ctx, id)
+func (u *AchievementUsecase) Submit(ctx context.Context, id string, subject *entity.Subject) error {
+	userID := subject.UserID
+	ref, err := u.visibleReference(ctx, subject, id)
 	if err != nil {
 		return err
 	}
 
-	if ref.Status != entity.StatusDraft && ref.Status != entity.StatusRejected {
-		return errors.New("can only submit draft or rejected achievements")
-	}
-
 	student, err := u.studentRepo.GetByUserID(ctx, userID)
 	if err != nil {
 		return errors.New("student profile not found")
@@ -251,6 +300,10 @@ func (u *AchievementUsecase) Submit(ctx context.Context, id string, userID uuid.
 		return errors.New("not authorized to submit this achievement")
 	}
 
+	if ref.Status != entity.StatusDraft && ref.Status != entity.StatusRejected {
+		return errors.New("can only submit draft or rejected achievements")
+	}
+
 	
 	if err := u.achievementRepo.UpdateReferenceStatus(ctx, id, entity.StatusSubmitted, nil, ""); err != nil {
 		return err
@@ -263,15 +316,18 @@ func (u *AchievementUsecase) Submit(ctx context.Context, id string, userID uuid.
 		OldStatus:        ref.Status,
 		NewStatus:        entity.StatusSubmitted,
 		ChangedBy:        userID,
+		ImpersonatedBy:   subject.Impersonator(),
 		Note:             "Submitted for verification",
 	}
 	u.achievementRepo.AddStatusHistory(ctx, history)
+	u.statisticsUsecase.OnStatusChange(ctx, ref.StudentID)
 
 	return nil
 }
 
-func (u *AchievementUsecase) Verify(ctx context.Context, id string, verifierID uuid.UUID) error {
-	ref, err := u.achievementRepo.GetReferenceByMongoID(ctx, id)
+func (u *AchievementUsecase) Verify(ctx context.Context, id string, subject *entity.Subject) error {
+	verifierID := subject.UserID
+	ref, err := u.visibleReference(ctx, subject, id)
 	if err != nil {
 		return err
 	}
@@ -307,15 +363,18 @@ func (u *AchievementUsecase) Verify(ctx context.Context, id string, verifierID u
 		OldStatus:        ref.Status,
 		NewStatus:        entity.StatusVerified,
 		ChangedBy:        verifierID,
+		ImpersonatedBy:   subject.Impersonator(),
 		Note:             "Achievement verified",
 	}
 	u.achievementRepo.AddStatusHistory(ctx, history)
+	u.statisticsUsecase.OnStatusChange(ctx, ref.StudentID)
 
 	return nil
 }
 
-func (u *AchievementUsecase) Reject(ctx context.Context, id string, verifierID uuid.UUID, note string) error {
-	ref, err := u.achievementRepo.GetReferenceByMongoID(ctx, id)
+func (u *AchievementUsecase) Reject(ctx context.Context, id string, subject *entity.Subject, note string) error {
+	verifierID := subject.UserID
+	ref, err := u.visibleReference(ctx, subject, id)
 	if err != nil {
 		return err
 	}
@@ -351,15 +410,17 @@ func (u *AchievementUsecase) Reject(ctx context.Context, id string, verifierID u
 		OldStatus:        ref.Status,
 		NewStatus:        entity.StatusRejected,
 		ChangedBy:        verifierID,
+		ImpersonatedBy:   subject.Impersonator(),
 		Note:             note,
 	}
 	u.achievementRepo.AddStatusHistory(ctx, history)
+	u.statisticsUsecase.OnStatusChange(ctx, ref.StudentID)
 
 	return nil
 }
 
-func (u *AchievementUsecase) GetHistory(ctx context.Context, id string) ([]*entity.AchievementStatusHistory, error) {
-	ref, err := u.achievementRepo.GetReferenceByMongoID(ctx, id)
+func (u *AchievementUsecase) GetHistory(ctx context.Context, subject *entity.Subject, id string) ([]*entity.AchievementStatusHistory, error) {
+	ref, err := u.visibleReference(ctx, subject, id)
 	if err != nil {
 		return nil, err
 	}
@@ -367,7 +428,7 @@ func (u *AchievementUsecase) GetHistory(ctx context.Context, id string) ([]*enti
 	return u.achievementRepo.GetStatusHistory(ctx, ref.ID)
 }
 
-func (u *AchievementUsecase) List(ctx context.Context, userID uuid.UUID, roleName string, filter *entity.AchievementFilter) ([]*entity.AchievementResponse, int, error) {
+func (u *AchievementUsecase) List(ctx context.Context, subject *entity.Subject, filter *entity.AchievementFilter) ([]*entity.AchievementResponse, int, error) {
 	limit := 10
 	offset := 0
 	if filter.Limit > 0 {
@@ -377,50 +438,24 @@ func (u *AchievementUsecase) List(ctx context.Context, userID uuid.UUID, roleNam
 		offset = (filter.Page - 1) * limit
 	}
 
+	studentIDs, err := u.ResolveScope(ctx, subject)
+	if err != nil {
+		return nil, 0, err
+	}
+
 	var refs []*entity.AchievementReference
 	var total int
-	var err error
 
-	switch roleName {
-	case "Mahasiswa":
-		
-		student, err := u.studentRepo.GetByUserID(ctx, userID)
-		if err != nil {
-			return nil, 0, errors.New("student profile not found")
-		}
-		refs, total, err = u.achievementRepo.ListReferences(ctx, &student.ID, filter.Status, limit, offset)
-		if err != nil {
-			return nil, 0, err
-		}
-
-	case "Dosen Wali":
-		
-		lecturer, err := u.userRepo.GetLecturerByUserID(ctx, userID)
-		if err != nil {
-			return nil, 0, errors.New("lecturer profile not found")
-		}
-		
-		students, _, err := u.studentRepo.GetByAdvisorID(ctx, lecturer.ID, 1000, 0)
-		if err != nil {
-			return nil, 0, err
-		}
-
-		studentIDs := make([]uuid.UUID, len(students))
-		for i, s := range students {
-			studentIDs[i] = s.ID
-		}
-
-		refs, total, err = u.achievementRepo.ListReferencesByStudentIDs(ctx, studentIDs, filter.Status, limit, offset)
-		if err != nil {
-			return nil, 0, err
-		}
-
-	case "Admin":
-		
+	switch {
+	case studentIDs == nil:
 		refs, total, err = u.achievementRepo.ListReferences(ctx, nil, filter.Status, limit, offset)
-		if err != nil {
-			return nil, 0, err
-		}
+	case len(studentIDs) == 1:
+		refs, total, err = u.achievementRepo.ListReferences(ctx, &studentIDs[0], filter.Status, limit, offset)
+	case len(studentIDs) > 1:
+		refs, total, err = u.achievementRepo.ListReferencesByStudentIDs(ctx, studentIDs, filter.Status, limit, offset)
+	}
+	if err != nil {
+		return nil, 0, err
 	}
 
 	
@@ -471,7 +506,101 @@ func (u *AchievementUsecase) List(ctx context.Context, userID uuid.UUID, roleNam
 	return achievements, total, nil
 }
 
-func (u *AchievementUsecase) ListByStudentID(ctx context.Context, studentID uuid.UUID, limit, offset int) ([]*entity.AchievementResponse, int, error) {
+// ResolveScope returns the IDs of the students whose achievements the
+// subject may see, as decided by the access policy. A nil slice means every
+// student; an empty slice means none.
+func (u *AchievementUsecase) ResolveScope(ctx context.Context, subject *entity.Subject) ([]uuid.UUID, error) {
+	return u.policy.Scope(ctx, subject)
+}
+
+// Export writes a header row followed by one flattened row per achievement
+// in scope that matches the filter. References are streamed from Postgres
+// and resolved against MongoDB in batches, so the full result set is never
+// held in memory.
+func (u *AchievementUsecase) Export(ctx context.Context, studentIDs []uuid.UUID, filter *entity.AchievementFilter, write func([]string) error) error {
+	if err := write(exportHeader()); err != nil {
+		return err
+	}
+	if studentIDs != nil && len(studentIDs) == 0 {
+		return nil
+	}
+
+	const batchSize = 500
+	batch := make([]*entity.AchievementReference, 0, batchSize)
+	students := make(map[uuid.UUID]*entity.Student)
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+
+		mongoIDs := make([]primitive.ObjectID, 0, len(batch))
+		var missing []uuid.UUID
+		for _, ref := range batch {
+			if id, err := primitive.ObjectIDFromHex(ref.MongoAchievementID); err == nil {
+				mongoIDs = append(mongoIDs, id)
+			}
+			if _, ok := students[ref.StudentID]; !ok {
+				missing = append(missing, ref.StudentID)
+				students[ref.StudentID] = nil
+			}
+		}
+
+		if len(missing) > 0 {
+			found, err := u.studentRepo.GetByIDs(ctx, missing)
+			if err != nil {
+				return err
+			}
+			for _, s := range found {
+				students[s.ID] = s
+			}
+		}
+
+		docs, err := u.achievementRepo.ListMongoByIDs(ctx, mongoIDs, filter.AchievementType)
+		if err != nil {
+			return err
+		}
+		byID := make(map[string]*entity.Achievement, len(docs))
+		for _, doc := range docs {
+			byID[doc.ID.Hex()] = doc
+		}
+
+		for _, ref := range batch {
+			achievement, ok := byID[ref.MongoAchievementID]
+			if !ok {
+				continue
+			}
+
+			if err := write(exportRow(ref, achievement, students[ref.StudentID])); err != nil {
+				return err
+			}
+		}
+
+		batch = batch[:0]
+		return nil
+	}
+
+	err := u.achievementRepo.StreamReferences(ctx, studentIDs, filter.Status, func(ref *entity.AchievementReference) error {
+		batch = append(batch, ref)
+		if len(batch) == batchSize {
+			return flush()
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return flush()
+}
+
+// ListByStudentID lists the achievements of a student the subject may
+// access, or returns ErrStudentNotFound.
+func (u *AchievementUsecase) ListByStudentID(ctx context.Context, subject *entity.Subject, studentID uuid.UUID, limit, offset int) ([]*entity.AchievementResponse, int, error) {
+	if err := u.policy.AuthorizeStudent(ctx, subject, studentID); err != nil {
+		return nil, 0, err
+	}
+
 	refs, total, err := u.achievementRepo.ListReferences(ctx, &studentID, "", limit, offset)
 	if err != nil {
 		return nil, 0, err
@@ -519,34 +648,169 @@ func (u *AchievementUsecase) ListByStudentID(ctx context.Context, studentID uuid
 	return achievements, total, nil
 }
 
-func (u *AchievementUsecase) GetStatistics(ctx context.Context, studentID *uuid.UUID) (*entity.StatisticsResponse, error) {
-	stats, err := u.achievementRepo.GetStatistics(ctx, studentID)
+// GetLeaderboard ranks students by the points of their verified
+// achievements. The period filters on the verification date; end_date is
+// inclusive.
+func (u *AchievementUsecase) GetLeaderboard(ctx context.Context, filter *entity.LeaderboardFilter) ([]*entity.LeaderboardEntry, int, error) {
+	limit := 10
+	offset := 0
+	if filter.Limit > 0 {
+		limit = filter.Limit
+	}
+	if limit > 100 {
+		limit = 100
+	}
+	if filter.Page > 0 {
+		offset = (filter.Page - 1) * limit
+	}
+
+	if filter.AchievementType != "" && !entity.AchievementType(filter.AchievementType).IsValid() {
+		return nil, 0, errors.New("invalid achievement type")
+	}
+
+	units := &entity.AcademicUnitFilter{}
+	for value, target := range map[string]**uuid.UUID{
+		filter.FacultyID:      &units.FacultyID,
+		filter.DepartmentID:   &units.DepartmentID,
+		filter.StudyProgramID: &units.StudyProgramID,
+	} {
+		if value == "" {
+			continue
+		}
+		id, err := uuid.Parse(value)
+		if err != nil {
+			return nil, 0, errors.New("invalid faculty, department or study program ID")
+		}
+		*target = &id
+	}
+
+	var from, to *time.Time
+	if filter.StartDate != "" {
+		t, err := utils.ParseDate(filter.StartDate)
+		if err != nil {
+			return nil, 0, errors.New("start_date must be YYYY-MM-DD")
+		}
+		from = &t
+	}
+	if filter.EndDate != "" {
+		t, err := utils.ParseDate(filter.EndDate)
+		if err != nil {
+			return nil, 0, errors.New("end_date must be YYYY-MM-DD")
+		}
+		t = t.AddDate(0, 0, 1)
+		to = &t
+	}
+
+	ids, err := u.achievementRepo.ListLeaderboardMongoIDs(ctx, units, filter.AcademicYear, from, to, filter.IncludeHidden)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	entries, total, err := u.achievementRepo.LeaderboardMongo(ctx, ids, filter.AchievementType, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(entries) == 0 {
+		return entries, total, nil
+	}
+
+	studentIDs := make([]uuid.UUID, len(entries))
+	for i, e := range entries {
+		studentIDs[i] = e.StudentID
+	}
+	students, err := u.studentRepo.GetByIDs(ctx, studentIDs)
+	if err != nil {
+		return nil, 0, err
+	}
+	byID := make(map[uuid.UUID]*entity.Student, len(students))
+	for _, s := range students {
+		byID[s.ID] = s
+	}
+	for _, e := range entries {
+		if s, ok := byID[e.StudentID]; ok {
+			e.NIM = s.StudentID
+			e.FullName = s.FullName
+			e.ProgramStudy = s.ProgramStudy
+			e.AcademicYear = s.AcademicYear
+		}
+	}
+
+	return entries, total, nil
+}
+
+// SetLeaderboardVisibility lets a student hide themselves from leaderboards.
+func (u *AchievementUsecase) SetLeaderboardVisibility(ctx context.Context, userID uuid.UUID, hidden bool) error {
+	student, err := u.studentRepo.GetByUserID(ctx, userID)
 	if err != nil {
-		return nil, err
+		return errors.New("student profile not found")
 	}
+	return u.studentRepo.SetLeaderboardHidden(ctx, student.ID, hidden)
+}
 
-	
-	var studentIDs []uuid.UUID
-	if studentID != nil {
-		studentIDs = []uuid.UUID{*studentID}
-	} else {
-		
-		students, _, _ := u.studentRepo.List(ctx, 10000, 0)
-		for _, s := range students {
-			studentIDs = append(studentIDs, s.ID)
+func exportHeader() []string {
+	header := []string{
+		"id", "nim", "student_name", "program_study", "achievement_type", "title", "description",
+		"status", "points", "tags", "submitted_at", "verified_at", "rejection_note", "created_at",
+	}
+	header = append(header, entity.ExportDetailKeys...)
+	return append(header, "other_details")
+}
+
+func exportRow(ref *entity.AchievementReference, achievement *entity.Achievement, student *entity.Student) []string {
+	var nim, studentName, programStudy string
+	if student != nil {
+		nim, studentName, programStudy = student.StudentID, student.FullName, student.ProgramStudy
+	}
+
+	row := []string{
+		ref.MongoAchievementID,
+		nim,
+		studentName,
+		programStudy,
+		string(achievement.AchievementType),
+		achievement.Title,
+		achievement.Description,
+		string(ref.Status),
+		strconv.Itoa(achievement.Points),
+		strings.Join(achievement.Tags, "; "),
+		formatExportTime(ref.SubmittedAt),
+		formatExportTime(ref.VerifiedAt),
+		ref.RejectionNote,
+		achievement.CreatedAt.Format(time.RFC3339),
+	}
+
+	flattened := make(map[string]bool, len(entity.ExportDetailKeys))
+	for _, key := range entity.ExportDetailKeys {
+		flattened[key] = true
+		if value, ok := achievement.Details[key]; ok && value != nil {
+			row = append(row, fmt.Sprint(value))
+		} else {
+			row = append(row, "")
 		}
 	}
 
-	if len(studentIDs) > 0 {
-		typeStats, err := u.achievementRepo.GetStatsMongo(ctx, studentIDs)
-		if err == nil {
-			stats.ByType = typeStats
+	other := make(map[string]interface{})
+	for key, value := range achievement.Details {
+		if !flattened[key] {
+			other[key] = value
+		}
+	}
+	otherDetails := ""
+	if len(other) > 0 {
+		if data, err := json.Marshal(other); err == nil {
+			otherDetails = string(data)
 		}
 	}
 
-	return stats, nil
+	return utils.EscapeSpreadsheetRow(append(row, otherDetails))
 }
 
+func formatExportTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
 
 func calculatePoints(achievementType entity.AchievementType, details map[string]interface{}) int {
 	basePoints := map[entity.AchievementType]int{
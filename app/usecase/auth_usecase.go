@@ -2,62 +2,188 @@ package usecase
 
 import (
 	"context"
+	"database/sql"
 	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
 	"time"
 
+	"github.com/Aryma-f4/uas-backend/app/authprovider"
 	"github.com/Aryma-f4/uas-backend/app/entity"
+	"github.com/Aryma-f4/uas-backend/app/mailer"
 	"github.com/Aryma-f4/uas-backend/app/repository"
 	"github.com/Aryma-f4/uas-backend/config"
+	"github.com/Aryma-f4/uas-backend/utils"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 	"golang.org/x/crypto/bcrypt"
 )
 
+var (
+	// ErrTooManyLoginAttempts is returned while the account or IP address of
+	// a login is locked after repeated failures.
+	ErrTooManyLoginAttempts = errors.New("too many failed login attempts, try again later")
+	// ErrInvalidCredentials is returned for a wrong username or password.
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrAccountInactive    = errors.New("user account is inactive")
+	// ErrAuthProviderUnavailable is returned when the provider of an account
+	// is unknown or could not decide on the credentials.
+	ErrAuthProviderUnavailable = errors.New("authentication provider unavailable")
+	// ErrAccountNotProvisioned is returned when the local account of a new
+	// directory user could not be created.
+	ErrAccountNotProvisioned = errors.New("account could not be created, contact an administrator")
+	// ErrPasswordManagedByDirectory is returned when setting the password of
+	// a user whose credentials are checked by a directory.
+	ErrPasswordManagedByDirectory = errors.New("password is managed by the directory")
+	// ErrInvalidRefreshToken is returned for unknown, expired or revoked
+	// refresh tokens.
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	// ErrRefreshTokenReused is returned when a used refresh token comes back;
+	// its whole session is revoked.
+	ErrRefreshTokenReused = errors.New("refresh token already used, please log in again")
+)
+
 type AuthUsecase struct {
-	userRepo *repository.UserRepository
-	config   *config.Config
+	userRepo           *repository.UserRepository
+	securityRepo       *repository.SecurityRepository
+	serviceAccountRepo *repository.ServiceAccountRepository
+	mailer             mailer.Mailer
+	keys               *utils.KeySet
+	providers          *authprovider.Registry
+	config             *config.Config
 }
 
-func NewAuthUsecase(userRepo *repository.UserRepository, cfg *config.Config) *AuthUsecase {
+func NewAuthUsecase(
+	userRepo *repository.UserRepository,
+	securityRepo *repository.SecurityRepository,
+	serviceAccountRepo *repository.ServiceAccountRepository,
+	mail mailer.Mailer,
+	keys *utils.KeySet,
+	providers *authprovider.Registry,
+	cfg *config.Config,
+) *AuthUsecase {
 	return &AuthUsecase{
-		userRepo: userRepo,
-		config:   cfg,
+		userRepo:           userRepo,
+		securityRepo:       securityRepo,
+		serviceAccountRepo: serviceAccountRepo,
+		mailer:             mail,
+		keys:               keys,
+		providers:          providers,
+		config:             cfg,
 	}
 }
 
-func (u *AuthUsecase) Login(ctx context.Context, req *entity.LoginRequest) (*entity.LoginResponse, error) {
-	
+// Login checks the credentials and starts a session for the client with the
+// given user agent and IP address. Failed attempts are throttled per account
+// and per IP address; unknown usernames are throttled like existing ones so
+// the responses do not reveal which accounts exist.
+func (u *AuthUsecase) Login(ctx context.Context, req *entity.LoginRequest, userAgent, ipAddress string) (*entity.LoginResponse, error) {
 	user, err := u.userRepo.GetByUsername(ctx, req.Username)
 	if err != nil {
 		user, err = u.userRepo.GetByEmail(ctx, req.Username)
 		if err != nil {
-			return nil, errors.New("invalid credentials")
+			user = nil
 		}
 	}
 
-	
+	accountKey := "account:" + strings.ToLower(strings.TrimSpace(req.Username))
+	if user != nil {
+		accountKey = "account:" + user.ID.String()
+	}
+	ipKey := "ip:" + ipAddress
+
+	lockedUntil, err := u.securityRepo.GetLockedUntil(ctx, accountKey, ipKey)
+	if err != nil {
+		return nil, err
+	}
+	if lockedUntil != nil {
+		return nil, ErrTooManyLoginAttempts
+	}
+
+	provider := u.providers.For(user, req.Username)
+	if provider == nil {
+		log.Printf("User %s has unknown auth provider %q", user.ID, user.AuthProvider)
+		return nil, ErrAuthProviderUnavailable
+	}
+	identity, err := provider.Authenticate(ctx, user, req.Username, req.Password)
+	if errors.Is(err, authprovider.ErrInvalidCredentials) {
+		u.recordLoginFailure(ctx, user, accountKey, ipKey, ipAddress)
+		return nil, ErrInvalidCredentials
+	}
+	if errors.Is(err, authprovider.ErrNoRole) {
+		return nil, err
+	}
+	if err != nil {
+		// The directory could not decide; this is no failed attempt
+		log.Printf("Auth provider %s failed: %v", provider.Name(), err)
+		return nil, ErrAuthProviderUnavailable
+	}
+
+	if user == nil {
+		if user, err = u.provisionDirectoryUser(ctx, provider, identity); err != nil {
+			return nil, err
+		}
+	} else if err := u.syncDirectoryRole(ctx, user, identity); err != nil {
+		return nil, err
+	}
+
+	if !user.IsActive {
+		return nil, ErrAccountInactive
+	}
+
+	if err := u.securityRepo.ResetLoginThrottle(ctx, accountKey); err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("Failed to reset login failures of user %s: %v", user.ID, err)
+	}
+
+	return u.CompleteLogin(ctx, user, userAgent, ipAddress)
+}
+
+// CompleteLogin finishes the login of a user whose first factor was checked,
+// by password or by single sign-on: it asks for a second factor where MFA
+// applies and starts a session otherwise.
+func (u *AuthUsecase) CompleteLogin(ctx context.Context, user *entity.User, userAgent, ipAddress string) (*entity.LoginResponse, error) {
 	if !user.IsActive {
-		return nil, errors.New("user account is inactive")
+		return nil, ErrAccountInactive
 	}
 
-	
-	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password)); err != nil {
-		return nil, errors.New("invalid credentials")
+	challenge, err := u.mfaChallenge(ctx, user, userAgent, ipAddress)
+	if err != nil {
+		return nil, err
 	}
+	if challenge != nil {
+		return challenge, nil
+	}
+
+	return u.startSession(ctx, user, userAgent, ipAddress)
+}
 
-	
+// startSession issues the tokens of a new session for an authenticated user.
+func (u *AuthUsecase) startSession(ctx context.Context, user *entity.User, userAgent, ipAddress string) (*entity.LoginResponse, error) {
 	permissions, err := u.userRepo.GetPermissions(ctx, user.RoleID)
 	if err != nil {
 		return nil, err
 	}
 
-	
-	token, err := u.generateToken(user.ID, user.RoleID)
+	// Every login starts a new session, which is also the refresh token family
+	sessionID := uuid.New()
+	refreshToken, stored, err := u.newRefreshToken(user.ID, sessionID)
 	if err != nil {
 		return nil, err
 	}
+	session := &entity.Session{
+		ID:        sessionID,
+		UserID:    user.ID,
+		UserAgent: userAgent,
+		IPAddress: ipAddress,
+		ExpiresAt: stored.ExpiresAt,
+	}
+	if err := u.userRepo.CreateSession(ctx, session, stored); err != nil {
+		return nil, err
+	}
 
-	refreshToken, err := u.generateRefreshToken(user.ID)
+	token, err := u.generateToken(ctx, user.ID, user.RoleID, sessionID)
 	if err != nil {
 		return nil, err
 	}
@@ -65,7 +191,7 @@ func (u *AuthUsecase) Login(ctx context.Context, req *entity.LoginRequest) (*ent
 	return &entity.LoginResponse{
 		Token:        token,
 		RefreshToken: refreshToken,
-		User: entity.UserInfo{
+		User: &entity.UserInfo{
 			ID:          user.ID,
 			Username:    user.Username,
 			FullName:    user.FullName,
@@ -76,48 +202,232 @@ func (u *AuthUsecase) Login(ctx context.Context, req *entity.LoginRequest) (*ent
 	}, nil
 }
 
-func (u *AuthUsecase) RefreshToken(ctx context.Context, refreshToken string) (string, string, error) {
-	
-	token, err := jwt.ParseWithClaims(refreshToken, jwt.MapClaims{}, func(token *jwt.Token) (interface{}, error) {
-		return []byte(u.config.JWTSecret), nil
-	})
+// provisionDirectoryUser creates the local account of a directory user on
+// their first login, with the role their groups map to.
+func (u *AuthUsecase) provisionDirectoryUser(ctx context.Context, provider authprovider.Provider, identity *authprovider.Identity) (*entity.User, error) {
+	if identity.Role == "" {
+		return nil, authprovider.ErrNoRole
+	}
+	if identity.Email == "" {
+		log.Printf("Directory user %s has no email address", identity.Username)
+		return nil, ErrAccountNotProvisioned
+	}
+	role, err := u.userRepo.GetRoleByName(ctx, identity.Role)
 	if err != nil {
-		return "", "", errors.New("invalid refresh token")
+		log.Printf("Role %q of directory user %s not found", identity.Role, identity.Username)
+		return nil, ErrAccountNotProvisioned
 	}
 
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if !ok || !token.Valid {
-		return "", "", errors.New("invalid refresh token")
+	// The password is checked by the directory; the local hash never matches
+	password, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	hashedPassword, err := u.HashPassword(password)
+	if err != nil {
+		return nil, err
 	}
 
-	
-	if tokenType, ok := claims["type"].(string); !ok || tokenType != "refresh" {
-		return "", "", errors.New("invalid token type")
+	fullName := identity.FullName
+	if fullName == "" {
+		fullName = identity.Username
 	}
+	user := &entity.User{
+		ID:           uuid.New(),
+		Username:     identity.Username,
+		Email:        identity.Email,
+		PasswordHash: hashedPassword,
+		FullName:     fullName,
+		RoleID:       role.ID,
+		RoleName:     role.Name,
+		IsActive:     true,
+		AuthProvider: provider.Name(),
+	}
+	if err := u.userRepo.Create(ctx, user); err != nil {
+		// Most likely a local account already has the username or email
+		log.Printf("Failed to provision directory user %s: %v", user.Username, err)
+		return nil, ErrAccountNotProvisioned
+	}
+	log.Printf("Provisioned %s user %s from the directory", provider.Name(), user.Username)
+	return user, nil
+}
 
-	
-	userIDStr, ok := claims["user_id"].(string)
-	if !ok {
-		return "", "", errors.New("invalid token claims")
+// syncDirectoryRole moves a user to the role their directory groups map to,
+// so group changes in the directory apply at the next login.
+func (u *AuthUsecase) syncDirectoryRole(ctx context.Context, user *entity.User, identity *authprovider.Identity) error {
+	if identity.Role == "" || identity.Role == user.RoleName {
+		return nil
 	}
+	role, err := u.userRepo.GetRoleByName(ctx, identity.Role)
+	if err != nil {
+		return fmt.Errorf("role %q of directory group not found", identity.Role)
+	}
+	if err := u.userRepo.UpdateRole(ctx, user.ID, role.ID); err != nil {
+		return err
+	}
+	log.Printf("Role of user %s changed from %s to %s by directory groups", user.ID, user.RoleName, role.Name)
+	user.RoleID, user.RoleName = role.ID, role.Name
+	return nil
+}
 
-	userID, err := uuid.Parse(userIDStr)
+// verifyPassword checks the password of a signed in user with their
+// authentication provider.
+func (u *AuthUsecase) verifyPassword(ctx context.Context, user *entity.User, password string) error {
+	provider := u.providers.For(user, user.Email)
+	if provider == nil {
+		return errors.New("authentication provider unavailable")
+	}
+	if _, err := provider.Authenticate(ctx, user, user.Username, password); err != nil {
+		return errors.New("password is incorrect")
+	}
+	return nil
+}
+
+// managesPassword reports whether the password of the user is kept here
+// rather than in a directory.
+func (u *AuthUsecase) managesPassword(user *entity.User) bool {
+	provider := u.providers.For(user, user.Email)
+	return provider != nil && provider.Name() == authprovider.Local
+}
+
+// HasAuthProvider reports whether an authentication provider is configured.
+func (u *AuthUsecase) HasAuthProvider(name string) bool {
+	_, ok := u.providers.Get(name)
+	return ok
+}
+
+// recordLoginFailure counts a failed login for the account and the IP
+// address and locks them once their limits are reached. Failures to record
+// are logged, so a database hiccup never turns into a successful login.
+func (u *AuthUsecase) recordLoginFailure(ctx context.Context, user *entity.User, accountKey, ipKey, ipAddress string) {
+	var userID *uuid.UUID
+	if user != nil {
+		userID = &user.ID
+	}
+	window := time.Duration(u.config.LoginFailureWindowMinutes) * time.Minute
+	lockout := time.Duration(u.config.LoginLockoutMinutes) * time.Minute
+
+	failures, err := u.securityRepo.RecordLoginFailure(ctx, accountKey, window)
+	if err != nil {
+		log.Printf("Failed to record login failure: %v", err)
+	} else if delay := u.loginBackoff(failures); delay > 0 {
+		if err := u.securityRepo.LockLogin(ctx, accountKey, time.Now().Add(delay)); err != nil {
+			log.Printf("Failed to lock login: %v", err)
+		}
+		if failures == u.config.LoginLockoutThreshold {
+			u.recordSecurityEvent(ctx, userID, entity.SecurityEventAccountLocked, ipAddress,
+				fmt.Sprintf("locked for %s after %d failed logins", lockout, failures))
+		}
+	}
+
+	if ipAddress == "" {
+		return
+	}
+	failures, err = u.securityRepo.RecordLoginFailure(ctx, ipKey, window)
 	if err != nil {
-		return "", "", errors.New("invalid user id")
+		log.Printf("Failed to record login failure: %v", err)
+		return
 	}
+	if failures >= u.config.LoginIPMaxFailures {
+		if err := u.securityRepo.LockLogin(ctx, ipKey, time.Now().Add(lockout)); err != nil {
+			log.Printf("Failed to lock login: %v", err)
+		}
+		if failures == u.config.LoginIPMaxFailures {
+			u.recordSecurityEvent(ctx, nil, entity.SecurityEventIPLocked, ipAddress,
+				fmt.Sprintf("locked for %s after %d failed logins", lockout, failures))
+		}
+	}
+}
 
-	user, err := u.userRepo.GetByID(ctx, userID)
+// loginBackoff returns how long an account is locked after its given number
+// of consecutive failures: nothing below LoginBackoffThreshold, then
+// LoginBackoffBaseSeconds doubling with every failure, and the full lockout
+// from LoginLockoutThreshold on.
+func (u *AuthUsecase) loginBackoff(failures int) time.Duration {
+	lockout := time.Duration(u.config.LoginLockoutMinutes) * time.Minute
+	if failures >= u.config.LoginLockoutThreshold {
+		return lockout
+	}
+	if failures < u.config.LoginBackoffThreshold {
+		return 0
+	}
+	delay := time.Duration(u.config.LoginBackoffBaseSeconds) * time.Second << min(failures-u.config.LoginBackoffThreshold, 20)
+	return min(delay, lockout)
+}
+
+// UnlockAccount clears the failed logins and lock of a user.
+func (u *AuthUsecase) UnlockAccount(ctx context.Context, userID, adminID uuid.UUID, ipAddress string) error {
+	if _, err := u.userRepo.GetByID(ctx, userID); err != nil {
+		return errors.New("user not found")
+	}
+
+	err := u.securityRepo.ResetLoginThrottle(ctx, "account:"+userID.String())
+	if errors.Is(err, sql.ErrNoRows) {
+		return errors.New("account is not locked")
+	}
 	if err != nil {
-		return "", "", errors.New("user not found")
+		return err
 	}
 
-	
-	newToken, err := u.generateToken(user.ID, user.RoleID)
+	u.recordSecurityEvent(ctx, &userID, entity.SecurityEventAccountUnlocked, ipAddress, "unlocked by "+adminID.String())
+	return nil
+}
+
+// ListSecurityEvents returns the security events of a user, newest first.
+func (u *AuthUsecase) ListSecurityEvents(ctx context.Context, userID uuid.UUID, limit, offset int) ([]*entity.SecurityEvent, int, error) {
+	return u.securityRepo.ListEventsByUser(ctx, userID, limit, offset)
+}
+
+func (u *AuthUsecase) recordSecurityEvent(ctx context.Context, userID *uuid.UUID, eventType, ipAddress, detail string) {
+	event := &entity.SecurityEvent{
+		ID:        uuid.New(),
+		UserID:    userID,
+		EventType: eventType,
+		IPAddress: ipAddress,
+		Detail:    detail,
+	}
+	if err := u.securityRepo.CreateEvent(ctx, event); err != nil {
+		log.Printf("Failed to record security event %s: %v", eventType, err)
+	}
+}
+
+// RefreshToken exchanges a refresh token for a new access token and a new
+// refresh token of the same family. A token can only be used once; presenting
+// an already used token revokes the whole family, since either the client or
+// an attacker holds a stolen copy.
+func (u *AuthUsecase) RefreshToken(ctx context.Context, refreshToken string) (string, string, error) {
+	stored, err := u.userRepo.GetRefreshTokenByHash(ctx, utils.HashToken(refreshToken))
+	if err != nil {
+		return "", "", ErrInvalidRefreshToken
+	}
+	if stored.RevokedAt != nil || time.Now().After(stored.ExpiresAt) {
+		return "", "", ErrInvalidRefreshToken
+	}
+	if stored.UsedAt != nil {
+		return "", "", u.revokeReusedFamily(ctx, stored)
+	}
+
+	user, err := u.userRepo.GetByID(ctx, stored.UserID)
 	if err != nil {
+		return "", "", ErrInvalidRefreshToken
+	}
+	if !user.IsActive {
+		return "", "", ErrAccountInactive
+	}
+
+	newRefreshToken, next, err := u.newRefreshToken(user.ID, stored.FamilyID)
+	if err != nil {
+		return "", "", err
+	}
+	if err := u.userRepo.RotateRefreshToken(ctx, stored.ID, next); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			// Another request used the token in the meantime
+			return "", "", u.revokeReusedFamily(ctx, stored)
+		}
 		return "", "", err
 	}
 
-	newRefreshToken, err := u.generateRefreshToken(user.ID)
+	newToken, err := u.generateToken(ctx, user.ID, user.RoleID, stored.FamilyID)
 	if err != nil {
 		return "", "", err
 	}
@@ -125,6 +435,64 @@ func (u *AuthUsecase) RefreshToken(ctx context.Context, refreshToken string) (st
 	return newToken, newRefreshToken, nil
 }
 
+// Logout revokes the session of the presented refresh token. Unknown or
+// already revoked tokens are ignored so that logging out twice succeeds.
+func (u *AuthUsecase) Logout(ctx context.Context, refreshToken string) error {
+	stored, err := u.userRepo.GetRefreshTokenByHash(ctx, utils.HashToken(refreshToken))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := u.userRepo.RevokeSession(ctx, stored.UserID, stored.FamilyID); err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	return nil
+}
+
+// ListSessions returns the active sessions of a user, marking the one with
+// the given ID as current.
+func (u *AuthUsecase) ListSessions(ctx context.Context, userID, currentID uuid.UUID) ([]*entity.Session, error) {
+	sessions, err := u.userRepo.ListActiveSessions(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, session := range sessions {
+		session.Current = session.ID == currentID
+	}
+	return sessions, nil
+}
+
+// RevokeSession revokes one session of a user. Its access tokens are
+// rejected from then on and its refresh token can no longer be used.
+func (u *AuthUsecase) RevokeSession(ctx context.Context, userID, sessionID uuid.UUID) error {
+	if err := u.userRepo.RevokeSession(ctx, userID, sessionID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return errors.New("session not found")
+		}
+		return err
+	}
+	return nil
+}
+
+// RevokeAllSessions signs a user out everywhere and returns the number of
+// sessions revoked.
+func (u *AuthUsecase) RevokeAllSessions(ctx context.Context, userID uuid.UUID) (int, error) {
+	if _, err := u.userRepo.GetByID(ctx, userID); err != nil {
+		return 0, errors.New("user not found")
+	}
+	return u.userRepo.RevokeAllSessions(ctx, userID)
+}
+
+func (u *AuthUsecase) revokeReusedFamily(ctx context.Context, stored *entity.RefreshToken) error {
+	if err := u.userRepo.RevokeSession(ctx, stored.UserID, stored.FamilyID); err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	log.Printf("Refresh token reuse detected for user %s, family %s revoked", stored.UserID, stored.FamilyID)
+	return ErrRefreshTokenReused
+}
+
 func (u *AuthUsecase) GetProfile(ctx context.Context, userID uuid.UUID) (*entity.UserInfo, error) {
 	user, err := u.userRepo.GetByID(ctx, userID)
 	if err != nil {
@@ -146,30 +514,321 @@ func (u *AuthUsecase) GetProfile(ctx context.Context, userID uuid.UUID) (*entity
 	}, nil
 }
 
-func (u *AuthUsecase) ValidateToken(tokenString string) (uuid.UUID, uuid.UUID, error) {
-	token, err := jwt.ParseWithClaims(tokenString, jwt.MapClaims{}, func(token *jwt.Token) (interface{}, error) {
-		return []byte(u.config.JWTSecret), nil
-	})
+// ValidateToken parses an access token and, if it belongs to a session,
+// rejects it once the session was revoked. Tokens without a sid claim were
+// issued before sessions existed and are accepted until they expire.
+// Impersonation tokens are rejected once their admin is no longer an admin.
+func (u *AuthUsecase) ValidateToken(ctx context.Context, tokenString string) (*entity.TokenClaims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, jwt.MapClaims{}, u.keys.Keyfunc)
 	if err != nil {
-		return uuid.Nil, uuid.Nil, err
+		return nil, err
 	}
 
 	claims, ok := token.Claims.(jwt.MapClaims)
 	if !ok || !token.Valid {
-		return uuid.Nil, uuid.Nil, errors.New("invalid token")
+		return nil, errors.New("invalid token")
 	}
 
-	userID, err := uuid.Parse(claims["user_id"].(string))
+	userIDStr, _ := claims["user_id"].(string)
+	userID, err := uuid.Parse(userIDStr)
 	if err != nil {
-		return uuid.Nil, uuid.Nil, err
+		return nil, err
 	}
 
-	roleID, err := uuid.Parse(claims["role_id"].(string))
+	roleIDStr, _ := claims["role_id"].(string)
+	roleID, err := uuid.Parse(roleIDStr)
 	if err != nil {
-		return uuid.Nil, uuid.Nil, err
+		return nil, err
 	}
 
-	return userID, roleID, nil
+	result := &entity.TokenClaims{UserID: userID, RoleID: roleID}
+	if perms, ok := claims["perms"].([]interface{}); ok {
+		result.RoleName, _ = claims["role"].(string)
+		result.Permissions = make([]string, 0, len(perms))
+		for _, perm := range perms {
+			if name, ok := perm.(string); ok {
+				result.Permissions = append(result.Permissions, name)
+			}
+		}
+		version, _ := claims["pv"].(float64)
+		result.PermissionVersion = int64(version)
+	}
+
+	if imp, ok := claims["imp"].(string); ok {
+		if result.ImpersonatorID, err = uuid.Parse(imp); err != nil {
+			return nil, err
+		}
+		if err := u.checkImpersonator(ctx, result.ImpersonatorID); err != nil {
+			return nil, err
+		}
+	}
+
+	sid, ok := claims["sid"].(string)
+	if !ok {
+		if result.ImpersonatorID != uuid.Nil {
+			return nil, errors.New("impersonation token without session")
+		}
+		return result, nil
+	}
+	if result.SessionID, err = uuid.Parse(sid); err != nil {
+		return nil, err
+	}
+
+	session, err := u.userRepo.GetSession(ctx, result.SessionID)
+	if err != nil {
+		return nil, errors.New("session not found")
+	}
+	if session.RevokedAt != nil || session.UserID != userID {
+		return nil, errors.New("session revoked")
+	}
+	if !sameImpersonator(session.ImpersonatedBy, result.ImpersonatorID) {
+		return nil, errors.New("session does not match token")
+	}
+	if time.Since(session.LastSeenAt) > time.Minute {
+		if err := u.userRepo.TouchSession(ctx, session.ID); err != nil {
+			log.Printf("Failed to update last seen of session %s: %v", session.ID, err)
+		}
+	}
+
+	return result, nil
+}
+
+// Impersonate issues a short-lived access token that acts as another user
+// on behalf of an admin, so support can see what the user sees. The token
+// carries the admin in its imp claim and belongs to a session of the user
+// without a refresh token, so revoking that session ends it. It also stops
+// working once the admin loses the Admin role. Admins cannot be
+// impersonated.
+func (u *AuthUsecase) Impersonate(ctx context.Context, adminID, userID uuid.UUID, reason, userAgent, ipAddress string) (*entity.ImpersonationResponse, error) {
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return nil, errors.New("reason is required")
+	}
+	if userID == adminID {
+		return nil, errors.New("cannot impersonate yourself")
+	}
+
+	user, err := u.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, errors.New("user not found")
+	}
+	if !user.IsActive {
+		return nil, errors.New("user is inactive")
+	}
+	if user.RoleName == "Admin" {
+		return nil, errors.New("admins cannot be impersonated")
+	}
+
+	expiresAt := time.Now().Add(time.Duration(u.config.ImpersonationMinutes) * time.Minute)
+	session := &entity.Session{
+		ID:             uuid.New(),
+		UserID:         user.ID,
+		UserAgent:      userAgent,
+		IPAddress:      ipAddress,
+		ExpiresAt:      expiresAt,
+		ImpersonatedBy: &adminID,
+	}
+	if err := u.userRepo.CreateImpersonationSession(ctx, session); err != nil {
+		return nil, err
+	}
+
+	claims, err := u.accessClaims(ctx, user.ID, user.RoleID, expiresAt)
+	if err != nil {
+		return nil, err
+	}
+	claims["sid"] = session.ID.String()
+	claims["imp"] = adminID.String()
+
+	token, err := u.keys.Sign(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	profile, err := u.GetProfile(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	profile.ImpersonatedBy = &adminID
+
+	u.recordSecurityEvent(ctx, &user.ID, entity.SecurityEventImpersonation, ipAddress, "impersonated by "+adminID.String()+": "+reason)
+	u.recordSecurityEvent(ctx, &adminID, entity.SecurityEventImpersonation, ipAddress, "impersonating "+user.ID.String()+": "+reason)
+
+	return &entity.ImpersonationResponse{
+		Token:          token,
+		ExpiresAt:      expiresAt,
+		User:           profile,
+		ImpersonatorID: adminID,
+	}, nil
+}
+
+// EndImpersonation revokes the impersonation session of an admin's token.
+func (u *AuthUsecase) EndImpersonation(ctx context.Context, userID, sessionID, adminID uuid.UUID, ipAddress string) error {
+	if err := u.RevokeSession(ctx, userID, sessionID); err != nil {
+		return err
+	}
+
+	u.recordSecurityEvent(ctx, &userID, entity.SecurityEventImpersonationEnd, ipAddress, "ended by "+adminID.String())
+	u.recordSecurityEvent(ctx, &adminID, entity.SecurityEventImpersonationEnd, ipAddress, "stopped impersonating "+userID.String())
+	return nil
+}
+
+// checkImpersonator rejects impersonation tokens of admins who were
+// deactivated or lost the Admin role since issuing them.
+func (u *AuthUsecase) checkImpersonator(ctx context.Context, adminID uuid.UUID) error {
+	admin, err := u.userRepo.GetByID(ctx, adminID)
+	if err != nil {
+		return errors.New("impersonator not found")
+	}
+	if !admin.IsActive || admin.RoleName != "Admin" {
+		return errors.New("impersonator is no longer an admin")
+	}
+	return nil
+}
+
+// sameImpersonator reports whether a session and a token agree on the admin
+// acting as the user, if any.
+func sameImpersonator(sessionAdmin *uuid.UUID, tokenAdmin uuid.UUID) bool {
+	if sessionAdmin == nil {
+		return tokenAdmin == uuid.Nil
+	}
+	return *sessionAdmin == tokenAdmin
+}
+
+// ResolveAccess returns the role name and permissions of a validated access
+// token: from its claims while their permission version is current, from
+// the permission cache otherwise.
+func (u *AuthUsecase) ResolveAccess(ctx context.Context, claims *entity.TokenClaims) (*entity.RoleAccess, error) {
+	if claims.Permissions != nil {
+		version, err := u.userRepo.PermissionVersion(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if version == claims.PermissionVersion {
+			return &entity.RoleAccess{
+				RoleID:      claims.RoleID,
+				RoleName:    claims.RoleName,
+				Permissions: claims.Permissions,
+				Version:     claims.PermissionVersion,
+			}, nil
+		}
+	}
+	return u.userRepo.GetRoleAccess(ctx, claims.RoleID)
+}
+
+// AcceptInvitation sets the password of a user created through a roster
+// import with invitation credentials.
+func (u *AuthUsecase) AcceptInvitation(ctx context.Context, token, password string) error {
+	invitation, err := u.userRepo.GetInvitationByTokenHash(ctx, utils.HashToken(token))
+	if err != nil {
+		return errors.New("invalid invitation token")
+	}
+	if invitation.AcceptedAt != nil {
+		return errors.New("invitation already accepted")
+	}
+	if time.Now().After(invitation.ExpiresAt) {
+		return errors.New("invitation expired")
+	}
+
+	hashedPassword, err := u.HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	if err := u.userRepo.AcceptInvitation(ctx, invitation.ID, invitation.UserID, hashedPassword); err != nil {
+		return errors.New("invitation already accepted")
+	}
+	return nil
+}
+
+// ChangePassword replaces the password of a user after checking the current
+// one. Every other session of the user is revoked; sessionID, the session
+// making the change, stays signed in.
+func (u *AuthUsecase) ChangePassword(ctx context.Context, userID, sessionID uuid.UUID, req *entity.ChangePasswordRequest) error {
+	user, err := u.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return errors.New("user not found")
+	}
+
+	if !u.managesPassword(user) {
+		return ErrPasswordManagedByDirectory
+	}
+	if err := u.verifyPassword(ctx, user, req.CurrentPassword); err != nil {
+		return errors.New("current password is incorrect")
+	}
+	if req.NewPassword == req.CurrentPassword {
+		return errors.New("new password must differ from the current password")
+	}
+
+	hashedPassword, err := u.HashPassword(req.NewPassword)
+	if err != nil {
+		return err
+	}
+	return u.userRepo.UpdatePassword(ctx, userID, hashedPassword, sessionID)
+}
+
+// RequestPasswordReset mails a reset link to the active user with the given
+// email. Unknown or inactive accounts and mail failures are not reported to
+// the caller, so the endpoint cannot be used to probe for accounts.
+func (u *AuthUsecase) RequestPasswordReset(ctx context.Context, email string) error {
+	user, err := u.userRepo.GetByEmail(ctx, email)
+	if err != nil || !user.IsActive || !u.managesPassword(user) {
+		return nil
+	}
+
+	token, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return err
+	}
+	expire := time.Duration(u.config.PasswordResetExpireMinutes) * time.Minute
+	reset := &entity.PasswordReset{
+		ID:        uuid.New(),
+		UserID:    user.ID,
+		TokenHash: utils.HashToken(token),
+		ExpiresAt: time.Now().Add(expire),
+	}
+	if err := u.userRepo.CreatePasswordReset(ctx, reset); err != nil {
+		return err
+	}
+
+	msg := &mailer.Message{
+		To:      []string{user.Email},
+		Subject: "Reset your password",
+		Body: fmt.Sprintf(
+			"Hello %s,\n\nOpen the link below to choose a new password. It expires in %d minutes and can only be used once.\n\n%s?token=%s\n\nIf you did not ask for a password reset, you can ignore this email.\n",
+			user.FullName, u.config.PasswordResetExpireMinutes, u.config.PasswordResetURL, url.QueryEscape(token),
+		),
+	}
+	if err := u.mailer.Send(ctx, msg); err != nil {
+		log.Printf("Failed to send password reset mail to user %s: %v", user.ID, err)
+	}
+	return nil
+}
+
+// ResetPassword sets a new password from a mailed reset token and signs the
+// user out everywhere.
+func (u *AuthUsecase) ResetPassword(ctx context.Context, token, password string) error {
+	reset, err := u.userRepo.GetPasswordResetByTokenHash(ctx, utils.HashToken(token))
+	if err != nil || reset.UsedAt != nil || time.Now().After(reset.ExpiresAt) {
+		return errors.New("invalid or expired reset token")
+	}
+
+	hashedPassword, err := u.HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	if err := u.userRepo.ResetPassword(ctx, reset.ID, reset.UserID, hashedPassword); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return errors.New("invalid or expired reset token")
+		}
+		return err
+	}
+	return nil
+}
+
+// JWKS returns the public keys that verify access tokens, for other services.
+func (u *AuthUsecase) JWKS() *utils.JWKS {
+	return u.keys.JWKS()
 }
 
 func (u *AuthUsecase) HashPassword(password string) (string, error) {
@@ -180,26 +839,52 @@ func (u *AuthUsecase) HashPassword(password string) (string, error) {
 	return string(bytes), nil
 }
 
-func (u *AuthUsecase) generateToken(userID, roleID uuid.UUID) (string, error) {
-	claims := jwt.MapClaims{
-		"user_id": userID.String(),
-		"role_id": roleID.String(),
-		"exp":     time.Now().Add(time.Duration(u.config.JWTExpireHours) * time.Hour).Unix(),
-		"iat":     time.Now().Unix(),
+func (u *AuthUsecase) generateToken(ctx context.Context, userID, roleID, sessionID uuid.UUID) (string, error) {
+	claims, err := u.accessClaims(ctx, userID, roleID, time.Now().Add(time.Duration(u.config.JWTExpireHours)*time.Hour))
+	if err != nil {
+		return "", err
 	}
+	claims["sid"] = sessionID.String()
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(u.config.JWTSecret))
+	return u.keys.Sign(claims)
 }
 
-func (u *AuthUsecase) generateRefreshToken(userID uuid.UUID) (string, error) {
+// accessClaims returns the claims every access token carries.
+func (u *AuthUsecase) accessClaims(ctx context.Context, userID, roleID uuid.UUID, expiresAt time.Time) (jwt.MapClaims, error) {
 	claims := jwt.MapClaims{
 		"user_id": userID.String(),
-		"exp":     time.Now().Add(time.Duration(u.config.JWTRefreshExpHours) * time.Hour).Unix(),
+		"role_id": roleID.String(),
+		"exp":     expiresAt.Unix(),
 		"iat":     time.Now().Unix(),
-		"type":    "refresh",
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(u.config.JWTSecret))
+	// Embedded permissions spare the permission lookup until the
+	// permission version moves
+	if u.config.JWTEmbedPermissions {
+		access, err := u.userRepo.GetRoleAccess(ctx, roleID)
+		if err != nil {
+			return nil, err
+		}
+		claims["role"] = access.RoleName
+		claims["perms"] = access.Permissions
+		claims["pv"] = access.Version
+	}
+
+	return claims, nil
+}
+
+// newRefreshToken returns an opaque refresh token and the row to store for
+// it, which only keeps its hash.
+func (u *AuthUsecase) newRefreshToken(userID, familyID uuid.UUID) (string, *entity.RefreshToken, error) {
+	token, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return "", nil, err
+	}
+	return token, &entity.RefreshToken{
+		ID:        uuid.New(),
+		UserID:    userID,
+		FamilyID:  familyID,
+		TokenHash: utils.HashToken(token),
+		ExpiresAt: time.Now().Add(time.Duration(u.config.JWTRefreshExpHours) * time.Hour),
+	}, nil
 }
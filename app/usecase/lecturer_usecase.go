@@ -2,6 +2,7 @@ package usecase
 
 import (
 	"context"
+	"errors"
 
 	"github.com/Aryma-f4/uas-backend/app/entity"
 	"github.com/Aryma-f4/uas-backend/app/repository"
@@ -31,3 +32,10 @@ func (u *LecturerUsecase) List(ctx context.Context, limit, offset int) ([]*entit
 func (u *LecturerUsecase) GetAdvisees(ctx context.Context, lecturerID uuid.UUID, limit, offset int) ([]*entity.Student, int, error) {
 	return u.studentRepo.GetByAdvisorID(ctx, lecturerID, limit, offset)
 }
+
+func (u *LecturerUsecase) UpdateDepartment(ctx context.Context, lecturerID, departmentID uuid.UUID) (*entity.Lecturer, error) {
+	if err := u.lecturerRepo.UpdateDepartment(ctx, lecturerID, departmentID); err != nil {
+		return nil, errors.New("lecturer or department not found")
+	}
+	return u.lecturerRepo.GetByID(ctx, lecturerID)
+}
@@ -0,0 +1,349 @@
+package usecase
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/Aryma-f4/uas-backend/app/entity"
+	"github.com/Aryma-f4/uas-backend/utils"
+	"github.com/google/uuid"
+)
+
+// TOTP two-factor authentication of AuthUsecase. A user with MFA enabled, or
+// whose role requires it, gets a challenge from Login instead of tokens and
+// completes the login with VerifyMFAChallenge.
+
+// mfaSkew is the number of 30 second steps of clock drift accepted.
+const mfaSkew = 1
+
+var (
+	ErrInvalidMFAToken   = errors.New("invalid or expired mfa token")
+	ErrInvalidMFACode    = errors.New("invalid code")
+	ErrMFANotStarted     = errors.New("mfa setup has not been started")
+	ErrMFAAlreadyEnabled = errors.New("mfa is already enabled")
+)
+
+// mfaChallenge returns the challenge response for a user who needs a
+// second factor, or nil if the password alone completes the login.
+func (u *AuthUsecase) mfaChallenge(ctx context.Context, user *entity.User, userAgent, ipAddress string) (*entity.LoginResponse, error) {
+	enabled, err := u.mfaEnabled(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	required, err := u.userRepo.IsMFARequired(ctx, user.RoleID)
+	if err != nil {
+		return nil, err
+	}
+	if !enabled && !required {
+		return nil, nil
+	}
+
+	token, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	challenge := &entity.MFAChallenge{
+		ID:            uuid.New(),
+		UserID:        user.ID,
+		TokenHash:     utils.HashToken(token),
+		UserAgent:     userAgent,
+		IPAddress:     ipAddress,
+		SetupRequired: !enabled,
+		ExpiresAt:     time.Now().Add(entity.MFAChallengeTTL),
+	}
+	if err := u.securityRepo.CreateMFAChallenge(ctx, challenge); err != nil {
+		return nil, err
+	}
+
+	return &entity.LoginResponse{
+		MFARequired:      true,
+		MFASetupRequired: challenge.SetupRequired,
+		MFAToken:         token,
+	}, nil
+}
+
+// SetupMFAChallenge starts the enrollment of a user whose role requires MFA
+// from the challenge of their first login.
+func (u *AuthUsecase) SetupMFAChallenge(ctx context.Context, mfaToken string) (*entity.MFAEnrollment, error) {
+	challenge, err := u.loadMFAChallenge(ctx, mfaToken)
+	if err != nil {
+		return nil, err
+	}
+	if !challenge.SetupRequired {
+		return nil, ErrMFAAlreadyEnabled
+	}
+	return u.BeginMFAEnrollment(ctx, challenge.UserID)
+}
+
+// VerifyMFAChallenge completes a login with a TOTP or recovery code. For a
+// challenge that required setup, the code confirms the new enrollment and
+// the response carries the recovery codes.
+func (u *AuthUsecase) VerifyMFAChallenge(ctx context.Context, mfaToken, code string) (*entity.LoginResponse, error) {
+	challenge, err := u.loadMFAChallenge(ctx, mfaToken)
+	if err != nil {
+		return nil, err
+	}
+	attempts, err := u.securityRepo.RecordMFAChallengeAttempt(ctx, challenge.ID)
+	if err != nil {
+		return nil, err
+	}
+	if attempts > entity.MFAChallengeMaxAttempts {
+		return nil, ErrInvalidMFAToken
+	}
+
+	user, err := u.userRepo.GetByID(ctx, challenge.UserID)
+	if err != nil || !user.IsActive {
+		return nil, ErrInvalidMFAToken
+	}
+	mfa, err := u.securityRepo.GetMFA(ctx, user.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrMFANotStarted
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var recoveryCodes []string
+	if mfa.EnabledAt == nil {
+		if !challenge.SetupRequired {
+			return nil, ErrInvalidMFAToken
+		}
+		if recoveryCodes, err = u.enableMFA(ctx, mfa, code, challenge.IPAddress); err != nil {
+			return nil, err
+		}
+	} else if err := u.verifySecondFactor(ctx, mfa, code, challenge.IPAddress); err != nil {
+		return nil, err
+	}
+
+	if err := u.securityRepo.CompleteMFAChallenge(ctx, challenge.ID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrInvalidMFAToken
+		}
+		return nil, err
+	}
+
+	response, err := u.startSession(ctx, user, challenge.UserAgent, challenge.IPAddress)
+	if err != nil {
+		return nil, err
+	}
+	response.RecoveryCodes = recoveryCodes
+	return response, nil
+}
+
+func (u *AuthUsecase) GetMFAStatus(ctx context.Context, userID uuid.UUID) (*entity.MFAStatus, error) {
+	user, err := u.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, errors.New("user not found")
+	}
+
+	status := &entity.MFAStatus{}
+	if status.Enabled, err = u.mfaEnabled(ctx, userID); err != nil {
+		return nil, err
+	}
+	if status.Required, err = u.userRepo.IsMFARequired(ctx, user.RoleID); err != nil {
+		return nil, err
+	}
+	if status.Enabled {
+		if status.RecoveryCodesRemaining, err = u.securityRepo.CountRecoveryCodes(ctx, userID); err != nil {
+			return nil, err
+		}
+	}
+	return status, nil
+}
+
+// BeginMFAEnrollment creates a pending TOTP secret for the user. MFA is
+// only enabled once ConfirmMFAEnrollment or a setup challenge receives a
+// code generated from it.
+func (u *AuthUsecase) BeginMFAEnrollment(ctx context.Context, userID uuid.UUID) (*entity.MFAEnrollment, error) {
+	user, err := u.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, errors.New("user not found")
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	if err := u.securityRepo.SaveMFASecret(ctx, userID, secret); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrMFAAlreadyEnabled
+		}
+		return nil, err
+	}
+
+	return &entity.MFAEnrollment{
+		Secret:          secret,
+		ProvisioningURI: utils.TOTPProvisioningURI(secret, u.config.MFAIssuer, user.Email),
+	}, nil
+}
+
+// ConfirmMFAEnrollment enables the pending secret of the user and returns
+// the recovery codes, which are only shown this once.
+func (u *AuthUsecase) ConfirmMFAEnrollment(ctx context.Context, userID uuid.UUID, code, ipAddress string) ([]string, error) {
+	mfa, err := u.securityRepo.GetMFA(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrMFANotStarted
+	}
+	if err != nil {
+		return nil, err
+	}
+	if mfa.EnabledAt != nil {
+		return nil, ErrMFAAlreadyEnabled
+	}
+	return u.enableMFA(ctx, mfa, code, ipAddress)
+}
+
+// DisableMFA turns MFA off after checking the password and a code. Users
+// whose role requires MFA cannot turn it off.
+func (u *AuthUsecase) DisableMFA(ctx context.Context, userID uuid.UUID, req *entity.DisableMFARequest, ipAddress string) error {
+	user, err := u.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return errors.New("user not found")
+	}
+	required, err := u.userRepo.IsMFARequired(ctx, user.RoleID)
+	if err != nil {
+		return err
+	}
+	if required {
+		return errors.New("mfa is required for your role")
+	}
+	if err := u.verifyPassword(ctx, user, req.Password); err != nil {
+		return err
+	}
+
+	mfa, err := u.enabledMFA(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if err := u.verifySecondFactor(ctx, mfa, req.Code, ipAddress); err != nil {
+		return err
+	}
+
+	if err := u.securityRepo.DisableMFA(ctx, userID); err != nil {
+		return err
+	}
+	u.recordSecurityEvent(ctx, &userID, entity.SecurityEventMFADisabled, ipAddress, "")
+	return nil
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes of the user after
+// checking a TOTP code.
+func (u *AuthUsecase) RegenerateRecoveryCodes(ctx context.Context, userID uuid.UUID, code, ipAddress string) ([]string, error) {
+	mfa, err := u.enabledMFA(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := u.verifyTOTP(ctx, mfa, code); err != nil {
+		return nil, err
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := u.securityRepo.ReplaceRecoveryCodes(ctx, userID, hashes); err != nil {
+		return nil, err
+	}
+	u.recordSecurityEvent(ctx, &userID, entity.SecurityEventRecoveryCodes, ipAddress, "")
+	return codes, nil
+}
+
+func (u *AuthUsecase) loadMFAChallenge(ctx context.Context, mfaToken string) (*entity.MFAChallenge, error) {
+	challenge, err := u.securityRepo.GetMFAChallengeByHash(ctx, utils.HashToken(mfaToken))
+	if err != nil {
+		return nil, ErrInvalidMFAToken
+	}
+	if challenge.UsedAt != nil || time.Now().After(challenge.ExpiresAt) || challenge.Attempts >= entity.MFAChallengeMaxAttempts {
+		return nil, ErrInvalidMFAToken
+	}
+	return challenge, nil
+}
+
+func (u *AuthUsecase) mfaEnabled(ctx context.Context, userID uuid.UUID) (bool, error) {
+	mfa, err := u.securityRepo.GetMFA(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return mfa.EnabledAt != nil, nil
+}
+
+func (u *AuthUsecase) enabledMFA(ctx context.Context, userID uuid.UUID) (*entity.UserMFA, error) {
+	mfa, err := u.securityRepo.GetMFA(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && mfa.EnabledAt == nil) {
+		return nil, errors.New("mfa is not enabled")
+	}
+	return mfa, err
+}
+
+// enableMFA checks code against the pending secret and enables it with a
+// fresh set of recovery codes.
+func (u *AuthUsecase) enableMFA(ctx context.Context, mfa *entity.UserMFA, code, ipAddress string) ([]string, error) {
+	step, ok := utils.ValidateTOTP(mfa.Secret, code, time.Now(), mfaSkew)
+	if !ok {
+		return nil, ErrInvalidMFACode
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := u.securityRepo.EnableMFA(ctx, mfa.UserID, step, hashes); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrMFAAlreadyEnabled
+		}
+		return nil, err
+	}
+	u.recordSecurityEvent(ctx, &mfa.UserID, entity.SecurityEventMFAEnabled, ipAddress, "")
+	return codes, nil
+}
+
+// verifySecondFactor accepts a TOTP code or an unused recovery code.
+func (u *AuthUsecase) verifySecondFactor(ctx context.Context, mfa *entity.UserMFA, code, ipAddress string) error {
+	if len(code) == utils.TOTPDigits {
+		return u.verifyTOTP(ctx, mfa, code)
+	}
+
+	err := u.securityRepo.UseRecoveryCode(ctx, mfa.UserID, utils.HashToken(utils.NormalizeRecoveryCode(code)))
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrInvalidMFACode
+	}
+	if err != nil {
+		return err
+	}
+	u.recordSecurityEvent(ctx, &mfa.UserID, entity.SecurityEventRecoveryCodeUse, ipAddress, "")
+	return nil
+}
+
+// verifyTOTP accepts each time step at most once, so an observed code
+// cannot be replayed.
+func (u *AuthUsecase) verifyTOTP(ctx context.Context, mfa *entity.UserMFA, code string) error {
+	step, ok := utils.ValidateTOTP(mfa.Secret, code, time.Now(), mfaSkew)
+	if !ok {
+		return ErrInvalidMFACode
+	}
+	err := u.securityRepo.UseTOTPStep(ctx, mfa.UserID, step)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrInvalidMFACode
+	}
+	return err
+}
+
+// generateRecoveryCodes returns new recovery codes and their hashes.
+func generateRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, entity.MFARecoveryCodeCount)
+	hashes := make([]string, entity.MFARecoveryCodeCount)
+	for i := range codes {
+		code, err := utils.GenerateRecoveryCode()
+		if err != nil {
+			return nil, nil, err
+		}
+		codes[i] = code
+		hashes[i] = utils.HashToken(utils.NormalizeRecoveryCode(code))
+	}
+	return codes, hashes, nil
+}
@@ -0,0 +1,243 @@
+package usecase
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/Aryma-f4/uas-backend/app/entity"
+	"github.com/Aryma-f4/uas-backend/app/oidc"
+	"github.com/Aryma-f4/uas-backend/app/repository"
+	"github.com/Aryma-f4/uas-backend/config"
+	"github.com/Aryma-f4/uas-backend/utils"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrInvalidLoginState    = errors.New("invalid or expired login state")
+	ErrSingleSignOnFailed   = errors.New("single sign-on failed")
+	ErrIdentityLinked       = errors.New("identity is linked to another account")
+	ErrNoMatchingAccount    = errors.New("no account matches this identity")
+	ErrIdentityWithoutEmail = errors.New("identity provider did not supply an email address")
+	ErrStudentClaimTooLong  = errors.New("student number claim is too long")
+)
+
+// OIDCUsecase logs users in through an OpenID Connect identity provider
+// with the authorization code flow and PKCE.
+type OIDCUsecase struct {
+	provider     *oidc.Provider
+	userRepo     *repository.UserRepository
+	studentRepo  *repository.StudentRepository
+	securityRepo *repository.SecurityRepository
+	authUsecase  *AuthUsecase
+	cfg          *config.Config
+}
+
+// NewOIDCUsecase returns the single sign-on usecase; a nil provider leaves
+// single sign-on disabled.
+func NewOIDCUsecase(
+	provider *oidc.Provider,
+	userRepo *repository.UserRepository,
+	studentRepo *repository.StudentRepository,
+	securityRepo *repository.SecurityRepository,
+	authUsecase *AuthUsecase,
+	cfg *config.Config,
+) *OIDCUsecase {
+	return &OIDCUsecase{
+		provider:     provider,
+		userRepo:     userRepo,
+		studentRepo:  studentRepo,
+		securityRepo: securityRepo,
+		authUsecase:  authUsecase,
+		cfg:          cfg,
+	}
+}
+
+func (u *OIDCUsecase) Enabled() bool {
+	return u.provider != nil
+}
+
+// LoginURL starts a login and returns the identity provider URL to send the
+// browser to. The state, nonce and PKCE verifier stay on the server.
+func (u *OIDCUsecase) LoginURL(ctx context.Context) (string, error) {
+	state, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return "", err
+	}
+	nonce, err := utils.GenerateRandomToken(16)
+	if err != nil {
+		return "", err
+	}
+	verifier, challenge, err := oidc.GeneratePKCE()
+	if err != nil {
+		return "", err
+	}
+
+	stored := &entity.OIDCState{
+		ID:           uuid.New(),
+		StateHash:    utils.HashToken(state),
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		ExpiresAt:    time.Now().Add(entity.OIDCStateTTL),
+	}
+	if err := u.securityRepo.CreateOIDCState(ctx, stored); err != nil {
+		return "", err
+	}
+
+	return u.provider.AuthCodeURL(ctx, state, nonce, challenge)
+}
+
+// Callback redeems the authorization code of a login started by LoginURL
+// and logs the matching user in.
+func (u *OIDCUsecase) Callback(ctx context.Context, code, state, userAgent, ipAddress string) (*entity.LoginResponse, error) {
+	stored, err := u.securityRepo.ConsumeOIDCState(ctx, utils.HashToken(state))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvalidLoginState
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	claims, err := u.provider.Exchange(ctx, code, stored.CodeVerifier, stored.Nonce)
+	if err != nil {
+		log.Printf("Single sign-on failed: %v", err)
+		return nil, ErrSingleSignOnFailed
+	}
+
+	user, linked, err := u.resolveUser(ctx, claims, ipAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	identity := &entity.UserIdentity{
+		ID:      uuid.New(),
+		UserID:  user.ID,
+		Issuer:  claims.Issuer,
+		Subject: claims.Subject,
+		Email:   claims.Email,
+	}
+	if err := u.securityRepo.SaveIdentityLogin(ctx, identity); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrIdentityLinked
+		}
+		return nil, err
+	}
+	if !linked {
+		u.authUsecase.recordSecurityEvent(ctx, &user.ID, entity.SecurityEventIdentityLinked, ipAddress, claims.Issuer+" "+claims.Subject)
+	}
+
+	return u.authUsecase.CompleteLogin(ctx, user, userAgent, ipAddress)
+}
+
+// resolveUser finds the user of an identity: by an earlier link, by the
+// student number claim or by verified email, in that order. Unknown students
+// are provisioned when enabled. linked reports whether the identity was
+// already linked.
+func (u *OIDCUsecase) resolveUser(ctx context.Context, claims *oidc.Claims, ipAddress string) (*entity.User, bool, error) {
+	identity, err := u.securityRepo.GetIdentity(ctx, claims.Issuer, claims.Subject)
+	if err == nil {
+		user, err := u.userRepo.GetByID(ctx, identity.UserID)
+		return user, true, err
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, false, err
+	}
+
+	nim := u.nimClaim(claims)
+	if nim != "" {
+		student, err := u.studentRepo.GetByStudentID(ctx, nim)
+		if err == nil {
+			user, err := u.userRepo.GetByID(ctx, student.UserID)
+			return user, false, err
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return nil, false, err
+		}
+	}
+
+	// Only an address the provider vouches for may claim an account
+	if claims.Email != "" && claims.EmailVerified != nil && *claims.EmailVerified {
+		user, err := u.userRepo.GetByEmail(ctx, claims.Email)
+		if err == nil {
+			return user, false, nil
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return nil, false, err
+		}
+	}
+
+	if u.cfg.OIDCJITProvisioning && nim != "" {
+		user, err := u.provisionStudent(ctx, claims, nim, ipAddress)
+		return user, false, err
+	}
+
+	return nil, false, ErrNoMatchingAccount
+}
+
+// provisionStudent creates a Mahasiswa user and student profile for an
+// identity with a student number. The random password is never handed out;
+// the student signs in through the identity provider or resets it.
+func (u *OIDCUsecase) provisionStudent(ctx context.Context, claims *oidc.Claims, nim, ipAddress string) (*entity.User, error) {
+	if claims.Email == "" {
+		return nil, ErrIdentityWithoutEmail
+	}
+	if len(nim) > 20 {
+		return nil, ErrStudentClaimTooLong
+	}
+
+	role, err := u.userRepo.GetRoleByName(ctx, "Mahasiswa")
+	if err != nil {
+		return nil, err
+	}
+	password, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	hashedPassword, err := u.authUsecase.HashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+
+	fullName := claims.Name
+	if fullName == "" {
+		fullName = nim
+	}
+	user := &entity.User{
+		ID:           uuid.New(),
+		Username:     nim,
+		Email:        claims.Email,
+		PasswordHash: hashedPassword,
+		FullName:     fullName,
+		RoleID:       role.ID,
+		RoleName:     role.Name,
+		IsActive:     true,
+	}
+	student := &entity.Student{
+		ID:        uuid.New(),
+		UserID:    user.ID,
+		StudentID: nim,
+	}
+	if err := u.userRepo.CreateWithProfile(ctx, user, student, nil, nil); err != nil {
+		return nil, fmt.Errorf("provision student %s: %w", nim, err)
+	}
+
+	log.Printf("Provisioned student %s from single sign-on", nim)
+	u.authUsecase.recordSecurityEvent(ctx, &user.ID, entity.SecurityEventUserProvisioned, ipAddress, claims.Issuer+" "+claims.Subject)
+	return user, nil
+}
+
+// nimClaim reads the configured student number claim, which providers
+// send as a string or a number.
+func (u *OIDCUsecase) nimClaim(claims *oidc.Claims) string {
+	switch v := claims.Raw[u.cfg.OIDCNIMClaim].(type) {
+	case string:
+		return strings.TrimSpace(v)
+	case float64:
+		return fmt.Sprintf("%.0f", v)
+	}
+	return ""
+}
@@ -0,0 +1,187 @@
+package usecase
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/Aryma-f4/uas-backend/app/entity"
+	"github.com/Aryma-f4/uas-backend/app/repository"
+	"github.com/google/uuid"
+)
+
+type RoleUsecase struct {
+	roleRepo *repository.RoleRepository
+}
+
+func NewRoleUsecase(roleRepo *repository.RoleRepository) *RoleUsecase {
+	return &RoleUsecase{roleRepo: roleRepo}
+}
+
+func (u *RoleUsecase) List(ctx context.Context) ([]*entity.Role, error) {
+	return u.roleRepo.List(ctx)
+}
+
+func (u *RoleUsecase) Get(ctx context.Context, id uuid.UUID) (*entity.Role, error) {
+	return u.roleRepo.GetByID(ctx, id)
+}
+
+func (u *RoleUsecase) Create(ctx context.Context, req *entity.CreateRoleRequest) (*entity.Role, error) {
+	name, err := validateRoleName(req.Name)
+	if err != nil {
+		return nil, err
+	}
+	if err := u.validatePermissions(ctx, req.Permissions); err != nil {
+		return nil, err
+	}
+
+	role := &entity.Role{
+		ID:          uuid.New(),
+		Name:        name,
+		Description: strings.TrimSpace(req.Description),
+		Permissions: req.Permissions,
+	}
+	if err := u.roleRepo.Create(ctx, role); err != nil {
+		return nil, roleWriteError(err)
+	}
+	return u.roleRepo.GetByID(ctx, role.ID)
+}
+
+// Update renames a role, changes its description or replaces its
+// permissions. Built-in roles keep their names because code refers to them.
+func (u *RoleUsecase) Update(ctx context.Context, id uuid.UUID, req *entity.EditRoleRequest) (*entity.Role, error) {
+	role, err := u.roleRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Name != nil {
+		name, err := validateRoleName(*req.Name)
+		if err != nil {
+			return nil, err
+		}
+		if role.IsBuiltin && name != role.Name {
+			return nil, errors.New("built-in roles cannot be renamed")
+		}
+		role.Name = name
+	}
+	if req.Description != nil {
+		role.Description = strings.TrimSpace(*req.Description)
+	}
+	if req.Permissions != nil {
+		if err := u.validatePermissions(ctx, req.Permissions); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := u.roleRepo.Update(ctx, role, req.Permissions); err != nil {
+		return nil, roleWriteError(err)
+	}
+	return u.roleRepo.GetByID(ctx, id)
+}
+
+func (u *RoleUsecase) Delete(ctx context.Context, id uuid.UUID) error {
+	role, err := u.roleRepo.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if role.IsBuiltin {
+		return errors.New("built-in roles cannot be deleted")
+	}
+	return roleWriteError(u.roleRepo.Delete(ctx, id))
+}
+
+func (u *RoleUsecase) GrantPermissions(ctx context.Context, id uuid.UUID, permissions []string) (*entity.Role, error) {
+	if len(permissions) == 0 {
+		return nil, errors.New("permissions are required")
+	}
+	if _, err := u.roleRepo.GetByID(ctx, id); err != nil {
+		return nil, err
+	}
+	if err := u.validatePermissions(ctx, permissions); err != nil {
+		return nil, err
+	}
+
+	if err := u.roleRepo.GrantPermissions(ctx, id, permissions); err != nil {
+		return nil, err
+	}
+	return u.roleRepo.GetByID(ctx, id)
+}
+
+func (u *RoleUsecase) RevokePermission(ctx context.Context, id uuid.UUID, permission string) (*entity.Role, error) {
+	if _, err := u.roleRepo.GetByID(ctx, id); err != nil {
+		return nil, err
+	}
+	if err := u.roleRepo.RevokePermission(ctx, id, permission); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errors.New("role does not have permission " + permission)
+		}
+		return nil, err
+	}
+	return u.roleRepo.GetByID(ctx, id)
+}
+
+func (u *RoleUsecase) ListPermissions(ctx context.Context) ([]*entity.Permission, error) {
+	return u.roleRepo.ListPermissions(ctx)
+}
+
+// SyncPermissions adds the known permissions and the ones referenced by
+// routes that the database is missing, so permissions introduced by an
+// upgrade reach existing deployments. It returns the names it added.
+func (u *RoleUsecase) SyncPermissions(ctx context.Context, known []entity.Permission, referenced []string) ([]string, error) {
+	permissions := append([]entity.Permission{}, known...)
+	seen := make(map[string]bool)
+	for _, permission := range known {
+		seen[permission.Name] = true
+	}
+	for _, name := range referenced {
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		resource, action, _ := strings.Cut(name, ":")
+		permissions = append(permissions, entity.Permission{Name: name, Resource: resource, Action: action})
+	}
+
+	return u.roleRepo.SyncPermissions(ctx, permissions)
+}
+
+func (u *RoleUsecase) validatePermissions(ctx context.Context, permissions []string) error {
+	if len(permissions) == 0 {
+		return nil
+	}
+	unknown, err := u.roleRepo.UnknownPermissions(ctx, permissions)
+	if err != nil {
+		return err
+	}
+	if len(unknown) > 0 {
+		return errors.New("unknown permissions: " + strings.Join(unknown, ", "))
+	}
+	return nil
+}
+
+func validateRoleName(name string) (string, error) {
+	name = strings.Join(strings.Fields(name), " ")
+	switch {
+	case name == "":
+		return "", errors.New("name is required")
+	case len(name) > 50:
+		return "", errors.New("name must be at most 50 characters")
+	case strings.EqualFold(name, entity.RoleServiceAccount):
+		return "", errors.New("name is reserved for service accounts")
+	}
+	return name, nil
+}
+
+func roleWriteError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case strings.Contains(err.Error(), "duplicate key"):
+		return errors.New("a role with this name already exists")
+	case strings.Contains(err.Error(), "foreign key"):
+		return errors.New("role is still assigned to users")
+	}
+	return err
+}
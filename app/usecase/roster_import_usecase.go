@@ -0,0 +1,243 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Aryma-f4/uas-backend/app/entity"
+	"github.com/Aryma-f4/uas-backend/app/repository"
+	"github.com/Aryma-f4/uas-backend/config"
+	"github.com/Aryma-f4/uas-backend/utils"
+	"github.com/google/uuid"
+)
+
+const (
+	rosterRoleStudent  = "student"
+	rosterRoleLecturer = "lecturer"
+
+	initialPasswordLength = 12
+
+	// Invited users cannot log in with a password until they accept the
+	// invitation; bcrypt never matches this value.
+	unusablePasswordHash = "!"
+)
+
+type RosterImportUsecase struct {
+	userRepo     *repository.UserRepository
+	lecturerRepo *repository.LecturerRepository
+	unitRepo     *repository.AcademicUnitRepository
+	authUsecase  *AuthUsecase
+	config       *config.Config
+}
+
+func NewRosterImportUsecase(
+	userRepo *repository.UserRepository,
+	lecturerRepo *repository.LecturerRepository,
+	unitRepo *repository.AcademicUnitRepository,
+	authUsecase *AuthUsecase,
+	cfg *config.Config,
+) *RosterImportUsecase {
+	return &RosterImportUsecase{
+		userRepo:     userRepo,
+		lecturerRepo: lecturerRepo,
+		unitRepo:     unitRepo,
+		authUsecase:  authUsecase,
+		config:       cfg,
+	}
+}
+
+// Import creates one user with its student or lecturer profile per row, each
+// row in its own transaction so a bad row does not abort the whole roster.
+// Lecturer rows are processed first so students in the same file can name
+// them as advisor.
+func (u *RosterImportUsecase) Import(ctx context.Context, records [][]string, defaultRole, credentials string) (*entity.RosterImportResult, error) {
+	if credentials != entity.RosterCredentialPassword && credentials != entity.RosterCredentialInvitation {
+		return nil, errors.New("credentials must be password or invitation")
+	}
+	if len(records) < 2 {
+		return nil, errors.New("file has no data rows")
+	}
+
+	index := utils.HeaderIndex(records[0])
+	for _, column := range []string{"username", "email", "full_name"} {
+		if _, ok := index[column]; !ok {
+			return nil, errors.New("missing required column: " + column)
+		}
+	}
+
+	studentRole, err := u.userRepo.GetRoleByName(ctx, "Mahasiswa")
+	if err != nil {
+		return nil, errors.New("role Mahasiswa not found")
+	}
+	lecturerRole, err := u.userRepo.GetRoleByName(ctx, "Dosen Wali")
+	if err != nil {
+		return nil, errors.New("role Dosen Wali not found")
+	}
+
+	type rosterRow struct {
+		number int
+		role   string
+		record []string
+	}
+	var rows []rosterRow
+	for i, record := range records[1:] {
+		if isBlankRecord(record) {
+			continue
+		}
+		role := normalizeRosterRole(utils.CellValue(record, index, "role"))
+		if role == "" {
+			role = normalizeRosterRole(defaultRole)
+		}
+		rows = append(rows, rosterRow{number: i + 2, role: role, record: record})
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		return rows[i].role == rosterRoleLecturer && rows[j].role != rosterRoleLecturer
+	})
+
+	result := &entity.RosterImportResult{TotalRows: len(rows)}
+	for _, row := range rows {
+		rowResult := &entity.RosterImportRowResult{
+			Row:      row.number,
+			Role:     row.role,
+			Username: utils.CellValue(row.record, index, "username"),
+			Email:    utils.CellValue(row.record, index, "email"),
+		}
+
+		if err := u.importRow(ctx, row.record, index, rowResult, studentRole.ID, lecturerRole.ID, credentials); err != nil {
+			rowResult.Status = "failed"
+			rowResult.Message = err.Error()
+			result.Failed++
+		} else {
+			rowResult.Status = "created"
+			result.Created++
+		}
+		result.Rows = append(result.Rows, rowResult)
+	}
+
+	sort.Slice(result.Rows, func(i, j int) bool { return result.Rows[i].Row < result.Rows[j].Row })
+
+	// Link imported programs and departments to their academic units
+	if result.Created > 0 {
+		if _, err := u.unitRepo.LinkUnmatched(ctx); err != nil {
+			log.Printf("Failed to link academic units after roster import: %v", err)
+		}
+	}
+
+	return result, nil
+}
+
+func (u *RosterImportUsecase) importRow(ctx context.Context, record []string, index map[string]int, result *entity.RosterImportRowResult, studentRoleID, lecturerRoleID uuid.UUID, credentials string) error {
+	fullName := utils.CellValue(record, index, "full_name")
+
+	if !utils.ValidateUsername(result.Username) {
+		return errors.New("invalid username")
+	}
+	if !utils.ValidateEmail(result.Email) {
+		return errors.New("invalid email format")
+	}
+	if fullName == "" {
+		return errors.New("full name is required")
+	}
+
+	user := &entity.User{
+		ID:       uuid.New(),
+		Username: result.Username,
+		Email:    result.Email,
+		FullName: fullName,
+		IsActive: true,
+	}
+
+	var student *entity.Student
+	var lecturer *entity.Lecturer
+
+	switch result.Role {
+	case rosterRoleStudent:
+		nim := utils.CellValue(record, index, "nim")
+		if nim == "" {
+			return errors.New("NIM is required")
+		}
+		user.RoleID = studentRoleID
+		student = &entity.Student{
+			ID:           uuid.New(),
+			UserID:       user.ID,
+			StudentID:    nim,
+			ProgramStudy: utils.CellValue(record, index, "program_study"),
+			AcademicYear: utils.CellValue(record, index, "academic_year"),
+		}
+		if advisorNIP := utils.CellValue(record, index, "advisor_nip"); advisorNIP != "" {
+			advisor, err := u.lecturerRepo.GetByLecturerID(ctx, advisorNIP)
+			if err != nil {
+				return errors.New("advisor with NIP " + advisorNIP + " not found")
+			}
+			student.AdvisorID = &advisor.ID
+		}
+
+	case rosterRoleLecturer:
+		nip := utils.CellValue(record, index, "nip")
+		if nip == "" {
+			return errors.New("NIP is required")
+		}
+		user.RoleID = lecturerRoleID
+		lecturer = &entity.Lecturer{
+			ID:         uuid.New(),
+			UserID:     user.ID,
+			LecturerID: nip,
+			Department: utils.CellValue(record, index, "department"),
+		}
+
+	default:
+		return errors.New("role must be student or lecturer")
+	}
+
+	var invitation *entity.UserInvitation
+	if credentials == entity.RosterCredentialInvitation {
+		token, err := utils.GenerateRandomToken(32)
+		if err != nil {
+			return err
+		}
+		user.PasswordHash = unusablePasswordHash
+		invitation = &entity.UserInvitation{
+			ID:        uuid.New(),
+			UserID:    user.ID,
+			TokenHash: utils.HashToken(token),
+			ExpiresAt: time.Now().Add(time.Duration(u.config.InvitationExpireHours) * time.Hour),
+		}
+		result.InvitationToken = token
+	} else {
+		password, err := utils.GenerateRandomPassword(initialPasswordLength)
+		if err != nil {
+			return err
+		}
+		hash, err := u.authUsecase.HashPassword(password)
+		if err != nil {
+			return err
+		}
+		user.PasswordHash = hash
+		result.InitialPassword = password
+	}
+
+	if err := u.userRepo.CreateWithProfile(ctx, user, student, lecturer, invitation); err != nil {
+		result.InitialPassword = ""
+		result.InvitationToken = ""
+		if strings.Contains(err.Error(), "duplicate key") {
+			return errors.New("username, email or NIM/NIP already exists")
+		}
+		return err
+	}
+
+	return nil
+}
+
+func normalizeRosterRole(role string) string {
+	switch strings.ToLower(strings.TrimSpace(role)) {
+	case "student", "mahasiswa":
+		return rosterRoleStudent
+	case "lecturer", "dosen", "dosen wali":
+		return rosterRoleLecturer
+	}
+	return ""
+}
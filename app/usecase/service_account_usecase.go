@@ -0,0 +1,309 @@
+package usecase
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/Aryma-f4/uas-backend/app/entity"
+	"github.com/Aryma-f4/uas-backend/app/repository"
+	"github.com/Aryma-f4/uas-backend/utils"
+	"github.com/google/uuid"
+)
+
+// apiKeyPrefixLength is how much of a key is kept in clear to tell keys apart.
+const apiKeyPrefixLength = len(entity.APIKeyPrefix) + 8
+
+// ServiceAccountUsecase manages service accounts and their API keys.
+type ServiceAccountUsecase struct {
+	serviceAccountRepo *repository.ServiceAccountRepository
+	authUsecase        *AuthUsecase
+}
+
+func NewServiceAccountUsecase(serviceAccountRepo *repository.ServiceAccountRepository, authUsecase *AuthUsecase) *ServiceAccountUsecase {
+	return &ServiceAccountUsecase{
+		serviceAccountRepo: serviceAccountRepo,
+		authUsecase:        authUsecase,
+	}
+}
+
+// Create adds a service account and returns its first key.
+func (u *ServiceAccountUsecase) Create(ctx context.Context, req *entity.CreateServiceAccountRequest, adminID uuid.UUID, ipAddress string) (*entity.APIKeyResponse, error) {
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return nil, errors.New("name is required")
+	}
+	if err := u.validatePermissions(ctx, req.Permissions); err != nil {
+		return nil, err
+	}
+	allowedIPs, err := normalizeAllowedIPs(req.AllowedIPs)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateKeyExpiry(req.ExpiresAt); err != nil {
+		return nil, err
+	}
+
+	account := &entity.ServiceAccount{
+		ID:          uuid.New(),
+		Name:        name,
+		Description: req.Description,
+		Permissions: req.Permissions,
+		AllowedIPs:  allowedIPs,
+		IsActive:    true,
+		CreatedBy:   &adminID,
+	}
+	key, stored, err := newAPIKey(account.ID, req.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+	if err := u.serviceAccountRepo.Create(ctx, account, stored); err != nil {
+		if strings.Contains(err.Error(), "duplicate key") {
+			return nil, errors.New("a service account with this name already exists")
+		}
+		return nil, err
+	}
+	u.authUsecase.recordSecurityEvent(ctx, &adminID, entity.SecurityEventAPIKeyCreated, ipAddress, keyDetail(account.Name, stored))
+
+	created, err := u.serviceAccountRepo.GetByID(ctx, account.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &entity.APIKeyResponse{Key: key, APIKey: stored, ServiceAccount: created}, nil
+}
+
+func (u *ServiceAccountUsecase) List(ctx context.Context) ([]*entity.ServiceAccount, error) {
+	return u.serviceAccountRepo.List(ctx)
+}
+
+func (u *ServiceAccountUsecase) Get(ctx context.Context, id uuid.UUID) (*entity.ServiceAccount, error) {
+	return u.serviceAccountRepo.GetByID(ctx, id)
+}
+
+func (u *ServiceAccountUsecase) Update(ctx context.Context, id uuid.UUID, req *entity.UpdateServiceAccountRequest) (*entity.ServiceAccount, error) {
+	account, err := u.serviceAccountRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Description != nil {
+		account.Description = *req.Description
+	}
+	if req.Permissions != nil {
+		if err := u.validatePermissions(ctx, req.Permissions); err != nil {
+			return nil, err
+		}
+		account.Permissions = req.Permissions
+	}
+	if req.AllowedIPs != nil {
+		if account.AllowedIPs, err = normalizeAllowedIPs(req.AllowedIPs); err != nil {
+			return nil, err
+		}
+	}
+	if req.IsActive != nil {
+		account.IsActive = *req.IsActive
+	}
+
+	if err := u.serviceAccountRepo.Update(ctx, account); err != nil {
+		return nil, err
+	}
+	return u.serviceAccountRepo.GetByID(ctx, id)
+}
+
+func (u *ServiceAccountUsecase) Delete(ctx context.Context, id uuid.UUID) error {
+	return u.serviceAccountRepo.Delete(ctx, id)
+}
+
+// CreateKey adds another key to a service account.
+func (u *ServiceAccountUsecase) CreateKey(ctx context.Context, accountID uuid.UUID, req *entity.CreateAPIKeyRequest, adminID uuid.UUID, ipAddress string) (*entity.APIKeyResponse, error) {
+	account, err := u.serviceAccountRepo.GetByID(ctx, accountID)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateKeyExpiry(req.ExpiresAt); err != nil {
+		return nil, err
+	}
+
+	key, stored, err := newAPIKey(accountID, req.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+	if err := u.serviceAccountRepo.CreateAPIKey(ctx, stored); err != nil {
+		return nil, err
+	}
+	u.authUsecase.recordSecurityEvent(ctx, &adminID, entity.SecurityEventAPIKeyCreated, ipAddress, keyDetail(account.Name, stored))
+
+	return &entity.APIKeyResponse{Key: key, APIKey: stored}, nil
+}
+
+// RotateKey replaces a key with a new one, keeping the old key valid for
+// the requested grace period.
+func (u *ServiceAccountUsecase) RotateKey(ctx context.Context, accountID, keyID uuid.UUID, req *entity.RotateAPIKeyRequest, adminID uuid.UUID, ipAddress string) (*entity.APIKeyResponse, error) {
+	account, err := u.serviceAccountRepo.GetByID(ctx, accountID)
+	if err != nil {
+		return nil, err
+	}
+	if req.GraceMinutes < 0 || req.GraceMinutes > 7*24*60 {
+		return nil, errors.New("grace_minutes must be between 0 and 10080")
+	}
+	if err := validateKeyExpiry(req.ExpiresAt); err != nil {
+		return nil, err
+	}
+
+	var graceUntil *time.Time
+	if req.GraceMinutes > 0 {
+		t := time.Now().Add(time.Duration(req.GraceMinutes) * time.Minute)
+		graceUntil = &t
+	}
+	key, stored, err := newAPIKey(accountID, req.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+	if err := u.serviceAccountRepo.RotateAPIKey(ctx, accountID, keyID, graceUntil, stored); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errors.New("api key not found or already revoked")
+		}
+		return nil, err
+	}
+	u.authUsecase.recordSecurityEvent(ctx, &adminID, entity.SecurityEventAPIKeyRotated, ipAddress, keyDetail(account.Name, stored))
+
+	return &entity.APIKeyResponse{Key: key, APIKey: stored}, nil
+}
+
+func (u *ServiceAccountUsecase) RevokeKey(ctx context.Context, accountID, keyID, adminID uuid.UUID, ipAddress string) error {
+	account, err := u.serviceAccountRepo.GetByID(ctx, accountID)
+	if err != nil {
+		return err
+	}
+	if err := u.serviceAccountRepo.RevokeAPIKey(ctx, accountID, keyID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return errors.New("api key not found or already revoked")
+		}
+		return err
+	}
+	u.authUsecase.recordSecurityEvent(ctx, &adminID, entity.SecurityEventAPIKeyRevoked, ipAddress, fmt.Sprintf("%s key %s", account.Name, keyID))
+	return nil
+}
+
+func (u *ServiceAccountUsecase) validatePermissions(ctx context.Context, permissions []string) error {
+	if len(permissions) == 0 {
+		return errors.New("at least one permission is required")
+	}
+	unknown, err := u.serviceAccountRepo.UnknownPermissions(ctx, permissions)
+	if err != nil {
+		return err
+	}
+	if len(unknown) > 0 {
+		return fmt.Errorf("unknown permissions: %s", strings.Join(unknown, ", "))
+	}
+	return nil
+}
+
+// ValidateAPIKey returns the service account of an API key presented from
+// the given address, with the permissions the key grants.
+func (u *AuthUsecase) ValidateAPIKey(ctx context.Context, key, ipAddress string) (*entity.ServiceAccount, error) {
+	if !strings.HasPrefix(key, entity.APIKeyPrefix) {
+		return nil, errors.New("invalid api key")
+	}
+
+	stored, err := u.serviceAccountRepo.GetAPIKeyByHash(ctx, utils.HashToken(key))
+	if err != nil {
+		return nil, errors.New("invalid api key")
+	}
+	if stored.RevokedAt != nil {
+		return nil, errors.New("api key revoked")
+	}
+	if stored.ExpiresAt != nil && time.Now().After(*stored.ExpiresAt) {
+		return nil, errors.New("api key expired")
+	}
+
+	account, err := u.serviceAccountRepo.GetByID(ctx, stored.ServiceAccountID)
+	if err != nil {
+		return nil, err
+	}
+	if !account.IsActive {
+		return nil, errors.New("service account is inactive")
+	}
+	if !ipAllowed(account.AllowedIPs, ipAddress) {
+		return nil, errors.New("address not allowed for this service account")
+	}
+
+	if err := u.serviceAccountRepo.TouchAPIKey(ctx, stored.ID); err != nil {
+		log.Printf("Failed to record use of api key %s: %v", stored.ID, err)
+	}
+	account.Keys = nil
+	return account, nil
+}
+
+func newAPIKey(accountID uuid.UUID, expiresAt *time.Time) (string, *entity.APIKey, error) {
+	secret, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return "", nil, err
+	}
+	key := entity.APIKeyPrefix + secret
+	return key, &entity.APIKey{
+		ID:               uuid.New(),
+		ServiceAccountID: accountID,
+		Prefix:           key[:apiKeyPrefixLength],
+		KeyHash:          utils.HashToken(key),
+		ExpiresAt:        expiresAt,
+		CreatedAt:        time.Now(),
+	}, nil
+}
+
+func validateKeyExpiry(expiresAt *time.Time) error {
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return errors.New("expires_at must be in the future")
+	}
+	return nil
+}
+
+func keyDetail(accountName string, key *entity.APIKey) string {
+	return fmt.Sprintf("%s key %s (%s...)", accountName, key.ID, key.Prefix)
+}
+
+// normalizeAllowedIPs checks that every entry is an address or CIDR range
+// and writes single addresses as ranges.
+func normalizeAllowedIPs(entries []string) ([]string, error) {
+	normalized := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if _, network, err := net.ParseCIDR(entry); err == nil {
+			normalized = append(normalized, network.String())
+			continue
+		}
+		ip := net.ParseIP(entry)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid address or range %q", entry)
+		}
+		bits := 128
+		if ip.To4() != nil {
+			ip, bits = ip.To4(), 32
+		}
+		normalized = append(normalized, (&net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}).String())
+	}
+	return normalized, nil
+}
+
+// ipAllowed reports whether the address is in one of the ranges; an empty
+// list allows every address.
+func ipAllowed(allowed []string, ipAddress string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	ip := net.ParseIP(ipAddress)
+	if ip == nil {
+		return false
+	}
+	for _, entry := range allowed {
+		if _, network, err := net.ParseCIDR(entry); err == nil && network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
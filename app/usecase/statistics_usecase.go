@@ -0,0 +1,367 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/Aryma-f4/uas-backend/app/entity"
+	"github.com/Aryma-f4/uas-backend/app/repository"
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// eventMonthPattern matches event dates stored as ISO strings.
+var eventMonthPattern = regexp.MustCompile(`^\d{4}-\d{2}`)
+
+// StatisticsUsecase maintains the pre-aggregated statistics tables and
+// serves the report statistics from them. Rows are recomputed per student
+// on every status change and rebuilt completely by RunScheduler.
+type StatisticsUsecase struct {
+	achievementRepo *repository.AchievementRepository
+	studentRepo     *repository.StudentRepository
+	unitRepo        *repository.AcademicUnitRepository
+	statsRepo       *repository.StatisticsRepository
+}
+
+func NewStatisticsUsecase(
+	achievementRepo *repository.AchievementRepository,
+	studentRepo *repository.StudentRepository,
+	unitRepo *repository.AcademicUnitRepository,
+	statsRepo *repository.StatisticsRepository,
+) *StatisticsUsecase {
+	return &StatisticsUsecase{
+		achievementRepo: achievementRepo,
+		studentRepo:     studentRepo,
+		unitRepo:        unitRepo,
+		statsRepo:       statsRepo,
+	}
+}
+
+// RefreshStudents recomputes the statistics of the given students.
+func (u *StatisticsUsecase) RefreshStudents(ctx context.Context, studentIDs []uuid.UUID) error {
+	if len(studentIDs) == 0 {
+		return nil
+	}
+
+	snapshot := statisticsSnapshot()
+	builder, err := u.build(ctx, studentIDs)
+	if err != nil {
+		return err
+	}
+	// Students whose last achievement was deleted still need a zero row
+	for _, id := range studentIDs {
+		builder.row(id)
+	}
+
+	return u.statsRepo.SaveStudentStatistics(ctx, builder.rows(), snapshot)
+}
+
+// RefreshAll rebuilds every statistics table from the achievements.
+func (u *StatisticsUsecase) RefreshAll(ctx context.Context) error {
+	snapshot := statisticsSnapshot()
+	builder, err := u.build(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	return u.statsRepo.ReplaceAllStatistics(ctx, builder.rows(), snapshot)
+}
+
+// OnStatusChange keeps the statistics of the given students current after
+// their achievements changed. A failure only delays the figures until the
+// next full refresh, so it is logged rather than returned.
+func (u *StatisticsUsecase) OnStatusChange(ctx context.Context, studentIDs ...uuid.UUID) {
+	if err := u.RefreshStudents(ctx, studentIDs); err != nil {
+		log.Printf("Failed to refresh statistics of %d student(s): %v", len(studentIDs), err)
+	}
+}
+
+// RunScheduler rebuilds the statistics immediately and then every interval
+// until ctx is cancelled. A non-positive interval only runs the first
+// rebuild.
+func (u *StatisticsUsecase) RunScheduler(ctx context.Context, interval time.Duration) {
+	u.refreshAllAndLog(ctx)
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			u.refreshAllAndLog(ctx)
+		}
+	}
+}
+
+func (u *StatisticsUsecase) refreshAllAndLog(ctx context.Context) {
+	start := time.Now()
+	if err := u.RefreshAll(ctx); err != nil {
+		log.Printf("Failed to refresh statistics: %v", err)
+		return
+	}
+	log.Printf("Statistics refreshed in %s", time.Since(start).Round(time.Millisecond))
+}
+
+// build streams the references of the given students (nil means every
+// student) and resolves them against MongoDB in batches.
+func (u *StatisticsUsecase) build(ctx context.Context, studentIDs []uuid.UUID) (*statisticsBuilder, error) {
+	builder := newStatisticsBuilder()
+
+	const batchSize = 500
+	batch := make([]*entity.AchievementReference, 0, batchSize)
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+
+		mongoIDs := make([]primitive.ObjectID, 0, len(batch))
+		for _, ref := range batch {
+			if id, err := primitive.ObjectIDFromHex(ref.MongoAchievementID); err == nil {
+				mongoIDs = append(mongoIDs, id)
+			}
+		}
+
+		docs, err := u.achievementRepo.ListMongoByIDs(ctx, mongoIDs, "")
+		if err != nil {
+			return err
+		}
+		byID := make(map[string]*entity.Achievement, len(docs))
+		for _, doc := range docs {
+			byID[doc.ID.Hex()] = doc
+		}
+
+		for _, ref := range batch {
+			builder.add(ref, byID[ref.MongoAchievementID])
+		}
+
+		batch = batch[:0]
+		return nil
+	}
+
+	err := u.achievementRepo.StreamReferences(ctx, studentIDs, "", func(ref *entity.AchievementReference) error {
+		batch = append(batch, ref)
+		if len(batch) == batchSize {
+			return flush()
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	return builder, nil
+}
+
+// GetStatistics reads the statistics of the given students from the
+// pre-aggregated tables. A nil slice covers every student; an empty slice
+// yields zero counts. Competition levels, top students and the monthly
+// trend count verified achievements only; trendBy buckets the trend by
+// event date (default) or verification date.
+func (u *StatisticsUsecase) GetStatistics(ctx context.Context, studentIDs []uuid.UUID, trendBy string) (*entity.StatisticsResponse, error) {
+	if trendBy == "" {
+		trendBy = entity.TrendByEvent
+	}
+	if trendBy != entity.TrendByEvent && trendBy != entity.TrendByVerified {
+		return nil, errors.New("trend_by must be event or verified")
+	}
+
+	if studentIDs != nil && len(studentIDs) == 0 {
+		return &entity.StatisticsResponse{
+			ByType:             make(map[string]int),
+			ByStatus:           make(map[string]int),
+			ByCompetitionLevel: make(map[string]int),
+			TopStudents:        []entity.TopStudentStats{},
+			MonthlyTrend:       []entity.MonthlyStats{},
+			TrendBy:            trendBy,
+		}, nil
+	}
+
+	stats, err := u.statsRepo.GetSummary(ctx, studentIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	if stats.TopStudents, err = u.statsRepo.GetTopStudents(ctx, studentIDs, entity.TopStudentsLimit); err != nil {
+		return nil, err
+	}
+
+	if stats.MonthlyTrend, err = u.statsRepo.GetMonthlyTrend(ctx, studentIDs, trendBy); err != nil {
+		return nil, err
+	}
+	stats.TrendBy = trendBy
+
+	return stats, nil
+}
+
+// GetAdviseeStatistics aggregates the statistics of every advisee of the
+// lecturer and adds a per-advisee breakdown, sorted by NIM.
+func (u *StatisticsUsecase) GetAdviseeStatistics(ctx context.Context, lecturerID uuid.UUID, trendBy string) (*entity.StatisticsResponse, error) {
+	studentIDs, err := u.studentRepo.ListIDsByAdvisorID(ctx, lecturerID)
+	if err != nil {
+		return nil, err
+	}
+
+	stats, err := u.GetStatistics(ctx, studentIDs, trendBy)
+	if err != nil {
+		return nil, err
+	}
+	stats.Advisees = []*entity.AdviseeStatistics{}
+	if len(studentIDs) == 0 {
+		return stats, nil
+	}
+
+	if stats.Advisees, err = u.statsRepo.ListStudentStatistics(ctx, studentIDs); err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+// GetStatisticsByUnit groups achievement counts by faculty, department or
+// study program, optionally restricted to one branch of the hierarchy.
+func (u *StatisticsUsecase) GetStatisticsByUnit(ctx context.Context, level string, filter *entity.AcademicUnitFilter) (*entity.UnitStatisticsResponse, error) {
+	if level == "" {
+		level = entity.UnitLevelFaculty
+	}
+	units, generatedAt, err := u.statsRepo.GetUnitStatistics(ctx, level, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	unlinked, err := u.unitRepo.CountUnlinkedStudents(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &entity.UnitStatisticsResponse{
+		Level:            level,
+		Filter:           *filter,
+		Units:            units,
+		UnlinkedStudents: unlinked,
+		GeneratedAt:      generatedAt,
+	}, nil
+}
+
+// statisticsSnapshot is taken before reading the achievements and stored as
+// refreshed_at, truncated to the precision of a Postgres timestamp.
+func statisticsSnapshot() time.Time {
+	return time.Now().UTC().Truncate(time.Microsecond)
+}
+
+// statisticsBuilder accumulates per-student statistics from references and
+// their Mongo documents.
+type statisticsBuilder struct {
+	students map[uuid.UUID]*entity.StudentStatistics
+	periods  map[uuid.UUID]map[string]*entity.PeriodStatistics
+}
+
+func newStatisticsBuilder() *statisticsBuilder {
+	return &statisticsBuilder{
+		students: make(map[uuid.UUID]*entity.StudentStatistics),
+		periods:  make(map[uuid.UUID]map[string]*entity.PeriodStatistics),
+	}
+}
+
+func (b *statisticsBuilder) row(studentID uuid.UUID) *entity.StudentStatistics {
+	row, ok := b.students[studentID]
+	if !ok {
+		row = &entity.StudentStatistics{
+			StudentID:          studentID,
+			ByType:             make(map[string]int),
+			ByCompetitionLevel: make(map[string]int),
+		}
+		b.students[studentID] = row
+	}
+	return row
+}
+
+// add counts one reference. doc is nil when the Mongo document is missing,
+// in which case only the status is counted.
+func (b *statisticsBuilder) add(ref *entity.AchievementReference, doc *entity.Achievement) {
+	row := b.row(ref.StudentID)
+	row.TotalAchievements++
+	switch ref.Status {
+	case entity.StatusDraft:
+		row.TotalDraft++
+	case entity.StatusSubmitted:
+		row.TotalPending++
+	case entity.StatusVerified:
+		row.TotalVerified++
+	case entity.StatusRejected:
+		row.TotalRejected++
+	}
+
+	if doc == nil {
+		return
+	}
+	row.ByType[string(doc.AchievementType)]++
+
+	if ref.Status != entity.StatusVerified {
+		return
+	}
+	row.VerifiedPoints += doc.Points
+	if level, _ := doc.Details["competitionLevel"].(string); strings.TrimSpace(level) != "" {
+		row.ByCompetitionLevel[strings.ToLower(strings.TrimSpace(level))]++
+	}
+
+	b.addPeriod(ref.StudentID, entity.TrendByEvent, eventMonth(doc, doc.CreatedAt), doc.Points)
+	if ref.VerifiedAt != nil {
+		b.addPeriod(ref.StudentID, entity.TrendByVerified, ref.VerifiedAt.Format("2006-01"), doc.Points)
+	}
+}
+
+func (b *statisticsBuilder) addPeriod(studentID uuid.UUID, basis, period string, points int) {
+	periods, ok := b.periods[studentID]
+	if !ok {
+		periods = make(map[string]*entity.PeriodStatistics)
+		b.periods[studentID] = periods
+	}
+
+	key := basis + "/" + period
+	p, ok := periods[key]
+	if !ok {
+		p = &entity.PeriodStatistics{Basis: basis, Period: period}
+		periods[key] = p
+	}
+	p.TotalVerified++
+	p.VerifiedPoints += points
+}
+
+func (b *statisticsBuilder) rows() []*entity.StudentStatistics {
+	rows := make([]*entity.StudentStatistics, 0, len(b.students))
+	for id, row := range b.students {
+		for _, p := range b.periods[id] {
+			row.Periods = append(row.Periods, p)
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// eventMonth returns the "YYYY-MM" of details.eventDate, which may be stored
+// as a BSON date or an ISO string, falling back to the month of fallback.
+func eventMonth(doc *entity.Achievement, fallback time.Time) string {
+	switch v := doc.Details["eventDate"].(type) {
+	case primitive.DateTime:
+		return v.Time().UTC().Format("2006-01")
+	case time.Time:
+		return v.UTC().Format("2006-01")
+	case string:
+		if eventMonthPattern.MatchString(v) {
+			return v[:7]
+		}
+	}
+	return fallback.UTC().Format("2006-01")
+}
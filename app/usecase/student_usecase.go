@@ -2,21 +2,30 @@ package usecase
 
 import (
 	"context"
+	"database/sql"
+	"errors"
+	"sort"
+	"strings"
 
 	"github.com/Aryma-f4/uas-backend/app/entity"
 	"github.com/Aryma-f4/uas-backend/app/repository"
+	"github.com/Aryma-f4/uas-backend/config"
 	"github.com/google/uuid"
 )
 
 type StudentUsecase struct {
 	studentRepo  *repository.StudentRepository
 	lecturerRepo *repository.LecturerRepository
+	unitRepo     *repository.AcademicUnitRepository
+	config       *config.Config
 }
 
-func NewStudentUsecase(studentRepo *repository.StudentRepository, lecturerRepo *repository.LecturerRepository) *StudentUsecase {
+func NewStudentUsecase(studentRepo *repository.StudentRepository, lecturerRepo *repository.LecturerRepository, unitRepo *repository.AcademicUnitRepository, cfg *config.Config) *StudentUsecase {
 	return &StudentUsecase{
 		studentRepo:  studentRepo,
 		lecturerRepo: lecturerRepo,
+		unitRepo:     unitRepo,
+		config:       cfg,
 	}
 }
 
@@ -24,20 +33,200 @@ func (u *StudentUsecase) GetByID(ctx context.Context, id uuid.UUID) (*entity.Stu
 	return u.studentRepo.GetByID(ctx, id)
 }
 
-func (u *StudentUsecase) List(ctx context.Context, limit, offset int) ([]*entity.Student, int, error) {
-	return u.studentRepo.List(ctx, limit, offset)
+// List pages through the given students, as scoped by the access policy; a
+// nil studentIDs slice means every student.
+func (u *StudentUsecase) List(ctx context.Context, studentIDs []uuid.UUID, limit, offset int) ([]*entity.Student, int, error) {
+	return u.studentRepo.List(ctx, studentIDs, limit, offset)
 }
 
-func (u *StudentUsecase) UpdateAdvisor(ctx context.Context, studentID, advisorID uuid.UUID) error {
-	
+// UpdateAdvisor assigns a new advisor and records the change in the advisor
+// history. Achievements still waiting for verification move to the new
+// advisor, since only the current advisor may verify or reject them.
+func (u *StudentUsecase) UpdateAdvisor(ctx context.Context, studentID, advisorID, assignedBy uuid.UUID, note string) (*entity.AdvisorChangeResult, error) {
 	_, err := u.lecturerRepo.GetByID(ctx, advisorID)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return u.studentRepo.UpdateAdvisor(ctx, studentID, advisorID)
+	transferred, err := u.studentRepo.UpdateAdvisor(ctx, studentID, advisorID, &assignedBy, note)
+	if err != nil {
+		return nil, err
+	}
+	if transferred < 0 {
+		return &entity.AdvisorChangeResult{Changed: false}, nil
+	}
+
+	return &entity.AdvisorChangeResult{Changed: true, TransferredSubmitted: transferred}, nil
+}
+
+func (u *StudentUsecase) UpdateStudyProgram(ctx context.Context, studentID, programID uuid.UUID) (*entity.Student, error) {
+	if err := u.studentRepo.UpdateStudyProgram(ctx, studentID, programID); err != nil {
+		return nil, errors.New("student or study program not found")
+	}
+	return u.studentRepo.GetByID(ctx, studentID)
+}
+
+func (u *StudentUsecase) GetAdvisorHistory(ctx context.Context, studentID uuid.UUID) ([]*entity.AdvisorHistoryEntry, error) {
+	if _, err := u.studentRepo.GetByID(ctx, studentID); err != nil {
+		return nil, err
+	}
+	return u.studentRepo.GetAdvisorHistory(ctx, studentID)
 }
 
 func (u *StudentUsecase) GetAdvisees(ctx context.Context, lecturerID uuid.UUID, limit, offset int) ([]*entity.Student, int, error) {
 	return u.studentRepo.GetByAdvisorID(ctx, lecturerID, limit, offset)
 }
+
+func (u *StudentUsecase) GetLecturerWorkloads(ctx context.Context) ([]*entity.LecturerWorkload, error) {
+	return u.lecturerRepo.ListWorkloads(ctx)
+}
+
+// PlanAdvisorAssignment proposes an advisor for every student without one.
+// A student linked to a study program is matched to lecturers of that
+// program's department; otherwise the free-text department must equal the
+// student's program study. The student always gets the matching lecturer
+// with the lowest current load below maxLoad. A maxLoad of 0 uses the
+// configured default.
+func (u *StudentUsecase) PlanAdvisorAssignment(ctx context.Context, maxLoad int) (*entity.AdvisorAssignmentPlan, error) {
+	if maxLoad <= 0 {
+		maxLoad = u.config.AdvisorMaxLoad
+	}
+	if maxLoad <= 0 {
+		return nil, errors.New("max load must be positive")
+	}
+
+	students, err := u.studentRepo.ListWithoutAdvisor(ctx)
+	if err != nil {
+		return nil, err
+	}
+	workloads, err := u.lecturerRepo.ListWorkloads(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	programs, err := u.unitRepo.ListStudyPrograms(ctx, &entity.AcademicUnitFilter{})
+	if err != nil {
+		return nil, err
+	}
+	programDepartment := make(map[uuid.UUID]uuid.UUID, len(programs))
+	for _, p := range programs {
+		programDepartment[p.ID] = p.DepartmentID
+	}
+
+	byDepartment := make(map[string][]*entity.LecturerWorkload)
+	byDepartmentID := make(map[uuid.UUID][]*entity.LecturerWorkload)
+	for _, w := range workloads {
+		key := normalizeUnitName(w.Department)
+		byDepartment[key] = append(byDepartment[key], w)
+		if w.DepartmentID != nil {
+			byDepartmentID[*w.DepartmentID] = append(byDepartmentID[*w.DepartmentID], w)
+		}
+	}
+
+	plan := &entity.AdvisorAssignmentPlan{
+		MaxLoad:     maxLoad,
+		Assignments: []entity.AdvisorAssignment{},
+		Unassigned:  []entity.UnassignedStudent{},
+		Workloads:   workloads,
+	}
+
+	for _, student := range students {
+		var candidates []*entity.LecturerWorkload
+		if student.StudyProgramID != nil {
+			if departmentID, ok := programDepartment[*student.StudyProgramID]; ok {
+				candidates = byDepartmentID[departmentID]
+			}
+		} else if student.ProgramStudy != "" {
+			candidates = byDepartment[normalizeUnitName(student.ProgramStudy)]
+		}
+		if len(candidates) == 0 {
+			plan.Unassigned = append(plan.Unassigned, unassignedStudent(student, "no lecturer in a matching department"))
+			continue
+		}
+
+		var chosen *entity.LecturerWorkload
+		for _, c := range candidates {
+			if c.AdviseeCount >= maxLoad {
+				continue
+			}
+			if chosen == nil || c.AdviseeCount < chosen.AdviseeCount ||
+				(c.AdviseeCount == chosen.AdviseeCount && c.NIP < chosen.NIP) {
+				chosen = c
+			}
+		}
+		if chosen == nil {
+			plan.Unassigned = append(plan.Unassigned, unassignedStudent(student, "all matching lecturers are at maximum load"))
+			continue
+		}
+
+		chosen.AdviseeCount++
+		plan.Assignments = append(plan.Assignments, entity.AdvisorAssignment{
+			StudentID:    student.ID,
+			NIM:          student.StudentID,
+			StudentName:  student.FullName,
+			ProgramStudy: student.ProgramStudy,
+			LecturerID:   chosen.LecturerID,
+			LecturerNIP:  chosen.NIP,
+			LecturerName: chosen.FullName,
+		})
+	}
+
+	sort.SliceStable(plan.Workloads, func(i, j int) bool {
+		return plan.Workloads[i].AdviseeCount > plan.Workloads[j].AdviseeCount
+	})
+
+	return plan, nil
+}
+
+// ErrAdvisorPlanStale is returned when the assignments to apply no longer
+// match the plan for current data.
+var ErrAdvisorPlanStale = errors.New("advisor assignment plan is out of date, preview it again")
+
+// ApplyAdvisorAssignment saves the assignments of a previewed plan in one
+// transaction. When they differ from the plan recomputed against current
+// data, nothing is saved and the current plan is returned with
+// ErrAdvisorPlanStale.
+func (u *StudentUsecase) ApplyAdvisorAssignment(ctx context.Context, adminID uuid.UUID, req *entity.ApplyAdvisorAssignmentRequest) (*entity.AdvisorAssignmentPlan, error) {
+	plan, err := u.PlanAdvisorAssignment(ctx, req.MaxLoad)
+	if err != nil {
+		return nil, err
+	}
+
+	previewed := make(map[uuid.UUID]uuid.UUID, len(req.Assignments))
+	for _, a := range req.Assignments {
+		previewed[a.StudentID] = a.LecturerID
+	}
+	if len(previewed) != len(req.Assignments) || len(previewed) != len(plan.Assignments) {
+		return plan, ErrAdvisorPlanStale
+	}
+	for _, a := range plan.Assignments {
+		if lecturerID, ok := previewed[a.StudentID]; !ok || lecturerID != a.LecturerID {
+			return plan, ErrAdvisorPlanStale
+		}
+	}
+
+	if err := u.studentRepo.AssignAdvisors(ctx, plan.Assignments, adminID, "Automatic advisor assignment"); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return plan, ErrAdvisorPlanStale
+		}
+		return nil, err
+	}
+	plan.Applied = true
+
+	return plan, nil
+}
+
+func unassignedStudent(student *entity.Student, reason string) entity.UnassignedStudent {
+	return entity.UnassignedStudent{
+		StudentID:    student.ID,
+		NIM:          student.StudentID,
+		StudentName:  student.FullName,
+		ProgramStudy: student.ProgramStudy,
+		Reason:       reason,
+	}
+}
+
+// normalizeUnitName makes free-text program and department names comparable.
+func normalizeUnitName(name string) string {
+	return strings.Join(strings.Fields(strings.ToLower(name)), " ")
+}
@@ -0,0 +1,231 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/Aryma-f4/uas-backend/app/entity"
+	"github.com/Aryma-f4/uas-backend/app/repository"
+	"github.com/Aryma-f4/uas-backend/utils"
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// timeSeriesUnlinked groups status changes of students without a study program.
+const timeSeriesUnlinked = "unlinked"
+
+type TimeSeriesUsecase struct {
+	achievementRepo *repository.AchievementRepository
+}
+
+func NewTimeSeriesUsecase(achievementRepo *repository.AchievementRepository) *TimeSeriesUsecase {
+	return &TimeSeriesUsecase{achievementRepo: achievementRepo}
+}
+
+// GetTimeSeries buckets the status changes of the given students (nil means
+// every student) by day, week or month, with a zero for every empty bucket.
+// from and to are inclusive dates; by default the range ends today and
+// covers 30 days, 12 weeks or 12 months.
+func (u *TimeSeriesUsecase) GetTimeSeries(ctx context.Context, studentIDs []uuid.UUID, filter *entity.TimeSeriesFilter) (*entity.TimeSeriesResponse, error) {
+	if filter.Metric == "" {
+		filter.Metric = entity.MetricSubmitted
+	}
+	if filter.Granularity == "" {
+		filter.Granularity = entity.GranularityMonth
+	}
+
+	status := filter.Metric
+	switch filter.Metric {
+	case entity.MetricSubmitted, entity.MetricVerified, entity.MetricRejected:
+	case entity.MetricPoints:
+		status = entity.MetricVerified
+	default:
+		return nil, errors.New("metric must be submitted, verified, rejected or points")
+	}
+
+	switch filter.Granularity {
+	case entity.GranularityDay, entity.GranularityWeek, entity.GranularityMonth:
+	default:
+		return nil, errors.New("granularity must be day, week or month")
+	}
+
+	switch filter.GroupBy {
+	case "", entity.GroupByType, entity.GroupByProgram:
+	default:
+		return nil, errors.New("group_by must be type or program")
+	}
+
+	to := time.Now().UTC().Truncate(24 * time.Hour)
+	if filter.To != "" {
+		t, err := utils.ParseDate(filter.To)
+		if err != nil {
+			return nil, errors.New("to must be YYYY-MM-DD")
+		}
+		to = t
+	}
+
+	var from time.Time
+	switch {
+	case filter.From != "":
+		t, err := utils.ParseDate(filter.From)
+		if err != nil {
+			return nil, errors.New("from must be YYYY-MM-DD")
+		}
+		from = t
+	case filter.Granularity == entity.GranularityDay:
+		from = to.AddDate(0, 0, -29)
+	case filter.Granularity == entity.GranularityWeek:
+		from = truncateBucket(to, entity.GranularityWeek).AddDate(0, 0, -7*11)
+	default:
+		from = truncateBucket(to, entity.GranularityMonth).AddDate(0, -11, 0)
+	}
+	if from.After(to) {
+		return nil, errors.New("from must not be after to")
+	}
+
+	var buckets []time.Time
+	for b := truncateBucket(from, filter.Granularity); !b.After(to); b = nextBucket(b, filter.Granularity) {
+		if len(buckets) == entity.TimeSeriesMaxBuckets {
+			return nil, errors.New("range has too many buckets for this granularity")
+		}
+		buckets = append(buckets, b)
+	}
+	index := make(map[time.Time]int, len(buckets))
+	response := &entity.TimeSeriesResponse{
+		Metric:      filter.Metric,
+		Granularity: filter.Granularity,
+		GroupBy:     filter.GroupBy,
+		From:        from.Format("2006-01-02"),
+		To:          to.Format("2006-01-02"),
+		Buckets:     make([]string, len(buckets)),
+		Series:      []*entity.TimeSeries{},
+	}
+	for i, b := range buckets {
+		index[b] = i
+		response.Buckets[i] = b.Format("2006-01-02")
+	}
+
+	series := make(map[string]*entity.TimeSeries)
+	add := func(key, label string, bucket, value int) {
+		s, ok := series[key]
+		if !ok {
+			s = &entity.TimeSeries{Key: key, Label: label, Values: make([]int, len(buckets))}
+			series[key] = s
+		}
+		s.Values[bucket] += value
+		s.Total += value
+	}
+	if filter.GroupBy == "" {
+		add("all", "All", 0, 0)
+	}
+
+	// Points and type grouping need the Mongo documents
+	needDocs := filter.Metric == entity.MetricPoints || filter.GroupBy == entity.GroupByType
+
+	const batchSize = 500
+	batch := make([]*entity.StatusChange, 0, batchSize)
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+
+		byID := make(map[string]*entity.Achievement)
+		if needDocs {
+			mongoIDs := make([]primitive.ObjectID, 0, len(batch))
+			for _, change := range batch {
+				if id, err := primitive.ObjectIDFromHex(change.MongoAchievementID); err == nil {
+					mongoIDs = append(mongoIDs, id)
+				}
+			}
+			docs, err := u.achievementRepo.ListMongoByIDs(ctx, mongoIDs, "")
+			if err != nil {
+				return err
+			}
+			for _, doc := range docs {
+				byID[doc.ID.Hex()] = doc
+			}
+		}
+
+		for _, change := range batch {
+			bucket := index[truncateBucket(change.ChangedAt, filter.Granularity)]
+			doc := byID[change.MongoAchievementID]
+
+			value := 1
+			if filter.Metric == entity.MetricPoints {
+				value = 0
+				if doc != nil {
+					value = doc.Points
+				}
+			}
+
+			switch filter.GroupBy {
+			case entity.GroupByType:
+				key := "unknown"
+				if doc != nil {
+					key = string(doc.AchievementType)
+				}
+				add(key, key, bucket, value)
+			case entity.GroupByProgram:
+				if change.StudyProgramID == nil {
+					add(timeSeriesUnlinked, "Unlinked", bucket, value)
+				} else {
+					add(change.StudyProgramID.String(), change.StudyProgramName, bucket, value)
+				}
+			default:
+				add("all", "All", bucket, value)
+			}
+		}
+
+		batch = batch[:0]
+		return nil
+	}
+
+	if studentIDs == nil || len(studentIDs) > 0 {
+		err := u.achievementRepo.StreamStatusChanges(ctx, studentIDs, status, from, to.AddDate(0, 0, 1), func(change *entity.StatusChange) error {
+			batch = append(batch, change)
+			if len(batch) == batchSize {
+				return flush()
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err := flush(); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, s := range series {
+		response.Series = append(response.Series, s)
+	}
+	sort.Slice(response.Series, func(i, j int) bool { return response.Series[i].Label < response.Series[j].Label })
+
+	return response, nil
+}
+
+// truncateBucket returns the start of the day, week (Monday) or month of t.
+func truncateBucket(t time.Time, granularity string) time.Time {
+	year, month, day := t.Date()
+	switch granularity {
+	case entity.GranularityWeek:
+		start := time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+		return start.AddDate(0, 0, -((int(start.Weekday()) + 6) % 7))
+	case entity.GranularityMonth:
+		return time.Date(year, month, 1, 0, 0, 0, 0, time.UTC)
+	}
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+func nextBucket(t time.Time, granularity string) time.Time {
+	switch granularity {
+	case entity.GranularityWeek:
+		return t.AddDate(0, 0, 7)
+	case entity.GranularityMonth:
+		return t.AddDate(0, 1, 0)
+	}
+	return t.AddDate(0, 0, 1)
+}
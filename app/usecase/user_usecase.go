@@ -2,6 +2,7 @@ package usecase
 
 import (
 	"context"
+	"log"
 
 	"github.com/Aryma-f4/uas-backend/app/entity"
 	"github.com/Aryma-f4/uas-backend/app/repository"
@@ -12,6 +13,7 @@ type UserUsecase struct {
 	userRepo     *repository.UserRepository
 	studentRepo  *repository.StudentRepository
 	lecturerRepo *repository.LecturerRepository
+	unitRepo     *repository.AcademicUnitRepository
 	authUsecase  *AuthUsecase
 }
 
@@ -19,12 +21,14 @@ func NewUserUsecase(
 	userRepo *repository.UserRepository,
 	studentRepo *repository.StudentRepository,
 	lecturerRepo *repository.LecturerRepository,
+	unitRepo *repository.AcademicUnitRepository,
 	authUsecase *AuthUsecase,
 ) *UserUsecase {
 	return &UserUsecase{
 		userRepo:     userRepo,
 		studentRepo:  studentRepo,
 		lecturerRepo: lecturerRepo,
+		unitRepo:     unitRepo,
 		authUsecase:  authUsecase,
 	}
 }
@@ -82,6 +86,11 @@ func (u *UserUsecase) CreateUser(ctx context.Context, req *entity.CreateUserRequ
 		}
 	}
 
+	// Link the new profile's program or department to its academic unit
+	if _, err := u.unitRepo.LinkUnmatched(ctx); err != nil {
+		log.Printf("Failed to link academic units of user %s: %v", user.ID, err)
+	}
+
 	return user, nil
 }
 
@@ -107,11 +116,27 @@ func (u *UserUsecase) UpdateUser(ctx context.Context, id uuid.UUID, req *entity.
 	if req.IsActive != nil {
 		user.IsActive = *req.IsActive
 	}
+	if req.AuthProvider != nil {
+		user.AuthProvider = *req.AuthProvider
+	}
+	if req.Password != "" && !u.authUsecase.managesPassword(user) {
+		return nil, ErrPasswordManagedByDirectory
+	}
 
 	if err := u.userRepo.Update(ctx, user); err != nil {
 		return nil, err
 	}
 
+	if req.Password != "" {
+		hashedPassword, err := u.authUsecase.HashPassword(req.Password)
+		if err != nil {
+			return nil, err
+		}
+		if err := u.userRepo.UpdatePassword(ctx, id, hashedPassword, uuid.Nil); err != nil {
+			return nil, err
+		}
+	}
+
 	return user, nil
 }
 
@@ -127,6 +152,12 @@ func (u *UserUsecase) UpdateUserRole(ctx context.Context, userID, roleID uuid.UU
 	return u.userRepo.UpdateRole(ctx, userID, roleID)
 }
 
+// SetRoleMFARequired makes the users of a role complete a TOTP challenge, or
+// enroll on their next login, before they get tokens.
+func (u *UserUsecase) SetRoleMFARequired(ctx context.Context, roleID uuid.UUID, required bool) error {
+	return u.userRepo.SetRoleMFARequired(ctx, roleID, required)
+}
+
 func (u *UserUsecase) GetRoles(ctx context.Context) ([]*entity.Role, error) {
 	return u.userRepo.GetRoles(ctx)
 }
@@ -25,11 +25,106 @@ type Config struct {
 	JWTSecret          string
 	JWTExpireHours     int
 	JWTRefreshExpHours int
+
+	// Asymmetric JWT signing. JWTKeysDir holds RSA or Ed25519 keys as
+	// <kid>.pem; JWTSigningKeyID picks the signing key when there are
+	// several private keys. Without JWTKeysDir tokens are signed HS256 with
+	// JWTSecret; JWTAcceptHS256 keeps accepting such tokens after switching.
+	JWTKeysDir      string
+	JWTSigningKeyID string
+	JWTAcceptHS256  bool
+
+	// Role name and permissions in access tokens. Embedded claims are
+	// trusted while their version matches the permission version, which the
+	// permission cache checks at most every PermissionCacheCheckSeconds.
+	JWTEmbedPermissions         bool
+	PermissionCacheCheckSeconds int
+
+	// Lifetime of the access tokens admins get to act as another user
+	ImpersonationMinutes int
+
+	// Login throttling. From LoginBackoffThreshold failures on, an account is
+	// locked for LoginBackoffBaseSeconds doubling with every failure; at
+	// LoginLockoutThreshold it is locked for LoginLockoutMinutes, as is an IP
+	// address at LoginIPMaxFailures. Counts start over after
+	// LoginFailureWindowMinutes without failures.
+	LoginBackoffThreshold     int
+	LoginBackoffBaseSeconds   int
+	LoginLockoutThreshold     int
+	LoginLockoutMinutes       int
+	LoginIPMaxFailures        int
+	LoginFailureWindowMinutes int
+
+	// Issuer shown by authenticator apps for TOTP enrollments
+	MFAIssuer string
+
+	// OpenID Connect single sign-on, enabled by OIDCIssuerURL. Users are
+	// matched by the student number in OIDCNIMClaim or by verified email;
+	// OIDCJITProvisioning creates unknown students from the NIM claim.
+	OIDCIssuerURL       string
+	OIDCClientID        string
+	OIDCClientSecret    string
+	OIDCRedirectURL     string
+	OIDCScopes          string
+	OIDCNIMClaim        string
+	OIDCJITProvisioning bool
+
+	// LDAP authentication, enabled by LDAPURL. Users with auth_provider
+	// "ldap" and logins at one of LDAPDomains are checked against the
+	// directory. LDAPGroupRoles maps groups to roles as
+	// "Role:group dn;Role:group dn".
+	LDAPURL               string
+	LDAPStartTLS          bool
+	LDAPBindDN            string
+	LDAPBindPassword      string
+	LDAPBaseDN            string
+	LDAPUserFilter        string
+	LDAPUsernameAttribute string
+	LDAPGroupAttribute    string
+	LDAPGroupRoles        string
+	LDAPDomains           string
+
+	// User onboarding
+	InvitationExpireHours int
+
+	// Mail; without SMTPHost mails are only logged
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUsername string
+	SMTPPassword string
+	SMTPFrom     string
+
+	// Password reset; the token is appended to PasswordResetURL as ?token=
+	PasswordResetURL           string
+	PasswordResetExpireMinutes int
+
+	// Advisor assignment
+	AdvisorMaxLoad int
+
+	// Full rebuild interval of the statistics tables; 0 only rebuilds at startup
+	StatisticsRefreshMinutes int
 }
 
 func LoadConfig() *Config {
 	jwtExpire, _ := strconv.Atoi(getEnv("JWT_EXPIRE_HOURS", "24"))
 	jwtRefreshExpire, _ := strconv.Atoi(getEnv("JWT_REFRESH_EXPIRE_HOURS", "168"))
+	jwtAcceptHS256, _ := strconv.ParseBool(getEnv("JWT_ACCEPT_HS256", "false"))
+	jwtEmbedPermissions, _ := strconv.ParseBool(getEnv("JWT_EMBED_PERMISSIONS", "false"))
+	permissionCacheCheck, _ := strconv.Atoi(getEnv("PERMISSION_CACHE_CHECK_SECONDS", "5"))
+	impersonationMinutes, _ := strconv.Atoi(getEnv("IMPERSONATION_MINUTES", "15"))
+	invitationExpire, _ := strconv.Atoi(getEnv("INVITATION_EXPIRE_HOURS", "168"))
+	advisorMaxLoad, _ := strconv.Atoi(getEnv("ADVISOR_MAX_LOAD", "40"))
+	statisticsRefresh, _ := strconv.Atoi(getEnv("STATISTICS_REFRESH_MINUTES", "60"))
+	loginBackoffThreshold, _ := strconv.Atoi(getEnv("LOGIN_BACKOFF_THRESHOLD", "3"))
+	loginBackoffBase, _ := strconv.Atoi(getEnv("LOGIN_BACKOFF_BASE_SECONDS", "1"))
+	loginLockoutThreshold, _ := strconv.Atoi(getEnv("LOGIN_LOCKOUT_THRESHOLD", "10"))
+	loginLockoutMinutes, _ := strconv.Atoi(getEnv("LOGIN_LOCKOUT_MINUTES", "15"))
+	loginIPMaxFailures, _ := strconv.Atoi(getEnv("LOGIN_IP_MAX_FAILURES", "50"))
+	loginFailureWindow, _ := strconv.Atoi(getEnv("LOGIN_FAILURE_WINDOW_MINUTES", "15"))
+	smtpPort, _ := strconv.Atoi(getEnv("SMTP_PORT", "587"))
+	passwordResetExpire, _ := strconv.Atoi(getEnv("PASSWORD_RESET_EXPIRE_MINUTES", "30"))
+	oidcJITProvisioning, _ := strconv.ParseBool(getEnv("OIDC_JIT_PROVISIONING", "false"))
+	ldapStartTLS, _ := strconv.ParseBool(getEnv("LDAP_START_TLS", "false"))
 
 	return &Config{
 		Port:               getEnv("PORT", "3000"),
@@ -44,6 +139,55 @@ func LoadConfig() *Config {
 		JWTSecret:          getEnv("JWT_SECRET", "your-secret-key-change-in-production"),
 		JWTExpireHours:     jwtExpire,
 		JWTRefreshExpHours: jwtRefreshExpire,
+		JWTKeysDir:         getEnv("JWT_KEYS_DIR", ""),
+		JWTSigningKeyID:    getEnv("JWT_SIGNING_KID", ""),
+		JWTAcceptHS256:     jwtAcceptHS256,
+
+		JWTEmbedPermissions:         jwtEmbedPermissions,
+		PermissionCacheCheckSeconds: permissionCacheCheck,
+		ImpersonationMinutes:        impersonationMinutes,
+
+		LoginBackoffThreshold:     loginBackoffThreshold,
+		LoginBackoffBaseSeconds:   loginBackoffBase,
+		LoginLockoutThreshold:     loginLockoutThreshold,
+		LoginLockoutMinutes:       loginLockoutMinutes,
+		LoginIPMaxFailures:        loginIPMaxFailures,
+		LoginFailureWindowMinutes: loginFailureWindow,
+
+		MFAIssuer: getEnv("MFA_ISSUER", "UAS Achievement"),
+
+		OIDCIssuerURL:       getEnv("OIDC_ISSUER_URL", ""),
+		OIDCClientID:        getEnv("OIDC_CLIENT_ID", ""),
+		OIDCClientSecret:    getEnv("OIDC_CLIENT_SECRET", ""),
+		OIDCRedirectURL:     getEnv("OIDC_REDIRECT_URL", "http://localhost:3000/api/v1/auth/oidc/callback"),
+		OIDCScopes:          getEnv("OIDC_SCOPES", "openid email profile"),
+		OIDCNIMClaim:        getEnv("OIDC_NIM_CLAIM", "nim"),
+		OIDCJITProvisioning: oidcJITProvisioning,
+
+		LDAPURL:               getEnv("LDAP_URL", ""),
+		LDAPStartTLS:          ldapStartTLS,
+		LDAPBindDN:            getEnv("LDAP_BIND_DN", ""),
+		LDAPBindPassword:      getEnv("LDAP_BIND_PASSWORD", ""),
+		LDAPBaseDN:            getEnv("LDAP_BASE_DN", ""),
+		LDAPUserFilter:        getEnv("LDAP_USER_FILTER", "(|(uid=%[1]s)(mail=%[1]s))"),
+		LDAPUsernameAttribute: getEnv("LDAP_USERNAME_ATTRIBUTE", "uid"),
+		LDAPGroupAttribute:    getEnv("LDAP_GROUP_ATTRIBUTE", "memberOf"),
+		LDAPGroupRoles:        getEnv("LDAP_GROUP_ROLES", ""),
+		LDAPDomains:           getEnv("LDAP_DOMAINS", ""),
+
+		InvitationExpireHours: invitationExpire,
+		AdvisorMaxLoad:        advisorMaxLoad,
+
+		SMTPHost:     getEnv("SMTP_HOST", ""),
+		SMTPPort:     smtpPort,
+		SMTPUsername: getEnv("SMTP_USERNAME", ""),
+		SMTPPassword: getEnv("SMTP_PASSWORD", ""),
+		SMTPFrom:     getEnv("SMTP_FROM", "no-reply@localhost"),
+
+		PasswordResetURL:           getEnv("PASSWORD_RESET_URL", "http://localhost:3000/reset-password"),
+		PasswordResetExpireMinutes: passwordResetExpire,
+
+		StatisticsRefreshMinutes: statisticsRefresh,
 	}
 }
 
@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"log"
 
+	"github.com/Aryma-f4/uas-backend/app/entity"
 	"github.com/google/uuid"
 	"golang.org/x/crypto/bcrypt"
 )
@@ -106,11 +107,315 @@ func createTables(db *sql.DB) error {
 			created_at TIMESTAMP DEFAULT NOW()
 		)`,
 
+		// Achievement import batches table
+		`CREATE TABLE IF NOT EXISTS achievement_import_batches (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			file_name VARCHAR(255),
+			initial_status VARCHAR(20) NOT NULL,
+			total_rows INT NOT NULL DEFAULT 0,
+			imported_rows INT NOT NULL DEFAULT 0,
+			created_by UUID REFERENCES users(id),
+			rolled_back_at TIMESTAMP,
+			created_at TIMESTAMP DEFAULT NOW()
+		)`,
+		`ALTER TABLE achievement_references ADD COLUMN IF NOT EXISTS import_batch_id UUID REFERENCES achievement_import_batches(id) ON DELETE SET NULL`,
+
+		// User invitations table
+		`CREATE TABLE IF NOT EXISTS user_invitations (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+			token_hash VARCHAR(64) UNIQUE NOT NULL,
+			expires_at TIMESTAMP NOT NULL,
+			accepted_at TIMESTAMP,
+			created_at TIMESTAMP DEFAULT NOW()
+		)`,
+
+		// Password reset tokens table, stored hashed
+		`CREATE TABLE IF NOT EXISTS password_resets (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			token_hash VARCHAR(64) UNIQUE NOT NULL,
+			expires_at TIMESTAMP NOT NULL,
+			used_at TIMESTAMP,
+			created_at TIMESTAMP DEFAULT NOW()
+		)`,
+
+		// Failed login counters per account and IP address
+		`CREATE TABLE IF NOT EXISTS login_throttles (
+			key VARCHAR(320) PRIMARY KEY,
+			failures INTEGER NOT NULL DEFAULT 0,
+			last_failure_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			locked_until TIMESTAMP
+		)`,
+
+		// Security events table, e.g. lockouts and unlocks
+		`CREATE TABLE IF NOT EXISTS security_events (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			user_id UUID REFERENCES users(id) ON DELETE SET NULL,
+			event_type VARCHAR(50) NOT NULL,
+			ip_address VARCHAR(45) NOT NULL DEFAULT '',
+			detail TEXT NOT NULL DEFAULT '',
+			created_at TIMESTAMP DEFAULT NOW()
+		)`,
+
+		// TOTP enrollment per user
+		`CREATE TABLE IF NOT EXISTS user_mfa (
+			user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+			secret VARCHAR(64) NOT NULL,
+			enabled_at TIMESTAMP,
+			last_used_step BIGINT NOT NULL DEFAULT 0,
+			created_at TIMESTAMP DEFAULT NOW()
+		)`,
+
+		// MFA recovery codes, stored hashed
+		`CREATE TABLE IF NOT EXISTS mfa_recovery_codes (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			code_hash VARCHAR(64) NOT NULL,
+			used_at TIMESTAMP,
+			created_at TIMESTAMP DEFAULT NOW(),
+			UNIQUE(user_id, code_hash)
+		)`,
+
+		// Non-human API clients and their keys
+		`CREATE TABLE IF NOT EXISTS service_accounts (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			name VARCHAR(100) UNIQUE NOT NULL,
+			description TEXT NOT NULL DEFAULT '',
+			allowed_ips TEXT[] NOT NULL DEFAULT '{}',
+			is_active BOOLEAN NOT NULL DEFAULT TRUE,
+			created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+			created_at TIMESTAMP DEFAULT NOW(),
+			updated_at TIMESTAMP DEFAULT NOW()
+		)`,
+
+		`CREATE TABLE IF NOT EXISTS service_account_permissions (
+			service_account_id UUID REFERENCES service_accounts(id) ON DELETE CASCADE,
+			permission_id UUID REFERENCES permissions(id) ON DELETE CASCADE,
+			PRIMARY KEY (service_account_id, permission_id)
+		)`,
+
+		`CREATE TABLE IF NOT EXISTS api_keys (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			service_account_id UUID NOT NULL REFERENCES service_accounts(id) ON DELETE CASCADE,
+			prefix VARCHAR(20) NOT NULL,
+			key_hash VARCHAR(64) UNIQUE NOT NULL,
+			expires_at TIMESTAMP,
+			last_used_at TIMESTAMP,
+			revoked_at TIMESTAMP,
+			created_at TIMESTAMP DEFAULT NOW()
+		)`,
+
+		// Pending OpenID Connect logins, consumed by the callback
+		`CREATE TABLE IF NOT EXISTS oidc_states (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			state_hash VARCHAR(64) UNIQUE NOT NULL,
+			nonce VARCHAR(64) NOT NULL,
+			code_verifier VARCHAR(128) NOT NULL,
+			expires_at TIMESTAMP NOT NULL,
+			created_at TIMESTAMP DEFAULT NOW()
+		)`,
+
+		// Identity provider accounts linked to users
+		`CREATE TABLE IF NOT EXISTS user_identities (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			issuer VARCHAR(255) NOT NULL,
+			subject VARCHAR(255) NOT NULL,
+			email VARCHAR(100) NOT NULL DEFAULT '',
+			last_login_at TIMESTAMP,
+			created_at TIMESTAMP DEFAULT NOW(),
+			UNIQUE(issuer, subject)
+		)`,
+
+		// Second login step of MFA users
+		`CREATE TABLE IF NOT EXISTS mfa_challenges (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			token_hash VARCHAR(64) UNIQUE NOT NULL,
+			user_agent TEXT NOT NULL DEFAULT '',
+			ip_address VARCHAR(45) NOT NULL DEFAULT '',
+			setup_required BOOLEAN NOT NULL DEFAULT FALSE,
+			attempts INTEGER NOT NULL DEFAULT 0,
+			expires_at TIMESTAMP NOT NULL,
+			used_at TIMESTAMP,
+			created_at TIMESTAMP DEFAULT NOW()
+		)`,
+
+		// Sessions table, one row per login
+		`CREATE TABLE IF NOT EXISTS sessions (
+			id UUID PRIMARY KEY,
+			user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			user_agent TEXT NOT NULL DEFAULT '',
+			ip_address VARCHAR(45) NOT NULL DEFAULT '',
+			created_at TIMESTAMP DEFAULT NOW(),
+			last_seen_at TIMESTAMP DEFAULT NOW(),
+			expires_at TIMESTAMP NOT NULL,
+			revoked_at TIMESTAMP
+		)`,
+
+		// Refresh tokens table, stored hashed and rotated within a family
+		`CREATE TABLE IF NOT EXISTS refresh_tokens (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			family_id UUID NOT NULL,
+			token_hash VARCHAR(64) UNIQUE NOT NULL,
+			expires_at TIMESTAMP NOT NULL,
+			used_at TIMESTAMP,
+			revoked_at TIMESTAMP,
+			created_at TIMESTAMP DEFAULT NOW()
+		)`,
+
+		// Advisor assignment history table
+		`CREATE TABLE IF NOT EXISTS advisor_assignments (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			student_id UUID REFERENCES students(id) ON DELETE CASCADE,
+			lecturer_id UUID REFERENCES lecturers(id) ON DELETE CASCADE,
+			assigned_by UUID REFERENCES users(id) ON DELETE SET NULL,
+			note TEXT,
+			started_at TIMESTAMP DEFAULT NOW(),
+			ended_at TIMESTAMP
+		)`,
+		// Backfill the current advisor of students assigned before history was kept
+		`INSERT INTO advisor_assignments (student_id, lecturer_id, started_at)
+		 SELECT s.id, s.advisor_id, s.created_at FROM students s
+		 WHERE s.advisor_id IS NOT NULL
+		   AND NOT EXISTS (SELECT 1 FROM advisor_assignments a WHERE a.student_id = s.id)`,
+
+		// Academic unit hierarchy: faculty → department → study program
+		`CREATE TABLE IF NOT EXISTS faculties (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			code VARCHAR(20) UNIQUE NOT NULL,
+			name VARCHAR(100) NOT NULL,
+			created_at TIMESTAMP DEFAULT NOW()
+		)`,
+		`CREATE TABLE IF NOT EXISTS departments (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			faculty_id UUID NOT NULL REFERENCES faculties(id),
+			code VARCHAR(20) UNIQUE NOT NULL,
+			name VARCHAR(100) NOT NULL,
+			aliases TEXT[] NOT NULL DEFAULT '{}',
+			created_at TIMESTAMP DEFAULT NOW()
+		)`,
+		`CREATE TABLE IF NOT EXISTS study_programs (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			department_id UUID NOT NULL REFERENCES departments(id),
+			code VARCHAR(20) UNIQUE NOT NULL,
+			name VARCHAR(100) NOT NULL,
+			degree VARCHAR(10),
+			aliases TEXT[] NOT NULL DEFAULT '{}',
+			created_at TIMESTAMP DEFAULT NOW()
+		)`,
+		`ALTER TABLE students ADD COLUMN IF NOT EXISTS study_program_id UUID REFERENCES study_programs(id)`,
+		`ALTER TABLE lecturers ADD COLUMN IF NOT EXISTS department_id UUID REFERENCES departments(id)`,
+
+		// Students may hide themselves from public leaderboards
+		`ALTER TABLE students ADD COLUMN IF NOT EXISTS hide_from_leaderboard BOOLEAN NOT NULL DEFAULT false`,
+
+		// Roles whose users must log in with a second factor
+		`ALTER TABLE roles ADD COLUMN IF NOT EXISTS mfa_required BOOLEAN NOT NULL DEFAULT false`,
+
+		// Built-in roles are referred to by name in code
+		`ALTER TABLE roles ADD COLUMN IF NOT EXISTS is_builtin BOOLEAN NOT NULL DEFAULT false`,
+		`UPDATE roles SET is_builtin = true WHERE name IN ('Admin', 'Mahasiswa', 'Dosen Wali') AND NOT is_builtin`,
+
+		// Authentication provider of a user; NULL picks it by login domain
+		`ALTER TABLE users ADD COLUMN IF NOT EXISTS auth_provider VARCHAR(50)`,
+
+		// Admin who made a status change while impersonating changed_by;
+		// deleting the admin keeps the history
+		`ALTER TABLE achievement_status_history ADD COLUMN IF NOT EXISTS impersonated_by UUID REFERENCES users(id) ON DELETE SET NULL`,
+
+		// Admin acting as the user of an impersonation session
+		`ALTER TABLE sessions ADD COLUMN IF NOT EXISTS impersonated_by UUID REFERENCES users(id) ON DELETE CASCADE`,
+
+		// Permission version, bumped by every row changed in roles,
+		// permissions or role_permissions so permission caches and tokens with
+		// embedded permissions notice it. Postgres only fires TRUNCATE
+		// triggers per statement, so those get their own trigger.
+		`CREATE TABLE IF NOT EXISTS permission_version (
+			id BOOLEAN PRIMARY KEY DEFAULT TRUE CHECK (id),
+			version BIGINT NOT NULL DEFAULT 1
+		)`,
+		`INSERT INTO permission_version (id) VALUES (TRUE) ON CONFLICT DO NOTHING`,
+		`CREATE OR REPLACE FUNCTION bump_permission_version() RETURNS TRIGGER AS $$
+		BEGIN
+			UPDATE permission_version SET version = version + 1;
+			RETURN NULL;
+		END
+		$$ LANGUAGE plpgsql`,
+		`DROP TRIGGER IF EXISTS permission_version_bump ON roles`,
+		`CREATE TRIGGER permission_version_bump AFTER INSERT OR UPDATE OR DELETE ON roles
+			FOR EACH ROW EXECUTE PROCEDURE bump_permission_version()`,
+		`DROP TRIGGER IF EXISTS permission_version_bump_truncate ON roles`,
+		`CREATE TRIGGER permission_version_bump_truncate AFTER TRUNCATE ON roles
+			FOR EACH STATEMENT EXECUTE PROCEDURE bump_permission_version()`,
+		`DROP TRIGGER IF EXISTS permission_version_bump ON permissions`,
+		`CREATE TRIGGER permission_version_bump AFTER INSERT OR UPDATE OR DELETE ON permissions
+			FOR EACH ROW EXECUTE PROCEDURE bump_permission_version()`,
+		`DROP TRIGGER IF EXISTS permission_version_bump_truncate ON permissions`,
+		`CREATE TRIGGER permission_version_bump_truncate AFTER TRUNCATE ON permissions
+			FOR EACH STATEMENT EXECUTE PROCEDURE bump_permission_version()`,
+		`DROP TRIGGER IF EXISTS permission_version_bump ON role_permissions`,
+		`CREATE TRIGGER permission_version_bump AFTER INSERT OR UPDATE OR DELETE ON role_permissions
+			FOR EACH ROW EXECUTE PROCEDURE bump_permission_version()`,
+		`DROP TRIGGER IF EXISTS permission_version_bump_truncate ON role_permissions`,
+		`CREATE TRIGGER permission_version_bump_truncate AFTER TRUNCATE ON role_permissions
+			FOR EACH STATEMENT EXECUTE PROCEDURE bump_permission_version()`,
+
+		// Pre-aggregated statistics, kept current on status changes and
+		// rebuilt by the periodic refresh. refreshed_at is the snapshot time
+		// the row was computed from.
+		`CREATE TABLE IF NOT EXISTS student_statistics (
+			student_id UUID PRIMARY KEY REFERENCES students(id) ON DELETE CASCADE,
+			study_program_id UUID REFERENCES study_programs(id) ON DELETE SET NULL,
+			total_achievements INTEGER NOT NULL DEFAULT 0,
+			total_draft INTEGER NOT NULL DEFAULT 0,
+			total_pending INTEGER NOT NULL DEFAULT 0,
+			total_verified INTEGER NOT NULL DEFAULT 0,
+			total_rejected INTEGER NOT NULL DEFAULT 0,
+			verified_points INTEGER NOT NULL DEFAULT 0,
+			by_type JSONB NOT NULL DEFAULT '{}',
+			by_competition_level JSONB NOT NULL DEFAULT '{}',
+			refreshed_at TIMESTAMP NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS student_period_statistics (
+			student_id UUID NOT NULL REFERENCES students(id) ON DELETE CASCADE,
+			basis VARCHAR(10) NOT NULL,
+			period CHAR(7) NOT NULL,
+			total_verified INTEGER NOT NULL DEFAULT 0,
+			verified_points INTEGER NOT NULL DEFAULT 0,
+			PRIMARY KEY (student_id, basis, period)
+		)`,
+		`CREATE TABLE IF NOT EXISTS program_statistics (
+			study_program_id UUID PRIMARY KEY REFERENCES study_programs(id) ON DELETE CASCADE,
+			students INTEGER NOT NULL DEFAULT 0,
+			total_achievements INTEGER NOT NULL DEFAULT 0,
+			total_draft INTEGER NOT NULL DEFAULT 0,
+			total_pending INTEGER NOT NULL DEFAULT 0,
+			total_verified INTEGER NOT NULL DEFAULT 0,
+			total_rejected INTEGER NOT NULL DEFAULT 0,
+			verified_points INTEGER NOT NULL DEFAULT 0,
+			refreshed_at TIMESTAMP NOT NULL
+		)`,
+
 		// Create indexes
 		`CREATE INDEX IF NOT EXISTS idx_users_role ON users(role_id)`,
 		`CREATE INDEX IF NOT EXISTS idx_students_advisor ON students(advisor_id)`,
 		`CREATE INDEX IF NOT EXISTS idx_achievement_refs_student ON achievement_references(student_id)`,
 		`CREATE INDEX IF NOT EXISTS idx_achievement_refs_status ON achievement_references(status)`,
+		`CREATE INDEX IF NOT EXISTS idx_achievement_refs_import_batch ON achievement_references(import_batch_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_advisor_assignments_student ON advisor_assignments(student_id, started_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_departments_faculty ON departments(faculty_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_study_programs_department ON study_programs(department_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_students_study_program ON students(study_program_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_lecturers_department ON lecturers(department_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_student_statistics_program ON student_statistics(study_program_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_refresh_tokens_family ON refresh_tokens(family_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_sessions_user ON sessions(user_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_security_events_user ON security_events(user_id, created_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_user_identities_user ON user_identities(user_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_api_keys_service_account ON api_keys(service_account_id)`,
 	}
 
 	for _, query := range queries {
@@ -123,6 +428,29 @@ func createTables(db *sql.DB) error {
 	return nil
 }
 
+// Permissions are the permissions the API knows, seeded on the first start
+// and added to existing databases by the permission sync at startup.
+var Permissions = []entity.Permission{
+	{Name: "achievement:create", Resource: "achievement", Action: "create", Description: "Create new achievement"},
+	{Name: "achievement:read", Resource: "achievement", Action: "read", Description: "Read achievement data"},
+	{Name: "achievement:update", Resource: "achievement", Action: "update", Description: "Update achievement data"},
+	{Name: "achievement:delete", Resource: "achievement", Action: "delete", Description: "Delete achievement"},
+	{Name: "achievement:verify", Resource: "achievement", Action: "verify", Description: "Verify achievement"},
+	{Name: "achievement:reject", Resource: "achievement", Action: "reject", Description: "Reject achievement"},
+	{Name: "user:create", Resource: "user", Action: "create", Description: "Create new user"},
+	{Name: "user:read", Resource: "user", Action: "read", Description: "Read user data"},
+	{Name: "user:update", Resource: "user", Action: "update", Description: "Update user data"},
+	{Name: "user:delete", Resource: "user", Action: "delete", Description: "Delete user"},
+	{Name: "user:manage", Resource: "user", Action: "manage", Description: "Full user management"},
+	{Name: "student:read", Resource: "student", Action: "read", Description: "Read student data"},
+	{Name: "student:manage", Resource: "student", Action: "manage", Description: "Manage student data"},
+	{Name: "lecturer:read", Resource: "lecturer", Action: "read", Description: "Read lecturer data"},
+	{Name: "lecturer:manage", Resource: "lecturer", Action: "manage", Description: "Manage lecturer data"},
+	{Name: "report:read", Resource: "report", Action: "read", Description: "Read reports"},
+	{Name: "report:all", Resource: "report", Action: "all", Description: "Access all reports"},
+	{Name: "department:read", Resource: "department", Action: "read", Description: "Access students and achievements of own department"},
+}
+
 func seedData(db *sql.DB) error {
 	// Check if roles already exist
 	var count int
@@ -146,7 +474,7 @@ func seedData(db *sql.DB) error {
 
 	for _, role := range roles {
 		_, err := db.Exec(
-			"INSERT INTO roles (id, name, description) VALUES ($1, $2, $3) ON CONFLICT (name) DO NOTHING",
+			"INSERT INTO roles (id, name, description, is_builtin) VALUES ($1, $2, $3, true) ON CONFLICT (name) DO NOTHING",
 			role.ID, role.Name, role.Description,
 		)
 		if err != nil {
@@ -161,33 +489,8 @@ func seedData(db *sql.DB) error {
 	db.QueryRow("SELECT id FROM roles WHERE name = 'Dosen Wali'").Scan(&dosenRoleID)
 
 	// Seed permissions
-	permissions := []struct {
-		Name        string
-		Resource    string
-		Action      string
-		Description string
-	}{
-		{"achievement:create", "achievement", "create", "Create new achievement"},
-		{"achievement:read", "achievement", "read", "Read achievement data"},
-		{"achievement:update", "achievement", "update", "Update achievement data"},
-		{"achievement:delete", "achievement", "delete", "Delete achievement"},
-		{"achievement:verify", "achievement", "verify", "Verify achievement"},
-		{"achievement:reject", "achievement", "reject", "Reject achievement"},
-		{"user:create", "user", "create", "Create new user"},
-		{"user:read", "user", "read", "Read user data"},
-		{"user:update", "user", "update", "Update user data"},
-		{"user:delete", "user", "delete", "Delete user"},
-		{"user:manage", "user", "manage", "Full user management"},
-		{"student:read", "student", "read", "Read student data"},
-		{"student:manage", "student", "manage", "Manage student data"},
-		{"lecturer:read", "lecturer", "read", "Read lecturer data"},
-		{"lecturer:manage", "lecturer", "manage", "Manage lecturer data"},
-		{"report:read", "report", "read", "Read reports"},
-		{"report:all", "report", "all", "Access all reports"},
-	}
-
 	permissionIDs := make(map[string]uuid.UUID)
-	for _, perm := range permissions {
+	for _, perm := range Permissions {
 		id := uuid.New()
 		permissionIDs[perm.Name] = id
 		_, err := db.Exec(
@@ -1,10 +1,12 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os"
 
+	"github.com/Aryma-f4/uas-backend/app/repository"
 	"github.com/Aryma-f4/uas-backend/config"
 	"github.com/Aryma-f4/uas-backend/routes"
 	"github.com/gofiber/fiber/v2"
@@ -66,6 +68,14 @@ func main() {
 	}
 	log.Println("Migrations completed")
 
+	// Link free-text study programs and departments to the academic unit tables
+	linked, err := repository.NewAcademicUnitRepository(postgresDB).LinkUnmatched(context.Background())
+	if err != nil {
+		log.Printf("Failed to link academic units: %v", err)
+	} else if linked.UnlinkedStudents > 0 || linked.UnlinkedLecturers > 0 {
+		log.Printf("Academic units: %d students and %d lecturers not linked to a unit yet", linked.UnlinkedStudents, linked.UnlinkedLecturers)
+	}
+
 	// Create Fiber app
 	app := fiber.New(fiber.Config{
 		ErrorHandler: func(c *fiber.Ctx, err error) error {
@@ -82,13 +92,14 @@ func main() {
 
 	// Global middleware
 	app.Use(recover.New())
+	// ${locals:audit} tags requests made with an impersonation token
 	app.Use(logger.New(logger.Config{
-		Format: "[${time}] ${status} - ${latency} ${method} ${path}\n",
+		Format: "[${time}] ${status} - ${latency} ${method} ${path}${locals:audit}\n",
 	}))
 	app.Use(cors.New(cors.Config{
 		AllowOrigins:     "*",
 		AllowMethods:     "GET,POST,PUT,DELETE,OPTIONS,PATCH",
-		AllowHeaders:     "Origin,Content-Type,Accept,Authorization",
+		AllowHeaders:     "Origin,Content-Type,Accept,Authorization,X-API-Key",
 		AllowCredentials: false,
 	}))
 
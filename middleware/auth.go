@@ -1,8 +1,13 @@
 package middleware
 
 import (
+	"database/sql"
+	"errors"
+	"sort"
 	"strings"
+	"sync"
 
+	"github.com/Aryma-f4/uas-backend/app/entity"
 	"github.com/Aryma-f4/uas-backend/app/repository"
 	"github.com/Aryma-f4/uas-backend/app/usecase"
 	"github.com/Aryma-f4/uas-backend/utils"
@@ -10,9 +15,27 @@ import (
 	"github.com/google/uuid"
 )
 
+// AuthMiddleware authenticates a request by its bearer token or, for
+// service accounts, its X-API-Key header.
 func AuthMiddleware(authUsecase *usecase.AuthUsecase) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		authHeader := c.Get("Authorization")
+		if apiKey := c.Get("X-API-Key"); apiKey != "" {
+			if authHeader != "" {
+				return utils.UnauthorizedResponse(c, "Use either a bearer token or an API key")
+			}
+
+			account, err := authUsecase.ValidateAPIKey(c.Context(), apiKey, c.IP())
+			if err != nil {
+				return utils.UnauthorizedResponse(c, "Invalid API key")
+			}
+
+			c.Locals("service_account_id", account.ID.String())
+			c.Locals("role_name", entity.RoleServiceAccount)
+			c.Locals("permissions", account.Permissions)
+			return c.Next()
+		}
+
 		if authHeader == "" {
 			return utils.UnauthorizedResponse(c, "Missing authorization header")
 		}
@@ -22,127 +45,168 @@ func AuthMiddleware(authUsecase *usecase.AuthUsecase) fiber.Handler {
 			return utils.UnauthorizedResponse(c, "Invalid authorization format")
 		}
 
-		userID, roleID, err := authUsecase.ValidateToken(parts[1])
+		claims, err := authUsecase.ValidateToken(c.Context(), parts[1])
 		if err != nil {
 			return utils.UnauthorizedResponse(c, "Invalid or expired token")
 		}
 
-		c.Locals("user_id", userID.String())
-		c.Locals("role_id", roleID.String())
+		access, err := authUsecase.ResolveAccess(c.Context(), claims)
+		if errors.Is(err, sql.ErrNoRows) {
+			return utils.ForbiddenResponse(c, "User role not found")
+		}
+		if err != nil {
+			return utils.InternalServerErrorResponse(c, "Failed to check permissions")
+		}
+
+		c.Locals("user_id", claims.UserID.String())
+		c.Locals("role_id", claims.RoleID.String())
+		c.Locals("role_name", access.RoleName)
+		c.Locals("permissions", access.Permissions)
+		if claims.SessionID != uuid.Nil {
+			c.Locals("session_id", claims.SessionID.String())
+		}
+		if claims.ImpersonatorID != uuid.Nil {
+			c.Locals("impersonator_id", claims.ImpersonatorID.String())
+			// Tags the request log line, see the logger format in main.go
+			c.Locals("audit", " impersonated_by="+claims.ImpersonatorID.String())
+		}
 
 		return c.Next()
 	}
 }
 
-func RequireRole(userRepo *repository.UserRepository, allowedRoles ...string) fiber.Handler {
+// DenyImpersonation refuses destructive and account security actions to
+// admins acting as another user.
+func DenyImpersonation() fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		roleIDStr := c.Locals("role_id")
-		if roleIDStr == nil {
-			return utils.UnauthorizedResponse(c, "Role not found in context")
+		if utils.GetImpersonatorIDFromContext(c) != uuid.Nil {
+			return utils.ForbiddenResponse(c, "Not available while impersonating")
 		}
+		return c.Next()
+	}
+}
 
-		roleID, err := uuid.Parse(roleIDStr.(string))
-		if err != nil {
-			return utils.UnauthorizedResponse(c, "Invalid role ID")
+func RequireRole(userRepo *repository.UserRepository, allowedRoles ...string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if utils.IsServiceAccount(c) {
+			return utils.ForbiddenResponse(c, "Not available to service accounts")
 		}
 
-		// Get user's role name
-		roles, err := userRepo.GetRoles(c.Context())
+		roleName, _, err := roleAccess(c, userRepo)
 		if err != nil {
-			return utils.InternalServerErrorResponse(c, "Failed to fetch roles")
-		}
-
-		var userRoleName string
-		for _, role := range roles {
-			if role.ID == roleID {
-				userRoleName = role.Name
-				break
-			}
-		}
-
-		if userRoleName == "" {
-			return utils.ForbiddenResponse(c, "User role not found")
+			return utils.ErrorResponse(c, err.Code, err.Message)
 		}
 
 		// Check if user's role is in allowed roles
-		allowed := false
 		for _, allowedRole := range allowedRoles {
-			if userRoleName == allowedRole {
-				allowed = true
-				break
+			if roleName == allowedRole {
+				return c.Next()
 			}
 		}
 
-		if !allowed {
-			return utils.ForbiddenResponse(c, "Insufficient role permissions")
-		}
-
-		c.Locals("role_name", userRoleName)
-		return c.Next()
+		return utils.ForbiddenResponse(c, "Insufficient role permissions")
 	}
 }
 
 func RequirePermission(userRepo *repository.UserRepository, permission string) fiber.Handler {
-	return func(c *fiber.Ctx) error {
-		roleIDStr := c.Locals("role_id")
-		if roleIDStr == nil {
-			return utils.UnauthorizedResponse(c, "Role not found in context")
-		}
+	return RequireAnyPermission(userRepo, permission)
+}
 
-		roleID, err := uuid.Parse(roleIDStr.(string))
-		if err != nil {
-			return utils.UnauthorizedResponse(c, "Invalid role ID")
-		}
+func RequireAnyPermission(userRepo *repository.UserRepository, permissions ...string) fiber.Handler {
+	referencePermissions(permissions...)
 
-		hasPermission, err := userRepo.CheckPermission(c.Context(), roleID, permission)
+	return func(c *fiber.Ctx) error {
+		_, granted, err := roleAccess(c, userRepo)
 		if err != nil {
-			return utils.InternalServerErrorResponse(c, "Failed to check permissions")
+			return utils.ErrorResponse(c, err.Code, err.Message)
 		}
 
-		if !hasPermission {
+		if !hasAnyPermission(granted, permissions...) {
 			return utils.ForbiddenResponse(c, "Insufficient permissions")
 		}
 
-		// Also get and set role name
-		roles, _ := userRepo.GetRoles(c.Context())
-		for _, role := range roles {
-			if role.ID == roleID {
-				c.Locals("role_name", role.Name)
-				break
-			}
-		}
-
 		return c.Next()
 	}
 }
 
-func RequireAnyPermission(userRepo *repository.UserRepository, permissions ...string) fiber.Handler {
-	return func(c *fiber.Ctx) error {
-		roleIDStr := c.Locals("role_id")
-		if roleIDStr == nil {
-			return utils.UnauthorizedResponse(c, "Role not found in context")
-		}
+// roleAccess returns the role name and permissions AuthMiddleware resolved,
+// looking them up in the permission cache when it did not.
+func roleAccess(c *fiber.Ctx, userRepo *repository.UserRepository) (string, []string, *fiber.Error) {
+	if granted, ok := c.Locals("permissions").([]string); ok {
+		return utils.GetRoleNameFromContext(c), granted, nil
+	}
 
-		roleID, err := uuid.Parse(roleIDStr.(string))
-		if err != nil {
-			return utils.UnauthorizedResponse(c, "Invalid role ID")
-		}
+	roleIDStr, ok := c.Locals("role_id").(string)
+	if !ok {
+		return "", nil, fiber.NewError(fiber.StatusUnauthorized, "Role not found in context")
+	}
 
-		for _, permission := range permissions {
-			hasPermission, err := userRepo.CheckPermission(c.Context(), roleID, permission)
-			if err == nil && hasPermission {
-				// Also get and set role name
-				roles, _ := userRepo.GetRoles(c.Context())
-				for _, role := range roles {
-					if role.ID == roleID {
-						c.Locals("role_name", role.Name)
-						break
-					}
-				}
-				return c.Next()
+	roleID, err := uuid.Parse(roleIDStr)
+	if err != nil {
+		return "", nil, fiber.NewError(fiber.StatusUnauthorized, "Invalid role ID")
+	}
+
+	access, err := userRepo.GetRoleAccess(c.Context(), roleID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil, fiber.NewError(fiber.StatusForbidden, "User role not found")
+	}
+	if err != nil {
+		return "", nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to check permissions")
+	}
+
+	c.Locals("role_name", access.RoleName)
+	c.Locals("permissions", access.Permissions)
+	return access.RoleName, access.Permissions, nil
+}
+
+var (
+	referencedMu sync.Mutex
+	referenced   = make(map[string]bool)
+)
+
+// referencePermissions records permissions that routes require.
+func referencePermissions(permissions ...string) {
+	referencedMu.Lock()
+	defer referencedMu.Unlock()
+	for _, permission := range permissions {
+		referenced[permission] = true
+	}
+}
+
+// ReferencedPermissions returns the permissions required by the routes set
+// up so far, sorted, for the permission sync at startup.
+func ReferencedPermissions() []string {
+	referencedMu.Lock()
+	defer referencedMu.Unlock()
+	names := make([]string, 0, len(referenced))
+	for name := range referenced {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// hasAnyPermission reports whether granted holds one of the wanted permissions.
+func hasAnyPermission(granted []string, wanted ...string) bool {
+	for _, permission := range wanted {
+		for _, g := range granted {
+			if g == permission {
+				return true
 			}
 		}
+	}
+	return false
+}
 
-		return utils.ForbiddenResponse(c, "Insufficient permissions")
+// Subject describes the caller of an authenticated request for the access
+// policy. Service accounts have no user ID.
+func Subject(c *fiber.Ctx) *entity.Subject {
+	userID, _ := utils.GetUserIDFromContext(c)
+	permissions, _ := c.Locals("permissions").([]string)
+	return &entity.Subject{
+		UserID:         userID,
+		RoleName:       utils.GetRoleNameFromContext(c),
+		Permissions:    permissions,
+		ImpersonatorID: utils.GetImpersonatorIDFromContext(c),
 	}
 }
@@ -0,0 +1,303 @@
+package routes
+
+import (
+	"errors"
+
+	"github.com/Aryma-f4/uas-backend/app/entity"
+	"github.com/Aryma-f4/uas-backend/app/repository"
+	"github.com/Aryma-f4/uas-backend/app/usecase"
+	"github.com/Aryma-f4/uas-backend/middleware"
+	"github.com/Aryma-f4/uas-backend/utils"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+func SetupAcademicUnitRoutes(router fiber.Router, unitUsecase *usecase.AcademicUnitUsecase, userRepo *repository.UserRepository, authUsecase *usecase.AuthUsecase) {
+	auth := middleware.AuthMiddleware(authUsecase)
+	adminOnly := middleware.RequireRole(userRepo, "Admin")
+
+	// Faculties
+	faculties := router.Group("/faculties")
+	faculties.Use(auth)
+
+	// GET /api/v1/faculties - List faculties
+	faculties.Get("/", func(c *fiber.Ctx) error {
+		list, err := unitUsecase.ListFaculties(c.Context())
+		if err != nil {
+			return utils.InternalServerErrorResponse(c, "Failed to fetch faculties")
+		}
+		return utils.SuccessResponse(c, list)
+	})
+
+	// POST /api/v1/faculties - Create faculty (Admin only)
+	faculties.Post("/", adminOnly, func(c *fiber.Ctx) error {
+		var req entity.FacultyRequest
+		if err := c.BodyParser(&req); err != nil {
+			return utils.BadRequestResponse(c, "Invalid request body")
+		}
+
+		faculty, err := unitUsecase.CreateFaculty(c.Context(), &req)
+		if err != nil {
+			return utils.BadRequestResponse(c, err.Error())
+		}
+		return c.Status(fiber.StatusCreated).JSON(utils.Response{
+			Status:  "success",
+			Message: "Faculty created successfully",
+			Data:    faculty,
+		})
+	})
+
+	// GET /api/v1/faculties/:id - Get faculty by ID
+	faculties.Get("/:id", func(c *fiber.Ctx) error {
+		id, err := utils.ParseUUID(c.Params("id"))
+		if err != nil {
+			return utils.BadRequestResponse(c, "Invalid faculty ID")
+		}
+
+		faculty, err := unitUsecase.GetFaculty(c.Context(), id)
+		if err != nil {
+			return utils.NotFoundResponse(c, "Faculty not found")
+		}
+		return utils.SuccessResponse(c, faculty)
+	})
+
+	// PUT /api/v1/faculties/:id - Update faculty (Admin only)
+	faculties.Put("/:id", adminOnly, func(c *fiber.Ctx) error {
+		id, err := utils.ParseUUID(c.Params("id"))
+		if err != nil {
+			return utils.BadRequestResponse(c, "Invalid faculty ID")
+		}
+
+		var req entity.FacultyRequest
+		if err := c.BodyParser(&req); err != nil {
+			return utils.BadRequestResponse(c, "Invalid request body")
+		}
+
+		faculty, err := unitUsecase.UpdateFaculty(c.Context(), id, &req)
+		if err != nil {
+			return utils.BadRequestResponse(c, err.Error())
+		}
+		return utils.SuccessWithMessageResponse(c, "Faculty updated successfully", faculty)
+	})
+
+	// DELETE /api/v1/faculties/:id - Delete faculty without departments (Admin only)
+	faculties.Delete("/:id", adminOnly, func(c *fiber.Ctx) error {
+		id, err := utils.ParseUUID(c.Params("id"))
+		if err != nil {
+			return utils.BadRequestResponse(c, "Invalid faculty ID")
+		}
+
+		if err := unitUsecase.DeleteFaculty(c.Context(), id); err != nil {
+			return utils.BadRequestResponse(c, err.Error())
+		}
+		return utils.SuccessMessageResponse(c, "Faculty deleted successfully")
+	})
+
+	// Departments
+	departments := router.Group("/departments")
+	departments.Use(auth)
+
+	// GET /api/v1/departments - List departments, optionally by faculty_id
+	departments.Get("/", func(c *fiber.Ctx) error {
+		filter, err := parseUnitFilter(c)
+		if err != nil {
+			return utils.BadRequestResponse(c, err.Error())
+		}
+
+		list, err := unitUsecase.ListDepartments(c.Context(), filter.FacultyID)
+		if err != nil {
+			return utils.InternalServerErrorResponse(c, "Failed to fetch departments")
+		}
+		return utils.SuccessResponse(c, list)
+	})
+
+	// POST /api/v1/departments - Create department (Admin only)
+	departments.Post("/", adminOnly, func(c *fiber.Ctx) error {
+		var req entity.DepartmentRequest
+		if err := c.BodyParser(&req); err != nil {
+			return utils.BadRequestResponse(c, "Invalid request body")
+		}
+
+		department, err := unitUsecase.CreateDepartment(c.Context(), &req)
+		if err != nil {
+			return utils.BadRequestResponse(c, err.Error())
+		}
+		return c.Status(fiber.StatusCreated).JSON(utils.Response{
+			Status:  "success",
+			Message: "Department created successfully",
+			Data:    department,
+		})
+	})
+
+	// GET /api/v1/departments/:id - Get department by ID
+	departments.Get("/:id", func(c *fiber.Ctx) error {
+		id, err := utils.ParseUUID(c.Params("id"))
+		if err != nil {
+			return utils.BadRequestResponse(c, "Invalid department ID")
+		}
+
+		department, err := unitUsecase.GetDepartment(c.Context(), id)
+		if err != nil {
+			return utils.NotFoundResponse(c, "Department not found")
+		}
+		return utils.SuccessResponse(c, department)
+	})
+
+	// PUT /api/v1/departments/:id - Update department (Admin only)
+	departments.Put("/:id", adminOnly, func(c *fiber.Ctx) error {
+		id, err := utils.ParseUUID(c.Params("id"))
+		if err != nil {
+			return utils.BadRequestResponse(c, "Invalid department ID")
+		}
+
+		var req entity.DepartmentRequest
+		if err := c.BodyParser(&req); err != nil {
+			return utils.BadRequestResponse(c, "Invalid request body")
+		}
+
+		department, err := unitUsecase.UpdateDepartment(c.Context(), id, &req)
+		if err != nil {
+			return utils.BadRequestResponse(c, err.Error())
+		}
+		return utils.SuccessWithMessageResponse(c, "Department updated successfully", department)
+	})
+
+	// DELETE /api/v1/departments/:id - Delete unused department (Admin only)
+	departments.Delete("/:id", adminOnly, func(c *fiber.Ctx) error {
+		id, err := utils.ParseUUID(c.Params("id"))
+		if err != nil {
+			return utils.BadRequestResponse(c, "Invalid department ID")
+		}
+
+		if err := unitUsecase.DeleteDepartment(c.Context(), id); err != nil {
+			return utils.BadRequestResponse(c, err.Error())
+		}
+		return utils.SuccessMessageResponse(c, "Department deleted successfully")
+	})
+
+	// Study programs
+	programs := router.Group("/study-programs")
+	programs.Use(auth)
+
+	// GET /api/v1/study-programs - List study programs, optionally by faculty_id or department_id
+	programs.Get("/", func(c *fiber.Ctx) error {
+		filter, err := parseUnitFilter(c)
+		if err != nil {
+			return utils.BadRequestResponse(c, err.Error())
+		}
+
+		list, err := unitUsecase.ListStudyPrograms(c.Context(), filter)
+		if err != nil {
+			return utils.InternalServerErrorResponse(c, "Failed to fetch study programs")
+		}
+		return utils.SuccessResponse(c, list)
+	})
+
+	// POST /api/v1/study-programs - Create study program (Admin only)
+	programs.Post("/", adminOnly, func(c *fiber.Ctx) error {
+		var req entity.StudyProgramRequest
+		if err := c.BodyParser(&req); err != nil {
+			return utils.BadRequestResponse(c, "Invalid request body")
+		}
+
+		program, err := unitUsecase.CreateStudyProgram(c.Context(), &req)
+		if err != nil {
+			return utils.BadRequestResponse(c, err.Error())
+		}
+		return c.Status(fiber.StatusCreated).JSON(utils.Response{
+			Status:  "success",
+			Message: "Study program created successfully",
+			Data:    program,
+		})
+	})
+
+	// GET /api/v1/study-programs/:id - Get study program by ID
+	programs.Get("/:id", func(c *fiber.Ctx) error {
+		id, err := utils.ParseUUID(c.Params("id"))
+		if err != nil {
+			return utils.BadRequestResponse(c, "Invalid study program ID")
+		}
+
+		program, err := unitUsecase.GetStudyProgram(c.Context(), id)
+		if err != nil {
+			return utils.NotFoundResponse(c, "Study program not found")
+		}
+		return utils.SuccessResponse(c, program)
+	})
+
+	// PUT /api/v1/study-programs/:id - Update study program (Admin only)
+	programs.Put("/:id", adminOnly, func(c *fiber.Ctx) error {
+		id, err := utils.ParseUUID(c.Params("id"))
+		if err != nil {
+			return utils.BadRequestResponse(c, "Invalid study program ID")
+		}
+
+		var req entity.StudyProgramRequest
+		if err := c.BodyParser(&req); err != nil {
+			return utils.BadRequestResponse(c, "Invalid request body")
+		}
+
+		program, err := unitUsecase.UpdateStudyProgram(c.Context(), id, &req)
+		if err != nil {
+			return utils.BadRequestResponse(c, err.Error())
+		}
+		return utils.SuccessWithMessageResponse(c, "Study program updated successfully", program)
+	})
+
+	// DELETE /api/v1/study-programs/:id - Delete study program without students (Admin only)
+	programs.Delete("/:id", adminOnly, func(c *fiber.Ctx) error {
+		id, err := utils.ParseUUID(c.Params("id"))
+		if err != nil {
+			return utils.BadRequestResponse(c, "Invalid study program ID")
+		}
+
+		if err := unitUsecase.DeleteStudyProgram(c.Context(), id); err != nil {
+			return utils.BadRequestResponse(c, err.Error())
+		}
+		return utils.SuccessMessageResponse(c, "Study program deleted successfully")
+	})
+
+	// Linking of free-text program and department names
+	units := router.Group("/academic-units")
+	units.Use(auth)
+
+	// GET /api/v1/academic-units/unlinked - Program and department names matching no unit (Admin only)
+	units.Get("/unlinked", adminOnly, func(c *fiber.Ctx) error {
+		names, err := unitUsecase.ListUnlinkedNames(c.Context())
+		if err != nil {
+			return utils.InternalServerErrorResponse(c, "Failed to fetch unlinked names")
+		}
+		return utils.SuccessResponse(c, names)
+	})
+
+	// POST /api/v1/academic-units/link - Link unmatched students and lecturers to units (Admin only)
+	units.Post("/link", adminOnly, func(c *fiber.Ctx) error {
+		result, err := unitUsecase.LinkUnmatched(c.Context())
+		if err != nil {
+			return utils.InternalServerErrorResponse(c, "Failed to link academic units")
+		}
+		return utils.SuccessWithMessageResponse(c, "Academic units linked", result)
+	})
+}
+
+// parseUnitFilter reads the optional faculty_id, department_id and
+// study_program_id query parameters.
+func parseUnitFilter(c *fiber.Ctx) (*entity.AcademicUnitFilter, error) {
+	filter := &entity.AcademicUnitFilter{}
+	for param, target := range map[string]**uuid.UUID{
+		"faculty_id":       &filter.FacultyID,
+		"department_id":    &filter.DepartmentID,
+		"study_program_id": &filter.StudyProgramID,
+	} {
+		value := c.Query(param)
+		if value == "" {
+			continue
+		}
+		id, err := utils.ParseUUID(value)
+		if err != nil {
+			return nil, errors.New("Invalid " + param)
+		}
+		*target = &id
+	}
+	return filter, nil
+}
@@ -1,6 +1,12 @@
 package routes
 
 import (
+	"bufio"
+	"context"
+	"errors"
+	"log"
+	"time"
+
 	"github.com/Aryma-f4/uas-backend/app/entity"
 	"github.com/Aryma-f4/uas-backend/app/repository"
 	"github.com/Aryma-f4/uas-backend/app/usecase"
@@ -9,40 +15,136 @@ import (
 	"github.com/gofiber/fiber/v2"
 )
 
-func SetupAchievementRoutes(router fiber.Router, achievementUsecase *usecase.AchievementUsecase, userRepo *repository.UserRepository, authUsecase *usecase.AuthUsecase) {
+func SetupAchievementRoutes(router fiber.Router, achievementUsecase *usecase.AchievementUsecase, importUsecase *usecase.AchievementImportUsecase, userRepo *repository.UserRepository, authUsecase *usecase.AuthUsecase) {
 	achievements := router.Group("/achievements")
 	achievements.Use(middleware.AuthMiddleware(authUsecase))
 
 	// GET /api/v1/achievements - List achievements (filtered by role)
 	achievements.Get("/", middleware.RequireAnyPermission(userRepo, "achievement:read", "achievement:verify"), func(c *fiber.Ctx) error {
+		filter := &entity.AchievementFilter{
+			Status:          c.Query("status"),
+			AchievementType: c.Query("type"),
+		}
+		filter.Page, filter.Limit, _ = utils.ParsePagination(c)
+
+		achievementList, total, err := achievementUsecase.List(c.Context(), middleware.Subject(c), filter)
+		if err != nil {
+			return utils.InternalServerErrorResponse(c, err.Error())
+		}
+
+		return utils.PaginatedSuccessResponse(c, achievementList, filter.Page, filter.Limit, total)
+	})
+
+	// POST /api/v1/achievements/import - Bulk import from CSV/XLSX (Admin only, dry run by default)
+	achievements.Post("/import", middleware.RequireRole(userRepo, "Admin"), func(c *fiber.Ctx) error {
 		userID, err := utils.GetUserIDFromContext(c)
 		if err != nil {
 			return utils.UnauthorizedResponse(c, "Invalid user context")
 		}
 
-		roleName := utils.GetRoleNameFromContext(c)
+		file, err := c.FormFile("file")
+		if err != nil {
+			return utils.BadRequestResponse(c, "File is required")
+		}
+
+		records, err := utils.ReadSpreadsheet(file)
+		if err != nil {
+			return utils.BadRequestResponse(c, err.Error())
+		}
+
+		initialStatus := entity.AchievementStatus(c.FormValue("initial_status", string(entity.StatusDraft)))
+		dryRun := c.FormValue("dry_run", "true") != "false"
+
+		result, err := importUsecase.Import(c.Context(), userID, file.Filename, records, initialStatus, dryRun)
+		if err != nil {
+			return utils.BadRequestResponse(c, err.Error())
+		}
+
+		if !dryRun && result.BatchID == nil {
+			return c.Status(fiber.StatusUnprocessableEntity).JSON(utils.Response{
+				Status:  "error",
+				Message: "Import has validation errors, nothing was imported",
+				Data:    result,
+			})
+		}
+
+		return utils.SuccessResponse(c, result)
+	})
+
+	// GET /api/v1/achievements/import - List import batches (Admin only)
+	achievements.Get("/import", middleware.RequireRole(userRepo, "Admin"), func(c *fiber.Ctx) error {
+		page, limit, offset := utils.ParsePagination(c)
+
+		batches, total, err := importUsecase.ListBatches(c.Context(), limit, offset)
+		if err != nil {
+			return utils.InternalServerErrorResponse(c, "Failed to fetch import batches")
+		}
+
+		return utils.PaginatedSuccessResponse(c, batches, page, limit, total)
+	})
+
+	// GET /api/v1/achievements/import/:batchId - Get import batch (Admin only)
+	achievements.Get("/import/:batchId", middleware.RequireRole(userRepo, "Admin"), func(c *fiber.Ctx) error {
+		batchID, err := utils.ParseUUID(c.Params("batchId"))
+		if err != nil {
+			return utils.BadRequestResponse(c, "Invalid batch ID")
+		}
+
+		batch, err := importUsecase.GetBatch(c.Context(), batchID)
+		if err != nil {
+			return utils.NotFoundResponse(c, "Import batch not found")
+		}
+
+		return utils.SuccessResponse(c, batch)
+	})
+
+	// DELETE /api/v1/achievements/import/:batchId - Roll back a whole import batch (Admin only)
+	achievements.Delete("/import/:batchId", middleware.RequireRole(userRepo, "Admin"), func(c *fiber.Ctx) error {
+		batchID, err := utils.ParseUUID(c.Params("batchId"))
+		if err != nil {
+			return utils.BadRequestResponse(c, "Invalid batch ID")
+		}
+
+		if err := importUsecase.Rollback(c.Context(), batchID); err != nil {
+			return utils.BadRequestResponse(c, err.Error())
+		}
+
+		return utils.SuccessMessageResponse(c, "Import batch rolled back successfully")
+	})
+
+	// GET /api/v1/achievements/export?format=csv|xlsx - Export achievements (same filters and scoping as list)
+	achievements.Get("/export", middleware.RequireAnyPermission(userRepo, "achievement:read", "achievement:verify"), func(c *fiber.Ctx) error {
+		format := c.Query("format", "csv")
+		if format != "csv" && format != "xlsx" {
+			return utils.BadRequestResponse(c, "Format must be csv or xlsx")
+		}
+
+		studentIDs, err := achievementUsecase.ResolveScope(c.Context(), middleware.Subject(c))
+		if err != nil {
+			return utils.InternalServerErrorResponse(c, "Failed to resolve export scope")
+		}
 
 		filter := &entity.AchievementFilter{
 			Status:          c.Query("status"),
 			AchievementType: c.Query("type"),
 		}
-		filter.Page, filter.Limit, _ = utils.ParsePagination(c)
 
-		achievementList, total, err := achievementUsecase.List(c.Context(), userID, roleName, filter)
-		if err != nil {
-			return utils.InternalServerErrorResponse(c, err.Error())
-		}
+		c.Set(fiber.HeaderContentType, utils.SpreadsheetContentType(format))
+		c.Set(fiber.HeaderContentDisposition, `attachment; filename="achievements-`+time.Now().Format("20060102-150405")+"."+format+`"`)
+		streamSpreadsheet(c, format, "Achievement", func(ctx context.Context, write func([]string) error) error {
+			return achievementUsecase.Export(ctx, studentIDs, filter, write)
+		})
 
-		return utils.PaginatedSuccessResponse(c, achievementList, filter.Page, filter.Limit, total)
+		return nil
 	})
 
 	// GET /api/v1/achievements/:id - Get achievement detail
 	achievements.Get("/:id", middleware.RequireAnyPermission(userRepo, "achievement:read", "achievement:verify"), func(c *fiber.Ctx) error {
 		id := c.Params("id")
 
-		achievement, err := achievementUsecase.GetByID(c.Context(), id)
+		achievement, err := achievementUsecase.GetByID(c.Context(), middleware.Subject(c), id)
 		if err != nil {
-			return utils.NotFoundResponse(c, "Achievement not found")
+			return achievementError(c, err)
 		}
 
 		return utils.SuccessResponse(c, achievement)
@@ -50,8 +152,7 @@ func SetupAchievementRoutes(router fiber.Router, achievementUsecase *usecase.Ach
 
 	// POST /api/v1/achievements - Create achievement (Mahasiswa only)
 	achievements.Post("/", middleware.RequirePermission(userRepo, "achievement:create"), func(c *fiber.Ctx) error {
-		userID, err := utils.GetUserIDFromContext(c)
-		if err != nil {
+		if _, err := utils.GetUserIDFromContext(c); err != nil {
 			return utils.UnauthorizedResponse(c, "Invalid user context")
 		}
 
@@ -67,7 +168,7 @@ func SetupAchievementRoutes(router fiber.Router, achievementUsecase *usecase.Ach
 			return utils.ValidationErrorResponse(c, "Achievement type is required")
 		}
 
-		achievement, err := achievementUsecase.Create(c.Context(), userID, &req)
+		achievement, err := achievementUsecase.Create(c.Context(), middleware.Subject(c), &req)
 		if err != nil {
 			return utils.InternalServerErrorResponse(c, err.Error())
 		}
@@ -80,8 +181,7 @@ func SetupAchievementRoutes(router fiber.Router, achievementUsecase *usecase.Ach
 
 	// PUT /api/v1/achievements/:id - Update achievement (Mahasiswa only, draft/rejected status)
 	achievements.Put("/:id", middleware.RequirePermission(userRepo, "achievement:update"), func(c *fiber.Ctx) error {
-		userID, err := utils.GetUserIDFromContext(c)
-		if err != nil {
+		if _, err := utils.GetUserIDFromContext(c); err != nil {
 			return utils.UnauthorizedResponse(c, "Invalid user context")
 		}
 
@@ -92,25 +192,24 @@ func SetupAchievementRoutes(router fiber.Router, achievementUsecase *usecase.Ach
 			return utils.BadRequestResponse(c, "Invalid request body")
 		}
 
-		achievement, err := achievementUsecase.Update(c.Context(), id, userID, &req)
+		achievement, err := achievementUsecase.Update(c.Context(), id, middleware.Subject(c), &req)
 		if err != nil {
-			return utils.BadRequestResponse(c, err.Error())
+			return achievementError(c, err)
 		}
 
 		return utils.SuccessResponse(c, achievement)
 	})
 
 	// DELETE /api/v1/achievements/:id - Delete achievement (Mahasiswa only, draft status)
-	achievements.Delete("/:id", middleware.RequirePermission(userRepo, "achievement:delete"), func(c *fiber.Ctx) error {
-		userID, err := utils.GetUserIDFromContext(c)
-		if err != nil {
+	achievements.Delete("/:id", middleware.DenyImpersonation(), middleware.RequirePermission(userRepo, "achievement:delete"), func(c *fiber.Ctx) error {
+		if _, err := utils.GetUserIDFromContext(c); err != nil {
 			return utils.UnauthorizedResponse(c, "Invalid user context")
 		}
 
 		id := c.Params("id")
 
-		if err := achievementUsecase.Delete(c.Context(), id, userID); err != nil {
-			return utils.BadRequestResponse(c, err.Error())
+		if err := achievementUsecase.Delete(c.Context(), id, middleware.Subject(c)); err != nil {
+			return achievementError(c, err)
 		}
 
 		return utils.SuccessMessageResponse(c, "Achievement deleted successfully")
@@ -118,15 +217,14 @@ func SetupAchievementRoutes(router fiber.Router, achievementUsecase *usecase.Ach
 
 	// POST /api/v1/achievements/:id/submit - Submit for verification (Mahasiswa only)
 	achievements.Post("/:id/submit", middleware.RequirePermission(userRepo, "achievement:create"), func(c *fiber.Ctx) error {
-		userID, err := utils.GetUserIDFromContext(c)
-		if err != nil {
+		if _, err := utils.GetUserIDFromContext(c); err != nil {
 			return utils.UnauthorizedResponse(c, "Invalid user context")
 		}
 
 		id := c.Params("id")
 
-		if err := achievementUsecase.Submit(c.Context(), id, userID); err != nil {
-			return utils.BadRequestResponse(c, err.Error())
+		if err := achievementUsecase.Submit(c.Context(), id, middleware.Subject(c)); err != nil {
+			return achievementError(c, err)
 		}
 
 		return utils.SuccessMessageResponse(c, "Achievement submitted for verification")
@@ -134,15 +232,14 @@ func SetupAchievementRoutes(router fiber.Router, achievementUsecase *usecase.Ach
 
 	// POST /api/v1/achievements/:id/verify - Verify achievement (Dosen Wali only)
 	achievements.Post("/:id/verify", middleware.RequirePermission(userRepo, "achievement:verify"), func(c *fiber.Ctx) error {
-		userID, err := utils.GetUserIDFromContext(c)
-		if err != nil {
+		if _, err := utils.GetUserIDFromContext(c); err != nil {
 			return utils.UnauthorizedResponse(c, "Invalid user context")
 		}
 
 		id := c.Params("id")
 
-		if err := achievementUsecase.Verify(c.Context(), id, userID); err != nil {
-			return utils.BadRequestResponse(c, err.Error())
+		if err := achievementUsecase.Verify(c.Context(), id, middleware.Subject(c)); err != nil {
+			return achievementError(c, err)
 		}
 
 		return utils.SuccessMessageResponse(c, "Achievement verified successfully")
@@ -150,8 +247,7 @@ func SetupAchievementRoutes(router fiber.Router, achievementUsecase *usecase.Ach
 
 	// POST /api/v1/achievements/:id/reject - Reject achievement (Dosen Wali only)
 	achievements.Post("/:id/reject", middleware.RequirePermission(userRepo, "achievement:reject"), func(c *fiber.Ctx) error {
-		userID, err := utils.GetUserIDFromContext(c)
-		if err != nil {
+		if _, err := utils.GetUserIDFromContext(c); err != nil {
 			return utils.UnauthorizedResponse(c, "Invalid user context")
 		}
 
@@ -166,8 +262,8 @@ func SetupAchievementRoutes(router fiber.Router, achievementUsecase *usecase.Ach
 			return utils.ValidationErrorResponse(c, "Rejection note is required")
 		}
 
-		if err := achievementUsecase.Reject(c.Context(), id, userID, req.RejectionNote); err != nil {
-			return utils.BadRequestResponse(c, err.Error())
+		if err := achievementUsecase.Reject(c.Context(), id, middleware.Subject(c), req.RejectionNote); err != nil {
+			return achievementError(c, err)
 		}
 
 		return utils.SuccessMessageResponse(c, "Achievement rejected")
@@ -177,11 +273,53 @@ func SetupAchievementRoutes(router fiber.Router, achievementUsecase *usecase.Ach
 	achievements.Get("/:id/history", middleware.RequireAnyPermission(userRepo, "achievement:read", "achievement:verify"), func(c *fiber.Ctx) error {
 		id := c.Params("id")
 
-		history, err := achievementUsecase.GetHistory(c.Context(), id)
+		history, err := achievementUsecase.GetHistory(c.Context(), middleware.Subject(c), id)
 		if err != nil {
-			return utils.NotFoundResponse(c, "Achievement not found")
+			return achievementError(c, err)
 		}
 
 		return utils.SuccessResponse(c, history)
 	})
 }
+
+// achievementError answers 404 for achievements the caller may not access,
+// so their existence is not revealed.
+func achievementError(c *fiber.Ctx, err error) error {
+	if errors.Is(err, usecase.ErrAchievementNotFound) {
+		return utils.NotFoundResponse(c, "Achievement not found")
+	}
+	return utils.BadRequestResponse(c, err.Error())
+}
+
+// streamSpreadsheet streams the rows produced by fill as the response body.
+// The status line is already sent when fill runs, so on failure the
+// connection is closed before the chunked body is terminated and the client
+// sees an aborted download instead of a truncated file. The context passed
+// to fill is cancelled as soon as writing to the client fails.
+func streamSpreadsheet(c *fiber.Ctx, format, name string, fill func(ctx context.Context, write func([]string) error) error) {
+	conn := c.Context().Conn()
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		writer, err := utils.NewSpreadsheetWriter(w, format)
+		if err == nil {
+			err = fill(ctx, func(row []string) error {
+				if err := writer.WriteRow(row); err != nil {
+					cancel()
+					return err
+				}
+				return nil
+			})
+			if err != nil {
+				writer.Abort()
+			} else if err = writer.Close(); err == nil {
+				err = w.Flush()
+			}
+		}
+		if err != nil {
+			log.Printf("%s export failed: %v", name, err)
+			conn.Close()
+		}
+	})
+}
@@ -1,11 +1,16 @@
 package routes
 
 import (
+	"errors"
+	"log"
+
+	"github.com/Aryma-f4/uas-backend/app/authprovider"
 	"github.com/Aryma-f4/uas-backend/app/entity"
 	"github.com/Aryma-f4/uas-backend/app/usecase"
 	"github.com/Aryma-f4/uas-backend/middleware"
 	"github.com/Aryma-f4/uas-backend/utils"
 	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
 )
 
 func SetupAuthRoutes(router fiber.Router, authUsecase *usecase.AuthUsecase) {
@@ -22,9 +27,9 @@ func SetupAuthRoutes(router fiber.Router, authUsecase *usecase.AuthUsecase) {
 			return utils.ValidationErrorResponse(c, "Username and password are required")
 		}
 
-		response, err := authUsecase.Login(c.Context(), &req)
+		response, err := authUsecase.Login(c.Context(), &req, c.Get(fiber.HeaderUserAgent), c.IP())
 		if err != nil {
-			return utils.UnauthorizedResponse(c, err.Error())
+			return loginError(c, err)
 		}
 
 		return utils.SuccessResponse(c, response)
@@ -43,7 +48,7 @@ func SetupAuthRoutes(router fiber.Router, authUsecase *usecase.AuthUsecase) {
 
 		token, refreshToken, err := authUsecase.RefreshToken(c.Context(), req.RefreshToken)
 		if err != nil {
-			return utils.UnauthorizedResponse(c, err.Error())
+			return loginError(c, err)
 		}
 
 		return utils.SuccessResponse(c, fiber.Map{
@@ -52,13 +57,302 @@ func SetupAuthRoutes(router fiber.Router, authUsecase *usecase.AuthUsecase) {
 		})
 	})
 
-	// POST /api/v1/auth/logout
+	// POST /api/v1/auth/logout - Revoke the presented refresh token and its family
 	auth.Post("/logout", func(c *fiber.Ctx) error {
-		// In a JWT-based system, logout is handled client-side
-		// Server can optionally blacklist the token
+		var req entity.RefreshTokenRequest
+		if err := c.BodyParser(&req); err != nil {
+			return utils.BadRequestResponse(c, "Invalid request body")
+		}
+
+		if req.RefreshToken == "" {
+			return utils.ValidationErrorResponse(c, "Refresh token is required")
+		}
+
+		if err := authUsecase.Logout(c.Context(), req.RefreshToken); err != nil {
+			return utils.InternalServerErrorResponse(c, "Failed to log out")
+		}
+
 		return utils.SuccessMessageResponse(c, "Logged out successfully")
 	})
 
+	// POST /api/v1/auth/invitations/accept - Set password from a roster import invitation
+	auth.Post("/invitations/accept", func(c *fiber.Ctx) error {
+		var req entity.AcceptInvitationRequest
+		if err := c.BodyParser(&req); err != nil {
+			return utils.BadRequestResponse(c, "Invalid request body")
+		}
+
+		if req.Token == "" {
+			return utils.ValidationErrorResponse(c, "Token is required")
+		}
+		if valid, msg := utils.ValidatePassword(req.Password); !valid {
+			return utils.ValidationErrorResponse(c, msg)
+		}
+
+		if err := authUsecase.AcceptInvitation(c.Context(), req.Token, req.Password); err != nil {
+			return utils.BadRequestResponse(c, err.Error())
+		}
+
+		return utils.SuccessMessageResponse(c, "Invitation accepted, you can now log in")
+	})
+
+	// POST /api/v1/auth/mfa/verify - Complete a login with a TOTP or recovery code
+	auth.Post("/mfa/verify", func(c *fiber.Ctx) error {
+		var req entity.MFAVerifyRequest
+		if err := c.BodyParser(&req); err != nil {
+			return utils.BadRequestResponse(c, "Invalid request body")
+		}
+
+		if req.MFAToken == "" || req.Code == "" {
+			return utils.ValidationErrorResponse(c, "MFA token and code are required")
+		}
+
+		response, err := authUsecase.VerifyMFAChallenge(c.Context(), req.MFAToken, req.Code)
+		if err != nil {
+			return loginError(c, err)
+		}
+
+		return utils.SuccessResponse(c, response)
+	})
+
+	// POST /api/v1/auth/mfa/setup - Start TOTP enrollment from a login that requires it
+	auth.Post("/mfa/setup", func(c *fiber.Ctx) error {
+		var req entity.MFASetupRequest
+		if err := c.BodyParser(&req); err != nil {
+			return utils.BadRequestResponse(c, "Invalid request body")
+		}
+
+		if req.MFAToken == "" {
+			return utils.ValidationErrorResponse(c, "MFA token is required")
+		}
+
+		enrollment, err := authUsecase.SetupMFAChallenge(c.Context(), req.MFAToken)
+		if err != nil {
+			return loginError(c, err)
+		}
+
+		return utils.SuccessResponse(c, enrollment)
+	})
+
+	// GET /api/v1/auth/mfa - MFA status of the current user
+	auth.Get("/mfa", middleware.AuthMiddleware(authUsecase), func(c *fiber.Ctx) error {
+		userID, err := utils.GetUserIDFromContext(c)
+		if err != nil {
+			return utils.UnauthorizedResponse(c, "Invalid user context")
+		}
+
+		status, err := authUsecase.GetMFAStatus(c.Context(), userID)
+		if err != nil {
+			return utils.InternalServerErrorResponse(c, "Failed to fetch MFA status")
+		}
+
+		return utils.SuccessResponse(c, status)
+	})
+
+	// POST /api/v1/auth/mfa/enroll - Create a TOTP secret for the current user
+	auth.Post("/mfa/enroll", middleware.AuthMiddleware(authUsecase), middleware.DenyImpersonation(), func(c *fiber.Ctx) error {
+		userID, err := utils.GetUserIDFromContext(c)
+		if err != nil {
+			return utils.UnauthorizedResponse(c, "Invalid user context")
+		}
+
+		enrollment, err := authUsecase.BeginMFAEnrollment(c.Context(), userID)
+		if err != nil {
+			return utils.BadRequestResponse(c, err.Error())
+		}
+
+		return utils.SuccessResponse(c, enrollment)
+	})
+
+	// POST /api/v1/auth/mfa/enroll/confirm - Enable MFA with a first code
+	auth.Post("/mfa/enroll/confirm", middleware.AuthMiddleware(authUsecase), middleware.DenyImpersonation(), func(c *fiber.Ctx) error {
+		userID, err := utils.GetUserIDFromContext(c)
+		if err != nil {
+			return utils.UnauthorizedResponse(c, "Invalid user context")
+		}
+
+		var req entity.MFACodeRequest
+		if err := c.BodyParser(&req); err != nil {
+			return utils.BadRequestResponse(c, "Invalid request body")
+		}
+
+		if req.Code == "" {
+			return utils.ValidationErrorResponse(c, "Code is required")
+		}
+
+		codes, err := authUsecase.ConfirmMFAEnrollment(c.Context(), userID, req.Code, c.IP())
+		if err != nil {
+			return utils.BadRequestResponse(c, err.Error())
+		}
+
+		return utils.SuccessResponse(c, entity.RecoveryCodesResponse{RecoveryCodes: codes})
+	})
+
+	// POST /api/v1/auth/mfa/recovery-codes - Replace the recovery codes
+	auth.Post("/mfa/recovery-codes", middleware.AuthMiddleware(authUsecase), middleware.DenyImpersonation(), func(c *fiber.Ctx) error {
+		userID, err := utils.GetUserIDFromContext(c)
+		if err != nil {
+			return utils.UnauthorizedResponse(c, "Invalid user context")
+		}
+
+		var req entity.MFACodeRequest
+		if err := c.BodyParser(&req); err != nil {
+			return utils.BadRequestResponse(c, "Invalid request body")
+		}
+
+		if req.Code == "" {
+			return utils.ValidationErrorResponse(c, "Code is required")
+		}
+
+		codes, err := authUsecase.RegenerateRecoveryCodes(c.Context(), userID, req.Code, c.IP())
+		if err != nil {
+			return utils.BadRequestResponse(c, err.Error())
+		}
+
+		return utils.SuccessResponse(c, entity.RecoveryCodesResponse{RecoveryCodes: codes})
+	})
+
+	// POST /api/v1/auth/mfa/disable - Turn MFA off with the password and a code
+	auth.Post("/mfa/disable", middleware.AuthMiddleware(authUsecase), middleware.DenyImpersonation(), func(c *fiber.Ctx) error {
+		userID, err := utils.GetUserIDFromContext(c)
+		if err != nil {
+			return utils.UnauthorizedResponse(c, "Invalid user context")
+		}
+
+		var req entity.DisableMFARequest
+		if err := c.BodyParser(&req); err != nil {
+			return utils.BadRequestResponse(c, "Invalid request body")
+		}
+
+		if req.Password == "" || req.Code == "" {
+			return utils.ValidationErrorResponse(c, "Password and code are required")
+		}
+
+		if err := authUsecase.DisableMFA(c.Context(), userID, &req, c.IP()); err != nil {
+			return utils.BadRequestResponse(c, err.Error())
+		}
+
+		return utils.SuccessMessageResponse(c, "MFA disabled successfully")
+	})
+
+	// POST /api/v1/auth/password/forgot - Mail a password reset link
+	auth.Post("/password/forgot", func(c *fiber.Ctx) error {
+		var req entity.ForgotPasswordRequest
+		if err := c.BodyParser(&req); err != nil {
+			return utils.BadRequestResponse(c, "Invalid request body")
+		}
+
+		if !utils.ValidateEmail(req.Email) {
+			return utils.ValidationErrorResponse(c, "Invalid email format")
+		}
+
+		if err := authUsecase.RequestPasswordReset(c.Context(), req.Email); err != nil {
+			return utils.InternalServerErrorResponse(c, "Failed to request password reset")
+		}
+
+		return utils.SuccessMessageResponse(c, "If the email belongs to an account, a reset link has been sent")
+	})
+
+	// POST /api/v1/auth/password/reset - Set a new password from a reset token
+	auth.Post("/password/reset", func(c *fiber.Ctx) error {
+		var req entity.ResetPasswordRequest
+		if err := c.BodyParser(&req); err != nil {
+			return utils.BadRequestResponse(c, "Invalid request body")
+		}
+
+		if req.Token == "" {
+			return utils.ValidationErrorResponse(c, "Token is required")
+		}
+		if valid, msg := utils.ValidatePassword(req.Password); !valid {
+			return utils.ValidationErrorResponse(c, msg)
+		}
+
+		if err := authUsecase.ResetPassword(c.Context(), req.Token, req.Password); err != nil {
+			return utils.BadRequestResponse(c, err.Error())
+		}
+
+		return utils.SuccessMessageResponse(c, "Password reset, please log in again")
+	})
+
+	// PUT /api/v1/auth/password - Change the password of the current user
+	auth.Put("/password", middleware.AuthMiddleware(authUsecase), middleware.DenyImpersonation(), func(c *fiber.Ctx) error {
+		userID, err := utils.GetUserIDFromContext(c)
+		if err != nil {
+			return utils.UnauthorizedResponse(c, "Invalid user context")
+		}
+
+		var req entity.ChangePasswordRequest
+		if err := c.BodyParser(&req); err != nil {
+			return utils.BadRequestResponse(c, "Invalid request body")
+		}
+
+		if req.CurrentPassword == "" {
+			return utils.ValidationErrorResponse(c, "Current password is required")
+		}
+		if valid, msg := utils.ValidatePassword(req.NewPassword); !valid {
+			return utils.ValidationErrorResponse(c, msg)
+		}
+
+		if err := authUsecase.ChangePassword(c.Context(), userID, utils.GetSessionIDFromContext(c), &req); err != nil {
+			return utils.BadRequestResponse(c, err.Error())
+		}
+
+		return utils.SuccessMessageResponse(c, "Password changed, other sessions have been signed out")
+	})
+
+	// GET /api/v1/auth/sessions - Active sessions of the current user
+	auth.Get("/sessions", middleware.AuthMiddleware(authUsecase), func(c *fiber.Ctx) error {
+		userID, err := utils.GetUserIDFromContext(c)
+		if err != nil {
+			return utils.UnauthorizedResponse(c, "Invalid user context")
+		}
+
+		sessions, err := authUsecase.ListSessions(c.Context(), userID, utils.GetSessionIDFromContext(c))
+		if err != nil {
+			return utils.InternalServerErrorResponse(c, "Failed to fetch sessions")
+		}
+
+		return utils.SuccessResponse(c, sessions)
+	})
+
+	// DELETE /api/v1/auth/sessions/:id - Revoke a session of the current user
+	auth.Delete("/sessions/:id", middleware.AuthMiddleware(authUsecase), middleware.DenyImpersonation(), func(c *fiber.Ctx) error {
+		userID, err := utils.GetUserIDFromContext(c)
+		if err != nil {
+			return utils.UnauthorizedResponse(c, "Invalid user context")
+		}
+
+		id, err := utils.ParseUUID(c.Params("id"))
+		if err != nil {
+			return utils.BadRequestResponse(c, "Invalid session ID")
+		}
+
+		if err := authUsecase.RevokeSession(c.Context(), userID, id); err != nil {
+			return utils.NotFoundResponse(c, "Session not found")
+		}
+
+		return utils.SuccessMessageResponse(c, "Session revoked successfully")
+	})
+
+	// DELETE /api/v1/auth/impersonation - End the impersonation the token belongs to
+	auth.Delete("/impersonation", middleware.AuthMiddleware(authUsecase), func(c *fiber.Ctx) error {
+		userID, err := utils.GetUserIDFromContext(c)
+		if err != nil {
+			return utils.UnauthorizedResponse(c, "Invalid user context")
+		}
+
+		adminID := utils.GetImpersonatorIDFromContext(c)
+		if adminID == uuid.Nil {
+			return utils.BadRequestResponse(c, "Not impersonating")
+		}
+
+		if err := authUsecase.EndImpersonation(c.Context(), userID, utils.GetSessionIDFromContext(c), adminID, c.IP()); err != nil {
+			return utils.BadRequestResponse(c, err.Error())
+		}
+
+		return utils.SuccessMessageResponse(c, "Impersonation ended")
+	})
+
 	// GET /api/v1/auth/profile (protected)
 	auth.Get("/profile", middleware.AuthMiddleware(authUsecase), func(c *fiber.Ctx) error {
 		userID, err := utils.GetUserIDFromContext(c)
@@ -70,7 +364,58 @@ func SetupAuthRoutes(router fiber.Router, authUsecase *usecase.AuthUsecase) {
 		if err != nil {
 			return utils.NotFoundResponse(c, "User not found")
 		}
+		if impersonatorID := utils.GetImpersonatorIDFromContext(c); impersonatorID != uuid.Nil {
+			profile.ImpersonatedBy = &impersonatorID
+		}
 
 		return utils.SuccessResponse(c, profile)
 	})
 }
+
+// SetupWellKnownRoutes serves the public keys at the root so other services
+// can verify access tokens.
+func SetupWellKnownRoutes(app *fiber.App, authUsecase *usecase.AuthUsecase) {
+	// GET /.well-known/jwks.json - Public keys that verify access tokens
+	app.Get("/.well-known/jwks.json", func(c *fiber.Ctx) error {
+		c.Set(fiber.HeaderCacheControl, "public, max-age=300")
+		return c.JSON(authUsecase.JWKS())
+	})
+}
+
+// loginErrors are the login failures whose fixed message is shown to the
+// client.
+var loginErrors = []error{
+	usecase.ErrInvalidCredentials,
+	usecase.ErrAccountInactive,
+	usecase.ErrAuthProviderUnavailable,
+	usecase.ErrAccountNotProvisioned,
+	authprovider.ErrNoRole,
+	usecase.ErrInvalidRefreshToken,
+	usecase.ErrRefreshTokenReused,
+	usecase.ErrInvalidMFAToken,
+	usecase.ErrInvalidMFACode,
+	usecase.ErrMFANotStarted,
+	usecase.ErrMFAAlreadyEnabled,
+	usecase.ErrInvalidLoginState,
+	usecase.ErrSingleSignOnFailed,
+	usecase.ErrIdentityLinked,
+	usecase.ErrNoMatchingAccount,
+	usecase.ErrIdentityWithoutEmail,
+	usecase.ErrStudentClaimTooLong,
+}
+
+// loginError answers a failed login or token refresh. Anything but a known
+// failure, such as a directory or database error, is logged and answered
+// with a generic message, so internals do not reach unauthenticated clients.
+func loginError(c *fiber.Ctx, err error) error {
+	if errors.Is(err, usecase.ErrTooManyLoginAttempts) {
+		return utils.ErrorResponse(c, fiber.StatusTooManyRequests, usecase.ErrTooManyLoginAttempts.Error())
+	}
+	for _, known := range loginErrors {
+		if errors.Is(err, known) {
+			return utils.UnauthorizedResponse(c, known.Error())
+		}
+	}
+	log.Printf("Authentication failed: %v", err)
+	return utils.UnauthorizedResponse(c, "authentication failed")
+}
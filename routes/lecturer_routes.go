@@ -1,6 +1,9 @@
 package routes
 
 import (
+	"errors"
+
+	"github.com/Aryma-f4/uas-backend/app/entity"
 	"github.com/Aryma-f4/uas-backend/app/repository"
 	"github.com/Aryma-f4/uas-backend/app/usecase"
 	"github.com/Aryma-f4/uas-backend/middleware"
@@ -8,7 +11,7 @@ import (
 	"github.com/gofiber/fiber/v2"
 )
 
-func SetupLecturerRoutes(router fiber.Router, lecturerUsecase *usecase.LecturerUsecase, studentUsecase *usecase.StudentUsecase, userRepo *repository.UserRepository, authUsecase *usecase.AuthUsecase) {
+func SetupLecturerRoutes(router fiber.Router, lecturerUsecase *usecase.LecturerUsecase, studentUsecase *usecase.StudentUsecase, policy *usecase.AccessPolicy, userRepo *repository.UserRepository, authUsecase *usecase.AuthUsecase) {
 	lecturers := router.Group("/lecturers")
 	lecturers.Use(middleware.AuthMiddleware(authUsecase))
 
@@ -24,6 +27,16 @@ func SetupLecturerRoutes(router fiber.Router, lecturerUsecase *usecase.LecturerU
 		return utils.PaginatedSuccessResponse(c, lecturerList, page, limit, total)
 	})
 
+	// GET /api/v1/lecturers/workload - Advisee count per lecturer (Admin only)
+	lecturers.Get("/workload", middleware.RequireRole(userRepo, "Admin"), func(c *fiber.Ctx) error {
+		workloads, err := studentUsecase.GetLecturerWorkloads(c.Context())
+		if err != nil {
+			return utils.InternalServerErrorResponse(c, "Failed to fetch lecturer workloads")
+		}
+
+		return utils.SuccessResponse(c, workloads)
+	})
+
 	// GET /api/v1/lecturers/:id - Get lecturer by ID
 	lecturers.Get("/:id", middleware.RequireAnyPermission(userRepo, "lecturer:read", "lecturer:manage"), func(c *fiber.Ctx) error {
 		id, err := utils.ParseUUID(c.Params("id"))
@@ -39,6 +52,26 @@ func SetupLecturerRoutes(router fiber.Router, lecturerUsecase *usecase.LecturerU
 		return utils.SuccessResponse(c, lecturer)
 	})
 
+	// PUT /api/v1/lecturers/:id/department - Link lecturer to a department
+	lecturers.Put("/:id/department", middleware.DenyImpersonation(), middleware.RequirePermission(userRepo, "lecturer:manage"), func(c *fiber.Ctx) error {
+		id, err := utils.ParseUUID(c.Params("id"))
+		if err != nil {
+			return utils.BadRequestResponse(c, "Invalid lecturer ID")
+		}
+
+		var req entity.UpdateDepartmentRequest
+		if err := c.BodyParser(&req); err != nil {
+			return utils.BadRequestResponse(c, "Invalid request body")
+		}
+
+		lecturer, err := lecturerUsecase.UpdateDepartment(c.Context(), id, req.DepartmentID)
+		if err != nil {
+			return utils.NotFoundResponse(c, err.Error())
+		}
+
+		return utils.SuccessWithMessageResponse(c, "Department updated successfully", lecturer)
+	})
+
 	// GET /api/v1/lecturers/:id/advisees - Get lecturer's advisees
 	lecturers.Get("/:id/advisees", middleware.RequireAnyPermission(userRepo, "lecturer:read", "student:read"), func(c *fiber.Ctx) error {
 		id, err := utils.ParseUUID(c.Params("id"))
@@ -46,6 +79,13 @@ func SetupLecturerRoutes(router fiber.Router, lecturerUsecase *usecase.LecturerU
 			return utils.BadRequestResponse(c, "Invalid lecturer ID")
 		}
 
+		if err := policy.AuthorizeAdvisees(c.Context(), middleware.Subject(c), id); err != nil {
+			if errors.Is(err, usecase.ErrLecturerNotFound) {
+				return utils.NotFoundResponse(c, "Lecturer not found")
+			}
+			return utils.InternalServerErrorResponse(c, "Failed to check lecturer access")
+		}
+
 		page, limit, offset := utils.ParsePagination(c)
 
 		advisees, total, err := lecturerUsecase.GetAdvisees(c.Context(), id, limit, offset)
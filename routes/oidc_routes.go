@@ -0,0 +1,51 @@
+package routes
+
+import (
+	"github.com/Aryma-f4/uas-backend/app/usecase"
+	"github.com/Aryma-f4/uas-backend/utils"
+	"github.com/gofiber/fiber/v2"
+)
+
+func SetupOIDCRoutes(router fiber.Router, oidcUsecase *usecase.OIDCUsecase) {
+	sso := router.Group("/auth/oidc", func(c *fiber.Ctx) error {
+		if !oidcUsecase.Enabled() {
+			return utils.NotFoundResponse(c, "Single sign-on is not configured")
+		}
+		return c.Next()
+	})
+
+	// GET /api/v1/auth/oidc/login - Redirect to the identity provider, or
+	// return the URL with ?redirect=false
+	sso.Get("/login", func(c *fiber.Ctx) error {
+		url, err := oidcUsecase.LoginURL(c.Context())
+		if err != nil {
+			return utils.ErrorResponse(c, fiber.StatusBadGateway, "Identity provider unavailable")
+		}
+
+		if c.Query("redirect") == "false" {
+			return utils.SuccessResponse(c, fiber.Map{"authorization_url": url})
+		}
+		return c.Redirect(url, fiber.StatusFound)
+	})
+
+	// GET /api/v1/auth/oidc/callback - Finish the login with the code from
+	// the identity provider
+	sso.Get("/callback", func(c *fiber.Ctx) error {
+		if errParam := c.Query("error"); errParam != "" {
+			message := c.Query("error_description", errParam)
+			return utils.UnauthorizedResponse(c, "Single sign-on failed: "+message)
+		}
+
+		code, state := c.Query("code"), c.Query("state")
+		if code == "" || state == "" {
+			return utils.ValidationErrorResponse(c, "code and state are required")
+		}
+
+		response, err := oidcUsecase.Callback(c.Context(), code, state, c.Get(fiber.HeaderUserAgent), c.IP())
+		if err != nil {
+			return loginError(c, err)
+		}
+
+		return utils.SuccessResponse(c, response)
+	})
+}
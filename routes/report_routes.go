@@ -1,61 +1,166 @@
 package routes
 
 import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/Aryma-f4/uas-backend/app/entity"
 	"github.com/Aryma-f4/uas-backend/app/repository"
 	"github.com/Aryma-f4/uas-backend/app/usecase"
 	"github.com/Aryma-f4/uas-backend/middleware"
 	"github.com/Aryma-f4/uas-backend/utils"
 	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
 )
 
-func SetupReportRoutes(router fiber.Router, achievementUsecase *usecase.AchievementUsecase, studentUsecase *usecase.StudentUsecase, userRepo *repository.UserRepository, authUsecase *usecase.AuthUsecase) {
+func SetupReportRoutes(router fiber.Router, achievementUsecase *usecase.AchievementUsecase, statisticsUsecase *usecase.StatisticsUsecase, accreditationUsecase *usecase.AccreditationUsecase, timeSeriesUsecase *usecase.TimeSeriesUsecase, studentUsecase *usecase.StudentUsecase, policy *usecase.AccessPolicy, userRepo *repository.UserRepository, authUsecase *usecase.AuthUsecase) {
 	reports := router.Group("/reports")
 	reports.Use(middleware.AuthMiddleware(authUsecase))
 
-	// GET /api/v1/reports/statistics - Get overall statistics
+	// GET /api/v1/reports/statistics - Statistics of the students the caller may access
 	reports.Get("/statistics", middleware.RequireAnyPermission(userRepo, "report:read", "report:all"), func(c *fiber.Ctx) error {
-		roleName := utils.GetRoleNameFromContext(c)
+		trendBy, ok := parseTrendBy(c)
+		if !ok {
+			return utils.BadRequestResponse(c, "trend_by must be event or verified")
+		}
 
-		var stats interface{}
-		var err error
+		studentIDs, err := policy.Scope(c.Context(), middleware.Subject(c))
+		if err != nil {
+			return utils.InternalServerErrorResponse(c, "Failed to resolve report scope")
+		}
 
-		switch roleName {
-		case "Admin":
-			// Admin sees all statistics
-			stats, err = achievementUsecase.GetStatistics(c.Context(), nil)
-		case "Dosen Wali":
-			// Dosen Wali sees statistics of their advisees
-			userID, _ := utils.GetUserIDFromContext(c)
-			lecturer, lerr := userRepo.GetLecturerByUserID(c.Context(), userID)
-			if lerr != nil {
-				return utils.ForbiddenResponse(c, "Lecturer profile not found")
-			}
-			
-			// Get advisee IDs and calculate stats
-			advisees, _, _ := studentUsecase.GetAdvisees(c.Context(), lecturer.ID, 1000, 0)
-			if len(advisees) > 0 {
-				// Calculate combined stats for all advisees
-				stats, err = achievementUsecase.GetStatistics(c.Context(), &advisees[0].ID)
-			} else {
-				stats = map[string]interface{}{
-					"total_achievements": 0,
-					"total_verified":     0,
-					"total_pending":      0,
-					"total_rejected":     0,
-				}
+		stats, err := statisticsUsecase.GetStatistics(c.Context(), studentIDs, trendBy)
+		if err != nil {
+			return utils.InternalServerErrorResponse(c, "Failed to fetch statistics")
+		}
+
+		return utils.SuccessResponse(c, stats)
+	})
+
+	// POST /api/v1/reports/statistics/refresh - Rebuild the statistics tables now (Admin only)
+	reports.Post("/statistics/refresh", middleware.RequireRole(userRepo, "Admin"), func(c *fiber.Ctx) error {
+		if err := statisticsUsecase.RefreshAll(c.Context()); err != nil {
+			return utils.InternalServerErrorResponse(c, "Failed to refresh statistics")
+		}
+
+		return utils.SuccessMessageResponse(c, "Statistics refreshed")
+	})
+
+	// GET /api/v1/reports/advisees - Advisee statistics of the calling lecturer, or of lecturer_id
+	reports.Get("/advisees", middleware.RequireAnyPermission(userRepo, "report:read", "report:all"), func(c *fiber.Ctx) error {
+		trendBy, ok := parseTrendBy(c)
+		if !ok {
+			return utils.BadRequestResponse(c, "trend_by must be event or verified")
+		}
+
+		var lecturerID uuid.UUID
+		if c.Query("lecturer_id") != "" {
+			id, err := utils.ParseUUID(c.Query("lecturer_id"))
+			if err != nil {
+				return utils.BadRequestResponse(c, "Invalid lecturer ID")
 			}
-		case "Mahasiswa":
-			// Mahasiswa sees their own statistics
+			lecturerID = id
+		} else {
 			userID, _ := utils.GetUserIDFromContext(c)
-			student, serr := userRepo.GetStudentByUserID(c.Context(), userID)
-			if serr != nil {
-				return utils.ForbiddenResponse(c, "Student profile not found")
+			lecturer, err := userRepo.GetLecturerByUserID(c.Context(), userID)
+			if err != nil {
+				return utils.BadRequestResponse(c, "lecturer_id is required")
+			}
+			lecturerID = lecturer.ID
+		}
+
+		if err := policy.AuthorizeAdvisees(c.Context(), middleware.Subject(c), lecturerID); err != nil {
+			if errors.Is(err, usecase.ErrLecturerNotFound) {
+				return utils.NotFoundResponse(c, "Lecturer not found")
 			}
-			stats, err = achievementUsecase.GetStatistics(c.Context(), &student.ID)
+			return utils.InternalServerErrorResponse(c, "Failed to check lecturer access")
+		}
+
+		stats, err := statisticsUsecase.GetAdviseeStatistics(c.Context(), lecturerID, trendBy)
+		if err != nil {
+			return utils.InternalServerErrorResponse(c, "Failed to fetch statistics")
+		}
+
+		return utils.SuccessResponse(c, stats)
+	})
+
+	// GET /api/v1/reports/timeseries - Submissions, verifications, rejections or points over time, scoped like the achievement list
+	reports.Get("/timeseries", middleware.RequireAnyPermission(userRepo, "report:read", "report:all"), func(c *fiber.Ctx) error {
+		var filter entity.TimeSeriesFilter
+		if err := c.QueryParser(&filter); err != nil {
+			return utils.BadRequestResponse(c, "Invalid query parameters")
+		}
+
+		studentIDs, err := achievementUsecase.ResolveScope(c.Context(), middleware.Subject(c))
+		if err != nil {
+			return utils.InternalServerErrorResponse(c, "Failed to resolve report scope")
+		}
+
+		series, err := timeSeriesUsecase.GetTimeSeries(c.Context(), studentIDs, &filter)
+		if err != nil {
+			return utils.BadRequestResponse(c, err.Error())
+		}
+
+		return utils.SuccessResponse(c, series)
+	})
+
+	// GET /api/v1/reports/leaderboard - Students ranked by verified points
+	reports.Get("/leaderboard", middleware.RequireAnyPermission(userRepo, "report:read", "report:all"), func(c *fiber.Ctx) error {
+		var filter entity.LeaderboardFilter
+		if err := c.QueryParser(&filter); err != nil {
+			return utils.BadRequestResponse(c, "Invalid query parameters")
+		}
+
+		// Only users who manage students may see students who opted out
+		if !middleware.Subject(c).HasPermission(entity.PermissionStudentManage) {
+			filter.IncludeHidden = false
+		}
+
+		entries, total, err := achievementUsecase.GetLeaderboard(c.Context(), &filter)
+		if err != nil {
+			return utils.BadRequestResponse(c, err.Error())
+		}
+
+		page, limit, _ := utils.ParsePagination(c)
+		return utils.PaginatedSuccessResponse(c, entries, page, limit, total)
+	})
+
+	// PUT /api/v1/reports/leaderboard/visibility - Student hides or shows themselves on leaderboards
+	reports.Put("/leaderboard/visibility", middleware.RequireRole(userRepo, "Mahasiswa"), func(c *fiber.Ctx) error {
+		userID, err := utils.GetUserIDFromContext(c)
+		if err != nil {
+			return utils.UnauthorizedResponse(c, "Invalid user context")
+		}
+
+		var req entity.LeaderboardVisibilityRequest
+		if err := c.BodyParser(&req); err != nil {
+			return utils.BadRequestResponse(c, "Invalid request body")
+		}
+
+		if err := achievementUsecase.SetLeaderboardVisibility(c.Context(), userID, req.Hidden); err != nil {
+			return utils.NotFoundResponse(c, err.Error())
+		}
+
+		return utils.SuccessWithMessageResponse(c, "Leaderboard visibility updated", req)
+	})
+
+	// GET /api/v1/reports/statistics/by-unit - Statistics grouped by faculty, department or study program
+	reports.Get("/statistics/by-unit", middleware.RequirePermission(userRepo, "report:all"), func(c *fiber.Ctx) error {
+		filter, err := parseUnitFilter(c)
+		if err != nil {
+			return utils.BadRequestResponse(c, err.Error())
+		}
+
+		level := c.Query("level", entity.UnitLevelFaculty)
+		switch level {
+		case entity.UnitLevelFaculty, entity.UnitLevelDepartment, entity.UnitLevelStudyProgram:
 		default:
-			return utils.ForbiddenResponse(c, "Insufficient permissions")
+			return utils.BadRequestResponse(c, "level must be faculty, department or study_program")
 		}
 
+		stats, err := statisticsUsecase.GetStatisticsByUnit(c.Context(), level, filter)
 		if err != nil {
 			return utils.InternalServerErrorResponse(c, "Failed to fetch statistics")
 		}
@@ -63,6 +168,45 @@ func SetupReportRoutes(router fiber.Router, achievementUsecase *usecase.Achievem
 		return utils.SuccessResponse(c, stats)
 	})
 
+	// GET /api/v1/reports/accreditation?study_program_id=&years=3&year=&format=json|xlsx - Accreditation table of a study program
+	reports.Get("/accreditation", middleware.RequirePermission(userRepo, "report:all"), func(c *fiber.Ctx) error {
+		programID, err := utils.ParseUUID(c.Query("study_program_id"))
+		if err != nil {
+			return utils.BadRequestResponse(c, "study_program_id is required")
+		}
+
+		format := c.Query("format", "json")
+		if format != "json" && format != "xlsx" {
+			return utils.BadRequestResponse(c, "Format must be json or xlsx")
+		}
+
+		years, err := strconv.Atoi(c.Query("years", strconv.Itoa(entity.AccreditationDefaultYears)))
+		if err != nil {
+			return utils.BadRequestResponse(c, "years must be a number")
+		}
+		endYear, err := strconv.Atoi(c.Query("year", strconv.Itoa(time.Now().Year())))
+		if err != nil {
+			return utils.BadRequestResponse(c, "year must be a number")
+		}
+
+		report, err := accreditationUsecase.GetReport(c.Context(), programID, endYear, years)
+		if err != nil {
+			return utils.BadRequestResponse(c, err.Error())
+		}
+
+		if format == "json" {
+			return utils.SuccessResponse(c, report)
+		}
+
+		c.Set(fiber.HeaderContentType, utils.SpreadsheetContentType(format))
+		c.Set(fiber.HeaderContentDisposition, `attachment; filename="accreditation-`+report.StudyProgram.Code+"-"+strconv.Itoa(endYear)+`.xlsx"`)
+		streamSpreadsheet(c, format, "Accreditation", func(_ context.Context, write func([]string) error) error {
+			return accreditationUsecase.WriteReport(report, write)
+		})
+
+		return nil
+	})
+
 	// GET /api/v1/reports/student/:id - Get student-specific report
 	reports.Get("/student/:id", middleware.RequireAnyPermission(userRepo, "report:read", "report:all"), func(c *fiber.Ctx) error {
 		studentID, err := utils.ParseUUID(c.Params("id"))
@@ -70,6 +214,15 @@ func SetupReportRoutes(router fiber.Router, achievementUsecase *usecase.Achievem
 			return utils.BadRequestResponse(c, "Invalid student ID")
 		}
 
+		trendBy, ok := parseTrendBy(c)
+		if !ok {
+			return utils.BadRequestResponse(c, "trend_by must be event or verified")
+		}
+
+		if err := policy.AuthorizeStudent(c.Context(), middleware.Subject(c), studentID); err != nil {
+			return studentAccessError(c, err)
+		}
+
 		// Get student info
 		student, err := studentUsecase.GetByID(c.Context(), studentID)
 		if err != nil {
@@ -77,13 +230,13 @@ func SetupReportRoutes(router fiber.Router, achievementUsecase *usecase.Achievem
 		}
 
 		// Get statistics
-		stats, err := achievementUsecase.GetStatistics(c.Context(), &studentID)
+		stats, err := statisticsUsecase.GetStatistics(c.Context(), []uuid.UUID{studentID}, trendBy)
 		if err != nil {
 			return utils.InternalServerErrorResponse(c, "Failed to fetch statistics")
 		}
 
 		// Get achievements
-		achievements, _, err := achievementUsecase.ListByStudentID(c.Context(), studentID, 100, 0)
+		achievements, _, err := achievementUsecase.ListByStudentID(c.Context(), middleware.Subject(c), studentID, 100, 0)
 		if err != nil {
 			return utils.InternalServerErrorResponse(c, "Failed to fetch achievements")
 		}
@@ -105,3 +258,9 @@ func SetupReportRoutes(router fiber.Router, achievementUsecase *usecase.Achievem
 		return utils.SuccessResponse(c, report)
 	})
 }
+
+// parseTrendBy reads the trend_by query parameter, defaulting to event date.
+func parseTrendBy(c *fiber.Ctx) (string, bool) {
+	trendBy := c.Query("trend_by", entity.TrendByEvent)
+	return trendBy, trendBy == entity.TrendByEvent || trendBy == entity.TrendByVerified
+}
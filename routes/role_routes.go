@@ -0,0 +1,152 @@
+package routes
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/Aryma-f4/uas-backend/app/entity"
+	"github.com/Aryma-f4/uas-backend/app/repository"
+	"github.com/Aryma-f4/uas-backend/app/usecase"
+	"github.com/Aryma-f4/uas-backend/middleware"
+	"github.com/Aryma-f4/uas-backend/utils"
+	"github.com/gofiber/fiber/v2"
+)
+
+func SetupRoleRoutes(router fiber.Router, roleUsecase *usecase.RoleUsecase, userRepo *repository.UserRepository, authUsecase *usecase.AuthUsecase) {
+	auth := middleware.AuthMiddleware(authUsecase)
+	adminOnly := middleware.RequireRole(userRepo, "Admin")
+
+	roles := router.Group("/roles")
+	roles.Use(auth, adminOnly, middleware.DenyImpersonation())
+
+	// GET /api/v1/roles - List roles with their permissions
+	roles.Get("/", func(c *fiber.Ctx) error {
+		list, err := roleUsecase.List(c.Context())
+		if err != nil {
+			return utils.InternalServerErrorResponse(c, "Failed to fetch roles")
+		}
+		return utils.SuccessResponse(c, list)
+	})
+
+	// POST /api/v1/roles - Create role
+	roles.Post("/", func(c *fiber.Ctx) error {
+		var req entity.CreateRoleRequest
+		if err := c.BodyParser(&req); err != nil {
+			return utils.BadRequestResponse(c, "Invalid request body")
+		}
+
+		role, err := roleUsecase.Create(c.Context(), &req)
+		if err != nil {
+			return utils.BadRequestResponse(c, err.Error())
+		}
+		return c.Status(fiber.StatusCreated).JSON(utils.Response{
+			Status:  "success",
+			Message: "Role created successfully",
+			Data:    role,
+		})
+	})
+
+	// GET /api/v1/roles/:id - Get role with its permissions
+	roles.Get("/:id", func(c *fiber.Ctx) error {
+		id, err := utils.ParseUUID(c.Params("id"))
+		if err != nil {
+			return utils.BadRequestResponse(c, "Invalid role ID")
+		}
+
+		role, err := roleUsecase.Get(c.Context(), id)
+		if err != nil {
+			return utils.NotFoundResponse(c, "Role not found")
+		}
+		return utils.SuccessResponse(c, role)
+	})
+
+	// PUT /api/v1/roles/:id - Update name, description or permissions of a role
+	roles.Put("/:id", func(c *fiber.Ctx) error {
+		id, err := utils.ParseUUID(c.Params("id"))
+		if err != nil {
+			return utils.BadRequestResponse(c, "Invalid role ID")
+		}
+
+		var req entity.EditRoleRequest
+		if err := c.BodyParser(&req); err != nil {
+			return utils.BadRequestResponse(c, "Invalid request body")
+		}
+
+		role, err := roleUsecase.Update(c.Context(), id, &req)
+		if errors.Is(err, sql.ErrNoRows) {
+			return utils.NotFoundResponse(c, "Role not found")
+		}
+		if err != nil {
+			return utils.BadRequestResponse(c, err.Error())
+		}
+		return utils.SuccessResponse(c, role)
+	})
+
+	// DELETE /api/v1/roles/:id - Delete a role without users; built-in roles cannot be deleted
+	roles.Delete("/:id", func(c *fiber.Ctx) error {
+		id, err := utils.ParseUUID(c.Params("id"))
+		if err != nil {
+			return utils.BadRequestResponse(c, "Invalid role ID")
+		}
+
+		err = roleUsecase.Delete(c.Context(), id)
+		if errors.Is(err, sql.ErrNoRows) {
+			return utils.NotFoundResponse(c, "Role not found")
+		}
+		if err != nil {
+			return utils.BadRequestResponse(c, err.Error())
+		}
+		return utils.SuccessMessageResponse(c, "Role deleted successfully")
+	})
+
+	// POST /api/v1/roles/:id/permissions - Grant permissions to a role
+	roles.Post("/:id/permissions", func(c *fiber.Ctx) error {
+		id, err := utils.ParseUUID(c.Params("id"))
+		if err != nil {
+			return utils.BadRequestResponse(c, "Invalid role ID")
+		}
+
+		var req entity.RolePermissionsRequest
+		if err := c.BodyParser(&req); err != nil {
+			return utils.BadRequestResponse(c, "Invalid request body")
+		}
+
+		role, err := roleUsecase.GrantPermissions(c.Context(), id, req.Permissions)
+		if errors.Is(err, sql.ErrNoRows) {
+			return utils.NotFoundResponse(c, "Role not found")
+		}
+		if err != nil {
+			return utils.BadRequestResponse(c, err.Error())
+		}
+		return utils.SuccessWithMessageResponse(c, "Permissions granted successfully", role)
+	})
+
+	// DELETE /api/v1/roles/:id/permissions/:name - Revoke a permission from a role
+	roles.Delete("/:id/permissions/:name", func(c *fiber.Ctx) error {
+		id, err := utils.ParseUUID(c.Params("id"))
+		if err != nil {
+			return utils.BadRequestResponse(c, "Invalid role ID")
+		}
+
+		role, err := roleUsecase.RevokePermission(c.Context(), id, c.Params("name"))
+		if errors.Is(err, sql.ErrNoRows) {
+			return utils.NotFoundResponse(c, "Role not found")
+		}
+		if err != nil {
+			return utils.NotFoundResponse(c, err.Error())
+		}
+		return utils.SuccessWithMessageResponse(c, "Permission revoked successfully", role)
+	})
+
+	permissions := router.Group("/permissions")
+	permissions.Use(auth, adminOnly, middleware.DenyImpersonation())
+
+	// GET /api/v1/permissions - List permissions
+	permissions.Get("/", func(c *fiber.Ctx) error {
+		list, err := roleUsecase.ListPermissions(c.Context())
+		if err != nil {
+			return utils.InternalServerErrorResponse(c, "Failed to fetch permissions")
+		}
+		return utils.SuccessResponse(c, list)
+	})
+}
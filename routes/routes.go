@@ -1,12 +1,20 @@
 package routes
 
 import (
+	"context"
 	"database/sql"
 	"log"
+	"strings"
+	"time"
 
+	"github.com/Aryma-f4/uas-backend/app/authprovider"
+	"github.com/Aryma-f4/uas-backend/app/mailer"
+	"github.com/Aryma-f4/uas-backend/app/oidc"
 	"github.com/Aryma-f4/uas-backend/app/repository"
 	"github.com/Aryma-f4/uas-backend/app/usecase"
 	"github.com/Aryma-f4/uas-backend/config"
+	"github.com/Aryma-f4/uas-backend/middleware"
+	"github.com/Aryma-f4/uas-backend/utils"
 	"github.com/gofiber/fiber/v2"
 	"go.mongodb.org/mongo-driver/mongo"
 )
@@ -16,7 +24,22 @@ func SetupRoutes(app *fiber.App, db *sql.DB, mongoDB *mongo.Database, cfg *confi
 	userRepo := repository.NewUserRepository(db)
 	studentRepo := repository.NewStudentRepository(db)
 	lecturerRepo := repository.NewLecturerRepository(db)
+	unitRepo := repository.NewAcademicUnitRepository(db)
+	statisticsRepo := repository.NewStatisticsRepository(db)
+	securityRepo := repository.NewSecurityRepository(db)
+	serviceAccountRepo := repository.NewServiceAccountRepository(db)
+	roleRepo := repository.NewRoleRepository(db, userRepo.PermissionCache())
 	
+	// Role permissions are served from memory; load them now so the first
+	// requests do not wait for it
+	if db != nil && cfg != nil {
+		permissions := userRepo.PermissionCache()
+		permissions.SetCheckInterval(time.Duration(cfg.PermissionCacheCheckSeconds) * time.Second)
+		if err := permissions.Load(context.Background()); err != nil {
+			log.Printf("Failed to load role permissions: %v", err)
+		}
+	}
+
 	// PERBAIKAN: Guard mongoDB != nil sebelum membuat achievementRepo
 	var achievementRepo *repository.AchievementRepository
 	if mongoDB != nil {
@@ -27,23 +50,139 @@ func SetupRoutes(app *fiber.App, db *sql.DB, mongoDB *mongo.Database, cfg *confi
 		achievementRepo = nil
 	}
 
+	// Mails are only logged until SMTP is configured
+	var mail mailer.Mailer = mailer.NewLogMailer()
+	if cfg != nil && cfg.SMTPHost != "" {
+		mail = mailer.NewSMTPMailer(mailer.SMTPConfig{
+			Host:     cfg.SMTPHost,
+			Port:     cfg.SMTPPort,
+			Username: cfg.SMTPUsername,
+			Password: cfg.SMTPPassword,
+			From:     cfg.SMTPFrom,
+		})
+	}
+
+	// Access token keys; the test setup runs without config
+	var keys *utils.KeySet
+	if cfg != nil {
+		var err error
+		if keys, err = loadKeySet(cfg); err != nil {
+			log.Fatalf("Failed to load JWT keys: %v", err)
+		}
+	}
+
+	// Password checks; the test setup runs without config
+	providers := authprovider.NewRegistry(authprovider.NewLocalProvider())
+	if cfg != nil {
+		if err := registerLDAP(providers, cfg); err != nil {
+			log.Fatalf("Failed to configure LDAP: %v", err)
+		}
+	}
+
+	// Single sign-on stays off until an identity provider is configured
+	var oidcProvider *oidc.Provider
+	if cfg != nil && cfg.OIDCIssuerURL != "" {
+		oidcProvider = oidc.NewProvider(oidc.Config{
+			IssuerURL:    cfg.OIDCIssuerURL,
+			ClientID:     cfg.OIDCClientID,
+			ClientSecret: cfg.OIDCClientSecret,
+			RedirectURL:  cfg.OIDCRedirectURL,
+			Scopes:       strings.Fields(cfg.OIDCScopes),
+		})
+	}
+
 	// Initialize usecases
-	authUsecase := usecase.NewAuthUsecase(userRepo, cfg)
-	userUsecase := usecase.NewUserUsecase(userRepo, studentRepo, lecturerRepo, authUsecase)
+	authUsecase := usecase.NewAuthUsecase(userRepo, securityRepo, serviceAccountRepo, mail, keys, providers, cfg)
+	serviceAccountUsecase := usecase.NewServiceAccountUsecase(serviceAccountRepo, authUsecase)
+	oidcUsecase := usecase.NewOIDCUsecase(oidcProvider, userRepo, studentRepo, securityRepo, authUsecase, cfg)
+	roleUsecase := usecase.NewRoleUsecase(roleRepo)
+	userUsecase := usecase.NewUserUsecase(userRepo, studentRepo, lecturerRepo, unitRepo, authUsecase)
+	rosterImportUsecase := usecase.NewRosterImportUsecase(userRepo, lecturerRepo, unitRepo, authUsecase, cfg)
+	
+	policy := usecase.NewAccessPolicy(studentRepo, lecturerRepo, unitRepo)
 	
 	// PERBAIKAN: Pass nil achievementRepo jika mongoDB nil
-	achievementUsecase := usecase. NewAchievementUsecase(achievementRepo, studentRepo, userRepo)
-	studentUsecase := usecase.NewStudentUsecase(studentRepo, lecturerRepo)
+	statisticsUsecase := usecase.NewStatisticsUsecase(achievementRepo, studentRepo, unitRepo, statisticsRepo)
+	achievementUsecase := usecase. NewAchievementUsecase(achievementRepo, studentRepo, userRepo, statisticsUsecase, policy)
+	achievementImportUsecase := usecase.NewAchievementImportUsecase(achievementRepo, studentRepo, statisticsUsecase)
+	studentUsecase := usecase.NewStudentUsecase(studentRepo, lecturerRepo, unitRepo, cfg)
 	lecturerUsecase := usecase.NewLecturerUsecase(lecturerRepo, studentRepo)
+	academicUnitUsecase := usecase.NewAcademicUnitUsecase(unitRepo)
+	accreditationUsecase := usecase.NewAccreditationUsecase(achievementRepo, studentRepo, unitRepo)
+	timeSeriesUsecase := usecase.NewTimeSeriesUsecase(achievementRepo)
+
+	SetupWellKnownRoutes(app, authUsecase)
 
 	// API v1 group
 	api := app.Group("/api/v1")
 
 	// Setup route groups
 	SetupAuthRoutes(api, authUsecase)
-	SetupUserRoutes(api, userUsecase, userRepo, authUsecase)
-	SetupAchievementRoutes(api, achievementUsecase, userRepo, authUsecase)
-	SetupStudentRoutes(api, studentUsecase, achievementUsecase, userRepo, authUsecase)
-	SetupLecturerRoutes(api, lecturerUsecase, studentUsecase, userRepo, authUsecase)
-	SetupReportRoutes(api, achievementUsecase, studentUsecase, userRepo, authUsecase)
+	SetupOIDCRoutes(api, oidcUsecase)
+	SetupUserRoutes(api, userUsecase, rosterImportUsecase, userRepo, authUsecase)
+	SetupRoleRoutes(api, roleUsecase, userRepo, authUsecase)
+	SetupServiceAccountRoutes(api, serviceAccountUsecase, userRepo, authUsecase)
+	SetupAchievementRoutes(api, achievementUsecase, achievementImportUsecase, userRepo, authUsecase)
+	SetupStudentRoutes(api, studentUsecase, achievementUsecase, policy, userRepo, authUsecase)
+	SetupLecturerRoutes(api, lecturerUsecase, studentUsecase, policy, userRepo, authUsecase)
+	SetupReportRoutes(api, achievementUsecase, statisticsUsecase, accreditationUsecase, timeSeriesUsecase, studentUsecase, policy, userRepo, authUsecase)
+	SetupAcademicUnitRoutes(api, academicUnitUsecase, userRepo, authUsecase)
+
+	// Register permissions added since the database was seeded, including
+	// any the routes above require but nobody created yet
+	if db != nil {
+		added, err := roleUsecase.SyncPermissions(context.Background(), config.Permissions, middleware.ReferencedPermissions())
+		if err != nil {
+			log.Printf("Failed to sync permissions: %v", err)
+		} else if len(added) > 0 {
+			log.Printf("Added permissions: %s", strings.Join(added, ", "))
+		}
+	}
+
+	// Rebuild the statistics tables in the background; skipped in stub mode
+	if achievementRepo != nil && cfg != nil {
+		interval := time.Duration(cfg.StatisticsRefreshMinutes) * time.Minute
+		go statisticsUsecase.RunScheduler(context.Background(), interval)
+	}
+}
+
+// loadKeySet loads the asymmetric signing keys, falling back to the legacy
+// HS256 secret when no key directory is configured.
+func loadKeySet(cfg *config.Config) (*utils.KeySet, error) {
+	if cfg.JWTKeysDir == "" {
+		log.Println("[WARN] JWT_KEYS_DIR not set, signing tokens with the legacy HS256 secret")
+		return utils.NewHMACKeySet(cfg.JWTSecret), nil
+	}
+
+	keys, err := utils.LoadKeySet(cfg.JWTKeysDir, cfg.JWTSigningKeyID, cfg.JWTSecret, cfg.JWTAcceptHS256)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Signing access tokens with %s", keys.Algorithm())
+	return keys, nil
+}
+
+// registerLDAP adds the LDAP provider when a directory is configured.
+func registerLDAP(providers *authprovider.Registry, cfg *config.Config) error {
+	if cfg.LDAPURL == "" {
+		return nil
+	}
+
+	groupRoles, err := authprovider.ParseGroupRoles(cfg.LDAPGroupRoles)
+	if err != nil {
+		return err
+	}
+	providers.Register(authprovider.NewLDAPProvider(authprovider.LDAPConfig{
+		URL:               cfg.LDAPURL,
+		StartTLS:          cfg.LDAPStartTLS,
+		BindDN:            cfg.LDAPBindDN,
+		BindPassword:      cfg.LDAPBindPassword,
+		BaseDN:            cfg.LDAPBaseDN,
+		UserFilter:        cfg.LDAPUserFilter,
+		UsernameAttribute: cfg.LDAPUsernameAttribute,
+		GroupAttribute:    cfg.LDAPGroupAttribute,
+		GroupRoles:        groupRoles,
+	}), strings.Split(cfg.LDAPDomains, ",")...)
+	log.Printf("LDAP authentication enabled against %s", cfg.LDAPURL)
+	return nil
 }
@@ -0,0 +1,195 @@
+package routes
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/Aryma-f4/uas-backend/app/entity"
+	"github.com/Aryma-f4/uas-backend/app/repository"
+	"github.com/Aryma-f4/uas-backend/app/usecase"
+	"github.com/Aryma-f4/uas-backend/middleware"
+	"github.com/Aryma-f4/uas-backend/utils"
+	"github.com/gofiber/fiber/v2"
+)
+
+func SetupServiceAccountRoutes(router fiber.Router, serviceAccountUsecase *usecase.ServiceAccountUsecase, userRepo *repository.UserRepository, authUsecase *usecase.AuthUsecase) {
+	accounts := router.Group("/service-accounts")
+
+	// Service accounts are managed by admins only
+	accounts.Use(middleware.AuthMiddleware(authUsecase))
+	accounts.Use(middleware.RequireRole(userRepo, "Admin"))
+	accounts.Use(middleware.DenyImpersonation())
+
+	// GET /api/v1/service-accounts - List service accounts
+	accounts.Get("/", func(c *fiber.Ctx) error {
+		list, err := serviceAccountUsecase.List(c.Context())
+		if err != nil {
+			return utils.InternalServerErrorResponse(c, "Failed to fetch service accounts")
+		}
+
+		return utils.SuccessResponse(c, list)
+	})
+
+	// POST /api/v1/service-accounts - Create a service account; the response holds its first key
+	accounts.Post("/", func(c *fiber.Ctx) error {
+		adminID, err := utils.GetUserIDFromContext(c)
+		if err != nil {
+			return utils.UnauthorizedResponse(c, "Invalid user context")
+		}
+
+		var req entity.CreateServiceAccountRequest
+		if err := c.BodyParser(&req); err != nil {
+			return utils.BadRequestResponse(c, "Invalid request body")
+		}
+
+		response, err := serviceAccountUsecase.Create(c.Context(), &req, adminID, c.IP())
+		if err != nil {
+			return utils.BadRequestResponse(c, err.Error())
+		}
+
+		return utils.SuccessWithMessageResponse(c, "Service account created; store the key now, it is not shown again", response)
+	})
+
+	// GET /api/v1/service-accounts/:id - Get a service account with its keys
+	accounts.Get("/:id", func(c *fiber.Ctx) error {
+		id, err := utils.ParseUUID(c.Params("id"))
+		if err != nil {
+			return utils.BadRequestResponse(c, "Invalid service account ID")
+		}
+
+		account, err := serviceAccountUsecase.Get(c.Context(), id)
+		if err != nil {
+			return utils.NotFoundResponse(c, "Service account not found")
+		}
+
+		return utils.SuccessResponse(c, account)
+	})
+
+	// PUT /api/v1/service-accounts/:id - Update description, permissions, allowed IPs or active flag
+	accounts.Put("/:id", func(c *fiber.Ctx) error {
+		id, err := utils.ParseUUID(c.Params("id"))
+		if err != nil {
+			return utils.BadRequestResponse(c, "Invalid service account ID")
+		}
+
+		var req entity.UpdateServiceAccountRequest
+		if err := c.BodyParser(&req); err != nil {
+			return utils.BadRequestResponse(c, "Invalid request body")
+		}
+
+		account, err := serviceAccountUsecase.Update(c.Context(), id, &req)
+		if errors.Is(err, sql.ErrNoRows) {
+			return utils.NotFoundResponse(c, "Service account not found")
+		}
+		if err != nil {
+			return utils.BadRequestResponse(c, err.Error())
+		}
+
+		return utils.SuccessResponse(c, account)
+	})
+
+	// DELETE /api/v1/service-accounts/:id - Delete a service account and its keys
+	accounts.Delete("/:id", func(c *fiber.Ctx) error {
+		id, err := utils.ParseUUID(c.Params("id"))
+		if err != nil {
+			return utils.BadRequestResponse(c, "Invalid service account ID")
+		}
+
+		if err := serviceAccountUsecase.Delete(c.Context(), id); err != nil {
+			return utils.NotFoundResponse(c, "Service account not found")
+		}
+
+		return utils.SuccessMessageResponse(c, "Service account deleted successfully")
+	})
+
+	// POST /api/v1/service-accounts/:id/keys - Add a key
+	accounts.Post("/:id/keys", func(c *fiber.Ctx) error {
+		id, err := utils.ParseUUID(c.Params("id"))
+		if err != nil {
+			return utils.BadRequestResponse(c, "Invalid service account ID")
+		}
+
+		adminID, err := utils.GetUserIDFromContext(c)
+		if err != nil {
+			return utils.UnauthorizedResponse(c, "Invalid user context")
+		}
+
+		var req entity.CreateAPIKeyRequest
+		if len(c.Body()) > 0 {
+			if err := c.BodyParser(&req); err != nil {
+				return utils.BadRequestResponse(c, "Invalid request body")
+			}
+		}
+
+		response, err := serviceAccountUsecase.CreateKey(c.Context(), id, &req, adminID, c.IP())
+		if errors.Is(err, sql.ErrNoRows) {
+			return utils.NotFoundResponse(c, "Service account not found")
+		}
+		if err != nil {
+			return utils.BadRequestResponse(c, err.Error())
+		}
+
+		return utils.SuccessWithMessageResponse(c, "API key created; store it now, it is not shown again", response)
+	})
+
+	// POST /api/v1/service-accounts/:id/keys/:keyId/rotate - Replace a key, optionally keeping the old one for grace_minutes
+	accounts.Post("/:id/keys/:keyId/rotate", func(c *fiber.Ctx) error {
+		id, err := utils.ParseUUID(c.Params("id"))
+		if err != nil {
+			return utils.BadRequestResponse(c, "Invalid service account ID")
+		}
+		keyID, err := utils.ParseUUID(c.Params("keyId"))
+		if err != nil {
+			return utils.BadRequestResponse(c, "Invalid API key ID")
+		}
+
+		adminID, err := utils.GetUserIDFromContext(c)
+		if err != nil {
+			return utils.UnauthorizedResponse(c, "Invalid user context")
+		}
+
+		var req entity.RotateAPIKeyRequest
+		if len(c.Body()) > 0 {
+			if err := c.BodyParser(&req); err != nil {
+				return utils.BadRequestResponse(c, "Invalid request body")
+			}
+		}
+
+		response, err := serviceAccountUsecase.RotateKey(c.Context(), id, keyID, &req, adminID, c.IP())
+		if errors.Is(err, sql.ErrNoRows) {
+			return utils.NotFoundResponse(c, "Service account not found")
+		}
+		if err != nil {
+			return utils.BadRequestResponse(c, err.Error())
+		}
+
+		return utils.SuccessWithMessageResponse(c, "API key rotated; store the new key now, it is not shown again", response)
+	})
+
+	// DELETE /api/v1/service-accounts/:id/keys/:keyId - Revoke a key
+	accounts.Delete("/:id/keys/:keyId", func(c *fiber.Ctx) error {
+		id, err := utils.ParseUUID(c.Params("id"))
+		if err != nil {
+			return utils.BadRequestResponse(c, "Invalid service account ID")
+		}
+		keyID, err := utils.ParseUUID(c.Params("keyId"))
+		if err != nil {
+			return utils.BadRequestResponse(c, "Invalid API key ID")
+		}
+
+		adminID, err := utils.GetUserIDFromContext(c)
+		if err != nil {
+			return utils.UnauthorizedResponse(c, "Invalid user context")
+		}
+
+		err = serviceAccountUsecase.RevokeKey(c.Context(), id, keyID, adminID, c.IP())
+		if errors.Is(err, sql.ErrNoRows) {
+			return utils.NotFoundResponse(c, "Service account not found")
+		}
+		if err != nil {
+			return utils.NotFoundResponse(c, err.Error())
+		}
+
+		return utils.SuccessMessageResponse(c, "API key revoked successfully")
+	})
+}
@@ -1,6 +1,8 @@
 package routes
 
 import (
+	"errors"
+
 	"github.com/Aryma-f4/uas-backend/app/entity"
 	"github.com/Aryma-f4/uas-backend/app/repository"
 	"github.com/Aryma-f4/uas-backend/app/usecase"
@@ -9,15 +11,20 @@ import (
 	"github.com/gofiber/fiber/v2"
 )
 
-func SetupStudentRoutes(router fiber.Router, studentUsecase *usecase.StudentUsecase, achievementUsecase *usecase.AchievementUsecase, userRepo *repository.UserRepository, authUsecase *usecase.AuthUsecase) {
+func SetupStudentRoutes(router fiber.Router, studentUsecase *usecase.StudentUsecase, achievementUsecase *usecase.AchievementUsecase, policy *usecase.AccessPolicy, userRepo *repository.UserRepository, authUsecase *usecase.AuthUsecase) {
 	students := router.Group("/students")
 	students.Use(middleware.AuthMiddleware(authUsecase))
 
-	// GET /api/v1/students - List all students
+	// GET /api/v1/students - List the students the caller may access
 	students.Get("/", middleware.RequireAnyPermission(userRepo, "student:read", "student:manage"), func(c *fiber.Ctx) error {
 		page, limit, offset := utils.ParsePagination(c)
 
-		studentList, total, err := studentUsecase.List(c.Context(), limit, offset)
+		studentIDs, err := policy.Scope(c.Context(), middleware.Subject(c))
+		if err != nil {
+			return utils.InternalServerErrorResponse(c, "Failed to check student access")
+		}
+
+		studentList, total, err := studentUsecase.List(c.Context(), studentIDs, limit, offset)
 		if err != nil {
 			return utils.InternalServerErrorResponse(c, "Failed to fetch students")
 		}
@@ -25,6 +32,43 @@ func SetupStudentRoutes(router fiber.Router, studentUsecase *usecase.StudentUsec
 		return utils.PaginatedSuccessResponse(c, studentList, page, limit, total)
 	})
 
+	// GET /api/v1/students/advisors/auto-assign/preview - Preview automatic advisor assignment (Admin only)
+	students.Get("/advisors/auto-assign/preview", middleware.RequireRole(userRepo, "Admin"), func(c *fiber.Ctx) error {
+		plan, err := studentUsecase.PlanAdvisorAssignment(c.Context(), c.QueryInt("max_load"))
+		if err != nil {
+			return utils.BadRequestResponse(c, err.Error())
+		}
+
+		return utils.SuccessResponse(c, plan)
+	})
+
+	// POST /api/v1/students/advisors/auto-assign - Apply a previewed advisor assignment (Admin only)
+	students.Post("/advisors/auto-assign", middleware.RequireRole(userRepo, "Admin"), func(c *fiber.Ctx) error {
+		userID, err := utils.GetUserIDFromContext(c)
+		if err != nil {
+			return utils.UnauthorizedResponse(c, "Invalid user context")
+		}
+
+		var req entity.ApplyAdvisorAssignmentRequest
+		if err := c.BodyParser(&req); err != nil {
+			return utils.BadRequestResponse(c, "Invalid request body")
+		}
+
+		plan, err := studentUsecase.ApplyAdvisorAssignment(c.Context(), userID, &req)
+		if errors.Is(err, usecase.ErrAdvisorPlanStale) {
+			return c.Status(fiber.StatusConflict).JSON(utils.Response{
+				Status:  "error",
+				Message: "Advisor assignment plan is out of date, review the current plan and apply it again",
+				Data:    plan,
+			})
+		}
+		if err != nil {
+			return utils.BadRequestResponse(c, err.Error())
+		}
+
+		return utils.SuccessWithMessageResponse(c, "Advisors assigned successfully", plan)
+	})
+
 	// GET /api/v1/students/:id - Get student by ID
 	students.Get("/:id", middleware.RequireAnyPermission(userRepo, "student:read", "student:manage"), func(c *fiber.Ctx) error {
 		id, err := utils.ParseUUID(c.Params("id"))
@@ -32,6 +76,10 @@ func SetupStudentRoutes(router fiber.Router, studentUsecase *usecase.StudentUsec
 			return utils.BadRequestResponse(c, "Invalid student ID")
 		}
 
+		if err := policy.AuthorizeStudent(c.Context(), middleware.Subject(c), id); err != nil {
+			return studentAccessError(c, err)
+		}
+
 		student, err := studentUsecase.GetByID(c.Context(), id)
 		if err != nil {
 			return utils.NotFoundResponse(c, "Student not found")
@@ -49,7 +97,10 @@ func SetupStudentRoutes(router fiber.Router, studentUsecase *usecase.StudentUsec
 
 		page, limit, offset := utils.ParsePagination(c)
 
-		achievementList, total, err := achievementUsecase.ListByStudentID(c.Context(), id, limit, offset)
+		achievementList, total, err := achievementUsecase.ListByStudentID(c.Context(), middleware.Subject(c), id, limit, offset)
+		if errors.Is(err, usecase.ErrStudentNotFound) {
+			return utils.NotFoundResponse(c, "Student not found")
+		}
 		if err != nil {
 			return utils.InternalServerErrorResponse(c, "Failed to fetch achievements")
 		}
@@ -58,7 +109,12 @@ func SetupStudentRoutes(router fiber.Router, studentUsecase *usecase.StudentUsec
 	})
 
 	// PUT /api/v1/students/:id/advisor - Update student's advisor (Admin only)
-	students.Put("/:id/advisor", middleware.RequirePermission(userRepo, "student:manage"), func(c *fiber.Ctx) error {
+	students.Put("/:id/advisor", middleware.DenyImpersonation(), middleware.RequirePermission(userRepo, "student:manage"), func(c *fiber.Ctx) error {
+		userID, err := utils.GetUserIDFromContext(c)
+		if err != nil {
+			return utils.UnauthorizedResponse(c, "Invalid user context")
+		}
+
 		id, err := utils.ParseUUID(c.Params("id"))
 		if err != nil {
 			return utils.BadRequestResponse(c, "Invalid student ID")
@@ -69,10 +125,59 @@ func SetupStudentRoutes(router fiber.Router, studentUsecase *usecase.StudentUsec
 			return utils.BadRequestResponse(c, "Invalid request body")
 		}
 
-		if err := studentUsecase.UpdateAdvisor(c.Context(), id, req.AdvisorID); err != nil {
+		result, err := studentUsecase.UpdateAdvisor(c.Context(), id, req.AdvisorID, userID, req.Note)
+		if err != nil {
 			return utils.InternalServerErrorResponse(c, err.Error())
 		}
 
-		return utils.SuccessMessageResponse(c, "Advisor updated successfully")
+		return utils.SuccessWithMessageResponse(c, "Advisor updated successfully", result)
 	})
+
+	// PUT /api/v1/students/:id/study-program - Link student to a study program
+	students.Put("/:id/study-program", middleware.DenyImpersonation(), middleware.RequirePermission(userRepo, "student:manage"), func(c *fiber.Ctx) error {
+		id, err := utils.ParseUUID(c.Params("id"))
+		if err != nil {
+			return utils.BadRequestResponse(c, "Invalid student ID")
+		}
+
+		var req entity.UpdateStudyProgramRequest
+		if err := c.BodyParser(&req); err != nil {
+			return utils.BadRequestResponse(c, "Invalid request body")
+		}
+
+		student, err := studentUsecase.UpdateStudyProgram(c.Context(), id, req.StudyProgramID)
+		if err != nil {
+			return utils.NotFoundResponse(c, err.Error())
+		}
+
+		return utils.SuccessWithMessageResponse(c, "Study program updated successfully", student)
+	})
+
+	// GET /api/v1/students/:id/advisor-history - Dated advisor assignments of a student
+	students.Get("/:id/advisor-history", middleware.RequireAnyPermission(userRepo, "student:read", "student:manage"), func(c *fiber.Ctx) error {
+		id, err := utils.ParseUUID(c.Params("id"))
+		if err != nil {
+			return utils.BadRequestResponse(c, "Invalid student ID")
+		}
+
+		if err := policy.AuthorizeStudent(c.Context(), middleware.Subject(c), id); err != nil {
+			return studentAccessError(c, err)
+		}
+
+		history, err := studentUsecase.GetAdvisorHistory(c.Context(), id)
+		if err != nil {
+			return utils.NotFoundResponse(c, "Student not found")
+		}
+
+		return utils.SuccessResponse(c, history)
+	})
+}
+
+// studentAccessError answers 404 for students the caller may not access, so
+// their existence is not revealed.
+func studentAccessError(c *fiber.Ctx, err error) error {
+	if errors.Is(err, usecase.ErrStudentNotFound) {
+		return utils.NotFoundResponse(c, "Student not found")
+	}
+	return utils.InternalServerErrorResponse(c, "Failed to check student access")
 }
@@ -1,6 +1,10 @@
 package routes
 
 import (
+	"bytes"
+	"errors"
+	"strconv"
+
 	"github.com/Aryma-f4/uas-backend/app/entity"
 	"github.com/Aryma-f4/uas-backend/app/repository"
 	"github.com/Aryma-f4/uas-backend/app/usecase"
@@ -9,12 +13,13 @@ import (
 	"github.com/gofiber/fiber/v2"
 )
 
-func SetupUserRoutes(router fiber.Router, userUsecase *usecase.UserUsecase, userRepo *repository.UserRepository, authUsecase *usecase.AuthUsecase) {
+func SetupUserRoutes(router fiber.Router, userUsecase *usecase.UserUsecase, rosterUsecase *usecase.RosterImportUsecase, userRepo *repository.UserRepository, authUsecase *usecase.AuthUsecase) {
 	users := router.Group("/users")
 	
 	// All user routes require authentication and Admin role
 	users.Use(middleware.AuthMiddleware(authUsecase))
 	users.Use(middleware.RequireRole(userRepo, "Admin"))
+	users.Use(middleware.DenyImpersonation())
 
 	// GET /api/v1/users
 	users.Get("/", func(c *fiber.Ctx) error {
@@ -38,6 +43,65 @@ func SetupUserRoutes(router fiber.Router, userUsecase *usecase.UserUsecase, user
 		return utils.SuccessResponse(c, roles)
 	})
 
+	// PUT /api/v1/users/roles/:id/mfa - Require MFA for every user of a role
+	users.Put("/roles/:id/mfa", func(c *fiber.Ctx) error {
+		id, err := utils.ParseUUID(c.Params("id"))
+		if err != nil {
+			return utils.BadRequestResponse(c, "Invalid role ID")
+		}
+
+		var req entity.UpdateRoleMFARequest
+		if err := c.BodyParser(&req); err != nil {
+			return utils.BadRequestResponse(c, "Invalid request body")
+		}
+
+		if err := userUsecase.SetRoleMFARequired(c.Context(), id, req.Required); err != nil {
+			return utils.NotFoundResponse(c, "Role not found")
+		}
+
+		return utils.SuccessMessageResponse(c, "Role MFA requirement updated successfully")
+	})
+
+	// POST /api/v1/users/import - Bulk student/lecturer roster import from CSV/XLSX
+	users.Post("/import", func(c *fiber.Ctx) error {
+		file, err := c.FormFile("file")
+		if err != nil {
+			return utils.BadRequestResponse(c, "File is required")
+		}
+
+		records, err := utils.ReadSpreadsheet(file)
+		if err != nil {
+			return utils.BadRequestResponse(c, err.Error())
+		}
+
+		credentials := c.FormValue("credentials", entity.RosterCredentialPassword)
+		result, err := rosterUsecase.Import(c.Context(), records, c.FormValue("type"), credentials)
+		if err != nil {
+			return utils.BadRequestResponse(c, err.Error())
+		}
+
+		if c.Query("format") != "csv" {
+			return utils.SuccessResponse(c, result)
+		}
+
+		// Downloadable report, including the generated credentials
+		var buf bytes.Buffer
+		writer, _ := utils.NewSpreadsheetWriter(&buf, "csv")
+		writer.WriteRow([]string{"row", "role", "username", "email", "status", "message", "initial_password", "invitation_token"})
+		for _, row := range result.Rows {
+			writer.WriteRow([]string{
+				strconv.Itoa(row.Row), row.Role, row.Username, row.Email, row.Status, row.Message, row.InitialPassword, row.InvitationToken,
+			})
+		}
+		if err := writer.Close(); err != nil {
+			return utils.InternalServerErrorResponse(c, "Failed to write import report")
+		}
+
+		c.Set(fiber.HeaderContentType, utils.SpreadsheetContentType("csv"))
+		c.Set(fiber.HeaderContentDisposition, `attachment; filename="roster-import-report.csv"`)
+		return c.Send(buf.Bytes())
+	})
+
 	// GET /api/v1/users/:id
 	users.Get("/:id", func(c *fiber.Ctx) error {
 		id, err := utils.ParseUUID(c.Params("id"))
@@ -108,8 +172,19 @@ func SetupUserRoutes(router fiber.Router, userUsecase *usecase.UserUsecase, user
 		if req.Email != "" && !utils.ValidateEmail(req.Email) {
 			return utils.ValidationErrorResponse(c, "Invalid email format")
 		}
+		if req.Password != "" {
+			if valid, msg := utils.ValidatePassword(req.Password); !valid {
+				return utils.ValidationErrorResponse(c, msg)
+			}
+		}
+		if req.AuthProvider != nil && *req.AuthProvider != "" && !authUsecase.HasAuthProvider(*req.AuthProvider) {
+			return utils.ValidationErrorResponse(c, "Unknown auth provider")
+		}
 
 		user, err := userUsecase.UpdateUser(c.Context(), id, &req)
+		if errors.Is(err, usecase.ErrPasswordManagedByDirectory) {
+			return utils.BadRequestResponse(c, "Password is managed by the directory, set auth_provider to local to give the user a local password")
+		}
 		if err != nil {
 			return utils.NotFoundResponse(c, "User not found")
 		}
@@ -131,6 +206,96 @@ func SetupUserRoutes(router fiber.Router, userUsecase *usecase.UserUsecase, user
 		return utils.SuccessMessageResponse(c, "User deleted successfully")
 	})
 
+	// GET /api/v1/users/:id/sessions - Active sessions of a user
+	users.Get("/:id/sessions", func(c *fiber.Ctx) error {
+		id, err := utils.ParseUUID(c.Params("id"))
+		if err != nil {
+			return utils.BadRequestResponse(c, "Invalid user ID")
+		}
+
+		sessions, err := authUsecase.ListSessions(c.Context(), id, utils.GetSessionIDFromContext(c))
+		if err != nil {
+			return utils.InternalServerErrorResponse(c, "Failed to fetch sessions")
+		}
+
+		return utils.SuccessResponse(c, sessions)
+	})
+
+	// DELETE /api/v1/users/:id/sessions - Revoke every session of a user
+	users.Delete("/:id/sessions", func(c *fiber.Ctx) error {
+		id, err := utils.ParseUUID(c.Params("id"))
+		if err != nil {
+			return utils.BadRequestResponse(c, "Invalid user ID")
+		}
+
+		revoked, err := authUsecase.RevokeAllSessions(c.Context(), id)
+		if err != nil {
+			return utils.NotFoundResponse(c, "User not found")
+		}
+
+		return utils.SuccessWithMessageResponse(c, "Sessions revoked successfully", fiber.Map{"revoked": revoked})
+	})
+
+	// POST /api/v1/users/:id/unlock - Clear failed logins and lockout of a user
+	users.Post("/:id/unlock", func(c *fiber.Ctx) error {
+		id, err := utils.ParseUUID(c.Params("id"))
+		if err != nil {
+			return utils.BadRequestResponse(c, "Invalid user ID")
+		}
+
+		adminID, err := utils.GetUserIDFromContext(c)
+		if err != nil {
+			return utils.UnauthorizedResponse(c, "Invalid user context")
+		}
+
+		if err := authUsecase.UnlockAccount(c.Context(), id, adminID, c.IP()); err != nil {
+			return utils.BadRequestResponse(c, err.Error())
+		}
+
+		return utils.SuccessMessageResponse(c, "Account unlocked successfully")
+	})
+
+	// POST /api/v1/users/:id/impersonate - Short-lived token acting as a user, for support
+	users.Post("/:id/impersonate", func(c *fiber.Ctx) error {
+		id, err := utils.ParseUUID(c.Params("id"))
+		if err != nil {
+			return utils.BadRequestResponse(c, "Invalid user ID")
+		}
+
+		adminID, err := utils.GetUserIDFromContext(c)
+		if err != nil {
+			return utils.UnauthorizedResponse(c, "Invalid user context")
+		}
+
+		var req entity.ImpersonateRequest
+		if err := c.BodyParser(&req); err != nil {
+			return utils.BadRequestResponse(c, "Invalid request body")
+		}
+
+		result, err := authUsecase.Impersonate(c.Context(), adminID, id, req.Reason, c.Get(fiber.HeaderUserAgent), c.IP())
+		if err != nil {
+			return utils.BadRequestResponse(c, err.Error())
+		}
+
+		return utils.SuccessWithMessageResponse(c, "Impersonation started", result)
+	})
+
+	// GET /api/v1/users/:id/security-events - Lockouts and unlocks of a user
+	users.Get("/:id/security-events", func(c *fiber.Ctx) error {
+		id, err := utils.ParseUUID(c.Params("id"))
+		if err != nil {
+			return utils.BadRequestResponse(c, "Invalid user ID")
+		}
+
+		page, limit, offset := utils.ParsePagination(c)
+		events, total, err := authUsecase.ListSecurityEvents(c.Context(), id, limit, offset)
+		if err != nil {
+			return utils.InternalServerErrorResponse(c, "Failed to fetch security events")
+		}
+
+		return utils.PaginatedSuccessResponse(c, events, page, limit, total)
+	})
+
 	// PUT /api/v1/users/:id/role
 	users.Put("/:id/role", func(c *fiber.Ctx) error {
 		id, err := utils.ParseUUID(c.Params("id"))
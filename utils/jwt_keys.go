@@ -0,0 +1,225 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// minRSAKeyBits is the smallest RSA modulus accepted for signing keys.
+const minRSAKeyBits = 2048
+
+// KeySet signs access tokens and holds the keys that verify them. With
+// asymmetric keys, tokens are signed RS256 or EdDSA by the active key and
+// carry its kid; every key in the set verifies, so a retired key keeps
+// validating its tokens until they expire. Without asymmetric keys the set
+// signs and verifies HS256 with a shared secret, the legacy mode.
+type KeySet struct {
+	signing    *verificationKey
+	keys       map[string]*verificationKey
+	hmacSecret []byte
+	acceptHMAC bool
+}
+
+type verificationKey struct {
+	kid     string
+	method  jwt.SigningMethod
+	private crypto.Signer
+	public  crypto.PublicKey
+}
+
+// JWK is a public key in JSON Web Key format.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	// RSA modulus and exponent
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// Ed25519 curve and public key
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// NewHMACKeySet returns a legacy key set that signs and verifies HS256.
+func NewHMACKeySet(secret string) *KeySet {
+	return &KeySet{hmacSecret: []byte(secret), acceptHMAC: true}
+}
+
+// LoadKeySet loads every *.pem file of dir, using the file name without
+// extension as kid. Private keys (PKCS#8, or PKCS#1 for RSA) can sign;
+// public keys (PKIX) only verify. signingKID selects the signing key and may
+// be empty when dir holds exactly one private key. acceptHMAC additionally
+// accepts HS256 tokens signed with hmacSecret, for migrating from the legacy
+// mode.
+func LoadKeySet(dir, signingKID, hmacSecret string, acceptHMAC bool) (*KeySet, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+
+	set := &KeySet{
+		keys:       make(map[string]*verificationKey),
+		hmacSecret: []byte(hmacSecret),
+		acceptHMAC: acceptHMAC,
+	}
+	var private []string
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		kid := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		key, err := parseVerificationKey(kid, data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		set.keys[kid] = key
+		if key.private != nil {
+			private = append(private, kid)
+		}
+	}
+
+	switch {
+	case signingKID != "":
+		set.signing = set.keys[signingKID]
+		if set.signing == nil || set.signing.private == nil {
+			return nil, fmt.Errorf("no private key with kid %q in %s", signingKID, dir)
+		}
+	case len(private) == 1:
+		set.signing = set.keys[private[0]]
+	case len(private) == 0:
+		return nil, fmt.Errorf("no private key in %s", dir)
+	default:
+		return nil, fmt.Errorf("%s has several private keys, set the signing kid", dir)
+	}
+	return set, nil
+}
+
+func parseVerificationKey(kid string, data []byte) (*verificationKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	var key interface{}
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		key, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	vk := &verificationKey{kid: kid}
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		vk.method, vk.private, vk.public = jwt.SigningMethodRS256, k, &k.PublicKey
+	case *rsa.PublicKey:
+		vk.method, vk.public = jwt.SigningMethodRS256, k
+	case ed25519.PrivateKey:
+		vk.method, vk.private, vk.public = jwt.SigningMethodEdDSA, k, k.Public()
+	case ed25519.PublicKey:
+		vk.method, vk.public = jwt.SigningMethodEdDSA, k
+	default:
+		return nil, fmt.Errorf("unsupported key type %T, use RSA or Ed25519", key)
+	}
+
+	if rsaKey, ok := vk.public.(*rsa.PublicKey); ok && rsaKey.N.BitLen() < minRSAKeyBits {
+		return nil, fmt.Errorf("RSA key must have at least %d bits", minRSAKeyBits)
+	}
+	return vk, nil
+}
+
+// Algorithm returns the JWT algorithm new tokens are signed with.
+func (k *KeySet) Algorithm() string {
+	if k.signing == nil {
+		return jwt.SigningMethodHS256.Alg()
+	}
+	return k.signing.method.Alg()
+}
+
+// Sign signs claims with the active key, setting its kid header.
+func (k *KeySet) Sign(claims jwt.Claims) (string, error) {
+	if k.signing == nil {
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(k.hmacSecret)
+	}
+	token := jwt.NewWithClaims(k.signing.method, claims)
+	token.Header["kid"] = k.signing.kid
+	return token.SignedString(k.signing.private)
+}
+
+// Keyfunc returns the key that verifies token, for jwt.Parse. The key is
+// chosen by kid and must match the token's algorithm, so a token cannot
+// switch to HS256 and be verified with a public key as the secret.
+func (k *KeySet) Keyfunc(token *jwt.Token) (interface{}, error) {
+	if _, ok := token.Method.(*jwt.SigningMethodHMAC); ok {
+		if !k.acceptHMAC || token.Method.Alg() != jwt.SigningMethodHS256.Alg() {
+			return nil, errors.New("HS256 tokens are not accepted")
+		}
+		return k.hmacSecret, nil
+	}
+
+	kid, _ := token.Header["kid"].(string)
+	key, ok := k.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("key %q does not sign %s", kid, token.Method.Alg())
+	}
+	return key.public, nil
+}
+
+// JWKS returns the public verification keys, sorted by kid. The legacy HS256
+// secret is never published.
+func (k *KeySet) JWKS() *JWKS {
+	kids := make([]string, 0, len(k.keys))
+	for kid := range k.keys {
+		kids = append(kids, kid)
+	}
+	sort.Strings(kids)
+
+	set := &JWKS{Keys: make([]JWK, 0, len(kids))}
+	for _, kid := range kids {
+		key := k.keys[kid]
+		jwk := JWK{Kid: kid, Use: "sig", Alg: key.method.Alg()}
+		switch pub := key.public.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set
+}
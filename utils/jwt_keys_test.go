@@ -0,0 +1,159 @@
+package utils
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func writePEM(t *testing.T, dir, name, blockType string, der []byte) {
+	t.Helper()
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	if err := os.WriteFile(filepath.Join(dir, name), data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writePrivateKey(t *testing.T, dir, name string, key interface{}) {
+	t.Helper()
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writePEM(t, dir, name, "PRIVATE KEY", der)
+}
+
+func testClaims() jwt.MapClaims {
+	return jwt.MapClaims{"user_id": "u1", "exp": time.Now().Add(time.Hour).Unix()}
+}
+
+func parseWith(keys *KeySet, token string) error {
+	_, err := jwt.Parse(token, keys.Keyfunc)
+	return err
+}
+
+func TestKeySetRotation(t *testing.T) {
+	dir := t.TempDir()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writePrivateKey(t, dir, "2025-01.pem", rsaKey)
+	writePrivateKey(t, dir, "2026-01.pem", edKey)
+
+	old, err := LoadKeySet(dir, "2025-01", "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if old.Algorithm() != "RS256" {
+		t.Errorf("algorithm = %s, want RS256", old.Algorithm())
+	}
+	oldToken, err := old.Sign(testClaims())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	current, err := LoadKeySet(dir, "2026-01", "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if current.Algorithm() != "EdDSA" {
+		t.Errorf("algorithm = %s, want EdDSA", current.Algorithm())
+	}
+	newToken, err := current.Sign(testClaims())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, _, err := jwt.NewParser().ParseUnverified(newToken, jwt.MapClaims{})
+	if err != nil || parsed.Header["kid"] != "2026-01" {
+		t.Errorf("kid header = %v, %v", parsed.Header["kid"], err)
+	}
+
+	// Tokens of the retired key stay valid while it is in the set
+	if err := parseWith(current, oldToken); err != nil {
+		t.Errorf("token of the previous key rejected: %v", err)
+	}
+	if err := parseWith(current, newToken); err != nil {
+		t.Errorf("token of the active key rejected: %v", err)
+	}
+
+	// Once only the public part of the old key is kept, it still verifies
+	os.Remove(filepath.Join(dir, "2025-01.pem"))
+	der, _ := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	writePEM(t, dir, "2025-01.pem", "PUBLIC KEY", der)
+	retired, err := LoadKeySet(dir, "", "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := parseWith(retired, oldToken); err != nil {
+		t.Errorf("token of the retired key rejected: %v", err)
+	}
+
+	jwks := retired.JWKS()
+	if len(jwks.Keys) != 2 || jwks.Keys[0].Kty != "RSA" || jwks.Keys[0].E != "AQAB" || jwks.Keys[1].Crv != "Ed25519" {
+		t.Errorf("unexpected JWKS %+v", jwks.Keys)
+	}
+}
+
+func TestKeySetRejectsHS256UnlessAccepted(t *testing.T) {
+	dir := t.TempDir()
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	writePrivateKey(t, dir, "k1.pem", edKey)
+
+	legacy, err := NewHMACKeySet("secret").Sign(testClaims())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	strict, err := LoadKeySet(dir, "", "secret", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := parseWith(strict, legacy); err == nil {
+		t.Error("HS256 token accepted without acceptHMAC")
+	}
+
+	migrating, err := LoadKeySet(dir, "", "secret", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := parseWith(migrating, legacy); err != nil {
+		t.Errorf("HS256 token rejected with acceptHMAC: %v", err)
+	}
+
+	// Unknown kids are rejected
+	other := t.TempDir()
+	_, otherKey, _ := ed25519.GenerateKey(rand.Reader)
+	writePrivateKey(t, other, "k2.pem", otherKey)
+	foreign, _ := LoadKeySet(other, "", "", false)
+	token, _ := foreign.Sign(testClaims())
+	if err := parseWith(strict, token); err == nil {
+		t.Error("token with unknown kid accepted")
+	}
+}
+
+func TestLoadKeySetErrors(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := LoadKeySet(dir, "", "", false); err == nil {
+		t.Error("empty directory accepted")
+	}
+
+	small, _ := rsa.GenerateKey(rand.Reader, 1024)
+	writePrivateKey(t, dir, "small.pem", small)
+	if _, err := LoadKeySet(dir, "", "", false); err == nil {
+		t.Error("1024-bit RSA key accepted")
+	}
+}
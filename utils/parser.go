@@ -2,6 +2,7 @@ package utils
 
 import (
 	"strconv"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
@@ -11,6 +12,11 @@ func ParseUUID(id string) (uuid.UUID, error) {
 	return uuid.Parse(id)
 }
 
+// ParseDate parses a YYYY-MM-DD query value.
+func ParseDate(value string) (time.Time, error) {
+	return time.Parse("2006-01-02", value)
+}
+
 func ParsePagination(c *fiber.Ctx) (page, limit, offset int) {
 	page, _ = strconv.Atoi(c.Query("page", "1"))
 	limit, _ = strconv.Atoi(c.Query("limit", "10"))
@@ -45,6 +51,34 @@ func GetRoleIDFromContext(c *fiber.Ctx) (uuid.UUID, error) {
 	return uuid.Parse(roleIDStr.(string))
 }
 
+// IsServiceAccount reports whether the request was authenticated by an API
+// key. Such requests have no user; their role name is
+// entity.RoleServiceAccount.
+func IsServiceAccount(c *fiber.Ctx) bool {
+	return c.Locals("service_account_id") != nil
+}
+
+// GetSessionIDFromContext returns uuid.Nil for tokens without a session.
+func GetSessionIDFromContext(c *fiber.Ctx) uuid.UUID {
+	sessionID, ok := c.Locals("session_id").(string)
+	if !ok {
+		return uuid.Nil
+	}
+	id, _ := uuid.Parse(sessionID)
+	return id
+}
+
+// GetImpersonatorIDFromContext returns the admin acting as the user of an
+// impersonation token, or uuid.Nil.
+func GetImpersonatorIDFromContext(c *fiber.Ctx) uuid.UUID {
+	impersonatorID, ok := c.Locals("impersonator_id").(string)
+	if !ok {
+		return uuid.Nil
+	}
+	id, _ := uuid.Parse(impersonatorID)
+	return id
+}
+
 func GetRoleNameFromContext(c *fiber.Ctx) string {
 	roleName := c.Locals("role_name")
 	if roleName == nil {
@@ -0,0 +1,174 @@
+package utils
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+	"mime/multipart"
+	"path/filepath"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// ReadSpreadsheet reads an uploaded CSV or XLSX file and returns all rows,
+// including the header row. For XLSX files only the first sheet is read.
+func ReadSpreadsheet(file *multipart.FileHeader) ([][]string, error) {
+	f, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	switch strings.ToLower(filepath.Ext(file.Filename)) {
+	case ".csv":
+		return readCSV(f)
+	case ".xlsx":
+		return readXLSX(f)
+	default:
+		return nil, errors.New("unsupported file format, use .csv or .xlsx")
+	}
+}
+
+func readCSV(r io.Reader) ([][]string, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	return reader.ReadAll()
+}
+
+func readXLSX(r io.Reader) ([][]string, error) {
+	book, err := excelize.OpenReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer book.Close()
+
+	sheets := book.GetSheetList()
+	if len(sheets) == 0 {
+		return nil, errors.New("workbook has no sheets")
+	}
+	return book.GetRows(sheets[0])
+}
+
+// HeaderIndex maps normalized header names (lowercase, trimmed, spaces
+// replaced by underscores) to their column index.
+func HeaderIndex(header []string) map[string]int {
+	index := make(map[string]int, len(header))
+	for i, name := range header {
+		index[NormalizeHeader(name)] = i
+	}
+	return index
+}
+
+func NormalizeHeader(name string) string {
+	name = strings.TrimPrefix(name, "\ufeff")
+	return strings.ReplaceAll(strings.ToLower(strings.TrimSpace(name)), " ", "_")
+}
+
+// CellValue returns the trimmed cell at the given column, or an empty string
+// when the row is shorter than the header.
+func CellValue(row []string, index map[string]int, column string) string {
+	i, ok := index[column]
+	if !ok || i >= len(row) {
+		return ""
+	}
+	return strings.TrimSpace(row[i])
+}
+
+// SpreadsheetWriter writes rows to a CSV or XLSX output stream. Close
+// finishes the file; Abort releases the writer without finishing it, so a
+// failed export is not mistaken for a complete one.
+type SpreadsheetWriter interface {
+	WriteRow(row []string) error
+	Close() error
+	Abort()
+}
+
+// NewSpreadsheetWriter returns a writer for the given format ("csv" or
+// "xlsx"). XLSX rows are spooled by excelize's stream writer, which moves
+// them to a temporary file once they exceed its in-memory buffer.
+func NewSpreadsheetWriter(w io.Writer, format string) (SpreadsheetWriter, error) {
+	switch format {
+	case "csv":
+		return &csvSpreadsheetWriter{writer: csv.NewWriter(w)}, nil
+	case "xlsx":
+		book := excelize.NewFile()
+		stream, err := book.NewStreamWriter(book.GetSheetList()[0])
+		if err != nil {
+			book.Close()
+			return nil, err
+		}
+		return &xlsxSpreadsheetWriter{out: w, book: book, stream: stream}, nil
+	default:
+		return nil, errors.New("unsupported format, use csv or xlsx")
+	}
+}
+
+// EscapeSpreadsheetRow prefixes cells starting with a formula trigger
+// ("=", "+", "-", "@", tab or carriage return) with a quote, so
+// user-supplied text is shown as text instead of being evaluated by
+// spreadsheet applications.
+func EscapeSpreadsheetRow(row []string) []string {
+	for i, cell := range row {
+		if cell != "" && strings.ContainsRune("=+-@\t\r", rune(cell[0])) {
+			row[i] = "'" + cell
+		}
+	}
+	return row
+}
+
+// SpreadsheetContentType returns the MIME type for an export format.
+func SpreadsheetContentType(format string) string {
+	if format == "xlsx" {
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	}
+	return "text/csv; charset=utf-8"
+}
+
+type csvSpreadsheetWriter struct {
+	writer *csv.Writer
+}
+
+func (w *csvSpreadsheetWriter) WriteRow(row []string) error {
+	return w.writer.Write(row)
+}
+
+func (w *csvSpreadsheetWriter) Close() error {
+	w.writer.Flush()
+	return w.writer.Error()
+}
+
+func (w *csvSpreadsheetWriter) Abort() {}
+
+type xlsxSpreadsheetWriter struct {
+	out    io.Writer
+	book   *excelize.File
+	stream *excelize.StreamWriter
+	rows   int
+}
+
+func (w *xlsxSpreadsheetWriter) WriteRow(row []string) error {
+	w.rows++
+	cell, err := excelize.CoordinatesToCellName(1, w.rows)
+	if err != nil {
+		return err
+	}
+	values := make([]interface{}, len(row))
+	for i, value := range row {
+		values[i] = value
+	}
+	return w.stream.SetRow(cell, values)
+}
+
+func (w *xlsxSpreadsheetWriter) Close() error {
+	defer w.book.Close()
+	if err := w.stream.Flush(); err != nil {
+		return err
+	}
+	return w.book.Write(w.out)
+}
+
+func (w *xlsxSpreadsheetWriter) Abort() {
+	w.book.Close()
+}
@@ -0,0 +1,14 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEscapeSpreadsheetRow(t *testing.T) {
+	row := []string{"=HYPERLINK(\"x\")", "+1", "-2", "@SUM(A1)", "\tcmd", "\rcmd", "plain", "", "10"}
+	want := []string{"'=HYPERLINK(\"x\")", "'+1", "'-2", "'@SUM(A1)", "'\tcmd", "'\rcmd", "plain", "", "10"}
+	if got := EscapeSpreadsheetRow(row); !reflect.DeepEqual(got, want) {
+		t.Errorf("EscapeSpreadsheetRow() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,94 @@
+package utils
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcKey is the SHA-1 test key of RFC 4226 and RFC 6238.
+var rfcKey = []byte("12345678901234567890")
+
+func TestHOTPRFC4226Vectors(t *testing.T) {
+	want := []string{
+		"755224", "287082", "359152", "969429", "338314",
+		"254676", "287922", "162583", "399871", "520489",
+	}
+	for counter, code := range want {
+		if got := HOTP(rfcKey, uint64(counter), 6); got != code {
+			t.Errorf("HOTP(counter %d) = %s, want %s", counter, got, code)
+		}
+	}
+}
+
+func TestTOTPRFC6238Vectors(t *testing.T) {
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	}
+	for _, tt := range tests {
+		step := TOTPStep(time.Unix(tt.unix, 0))
+		if got := HOTP(rfcKey, uint64(step), 8); got != tt.code {
+			t.Errorf("TOTP(%d) = %s, want %s", tt.unix, got, tt.code)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	secret := base32.StdEncoding.EncodeToString(rfcKey)
+	now := time.Unix(1111111111, 0)
+	code := HOTP(rfcKey, uint64(TOTPStep(now)), TOTPDigits)
+
+	step, ok := ValidateTOTP(secret, code, now, 1)
+	if !ok || step != TOTPStep(now) {
+		t.Fatalf("ValidateTOTP(current) = %d, %v", step, ok)
+	}
+
+	// One step of drift is accepted, two are not
+	if _, ok := ValidateTOTP(secret, code, now.Add(TOTPPeriod*time.Second), 1); !ok {
+		t.Error("code of the previous step rejected")
+	}
+	if _, ok := ValidateTOTP(secret, code, now.Add(2*TOTPPeriod*time.Second), 1); ok {
+		t.Error("code two steps old accepted")
+	}
+	wrong := code[:5] + string('0'+(code[5]-'0'+1)%10)
+	if _, ok := ValidateTOTP(secret, wrong, now, 1); ok {
+		t.Error("wrong code accepted")
+	}
+	if _, ok := ValidateTOTP("not base32!", code, now, 1); ok {
+		t.Error("invalid secret accepted")
+	}
+}
+
+func TestTOTPProvisioningURI(t *testing.T) {
+	uri := TOTPProvisioningURI("JBSWY3DPEHPK3PXP", "UAS Achievement", "admin@example.com")
+	if !strings.HasPrefix(uri, "otpauth://totp/UAS%20Achievement:admin@example.com?") {
+		t.Errorf("unexpected label in %s", uri)
+	}
+	for _, param := range []string{"secret=JBSWY3DPEHPK3PXP", "issuer=UAS+Achievement", "digits=6", "period=30"} {
+		if !strings.Contains(uri, param) {
+			t.Errorf("%s missing from %s", param, uri)
+		}
+	}
+}
+
+func TestRecoveryCode(t *testing.T) {
+	code, err := GenerateRecoveryCode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(code) != 11 || code[5] != '-' {
+		t.Errorf("unexpected format %q", code)
+	}
+	if got := NormalizeRecoveryCode(" " + strings.ToUpper(code) + " "); got != strings.Replace(code, "-", "", 1) {
+		t.Errorf("NormalizeRecoveryCode = %q", got)
+	}
+}